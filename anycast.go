@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"cmp"
+	"context"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// AnycastMapper repeatedly queries an anycast resolver to discover which
+// instances answer, to support anycast catchment studies.
+//
+// Each attempt sends a CHAOS TXT query for id.server (RFC 4892) including
+// the NSID option (RFC 5001), such that a single exchange reveals the
+// instance identifier using either mechanism.
+//
+// Construct using [NewAnycastMapper].
+type AnycastMapper struct {
+	// Transport is the [DNSMsgTransport] to use.
+	//
+	// Set by [NewAnycastMapper] to the user-provided value.
+	Transport DNSMsgTransport
+
+	// Count is the number of attempts.
+	//
+	// Set by [NewAnycastMapper] to the user-provided value.
+	Count int
+
+	// Interval OPTIONALLY configures waiting between attempts.
+	Interval time.Duration
+
+	// Timeout is the timeout of each attempt.
+	//
+	// Set by [NewAnycastMapper] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Clock is the [Clock] to use to wait between attempts.
+	//
+	// Set by [NewAnycastMapper] to [RealClock].
+	Clock Clock
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewAnycastMapper] to [GlobalRand].
+	Rand Rand
+}
+
+// AnycastAttempt is the outcome of a single [*AnycastMapper] attempt.
+type AnycastAttempt struct {
+	// NSID is the name server identifier returned using the NSID option or empty.
+	NSID string
+
+	// IDServer is the content of the id.server TXT record or empty.
+	IDServer string
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the attempt.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// Instance returns the instance identifier, preferring NSID over IDServer.
+//
+// The return value is empty if the server did not identify itself.
+func (a *AnycastAttempt) Instance() string {
+	if a.NSID != "" {
+		return a.NSID
+	}
+	return a.IDServer
+}
+
+// AnycastInstance aggregates the attempts answered by the same instance.
+type AnycastInstance struct {
+	// Name is the instance identifier or empty for unidentified instances.
+	Name string
+
+	// Count is the number of attempts answered by the instance.
+	Count int
+
+	// Latency contains the latency statistics of the attempts.
+	Latency LatencyStats
+}
+
+// AnycastMap is the result of running an [*AnycastMapper].
+type AnycastMap struct {
+	// Attempts contains the attempts in the order in which we ran them.
+	Attempts []*AnycastAttempt
+
+	// Instances contains the instances that answered, sorted by decreasing
+	// Count and then by Name. Failed attempts do not appear here.
+	Instances []*AnycastInstance
+}
+
+// NewAnycastMapper creates a new [*AnycastMapper].
+func NewAnycastMapper(txp DNSMsgTransport, count int) *AnycastMapper {
+	return &AnycastMapper{
+		Transport: txp,
+		Count:     count,
+		Timeout:   DefaultResolverTimeout,
+		Clock:     RealClock{},
+		Rand:      GlobalRand{},
+	}
+}
+
+// Run runs the attempts serially and returns the map.
+//
+// When the context is done, we stop starting new attempts.
+func (m *AnycastMapper) Run(ctx context.Context) *AnycastMap {
+	// 1. run the attempts
+	attempts := make([]*AnycastAttempt, 0, m.Count)
+	for idx := range m.Count {
+		if idx > 0 && m.Interval > 0 {
+			m.wait(ctx)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		attempts = append(attempts, m.attempt(ctx))
+	}
+
+	// 2. aggregate the successful attempts by instance
+	latencies := make(map[string][]time.Duration)
+	for _, attempt := range attempts {
+		if attempt.Err == nil {
+			name := attempt.Instance()
+			latencies[name] = append(latencies[name], attempt.Elapsed)
+		}
+	}
+	instances := make([]*AnycastInstance, 0, len(latencies))
+	for name, samples := range latencies {
+		instances = append(instances, &AnycastInstance{
+			Name:    name,
+			Count:   len(samples),
+			Latency: NewLatencyStats(samples),
+		})
+	}
+	slices.SortFunc(instances, func(a, b *AnycastInstance) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Name, b.Name))
+	})
+	return &AnycastMap{Attempts: attempts, Instances: instances}
+}
+
+// wait waits for the Interval to elapse or for the context to be done.
+func (m *AnycastMapper) wait(ctx context.Context) {
+	timer := m.Clock.NewTimer(m.Interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C():
+	}
+}
+
+// attempt runs a single attempt.
+func (m *AnycastMapper) attempt(ctx context.Context) *AnycastAttempt {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// 1. create the CHAOS query including the NSID option
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("id.server.", dns.TypeTXT)
+	queryMsg.Id = randID(m.Rand)
+	queryMsg.Question[0].Qclass = dns.ClassCHAOS
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+	opt := queryMsg.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+
+	// 2. perform the exchange
+	started := time.Now()
+	respMsg, err := m.Transport.ExchangeMsg(ctx, queryMsg)
+	attempt := &AnycastAttempt{
+		Err:     err,
+		Failure: ClassifyError(err),
+		Started: started,
+		Elapsed: time.Since(started),
+	}
+	if err != nil {
+		return attempt
+	}
+
+	// 3. extract the instance identifiers
+	if opt := respMsg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if nsid, ok := option.(*dns.EDNS0_NSID); ok {
+				if raw, err := hex.DecodeString(nsid.Nsid); err == nil {
+					attempt.NSID = string(raw)
+				}
+			}
+		}
+	}
+	for _, rr := range respMsg.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			attempt.IDServer = strings.Join(txt.Txt, "")
+		}
+	}
+	return attempt
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAnycastResponse answers the query identifying as the given instance
+// using NSID, id.server, or both, depending on which are not empty.
+func newAnycastResponse(queryMsg *dns.Msg, nsid, idServer string) *dns.Msg {
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	if idServer != "" {
+		respMsg.Answer = append(respMsg.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: "id.server.", Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{idServer},
+		})
+	}
+	opt := respMsg.SetEdns0(1232, false).IsEdns0()
+	if nsid != "" {
+		opt.Option = append(opt.Option, &dns.EDNS0_NSID{
+			Code: dns.EDNS0NSID,
+			Nsid: hex.EncodeToString([]byte(nsid)),
+		})
+	}
+	return respMsg
+}
+
+func TestAnycastMapperRun(t *testing.T) {
+	var count atomic.Int64
+	mapper := NewAnycastMapper(msgTransportStub{
+		exchangeMsg: func(_ context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+			// make sure the query is what we expect
+			require.Equal(t, "id.server.", queryMsg.Question[0].Name)
+			require.Equal(t, uint16(dns.ClassCHAOS), queryMsg.Question[0].Qclass)
+			opt := queryMsg.IsEdns0()
+			require.NotNil(t, opt)
+			require.Len(t, opt.Option, 1)
+			require.IsType(t, &dns.EDNS0_NSID{}, opt.Option[0])
+
+			switch count.Add(1) {
+			case 1, 2, 3:
+				return newAnycastResponse(queryMsg, "fra1", "ignored"), nil
+			case 4, 5:
+				return newAnycastResponse(queryMsg, "", "ams1"), nil
+			case 6:
+				return newAnycastResponse(queryMsg, "", ""), nil
+			default:
+				return nil, context.DeadlineExceeded
+			}
+		},
+	}, 7)
+	mapper.Interval = time.Microsecond
+
+	result := mapper.Run(context.Background())
+	require.Len(t, result.Attempts, 7)
+	assert.Equal(t, "fra1", result.Attempts[0].NSID)
+	assert.Equal(t, "ignored", result.Attempts[0].IDServer)
+	assert.Equal(t, "fra1", result.Attempts[0].Instance())
+	assert.Equal(t, "ams1", result.Attempts[3].Instance())
+	assert.Equal(t, FailureGenericTimeout, result.Attempts[6].Failure)
+
+	require.Len(t, result.Instances, 3)
+	for idx, expect := range []struct {
+		name  string
+		count int
+	}{{"fra1", 3}, {"ams1", 2}, {"", 1}} {
+		assert.Equal(t, expect.name, result.Instances[idx].Name)
+		assert.Equal(t, expect.count, result.Instances[idx].Count)
+		assert.Equal(t, expect.count, result.Instances[idx].Latency.Count)
+	}
+}
+
+func TestAnycastMapperContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mapper := NewAnycastMapper(msgTransportStub{
+		exchangeMsg: func(context.Context, *dns.Msg) (*dns.Msg, error) {
+			cancel()
+			return nil, errors.New("mocked error")
+		},
+	}, 10)
+	mapper.Interval = time.Hour
+
+	result := mapper.Run(ctx)
+	require.Len(t, result.Attempts, 1)
+	assert.Empty(t, result.Instances)
+}
+
+func TestAnycastMapperSimulatedClock(t *testing.T) {
+	var count atomic.Int64
+	mapper := NewAnycastMapper(msgTransportStub{
+		exchangeMsg: func(_ context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+			count.Add(1)
+			return newAnycastResponse(queryMsg, "fra1", ""), nil
+		},
+	}, 2)
+	assert.Equal(t, RealClock{}, mapper.Clock)
+	clock := NewSimulatedClock(time.Now())
+	mapper.Clock = clock
+	mapper.Interval = time.Hour
+
+	done := make(chan *AnycastMap, 1)
+	go func() { done <- mapper.Run(context.Background()) }()
+
+	// wait for the mapper to block on the timer after the first attempt
+	for clock.PendingTimers() <= 0 {
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, int64(1), count.Load())
+
+	// the second attempt runs only after the interval elapses
+	clock.Advance(time.Hour)
+	result := <-done
+	require.Len(t, result.Attempts, 2)
+	require.Equal(t, int64(2), count.Load())
+}
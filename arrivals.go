@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"slices"
+	"time"
+)
+
+// arrivalBucketBounds are the upper bounds of the [DatagramArrivals] histogram
+// buckets, which grow by a factor of ten to span typical injection gaps (close
+// to zero) as well as typical round trips to distant resolvers.
+var arrivalBucketBounds = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// DatagramArrivals summarizes the temporal pattern of the datagrams collected
+// in response to a query, since injected responses typically arrive in a
+// burst well before the legitimate response.
+//
+// Construct using [NewDatagramArrivals].
+type DatagramArrivals struct {
+	// Count is the number of datagrams.
+	Count int
+
+	// Offsets contains the arrival time of each datagram since the query, in order.
+	Offsets []time.Duration
+
+	// InterArrival contains the [LatencyStats] of the gaps between consecutive datagrams.
+	InterArrival LatencyStats
+
+	// Histogram contains the distribution of the gaps between consecutive datagrams.
+	Histogram []ArrivalBucket
+}
+
+// ArrivalBucket is a bucket of the [DatagramArrivals] histogram.
+type ArrivalBucket struct {
+	// UpperBound is the exclusive upper bound of the bucket. The last
+	// bucket is zero, meaning that the bucket is unbounded.
+	UpperBound time.Duration
+
+	// Count is the number of gaps within the bucket.
+	Count int
+}
+
+// NewDatagramArrivals computes the [*DatagramArrivals] of the given datagrams
+// relative to started, which is usually when we sent the query.
+//
+// We sort the datagrams by arrival time, to be robust to observers
+// reporting the datagrams out of order.
+func NewDatagramArrivals(started time.Time, datagrams []*DNSOverUDPDatagram) *DatagramArrivals {
+	// 1. compute the sorted arrival offsets
+	arrivals := &DatagramArrivals{Count: len(datagrams), Offsets: []time.Duration{}}
+	for _, datagram := range datagrams {
+		arrivals.Offsets = append(arrivals.Offsets, datagram.Received.Sub(started))
+	}
+	slices.Sort(arrivals.Offsets)
+
+	// 2. compute the gaps between consecutive datagrams
+	gaps := []time.Duration{}
+	for idx := 1; idx < len(arrivals.Offsets); idx++ {
+		gaps = append(gaps, arrivals.Offsets[idx]-arrivals.Offsets[idx-1])
+	}
+	arrivals.InterArrival = NewLatencyStats(gaps)
+
+	// 3. fill the histogram buckets
+	for _, bound := range arrivalBucketBounds {
+		arrivals.Histogram = append(arrivals.Histogram, ArrivalBucket{UpperBound: bound})
+	}
+	arrivals.Histogram = append(arrivals.Histogram, ArrivalBucket{})
+	for _, gap := range gaps {
+		idx, _ := slices.BinarySearch(arrivalBucketBounds, gap+1)
+		arrivals.Histogram[idx].Count++
+	}
+	return arrivals
+}
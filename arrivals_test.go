@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDatagramArrivals(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// offsets contains the arrival offsets of the datagrams.
+		offsets []time.Duration
+
+		// wantOffsets contains the expected sorted offsets.
+		wantOffsets []time.Duration
+
+		// wantGaps contains the expected inter-arrival gaps stats.
+		wantGaps LatencyStats
+
+		// wantCounts contains the expected histogram counts.
+		wantCounts []int
+	}
+
+	tests := []testCase{
+		{
+			name:        "no datagrams",
+			offsets:     []time.Duration{},
+			wantOffsets: []time.Duration{},
+			wantCounts:  []int{0, 0, 0, 0, 0, 0},
+		},
+
+		{
+			name:        "single datagram",
+			offsets:     []time.Duration{20 * time.Millisecond},
+			wantOffsets: []time.Duration{20 * time.Millisecond},
+			wantCounts:  []int{0, 0, 0, 0, 0, 0},
+		},
+
+		{
+			name: "injection burst followed by legitimate response",
+			offsets: []time.Duration{
+				150 * time.Millisecond,
+				2 * time.Millisecond,
+				2*time.Millisecond + 50*time.Microsecond,
+				2*time.Millisecond + time.Millisecond,
+				1500 * time.Millisecond,
+			},
+			wantOffsets: []time.Duration{
+				2 * time.Millisecond,
+				2*time.Millisecond + 50*time.Microsecond,
+				2*time.Millisecond + time.Millisecond,
+				150 * time.Millisecond,
+				1500 * time.Millisecond,
+			},
+			wantGaps: LatencyStats{
+				Count:  4,
+				Min:    50 * time.Microsecond,
+				Median: 950 * time.Microsecond,
+				P95:    1350 * time.Millisecond,
+				P99:    1350 * time.Millisecond,
+				Max:    1350 * time.Millisecond,
+				Mean:   (1498 * time.Millisecond) / 4,
+				Stddev: NewLatencyStats([]time.Duration{
+					50 * time.Microsecond, 950 * time.Microsecond, 147 * time.Millisecond, 1350 * time.Millisecond,
+				}).Stddev,
+			},
+			wantCounts: []int{1, 1, 0, 0, 1, 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			started := time.Now()
+			var datagrams []*DNSOverUDPDatagram
+			for _, offset := range tc.offsets {
+				datagrams = append(datagrams, &DNSOverUDPDatagram{Received: started.Add(offset)})
+			}
+			arrivals := NewDatagramArrivals(started, datagrams)
+			assert.Equal(t, len(tc.offsets), arrivals.Count)
+			assert.Equal(t, tc.wantOffsets, arrivals.Offsets)
+			assert.Equal(t, tc.wantGaps, arrivals.InterArrival)
+			var counts []int
+			for _, bucket := range arrivals.Histogram {
+				counts = append(counts, bucket.Count)
+			}
+			assert.Equal(t, tc.wantCounts, counts)
+			assert.Equal(t, time.Second, arrivals.Histogram[len(arrivals.Histogram)-2].UpperBound)
+			assert.Zero(t, arrivals.Histogram[len(arrivals.Histogram)-1].UpperBound)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AtlasFirmwareVersion is the firmware version we declare in [*AtlasDNSResult],
+// which tells RIPE Atlas tooling which version of the schema to expect.
+const AtlasFirmwareVersion = 5080
+
+// AtlasDNSResult is a DNS measurement result using the RIPE Atlas schema.
+//
+// See https://atlas.ripe.net/docs/apis/result-format/.
+//
+// Construct using [NewAtlasDNSResult].
+type AtlasDNSResult struct {
+	// Fw is the firmware version.
+	//
+	// Set by [NewAtlasDNSResult] to [AtlasFirmwareVersion].
+	Fw int `json:"fw"`
+
+	// AF is the address family (4 or 6).
+	AF int `json:"af"`
+
+	// DstAddr is the server address.
+	DstAddr string `json:"dst_addr"`
+
+	// DstPort is the server port.
+	DstPort string `json:"dst_port"`
+
+	// From is the OPTIONAL public address of the probe.
+	From string `json:"from,omitempty"`
+
+	// MsmID is the OPTIONAL measurement ID.
+	MsmID int64 `json:"msm_id,omitempty"`
+
+	// PrbID is the OPTIONAL probe ID.
+	PrbID int64 `json:"prb_id,omitempty"`
+
+	// Proto is the protocol ("UDP" or "TCP").
+	Proto string `json:"proto"`
+
+	// Qbuf is the base64 encoded raw query or empty.
+	Qbuf string `json:"qbuf,omitempty"`
+
+	// Timestamp is the Unix time when we started the measurement.
+	Timestamp int64 `json:"timestamp"`
+
+	// Type is always "dns".
+	Type string `json:"type"`
+
+	// Result is the result in case of success or nil.
+	Result *AtlasDNSResultBody `json:"result,omitempty"`
+
+	// Error is the error in case of failure or nil. The key is "timeout",
+	// in which case the value is the timeout in milliseconds, or "socket",
+	// in which case the value is the error string.
+	Error map[string]any `json:"error,omitempty"`
+}
+
+// AtlasDNSResultBody is the result field of [*AtlasDNSResult].
+type AtlasDNSResultBody struct {
+	// ANCOUNT is the number of answer records.
+	ANCOUNT int `json:"ANCOUNT"`
+
+	// ARCOUNT is the number of additional records.
+	ARCOUNT int `json:"ARCOUNT"`
+
+	// ID is the response ID.
+	ID int `json:"ID"`
+
+	// NSCOUNT is the number of authority records.
+	NSCOUNT int `json:"NSCOUNT"`
+
+	// QDCOUNT is the number of questions.
+	QDCOUNT int `json:"QDCOUNT"`
+
+	// Abuf is the base64 encoded raw response.
+	Abuf string `json:"abuf"`
+
+	// Rt is the round trip time in milliseconds.
+	Rt float64 `json:"rt"`
+
+	// Size is the size of the raw response.
+	Size int `json:"size"`
+}
+
+// NewAtlasDNSResult converts a [*DNSMeasurement] to a [*AtlasDNSResult].
+//
+// We consider the measurement successful when we received a raw response
+// that we can parse, regardless of Err, since Atlas tooling expects the
+// result to contain responses with RCODE errors as well.
+func NewAtlasDNSResult(m *DNSMeasurement) *AtlasDNSResult {
+	// 1. fill the fields that do not depend on the outcome
+	result := &AtlasDNSResult{
+		Fw:        AtlasFirmwareVersion,
+		AF:        4,
+		DstAddr:   m.Endpoint.Addr().Unmap().String(),
+		DstPort:   strconv.Itoa(int(m.Endpoint.Port())),
+		Proto:     strings.ToUpper(m.Network),
+		Timestamp: m.Started.Unix(),
+		Type:      "dns",
+	}
+	if m.Endpoint.Addr().Unmap().Is6() {
+		result.AF = 6
+	}
+	if m.RawQuery != nil {
+		result.Qbuf = base64.StdEncoding.EncodeToString(m.RawQuery)
+	}
+
+	// 2. fill the result when we have a parseable response
+	respMsg := new(dns.Msg)
+	if m.RawResponse != nil && respMsg.Unpack(m.RawResponse) == nil {
+		result.Result = &AtlasDNSResultBody{
+			ANCOUNT: len(respMsg.Answer),
+			ARCOUNT: len(respMsg.Extra),
+			ID:      int(respMsg.Id),
+			NSCOUNT: len(respMsg.Ns),
+			QDCOUNT: len(respMsg.Question),
+			Abuf:    base64.StdEncoding.EncodeToString(m.RawResponse),
+			Rt:      float64(m.Elapsed.Microseconds()) / 1000,
+			Size:    len(m.RawResponse),
+		}
+		return result
+	}
+
+	// 3. otherwise, fill the error
+	switch {
+	case m.Failure == FailureGenericTimeout:
+		result.Error = map[string]any{"timeout": m.Elapsed.Milliseconds()}
+	case m.Err != nil:
+		result.Error = map[string]any{"socket": m.Err.Error()}
+	default:
+		result.Error = map[string]any{"socket": "no response"}
+	}
+	return result
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAtlasDNSResult(t *testing.T) {
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	rawQuery, err := queryMsg.Pack()
+	require.NoError(t, err)
+	rawResp := buildRawResponseFromQuery(t, rawQuery)
+	started := time.Unix(1700000000, 0)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// measurement is the measurement to convert.
+		measurement *DNSMeasurement
+
+		// check checks the result.
+		check func(t *testing.T, result *AtlasDNSResult)
+	}
+
+	tests := []testCase{
+		{
+			name: "successful IPv4 measurement",
+			measurement: &DNSMeasurement{
+				Network:     "udp",
+				Endpoint:    netip.MustParseAddrPort("8.8.8.8:53"),
+				RawQuery:    rawQuery,
+				RawResponse: rawResp,
+				Started:     started,
+				Elapsed:     12500 * time.Microsecond,
+			},
+			check: func(t *testing.T, result *AtlasDNSResult) {
+				assert.Equal(t, 4, result.AF)
+				assert.Equal(t, "8.8.8.8", result.DstAddr)
+				assert.Equal(t, "53", result.DstPort)
+				assert.Equal(t, "UDP", result.Proto)
+				assert.Equal(t, int64(1700000000), result.Timestamp)
+				assert.Equal(t, base64.StdEncoding.EncodeToString(rawQuery), result.Qbuf)
+				assert.Nil(t, result.Error)
+				require.NotNil(t, result.Result)
+				assert.Equal(t, &AtlasDNSResultBody{
+					ANCOUNT: 1,
+					QDCOUNT: 1,
+					ID:      int(queryMsg.Id),
+					Abuf:    base64.StdEncoding.EncodeToString(rawResp),
+					Rt:      12.5,
+					Size:    len(rawResp),
+				}, result.Result)
+			},
+		},
+
+		{
+			name: "timeout with IPv6",
+			measurement: &DNSMeasurement{
+				Network:  "udp",
+				Endpoint: netip.MustParseAddrPort("[2001:4860:4860::8888]:53"),
+				RawQuery: rawQuery,
+				Err:      context.DeadlineExceeded,
+				Failure:  FailureGenericTimeout,
+				Started:  started,
+				Elapsed:  5 * time.Second,
+			},
+			check: func(t *testing.T, result *AtlasDNSResult) {
+				assert.Equal(t, 6, result.AF)
+				assert.Equal(t, "2001:4860:4860::8888", result.DstAddr)
+				assert.Nil(t, result.Result)
+				assert.Equal(t, map[string]any{"timeout": int64(5000)}, result.Error)
+			},
+		},
+
+		{
+			name: "socket error",
+			measurement: &DNSMeasurement{
+				Network:  "udp",
+				Endpoint: netip.MustParseAddrPort("8.8.8.8:53"),
+				Err:      errors.New("connection refused"),
+				Failure:  FailureConnectionRefused,
+				Started:  started,
+			},
+			check: func(t *testing.T, result *AtlasDNSResult) {
+				assert.Empty(t, result.Qbuf)
+				assert.Nil(t, result.Result)
+				assert.Equal(t, map[string]any{"socket": "connection refused"}, result.Error)
+			},
+		},
+
+		{
+			name: "unparseable response",
+			measurement: &DNSMeasurement{
+				Network:     "udp",
+				Endpoint:    netip.MustParseAddrPort("8.8.8.8:53"),
+				RawResponse: []byte{0x00},
+				Started:     started,
+			},
+			check: func(t *testing.T, result *AtlasDNSResult) {
+				assert.Nil(t, result.Result)
+				assert.Equal(t, map[string]any{"socket": "no response"}, result.Error)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := NewAtlasDNSResult(tc.measurement)
+			assert.Equal(t, AtlasFirmwareVersion, result.Fw)
+			assert.Equal(t, "dns", result.Type)
+			tc.check(t, result)
+		})
+	}
+}
+
+func TestAtlasDNSResultJSON(t *testing.T) {
+	result := NewAtlasDNSResult(&DNSMeasurement{
+		Network:  "udp",
+		Endpoint: netip.MustParseAddrPort("8.8.8.8:53"),
+		Err:      errors.New("mocked error"),
+		Started:  time.Unix(1700000000, 0),
+	})
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"fw": 5080,
+		"af": 4,
+		"dst_addr": "8.8.8.8",
+		"dst_port": "53",
+		"proto": "UDP",
+		"timestamp": 1700000000,
+		"type": "dns",
+		"error": {"socket": "mocked error"}
+	}`, string(data))
+
+	// the OPTIONAL IDs appear only when set
+	result.MsmID, result.PrbID = 1001, 6001
+	data, err = json.Marshal(result)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"msm_id":1001,"prb_id":6001`)
+}
@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// ErrBreakerOpen indicates that [*BreakerTransport] refused the exchange
+// because the wrapped transport is failing persistently.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker states returned by [*BreakerTransport.State].
+const (
+	// BreakerClosed means that we are using the wrapped transport.
+	BreakerClosed = "closed"
+
+	// BreakerOpen means that we are failing fast without using the wrapped transport.
+	BreakerOpen = "open"
+
+	// BreakerHalfOpen means that a single probe exchange is in progress.
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerTransport wraps a [DNSTransport] and temporarily removes it from
+// rotation after consecutive failures, so that a long-running [*Resolver]
+// stops paying full timeouts for dead upstreams.
+//
+// After Threshold consecutive failures the breaker opens and we fail
+// with [ErrBreakerOpen] without contacting the upstream. Once Cooldown
+// has elapsed, we allow a single probe exchange: its success closes the
+// breaker and its failure opens it again for another Cooldown. We do not
+// count the failures occurring after the context is done, since they are
+// most likely caused by the caller canceling the exchange.
+//
+// A [*BreakerTransport] is safe for concurrent use.
+//
+// Construct using [NewBreakerTransport].
+type BreakerTransport struct {
+	// Transport is the wrapped [DNSTransport].
+	//
+	// Set by [NewBreakerTransport] to the user-provided value.
+	Transport DNSTransport
+
+	// Threshold is the number of consecutive failures opening the breaker.
+	//
+	// Set by [NewBreakerTransport] to 5.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before probing.
+	//
+	// Set by [NewBreakerTransport] to 30 seconds.
+	Cooldown time.Duration
+
+	// ObserveState is an OPTIONAL hook called when the state changes.
+	ObserveState func(state string)
+
+	// Clock is the [Clock] to use for the cooldown.
+	//
+	// Set by [NewBreakerTransport] to [RealClock].
+	Clock Clock
+
+	// failures is the number of consecutive failures.
+	failures int
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// openedAt is when the breaker last opened.
+	openedAt time.Time
+
+	// state is the current state.
+	state string
+}
+
+// NewBreakerTransport creates a new [*BreakerTransport].
+func NewBreakerTransport(txp DNSTransport) *BreakerTransport {
+	return &BreakerTransport{
+		Transport: txp,
+		Threshold: 5,
+		Cooldown:  30 * time.Second,
+		Clock:     RealClock{},
+		state:     BreakerClosed,
+	}
+}
+
+// Ensure that [*BreakerTransport] implements [DNSExtendedTransport] and [io.Closer].
+var (
+	_ DNSExtendedTransport = &BreakerTransport{}
+	_ io.Closer            = &BreakerTransport{}
+)
+
+// Close closes the wrapped Transport if it implements [io.Closer].
+func (bt *BreakerTransport) Close() error {
+	return transportClose(bt.Transport)
+}
+
+// Exchange implements [DNSTransport].
+func (bt *BreakerTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return bt.exchange(ctx, func() (*dnscodec.Response, error) {
+		return bt.Transport.Exchange(ctx, query)
+	})
+}
+
+// ExchangeExtended implements [DNSExtendedTransport].
+//
+// We forward to the wrapped Transport ExchangeExtended method, if available,
+// and we return a [*DNSMeasurement] without network details when the breaker
+// is open or the wrapped Transport does not implement [DNSExtendedTransport].
+func (bt *BreakerTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	var m *DNSMeasurement
+	resp, err := bt.exchange(ctx, func() (*dnscodec.Response, error) {
+		var resp *dnscodec.Response
+		resp, m = exchangeExtended(ctx, bt.Transport, query)
+		return resp, m.Err
+	})
+	if m == nil {
+		m = newDNSMeasurement("", netip.AddrPort{}, query)
+		m.complete(resp, err)
+	}
+	return resp, m
+}
+
+// exchange implements Exchange and ExchangeExtended using the given
+// function to perform the exchange with the wrapped Transport.
+func (bt *BreakerTransport) exchange(ctx context.Context,
+	fx func() (*dnscodec.Response, error)) (*dnscodec.Response, error) {
+	// 1. check whether we can use the wrapped transport
+	allowed, state := bt.acquire()
+	bt.observeState(state)
+	if !allowed {
+		return nil, ErrBreakerOpen
+	}
+
+	// 2. perform the exchange
+	resp, err := fx()
+
+	// 3. update the state depending on the outcome, without blaming the upstream
+	// for errors occurring after the context is done, since the caller may have
+	// canceled the exchange (e.g., when another exchange has already succeeded)
+	if err != nil && ctx.Err() != nil {
+		bt.observeState(bt.abandon())
+		return resp, err
+	}
+	bt.observeState(bt.release(breakerIsFailure(err)))
+	return resp, err
+}
+
+// State returns the current state.
+func (bt *BreakerTransport) State() string {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return bt.state
+}
+
+// acquire returns whether the caller is allowed to perform an exchange
+// along with the value returned by setState.
+func (bt *BreakerTransport) acquire() (bool, string) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	switch {
+	case bt.state == BreakerClosed:
+		return true, ""
+	case bt.state == BreakerOpen && bt.Clock.Now().Sub(bt.openedAt) >= bt.Cooldown:
+		return true, bt.setState(BreakerHalfOpen)
+	default:
+		return false, ""
+	}
+}
+
+// release updates the state after an exchange and returns the value returned by setState.
+func (bt *BreakerTransport) release(failed bool) string {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if !failed {
+		bt.failures = 0
+		return bt.setState(BreakerClosed)
+	}
+	bt.failures++
+	if bt.state == BreakerHalfOpen || bt.failures >= bt.Threshold {
+		bt.openedAt = bt.Clock.Now()
+		return bt.setState(BreakerOpen)
+	}
+	return ""
+}
+
+// abandon updates the state after an exchange whose outcome does not tell us
+// anything about the upstream and returns the value returned by setState.
+//
+// When the exchange was the probe, we reopen the breaker without resetting
+// the cooldown, so that the next exchange becomes the probe.
+func (bt *BreakerTransport) abandon() string {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.state == BreakerHalfOpen {
+		return bt.setState(BreakerOpen)
+	}
+	return ""
+}
+
+// setState sets the state and returns the new state when it changed or an empty
+// string otherwise. The caller must hold the mutex and must pass the return
+// value to observeState after releasing the mutex.
+func (bt *BreakerTransport) setState(state string) string {
+	if bt.state == state {
+		return ""
+	}
+	bt.state = state
+	return state
+}
+
+// observeState invokes the ObserveState hook, if any, unless the state is empty.
+//
+// We invoke the hook without holding the mutex, such that the
+// hook can safely call back into the [*BreakerTransport].
+func (bt *BreakerTransport) observeState(state string) {
+	if state != "" && bt.ObserveState != nil {
+		bt.ObserveState(state)
+	}
+}
+
+// breakerIsFailure returns whether the error indicates a failing upstream, which
+// excludes the errors caused by receiving a valid NXDOMAIN or no data response.
+func breakerIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, dnscodec.ErrNoName) && !errors.Is(err, dnscodec.ErrNoData)
+}
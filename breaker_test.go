@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBreakerTransport(t *testing.T) {
+	bt := NewBreakerTransport(transportStub{})
+	assert.Equal(t, 5, bt.Threshold)
+	assert.Equal(t, 30*time.Second, bt.Cooldown)
+	assert.Equal(t, RealClock{}, bt.Clock)
+	assert.Equal(t, BreakerClosed, bt.State())
+}
+
+func TestBreakerTransport(t *testing.T) {
+	// create a transport whose outcome we can control
+	var (
+		calls   int
+		failErr error
+	)
+	txp := transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		calls++
+		return nil, failErr
+	}}
+	clock := NewSimulatedClock(time.Now())
+	bt := NewBreakerTransport(txp)
+	bt.Threshold = 2
+	bt.Clock = clock
+	var states []string
+	bt.ObserveState = func(state string) { states = append(states, state) }
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+
+	// NXDOMAIN and no data responses do not count as failures
+	for _, err := range []error{dnscodec.ErrNoName, dnscodec.ErrNoData, dnscodec.ErrNoName} {
+		failErr = err
+		_, gotErr := bt.Exchange(context.Background(), query)
+		require.ErrorIs(t, gotErr, err)
+	}
+	assert.Equal(t, BreakerClosed, bt.State())
+
+	// consecutive failures open the breaker
+	failErr = errors.New("mocked error")
+	for range 2 {
+		_, err := bt.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, failErr)
+	}
+	assert.Equal(t, BreakerOpen, bt.State())
+
+	// while open we fail fast without using the transport
+	calls = 0
+	_, err := bt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Equal(t, 0, calls)
+	clock.Advance(bt.Cooldown - time.Second)
+	_, err = bt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, ErrBreakerOpen)
+	clock.Advance(time.Second)
+
+	// after the cooldown a failing probe opens the breaker again
+	_, err = bt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, failErr)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, BreakerOpen, bt.State())
+	_, err = bt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, ErrBreakerOpen)
+
+	// after the cooldown a successful probe closes the breaker
+	clock.Advance(bt.Cooldown)
+	failErr = nil
+	_, err = bt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, BreakerClosed, bt.State())
+
+	assert.Equal(t, []string{
+		BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed,
+	}, states)
+}
+
+func TestBreakerTransportHalfOpenSingleProbe(t *testing.T) {
+	// create a transport blocking until we unblock it
+	unblock := make(chan struct{})
+	entered := make(chan struct{})
+	txp := transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		close(entered)
+		<-unblock
+		return &dnscodec.Response{}, nil
+	}}
+	bt := NewBreakerTransport(txp)
+	bt.state = BreakerOpen
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+
+	// start the probe and make sure concurrent exchanges fail fast
+	done := make(chan error, 1)
+	go func() {
+		_, err := bt.Exchange(context.Background(), query)
+		done <- err
+	}()
+	<-entered
+	assert.Equal(t, BreakerHalfOpen, bt.State())
+	_, err := bt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, ErrBreakerOpen)
+
+	// complete the probe
+	close(unblock)
+	require.NoError(t, <-done)
+	assert.Equal(t, BreakerClosed, bt.State())
+}
+
+func TestBreakerTransportIgnoresCanceledExchanges(t *testing.T) {
+	// create a transport failing because the context is done
+	txp := transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	clock := NewSimulatedClock(time.Now())
+	bt := NewBreakerTransport(txp)
+	bt.Threshold = 1
+	bt.Clock = clock
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// canceled exchanges do not open the breaker
+	for range 3 {
+		_, err := bt.Exchange(ctx, query)
+		require.ErrorIs(t, err, context.Canceled)
+	}
+	assert.Equal(t, BreakerClosed, bt.State())
+
+	// a canceled probe reopens the breaker without resetting the cooldown
+	bt.state = BreakerOpen
+	clock.Advance(bt.Cooldown)
+	_, err := bt.Exchange(ctx, query)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, BreakerOpen, bt.State())
+	_, err = bt.Exchange(ctx, query)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, BreakerOpen, bt.State())
+}
+
+func TestBreakerTransportObserveStateCallsBack(t *testing.T) {
+	bt := NewBreakerTransport(transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return nil, errors.New("mocked error")
+	}})
+	bt.Threshold = 1
+	var states []string
+	bt.ObserveState = func(string) { states = append(states, bt.State()) }
+	_, err := bt.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.Error(t, err)
+	assert.Equal(t, []string{BreakerOpen}, states)
+}
+
+func TestBreakerTransportWithResolver(t *testing.T) {
+	// the resolver skips the open breaker and uses the next transport
+	dead := NewBreakerTransport(transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return nil, errors.New("mocked error")
+	}})
+	dead.Threshold = 1
+	var healthyCalls int
+	healthy := transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		healthyCalls++
+		return nil, dnscodec.ErrNoName
+	}}
+	reso := NewResolver(dead, healthy)
+	for range 3 {
+		_, err := reso.LookupA(context.Background(), "example.com")
+		require.ErrorIs(t, err, dnscodec.ErrNoName)
+	}
+	assert.Equal(t, BreakerOpen, dead.State())
+	assert.Equal(t, 3, healthyCalls)
+}
+
+func TestBreakerTransportClose(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	bt := NewBreakerTransport(closerTransportStub{close: func() error {
+		return expectedErr
+	}})
+	require.ErrorIs(t, bt.Close(), expectedErr)
+	require.NoError(t, NewBreakerTransport(transportStub{}).Close())
+}
+
+func TestBreakerTransportExchangeExtended(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	bt := NewBreakerTransport(transportStub{exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+		return nil, expectedErr
+	}})
+	bt.Threshold = 1
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+
+	// the failure opens the breaker
+	resp, m := bt.ExchangeExtended(context.Background(), query)
+	require.Nil(t, resp)
+	require.ErrorIs(t, m.Err, expectedErr)
+	assert.Equal(t, BreakerOpen, bt.State())
+
+	// while open we return a measurement describing the refusal
+	resp, m = bt.ExchangeExtended(context.Background(), query)
+	require.Nil(t, resp)
+	require.ErrorIs(t, m.Err, ErrBreakerOpen)
+	assert.Same(t, query, m.Query)
+	assert.False(t, m.Started.IsZero())
+}
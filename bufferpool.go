@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import "sync"
+
+// BufferPool is a pool of byte buffers used to serialize queries and to
+// read responses, which reduces allocations under high query volume.
+//
+// A [*BufferPool] is safe for concurrent use and can be shared by several
+// transports. A nil [*BufferPool] is valid and allocates a new buffer
+// each time, which is the default behavior of transports.
+//
+// Construct using [NewBufferPool].
+type BufferPool struct {
+	// pool is the underlying pool of *[]byte.
+	pool sync.Pool
+}
+
+// NewBufferPool creates a new [*BufferPool].
+func NewBufferPool() *BufferPool {
+	return &BufferPool{}
+}
+
+// Get returns a buffer whose length is size.
+//
+// Return the buffer to the pool using [*BufferPool.Put] when done.
+func (bp *BufferPool) Get(size int) *[]byte {
+	if bp != nil {
+		if buff, ok := bp.pool.Get().(*[]byte); ok && cap(*buff) >= size {
+			*buff = (*buff)[:size]
+			return buff
+		}
+	}
+	buff := make([]byte, size)
+	return &buff
+}
+
+// Put returns a buffer obtained using [*BufferPool.Get] to the pool.
+//
+// The caller MUST NOT use the buffer after calling this method.
+func (bp *BufferPool) Put(buff *[]byte) {
+	if bp != nil {
+		bp.pool.Put(buff)
+	}
+}
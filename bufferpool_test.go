@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// pool is the pool to use.
+		pool *BufferPool
+	}
+
+	tests := []testCase{
+		{name: "nil pool", pool: nil},
+		{name: "non-nil pool", pool: NewBufferPool()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := tc.pool.Get(128)
+			assert.Len(t, *buff, 128)
+			tc.pool.Put(buff)
+
+			// a smaller size reslices the buffer, a larger one allocates
+			buff = tc.pool.Get(64)
+			assert.Len(t, *buff, 64)
+			tc.pool.Put(buff)
+			buff = tc.pool.Get(1024)
+			assert.Len(t, *buff, 1024)
+			tc.pool.Put(buff)
+		})
+	}
+}
+
+// newBenchmarkConn returns a [*netstub.FuncConn] answering queries with the given ID.
+func newBenchmarkConn(b *testing.B, id uint16) *netstub.FuncConn {
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	query.ID = id
+	queryMsg, rawQuery, err := dnsOverUDPPackQuery(query, dnscodec.QueryMaxResponseSizeUDP, false, nil)
+	require.NoError(b, err)
+	require.Equal(b, id, queryMsg.Id)
+	rawResp := buildRawResponseFromQuery(b, rawQuery)
+	return &netstub.FuncConn{
+		WriteFunc: func(b []byte) (int, error) {
+			return len(b), nil
+		},
+		ReadFunc: func(b []byte) (int, error) {
+			return copy(b, rawResp), nil
+		},
+	}
+}
+
+func BenchmarkDNSOverUDPTransportExchangeWithConn(b *testing.B) {
+	type testCase struct {
+		// name is the benchmark name.
+		name string
+
+		// pool is the pool to use.
+		pool *BufferPool
+	}
+
+	tests := []testCase{
+		{name: "WithoutBufferPool", pool: nil},
+		{name: "WithBufferPool", pool: NewBufferPool()},
+	}
+
+	for _, tc := range tests {
+		b.Run(tc.name, func(b *testing.B) {
+			conn := newBenchmarkConn(b, 1)
+			txp := NewDNSOverUDPTransport(&netstub.FuncDialer{}, netip.MustParseAddrPort("127.0.0.1:53"))
+			txp.BufferPool = tc.pool
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			query.ID = 1
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := txp.ExchangeWithConn(context.Background(), conn, query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// DefaultBulkConcurrency is the default concurrency used by [*BulkRunner].
+const DefaultBulkConcurrency = 16
+
+// BulkItem is a work item for [*BulkRunner].
+type BulkItem struct {
+	// Domain is the domain to query.
+	Domain string
+
+	// Type is the query type (e.g., dns.TypeA).
+	Type uint16
+}
+
+// BulkResult is the result of running a [BulkItem].
+type BulkResult struct {
+	// Item is the corresponding work item.
+	Item BulkItem
+
+	// Response is the response or nil.
+	Response *dnscodec.Response
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the exchange.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// BulkRunner performs many lookups concurrently using a [DNSTransport].
+//
+// Construct using [NewBulkRunner].
+type BulkRunner struct {
+	// Transport is the [DNSTransport] to use.
+	//
+	// Set by [NewBulkRunner] to the user-provided value.
+	Transport DNSTransport
+
+	// Concurrency is the maximum number of concurrent lookups.
+	//
+	// Set by [NewBulkRunner] to [DefaultBulkConcurrency].
+	Concurrency int
+
+	// Timeout is the timeout of each lookup.
+	//
+	// Set by [NewBulkRunner] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewBulkRunner] to [GlobalRand].
+	Rand Rand
+
+	// RateLimiter OPTIONALLY limits the rate of outgoing queries.
+	RateLimiter *RateLimiter
+}
+
+// NewBulkRunner creates a new [*BulkRunner].
+func NewBulkRunner(txp DNSTransport) *BulkRunner {
+	return &BulkRunner{
+		Transport:   txp,
+		Concurrency: DefaultBulkConcurrency,
+		Timeout:     DefaultResolverTimeout,
+		Rand:        GlobalRand{},
+	}
+}
+
+// Run runs the given work items in the background and streams the results
+// on the returned channel, which is closed once all the results have been
+// emitted. The results order does not match the items order.
+//
+// When the context is done, we stop consuming items. The caller MUST drain
+// the returned channel to avoid leaking goroutines.
+func (br *BulkRunner) Run(ctx context.Context, items iter.Seq[BulkItem]) <-chan *BulkResult {
+	return bulkRun(ctx, br.Concurrency, items, br.run)
+}
+
+// bulkRun runs fx for each item using at most concurrency goroutines and streams
+// the results on the returned channel, which is closed when done. When the context
+// is done, we stop consuming items.
+func bulkRun[T, R any](ctx context.Context,
+	concurrency int, items iter.Seq[T], fx func(context.Context, T) R) <-chan R {
+	concurrency = max(concurrency, 1)
+	output := make(chan R, concurrency)
+	go func() {
+		defer close(output)
+		sem := make(chan struct{}, concurrency)
+		wg := &sync.WaitGroup{}
+		for item := range items {
+			// 1. wait for a free slot unless the context is done
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			// 2. run the item in the background
+			wg.Go(func() {
+				defer func() { <-sem }()
+				output <- fx(ctx, item)
+			})
+		}
+		wg.Wait()
+	}()
+	return output
+}
+
+// run runs a single work item.
+func (br *BulkRunner) run(ctx context.Context, item BulkItem) *BulkResult {
+	started := time.Now()
+	resp, err := br.exchange(ctx, item)
+	return &BulkResult{
+		Item:     item,
+		Response: resp,
+		Err:      err,
+		Failure:  ClassifyError(err),
+		Started:  started,
+		Elapsed:  time.Since(started),
+	}
+}
+
+// exchange performs the exchange for a single work item.
+func (br *BulkRunner) exchange(ctx context.Context, item BulkItem) (*dnscodec.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, br.Timeout)
+	defer cancel()
+	if br.RateLimiter != nil {
+		if err := br.RateLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	query := dnscodec.NewQuery(item.Domain, item.Type)
+	query.ID = randID(br.Rand)
+	return br.Transport.Exchange(ctx, query)
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectBulkResults drains the channel returned by [*BulkRunner.Run].
+func collectBulkResults(output <-chan *BulkResult) map[string]*BulkResult {
+	results := map[string]*BulkResult{}
+	for result := range output {
+		results[result.Item.Domain] = result
+	}
+	return results
+}
+
+func TestBulkRunnerSuccess(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+
+	txp := NewDNSOverUDPTransport(&net.Dialer{}, netip.MustParseAddrPort(server.Address()))
+	runner := NewBulkRunner(txp)
+	items := slices.Values([]BulkItem{
+		{Domain: "example.com", Type: dns.TypeA},
+		{Domain: "nonexistent.example.com", Type: dns.TypeA},
+	})
+
+	results := collectBulkResults(runner.Run(context.Background(), items))
+	require.Len(t, results, 2)
+
+	success := results["example.com"]
+	require.NoError(t, success.Err)
+	assert.Empty(t, success.Failure)
+	addrs, err := success.Response.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	assert.False(t, success.Started.IsZero())
+	assert.Positive(t, success.Elapsed)
+
+	failure := results["nonexistent.example.com"]
+	require.ErrorIs(t, failure.Err, dnscodec.ErrNoName)
+	assert.Equal(t, FailureDNSNXDOMAIN, failure.Failure)
+	assert.Nil(t, failure.Response)
+}
+
+func TestBulkRunnerConcurrency(t *testing.T) {
+	var inflight, peak atomic.Int64
+	runner := NewBulkRunner(transportStub{
+		exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+			cur := inflight.Add(1)
+			defer inflight.Add(-1)
+			for {
+				old := peak.Load()
+				if cur <= old || peak.CompareAndSwap(old, cur) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return nil, dnscodec.ErrNoData
+		},
+	})
+	runner.Concurrency = 4
+
+	items := func(yield func(BulkItem) bool) {
+		for idx := range 64 {
+			if !yield(BulkItem{Domain: fmt.Sprintf("%d.example.com", idx), Type: dns.TypeA}) {
+				return
+			}
+		}
+	}
+
+	results := collectBulkResults(runner.Run(context.Background(), items))
+	require.Len(t, results, 64)
+	for _, result := range results {
+		assert.Equal(t, FailureDNSNoAnswer, result.Failure)
+	}
+	require.LessOrEqual(t, peak.Load(), int64(4))
+}
+
+func TestBulkRunnerContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var count atomic.Int64
+	runner := NewBulkRunner(transportStub{
+		exchange: func(ctx context.Context, _ *dnscodec.Query) (*dnscodec.Response, error) {
+			count.Add(1)
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	runner.Concurrency = 1
+
+	// an infinite sequence of items
+	var items iter.Seq[BulkItem] = func(yield func(BulkItem) bool) {
+		for yield(BulkItem{Domain: "example.com", Type: dns.TypeA}) {
+		}
+	}
+
+	results := collectBulkResults(runner.Run(ctx, items))
+	require.Len(t, results, 1)
+	assert.Equal(t, FailureInterrupted, results["example.com"].Failure)
+	assert.Equal(t, int64(1), count.Load())
+}
+
+func TestBulkRunnerRateLimiter(t *testing.T) {
+	runner := NewBulkRunner(transportStub{
+		exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+			return nil, dnscodec.ErrNoData
+		},
+	})
+	runner.RateLimiter = NewRateLimiter(1, 1)
+	runner.Timeout = 20 * time.Millisecond
+	items := slices.Values([]BulkItem{
+		{Domain: "a.example.com", Type: dns.TypeA},
+		{Domain: "b.example.com", Type: dns.TypeA},
+	})
+
+	results := collectBulkResults(runner.Run(context.Background(), items))
+	require.Len(t, results, 2)
+	var failures []string
+	for _, result := range results {
+		failures = append(failures, result.Failure)
+	}
+	slices.Sort(failures)
+	require.Equal(t, []string{FailureDNSNoAnswer, FailureGenericTimeout}, failures)
+}
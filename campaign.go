@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// CampaignResolver is a named [DNSTransport] used by [*Campaign].
+type CampaignResolver struct {
+	// Name identifies the resolver in the records (e.g., "udp://8.8.8.8:53").
+	Name string
+
+	// Transport is the [DNSTransport] to use.
+	Transport DNSTransport
+
+	// RateLimiter OPTIONALLY limits the rate of queries sent to this resolver.
+	RateLimiter *RateLimiter
+}
+
+// CampaignRecord is the record emitted by [*Campaign] for each cell, which
+// is flat to simplify exporting it as CSV or JSONL.
+type CampaignRecord struct {
+	// Domain is the domain we queried.
+	Domain string `json:"domain"`
+
+	// Resolver is the name of the resolver we used.
+	Resolver string `json:"resolver"`
+
+	// QueryType is the query type (e.g., "A").
+	QueryType string `json:"query_type"`
+
+	// Answers contains the data of the valid answer RRs.
+	Answers []string `json:"answers,omitempty"`
+
+	// Failure is the result of applying [ClassifyError] to the error.
+	Failure string `json:"failure,omitempty"`
+
+	// Started is when we started the exchange.
+	Started time.Time `json:"started"`
+
+	// Elapsed is the time elapsed since Started, which we serialize
+	// to JSON as a floating point number of seconds.
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// campaignRecordJSON is the JSON representation of [*CampaignRecord], where
+// the shallower Elapsed field takes precedence over the embedded one.
+type campaignRecordJSON struct {
+	*campaignRecordAlias
+
+	// Elapsed is the elapsed time in seconds.
+	Elapsed float64 `json:"elapsed"`
+}
+
+// campaignRecordAlias is a [CampaignRecord] without the JSON methods.
+type campaignRecordAlias CampaignRecord
+
+// MarshalJSON implements [json.Marshaler].
+func (r *CampaignRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&campaignRecordJSON{
+		campaignRecordAlias: (*campaignRecordAlias)(r),
+		Elapsed:             r.Elapsed.Seconds(),
+	})
+}
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (r *CampaignRecord) UnmarshalJSON(data []byte) error {
+	value := &campaignRecordJSON{campaignRecordAlias: (*campaignRecordAlias)(r)}
+	if err := json.Unmarshal(data, value); err != nil {
+		return err
+	}
+	r.Elapsed = time.Duration(math.Round(value.Elapsed * float64(time.Second)))
+	return nil
+}
+
+// CampaignCSVHeader is the CSV header matching [*CampaignRecord.CSVRow].
+var CampaignCSVHeader = []string{
+	"domain", "resolver", "query_type", "answers", "failure", "started", "elapsed_ms",
+}
+
+// CSVRow returns the record as a CSV row matching [CampaignCSVHeader].
+//
+// We separate answers using spaces and format Started using RFC3339Nano.
+func (r *CampaignRecord) CSVRow() []string {
+	return []string{
+		r.Domain,
+		r.Resolver,
+		r.QueryType,
+		strings.Join(r.Answers, " "),
+		r.Failure,
+		r.Started.Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(r.Elapsed)/float64(time.Millisecond), 'f', 3, 64),
+	}
+}
+
+// Campaign crosses a list of domains with a list of resolvers and queries
+// each domain using each resolver, emitting a [*CampaignRecord] per cell.
+//
+// Construct using [NewCampaign].
+type Campaign struct {
+	// Domains contains the domains to query.
+	//
+	// Set by [NewCampaign] to the user-provided value.
+	Domains []string
+
+	// Resolvers contains the resolvers to use.
+	//
+	// Set by [NewCampaign] to the user-provided value.
+	Resolvers []CampaignResolver
+
+	// QueryTypes contains the query types to use for each domain.
+	//
+	// Set by [NewCampaign] to A and AAAA.
+	QueryTypes []uint16
+
+	// Concurrency is the maximum number of concurrent lookups.
+	//
+	// Set by [NewCampaign] to [DefaultBulkConcurrency].
+	Concurrency int
+
+	// Timeout is the timeout of each lookup.
+	//
+	// Set by [NewCampaign] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewCampaign] to [GlobalRand].
+	Rand Rand
+
+	// RateLimiter OPTIONALLY limits the overall rate of queries.
+	RateLimiter *RateLimiter
+}
+
+// NewCampaign creates a new [*Campaign].
+func NewCampaign(domains []string, resolvers ...CampaignResolver) *Campaign {
+	return &Campaign{
+		Domains:     domains,
+		Resolvers:   resolvers,
+		QueryTypes:  []uint16{dns.TypeA, dns.TypeAAAA},
+		Concurrency: DefaultBulkConcurrency,
+		Timeout:     DefaultResolverTimeout,
+		Rand:        GlobalRand{},
+	}
+}
+
+// campaignCell is a single cell of a [*Campaign].
+type campaignCell struct {
+	// domain is the domain to query.
+	domain string
+
+	// qtype is the query type.
+	qtype uint16
+
+	// resolver is the resolver to use.
+	resolver CampaignResolver
+}
+
+// Run runs the campaign in the background and streams the records on the
+// returned channel, which is closed once all the records have been emitted.
+// The records order does not match the cells order.
+//
+// When the context is done, we stop starting new lookups. The caller MUST
+// drain the returned channel to avoid leaking goroutines.
+func (c *Campaign) Run(ctx context.Context) <-chan *CampaignRecord {
+	return bulkRun(ctx, c.Concurrency, c.cells(), c.run)
+}
+
+// cells returns the cells of the campaign.
+//
+// We iterate over resolvers in the innermost loop, so that consecutive
+// lookups of the same domain are spread across resolvers.
+func (c *Campaign) cells() iter.Seq[campaignCell] {
+	return func(yield func(campaignCell) bool) {
+		for _, domain := range c.Domains {
+			for _, qtype := range c.QueryTypes {
+				for _, resolver := range c.Resolvers {
+					if !yield(campaignCell{domain: domain, qtype: qtype, resolver: resolver}) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// run runs a single cell.
+func (c *Campaign) run(ctx context.Context, cell campaignCell) *CampaignRecord {
+	started := time.Now()
+	resp, err := c.exchange(ctx, cell)
+	record := &CampaignRecord{
+		Domain:    cell.domain,
+		Resolver:  cell.resolver.Name,
+		QueryType: dns.TypeToString[cell.qtype],
+		Failure:   ClassifyError(err),
+		Started:   started,
+		Elapsed:   time.Since(started),
+	}
+	if resp != nil {
+		for _, rr := range resp.ValidRRs {
+			record.Answers = append(record.Answers, campaignRRData(rr))
+		}
+	}
+	return record
+}
+
+// exchange performs the exchange for a single cell.
+func (c *Campaign) exchange(ctx context.Context, cell campaignCell) (*dnscodec.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	for _, rl := range []*RateLimiter{c.RateLimiter, cell.resolver.RateLimiter} {
+		if rl != nil {
+			if err := rl.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	query := dnscodec.NewQuery(cell.domain, cell.qtype)
+	query.ID = randID(c.Rand)
+	return cell.resolver.Transport.Exchange(ctx, query)
+}
+
+// campaignRRData returns the data of a RR without the header.
+func campaignRRData(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
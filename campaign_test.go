@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaignRun(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	config.AddNetipAddr("example.com", netip.MustParseAddr("2606:2800:220:1:248:1893:25c8:1946"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+
+	good := CampaignResolver{
+		Name:      "udp://" + server.Address(),
+		Transport: NewDNSOverUDPTransport(&net.Dialer{}, netip.MustParseAddrPort(server.Address())),
+	}
+	bad := CampaignResolver{
+		Name: "broken",
+		Transport: transportStub{
+			exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+				return nil, dnscodec.ErrServerTemporarilyMisbehaving
+			},
+		},
+		RateLimiter: NewRateLimiter(1000, 10),
+	}
+	campaign := NewCampaign([]string{"example.com", "nonexistent.example.com"}, good, bad)
+	campaign.RateLimiter = NewRateLimiter(1000, 10)
+
+	// collect the records indexed by domain, query type, and resolver
+	records := map[string]*CampaignRecord{}
+	for record := range campaign.Run(context.Background()) {
+		records[record.Domain+" "+record.QueryType+" "+record.Resolver] = record
+	}
+	require.Len(t, records, 8)
+
+	type testCase struct {
+		// key is the key of the record to check.
+		key string
+
+		// wantAnswers is the expected answers.
+		wantAnswers []string
+
+		// wantFailure is the expected failure.
+		wantFailure string
+	}
+
+	tests := []testCase{
+		{
+			key:         "example.com A " + good.Name,
+			wantAnswers: []string{"93.184.216.34"},
+		},
+
+		{
+			key:         "example.com AAAA " + good.Name,
+			wantAnswers: []string{"2606:2800:220:1:248:1893:25c8:1946"},
+		},
+
+		{
+			key:         "nonexistent.example.com A " + good.Name,
+			wantFailure: FailureDNSNXDOMAIN,
+		},
+
+		{
+			key:         "example.com A broken",
+			wantFailure: FailureDNSServfail,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.key, func(t *testing.T) {
+			record := records[tc.key]
+			require.NotNil(t, record)
+			assert.Equal(t, tc.wantAnswers, record.Answers)
+			assert.Equal(t, tc.wantFailure, record.Failure)
+			assert.False(t, record.Started.IsZero())
+		})
+	}
+}
+
+func TestCampaignRecordExport(t *testing.T) {
+	record := &CampaignRecord{
+		Domain:    "example.com",
+		Resolver:  "udp://8.8.8.8:53",
+		QueryType: "A",
+		Answers:   []string{"93.184.216.34", "93.184.216.35"},
+		Started:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Elapsed:   1500 * time.Microsecond,
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		builder := &strings.Builder{}
+		writer := csv.NewWriter(builder)
+		require.NoError(t, writer.Write(CampaignCSVHeader))
+		require.NoError(t, writer.Write(record.CSVRow()))
+		writer.Flush()
+		expect := "domain,resolver,query_type,answers,failure,started,elapsed_ms\n" +
+			"example.com,udp://8.8.8.8:53,A,93.184.216.34 93.184.216.35,,2026-01-01T00:00:00Z,1.500\n"
+		assert.Equal(t, expect, builder.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		data, err := json.Marshal(record)
+		require.NoError(t, err)
+		expect := `{"domain":"example.com","resolver":"udp://8.8.8.8:53","query_type":"A",` +
+			`"answers":["93.184.216.34","93.184.216.35"],"started":"2026-01-01T00:00:00Z","elapsed":0.0015}`
+		assert.Equal(t, expect, string(data))
+
+		var decoded CampaignRecord
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, record, &decoded)
+	})
+}
+
+func TestCampaignRRData(t *testing.T) {
+	rr, err := dns.NewRR("example.com. 300 IN CNAME www.example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.com.", campaignRRData(rr))
+}
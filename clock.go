@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts the passing of time, which allows testing time-dependent
+// logic deterministically and driving replay analysis using simulated time.
+//
+// Caches, limiters, breakers, and schedulers use a [Clock]. Socket deadlines
+// and context timeouts always use the real clock, since the runtime and the
+// kernel enforce them.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a [ClockTimer] firing after the given duration.
+	NewTimer(d time.Duration) ClockTimer
+}
+
+// ClockTimer is a timer created by a [Clock].
+type ClockTimer interface {
+	// C returns the channel where we send the time when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing and returns whether it was pending.
+	Stop() bool
+}
+
+// RealClock is the [Clock] using the [time] package.
+type RealClock struct{}
+
+// Ensure that [RealClock] implements [Clock].
+var _ Clock = RealClock{}
+
+// Now implements [Clock].
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer implements [Clock].
+func (RealClock) NewTimer(d time.Duration) ClockTimer {
+	return realClockTimer{time.NewTimer(d)}
+}
+
+// realClockTimer is the [ClockTimer] returned by [RealClock].
+type realClockTimer struct {
+	// timer is the underlying timer.
+	timer *time.Timer
+}
+
+// C implements [ClockTimer].
+func (t realClockTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// Stop implements [ClockTimer].
+func (t realClockTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// SimulatedClock is a [Clock] whose time only changes when calling Advance.
+//
+// A [*SimulatedClock] is safe for concurrent use.
+//
+// Construct using [NewSimulatedClock].
+type SimulatedClock struct {
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// now is the current time.
+	now time.Time
+
+	// timers contains the pending timers.
+	timers []*simulatedTimer
+}
+
+// NewSimulatedClock creates a new [*SimulatedClock] starting at the given time.
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	return &SimulatedClock{now: start}
+}
+
+// Ensure that [*SimulatedClock] implements [Clock].
+var _ Clock = &SimulatedClock{}
+
+// Now implements [Clock].
+func (c *SimulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements [Clock].
+//
+// The timer fires immediately when the duration is not positive.
+func (c *SimulatedClock) NewTimer(d time.Duration) ClockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &simulatedTimer{clock: c, ch: make(chan time.Time, 1), when: c.now.Add(d)}
+	if d <= 0 {
+		timer.ch <- c.now
+		return timer
+	}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the time forward by the given duration and fires the
+// timers expiring at or before the new time.
+func (c *SimulatedClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.when.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// PendingTimers returns the number of timers that have not fired yet, which
+// allows waiting for a goroutine to block on a timer before calling Advance.
+func (c *SimulatedClock) PendingTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// simulatedTimer is the [ClockTimer] returned by [*SimulatedClock].
+type simulatedTimer struct {
+	// clock is the clock that created the timer.
+	clock *SimulatedClock
+
+	// ch is the channel where we send the time.
+	ch chan time.Time
+
+	// when is when the timer fires.
+	when time.Time
+}
+
+// C implements [ClockTimer].
+func (t *simulatedTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop implements [ClockTimer].
+func (t *simulatedTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for idx, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:idx], t.clock.timers[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealClock(t *testing.T) {
+	clock := RealClock{}
+	before := time.Now()
+	assert.False(t, clock.Now().Before(before))
+
+	timer := clock.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+
+	timer = clock.NewTimer(time.Hour)
+	assert.True(t, timer.Stop())
+}
+
+func TestSimulatedClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewSimulatedClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	// create timers expiring at different times
+	early := clock.NewTimer(time.Second)
+	late := clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Second)
+	require.Equal(t, 3, clock.PendingTimers())
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	require.Equal(t, 2, clock.PendingTimers())
+
+	// advancing fires only the expired timers
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), clock.Now())
+	assert.Equal(t, start.Add(time.Second), <-early.C())
+	assert.False(t, early.Stop())
+	require.Equal(t, 1, clock.PendingTimers())
+	select {
+	case <-late.C():
+		t.Fatal("the late timer should not have fired")
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, start.Add(time.Hour+time.Second), <-late.C())
+	assert.Equal(t, 0, clock.PendingTimers())
+	select {
+	case <-stopped.C():
+		t.Fatal("the stopped timer should not have fired")
+	default:
+	}
+
+	// timers with a non positive duration fire immediately
+	now := clock.NewTimer(0)
+	assert.Equal(t, clock.Now(), <-now.C())
+	assert.Equal(t, 0, clock.PendingTimers())
+}
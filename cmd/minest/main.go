@@ -0,0 +1,374 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Command minest is a dig-like DNS measurement tool.
+//
+// Usage:
+//
+//	minest [flags] domain [type]
+//
+// The tool sends a single DNS query and prints the response in a dig-like
+// text format (-format text), in JSON (-format json), using the RIPE Atlas
+// schema (-format atlas), or using the OONI format (-format ooni).
+//
+// The -transport flag is either a protocol (udp, tcp, or tls), which we
+// combine with -server, or a URL accepted by [minest.NewDNSTransportFromURL]
+// (e.g., tls://1.1.1.1?sni=one.one.one.one), which overrides -server.
+//
+// With -duplicates, the tool keeps reading until the timeout expires and
+// reports all the received datagrams, which is useful to detect injection.
+// This flag requires DNS over UDP. With -raw, the JSON output also includes
+// the base64 encoded raw messages.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/minest"
+	"github.com/miekg/dns"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// config contains the command line configuration.
+type config struct {
+	// duplicates enables collecting duplicate responses.
+	duplicates bool
+
+	// endpoint is the server endpoint, which we only set when using -duplicates.
+	endpoint netip.AddrPort
+
+	// format is the output format.
+	format string
+
+	// query is the query to send.
+	query *dnscodec.Query
+
+	// raw enables including the raw messages in the JSON output.
+	raw bool
+
+	// timeout is the exchange timeout.
+	timeout time.Duration
+
+	// transport is the transport to use unless using -duplicates.
+	transport minest.DNSExtendedTransport
+}
+
+// run runs the command and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	cfg, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "minest: %s\n", err.Error())
+		return 2
+	}
+
+	var (
+		m         *minest.DNSMeasurement
+		datagrams []*minest.DNSOverUDPDatagram
+	)
+	if cfg.duplicates {
+		m, datagrams = measureWithDuplicates(ctx, cfg)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+		_, m = cfg.transport.ExchangeExtended(ctx, cfg.query)
+	}
+
+	if err := writeOutput(stdout, cfg, m, datagrams); err != nil {
+		fmt.Fprintf(stderr, "minest: %s\n", err.Error())
+		return 1
+	}
+	if m.RawResponse == nil {
+		return 1
+	}
+	return 0
+}
+
+// parseArgs parses the command line arguments.
+func parseArgs(args []string, stderr io.Writer) (*config, error) {
+	fset := flag.NewFlagSet("minest", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: minest [flags] domain [type]\n")
+		fset.PrintDefaults()
+	}
+	var (
+		cfg      = &config{}
+		server   = fset.String("server", "8.8.8.8", "server `address` with optional port")
+		protocol = fset.String("transport", "udp", "transport `protocol` (udp, tcp, or tls) or URL")
+	)
+	fset.BoolVar(&cfg.duplicates, "duplicates", false, "collect all responses until the timeout expires")
+	fset.StringVar(&cfg.format, "format", "text", "output `format`: text, json, atlas, or ooni")
+	fset.BoolVar(&cfg.raw, "raw", false, "include the raw messages in the JSON output")
+	fset.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "exchange `timeout`")
+	if err := fset.Parse(args); err != nil {
+		return nil, err
+	}
+
+	switch cfg.format {
+	case "text", "json", "atlas", "ooni":
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", cfg.format)
+	}
+	if err := cfg.newTransport(*protocol, *server); err != nil {
+		return nil, err
+	}
+
+	qtype := dns.TypeA
+	switch fset.NArg() {
+	case 2:
+		value, found := dns.StringToType[strings.ToUpper(fset.Arg(1))]
+		if !found {
+			return nil, fmt.Errorf("unsupported query type: %s", fset.Arg(1))
+		}
+		qtype = value
+	case 1:
+	default:
+		fset.Usage()
+		return nil, errors.New("expected domain and optional type")
+	}
+	cfg.query = dnscodec.NewQuery(fset.Arg(0), qtype)
+	return cfg, nil
+}
+
+// newTransport creates the transport using the given protocol or URL and server
+// and, when using -duplicates, saves the endpoint of the DNS over UDP transport.
+func (cfg *config) newTransport(protocol, server string) error {
+	rawURL := protocol
+	if !strings.Contains(protocol, "://") {
+		rawURL = protocol + "://" + server
+	}
+	txp, err := minest.NewDNSTransportFromURL(&net.Dialer{}, rawURL)
+	if err != nil {
+		return err
+	}
+	if cfg.duplicates {
+		udp, ok := txp.(*minest.DNSOverUDPTransport)
+		if !ok {
+			return errors.New("-duplicates requires the udp transport")
+		}
+		cfg.endpoint = udp.Endpoint
+		return nil
+	}
+	extended, ok := txp.(minest.DNSExtendedTransport)
+	if !ok {
+		return fmt.Errorf("unsupported transport: %s", rawURL)
+	}
+	cfg.transport = extended
+	return nil
+}
+
+// measureWithDuplicates performs the exchange using an unconnected socket and
+// keeps reading until the timeout expires to collect all the datagrams.
+func measureWithDuplicates(
+	ctx context.Context, cfg *config) (*minest.DNSMeasurement, []*minest.DNSOverUDPDatagram) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+
+	// 1. create the transport observing the query and the datagrams and capturing
+	// the TTL when the output format includes it
+	var datagrams []*minest.DNSOverUDPDatagram
+	m := &minest.DNSMeasurement{Network: "udp", Endpoint: cfg.endpoint, Query: cfg.query}
+	txp := minest.NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, cfg.endpoint)
+	txp.CaptureTTL = cfg.format == "json" || cfg.raw
+	txp.ObserveRawQuery = func(rawQuery []byte) {
+		m.RawQuery = rawQuery
+	}
+	txp.ObserveDatagram = func(datagram *minest.DNSOverUDPDatagram) {
+		datagrams = append(datagrams, datagram)
+	}
+
+	// 2. perform the exchange
+	m.Started = time.Now()
+	m.Err = func() error {
+		pconn, err := txp.Listen(ctx)
+		if err != nil {
+			return err
+		}
+		defer pconn.Close()
+		queryMsg, err := txp.SendQuery(ctx, pconn, cfg.query)
+		if err != nil {
+			return err
+		}
+		m.Response, err = txp.RecvResponse(ctx, pconn, queryMsg)
+		m.Elapsed = time.Since(m.Started)
+
+		// 3. the last datagram is the response unless reading failed
+		var nerr net.Error
+		if !errors.As(err, &nerr) && len(datagrams) > 0 {
+			m.RawResponse = datagrams[len(datagrams)-1].RawResponse
+		}
+
+		// 4. keep reading until the timeout expires
+		for ctx.Err() == nil {
+			if _, err := txp.RecvResponse(ctx, pconn, queryMsg); errors.As(err, &nerr) {
+				break
+			}
+		}
+		return err
+	}()
+	if m.Elapsed <= 0 {
+		m.Elapsed = time.Since(m.Started)
+	}
+	m.Failure = minest.ClassifyError(m.Err)
+	return m, datagrams
+}
+
+// jsonOutput is the output using the json format.
+type jsonOutput struct {
+	Server      string          `json:"server"`
+	Domain      string          `json:"domain"`
+	QueryType   string          `json:"query_type"`
+	Answers     []string        `json:"answers"`
+	Failure     string          `json:"failure,omitempty"`
+	Started     time.Time       `json:"started"`
+	Elapsed     float64         `json:"elapsed"`
+	RawQuery    string          `json:"raw_query,omitempty"`
+	RawResponse string          `json:"raw_response,omitempty"`
+	Datagrams   []*jsonDatagram `json:"datagrams,omitempty"`
+	Arrivals    *jsonArrivals   `json:"arrivals,omitempty"`
+}
+
+// jsonDatagram is a datagram within [*jsonOutput].
+type jsonDatagram struct {
+	Source           string  `json:"source"`
+	T                float64 `json:"t"`
+	TTL              int     `json:"ttl,omitempty"`
+	UnexpectedSource bool    `json:"unexpected_source"`
+	RawResponse      string  `json:"raw_response,omitempty"`
+}
+
+// jsonArrivals is the summary of the datagrams arrivals within [*jsonOutput].
+type jsonArrivals struct {
+	GapMin    float64              `json:"gap_min"`
+	GapMedian float64              `json:"gap_median"`
+	GapMax    float64              `json:"gap_max"`
+	Histogram []*jsonArrivalBucket `json:"histogram"`
+}
+
+// jsonArrivalBucket is a histogram bucket within [*jsonArrivals].
+type jsonArrivalBucket struct {
+	UpperBound float64 `json:"upper_bound,omitempty"`
+	Count      int     `json:"count"`
+}
+
+// writeOutput writes the measurement using the configured format.
+func writeOutput(w io.Writer, cfg *config,
+	m *minest.DNSMeasurement, datagrams []*minest.DNSOverUDPDatagram) error {
+	var value any
+	switch cfg.format {
+	case "atlas":
+		value = minest.NewAtlasDNSResult(m)
+	case "ooni":
+		value = minest.NewOONIDNSQuery(m, m.Started)
+	case "json":
+		value = newJSONOutput(cfg, m, datagrams)
+	default:
+		return writeText(w, m, datagrams)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// newJSONOutput creates the output using the json format.
+func newJSONOutput(cfg *config, m *minest.DNSMeasurement, datagrams []*minest.DNSOverUDPDatagram) *jsonOutput {
+	out := &jsonOutput{
+		Server:    m.Endpoint.String(),
+		Domain:    m.Query.Name,
+		QueryType: dns.TypeToString[m.Query.Type],
+		Answers:   []string{},
+		Failure:   m.Failure,
+		Started:   m.Started,
+		Elapsed:   m.Elapsed.Seconds(),
+	}
+	if m.Response != nil {
+		for _, rr := range m.Response.Response.Answer {
+			out.Answers = append(out.Answers, rr.String())
+		}
+	}
+	if cfg.raw {
+		out.RawQuery = encodeRaw(m.RawQuery)
+		out.RawResponse = encodeRaw(m.RawResponse)
+	}
+	for _, datagram := range datagrams {
+		entry := &jsonDatagram{
+			Source:           datagram.Source.String(),
+			T:                datagram.Received.Sub(m.Started).Seconds(),
+			TTL:              datagram.TTL,
+			UnexpectedSource: datagram.UnexpectedSource,
+		}
+		if cfg.raw {
+			entry.RawResponse = encodeRaw(datagram.RawResponse)
+		}
+		out.Datagrams = append(out.Datagrams, entry)
+	}
+	if len(datagrams) > 1 {
+		arrivals := minest.NewDatagramArrivals(m.Started, datagrams)
+		out.Arrivals = &jsonArrivals{
+			GapMin:    arrivals.InterArrival.Min.Seconds(),
+			GapMedian: arrivals.InterArrival.Median.Seconds(),
+			GapMax:    arrivals.InterArrival.Max.Seconds(),
+		}
+		for _, bucket := range arrivals.Histogram {
+			out.Arrivals.Histogram = append(out.Arrivals.Histogram, &jsonArrivalBucket{
+				UpperBound: bucket.UpperBound.Seconds(),
+				Count:      bucket.Count,
+			})
+		}
+	}
+	return out
+}
+
+// encodeRaw encodes a raw message using base64 or returns an empty string.
+func encodeRaw(raw []byte) string {
+	if raw == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// writeText writes the measurement using a dig-like text format.
+func writeText(w io.Writer, m *minest.DNSMeasurement, datagrams []*minest.DNSOverUDPDatagram) error {
+	var builder strings.Builder
+	if m.RawResponse == nil {
+		fmt.Fprintf(&builder, ";; failure: %s\n", m.Failure)
+	}
+	for _, datagram := range datagrams {
+		fmt.Fprintf(&builder, ";; datagram from %s after %s (unexpected source: %v)\n",
+			datagram.Source, datagram.Received.Sub(m.Started), datagram.UnexpectedSource)
+	}
+	if len(datagrams) > 1 {
+		gaps := minest.NewDatagramArrivals(m.Started, datagrams).InterArrival
+		fmt.Fprintf(&builder, ";; inter-arrival gaps: min %s, median %s, max %s\n", gaps.Min, gaps.Median, gaps.Max)
+	}
+	if respMsg := new(dns.Msg); m.RawResponse != nil && respMsg.Unpack(m.RawResponse) == nil {
+		fmt.Fprintf(&builder, "%s\n", respMsg.String())
+	}
+	fmt.Fprintf(&builder, ";; Query time: %s\n", m.Elapsed)
+	fmt.Fprintf(&builder, ";; SERVER: %s (%s)\n", m.Endpoint, m.Network)
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer starts a DNS server answering twice to each query, to simulate
+// duplicates, and returns its endpoint, which serves both UDP and TCP.
+func newServer(t *testing.T) string {
+	t.Helper()
+
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", pconn.LocalAddr().String())
+	require.NoError(t, err)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		respMsg.Answer = append(respMsg.Answer, &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   queryMsg.Question[0].Name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    60,
+			},
+			A: net.IPv4(93, 184, 216, 34),
+		})
+		w.WriteMsg(respMsg)
+		w.WriteMsg(respMsg)
+	})
+	for _, server := range []*dns.Server{{PacketConn: pconn}, {Listener: listener}} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		server.Handler = handler
+		go server.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { server.Shutdown() })
+	}
+	return pconn.LocalAddr().String()
+}
+
+func TestRun(t *testing.T) {
+	endpoint := newServer(t)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// args contains the command line arguments.
+		args []string
+
+		// wantCode is the expected exit code.
+		wantCode int
+
+		// check checks the standard output.
+		check func(t *testing.T, stdout string)
+	}
+
+	tests := []testCase{
+		{
+			name:     "text output",
+			args:     []string{"-server", endpoint, "example.com"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				assert.Contains(t, stdout, "93.184.216.34")
+				assert.Contains(t, stdout, ";; SERVER: "+endpoint)
+			},
+		},
+
+		{
+			name:     "json output with raw messages",
+			args:     []string{"-server", endpoint, "-format", "json", "-raw", "example.com", "a"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				var out jsonOutput
+				require.NoError(t, json.Unmarshal([]byte(stdout), &out))
+				assert.Equal(t, "A", out.QueryType)
+				require.Len(t, out.Answers, 1)
+				assert.NotEmpty(t, out.RawQuery)
+				assert.NotEmpty(t, out.RawResponse)
+				assert.Empty(t, out.Datagrams)
+				assert.Nil(t, out.Arrivals)
+			},
+		},
+
+		{
+			name: "json output with duplicates",
+			args: []string{"-server", endpoint, "-format", "json", "-duplicates",
+				"-timeout", "250ms", "example.com"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				var out jsonOutput
+				require.NoError(t, json.Unmarshal([]byte(stdout), &out))
+				require.Len(t, out.Answers, 1)
+				assert.Empty(t, out.Failure)
+				assert.Empty(t, out.RawResponse)
+				require.Len(t, out.Datagrams, 2)
+				assert.False(t, out.Datagrams[0].UnexpectedSource)
+				if runtime.GOOS == "linux" {
+					assert.Positive(t, out.Datagrams[0].TTL)
+				}
+				require.NotNil(t, out.Arrivals)
+				require.Len(t, out.Arrivals.Histogram, 6)
+			},
+		},
+
+		{
+			name:     "atlas output",
+			args:     []string{"-server", endpoint, "-format", "atlas", "example.com"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				assert.Contains(t, stdout, `"abuf":`)
+			},
+		},
+
+		{
+			name:     "ooni output",
+			args:     []string{"-server", endpoint, "-format", "ooni", "example.com"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				assert.Contains(t, stdout, `"ipv4":"93.184.216.34"`)
+			},
+		},
+
+		{
+			name:     "tcp transport",
+			args:     []string{"-server", endpoint, "-transport", "tcp", "example.com"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				assert.Contains(t, stdout, "93.184.216.34")
+				assert.Contains(t, stdout, ";; SERVER: "+endpoint+" (tcp)")
+			},
+		},
+
+		{
+			name:     "transport URL",
+			args:     []string{"-transport", "udp://" + endpoint, "example.com"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout string) {
+				assert.Contains(t, stdout, ";; SERVER: "+endpoint+" (udp)")
+			},
+		},
+
+		{
+			name:     "unsupported transport",
+			args:     []string{"-transport", "doq", "example.com"},
+			wantCode: 2,
+		},
+
+		{
+			name:     "duplicates without udp",
+			args:     []string{"-transport", "tcp", "-duplicates", "example.com"},
+			wantCode: 2,
+		},
+
+		{
+			name:     "unsupported format",
+			args:     []string{"-format", "yaml", "example.com"},
+			wantCode: 2,
+		},
+
+		{
+			name:     "invalid server",
+			args:     []string{"-server", "dns.google", "example.com"},
+			wantCode: 2,
+		},
+
+		{
+			name:     "invalid query type",
+			args:     []string{"example.com", "NONEXISTENT"},
+			wantCode: 2,
+		},
+
+		{
+			name:     "missing domain",
+			args:     []string{},
+			wantCode: 2,
+		},
+
+		{
+			name:     "help",
+			args:     []string{"-help"},
+			wantCode: 0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(context.Background(), tc.args, &stdout, &stderr)
+			require.Equal(t, tc.wantCode, code, stderr.String())
+			if tc.check != nil {
+				tc.check(t, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pconn.Close()
+
+	for _, duplicates := range []string{"-duplicates=false", "-duplicates=true"} {
+		t.Run(duplicates, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			started := time.Now()
+			code := run(context.Background(), []string{"-server", pconn.LocalAddr().String(),
+				"-timeout", "100ms", duplicates, "example.com"}, &stdout, &stderr)
+			assert.Equal(t, 1, code)
+			assert.Less(t, time.Since(started), 5*time.Second)
+			assert.Contains(t, stdout.String(), ";; failure: ")
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrCNAMELoop indicates that the CNAME chain in a response contains a cycle.
+	ErrCNAMELoop = errors.New("CNAME loop")
+
+	// ErrCNAMEChainTooLong indicates that the CNAME chain in a response is too long.
+	ErrCNAMEChainTooLong = errors.New("CNAME chain too long")
+)
+
+// DefaultMaxCNAMEChainLength is the default maximum number of CNAME
+// records that [*CNAMEChainValidator] follows, which is the same limit
+// used by BIND when following CNAME chains.
+const DefaultMaxCNAMEChainLength = 16
+
+// CNAMEChainError is the error returned by [*CNAMEChainValidator].
+//
+// This error wraps either [ErrCNAMELoop] or [ErrCNAMEChainTooLong].
+type CNAMEChainError struct {
+	// Chain contains the canonical names we observed following the
+	// chain, starting from the query name. For a loop, the last name
+	// is the name closing the cycle.
+	Chain []string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *CNAMEChainError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err.Error(), strings.Join(e.Chain, " -> "))
+}
+
+// Unwrap returns the underlying error.
+func (e *CNAMEChainError) Unwrap() error {
+	return e.Err
+}
+
+// CNAMEChainValidator is a [ResponseValidator] that fails with a [*CNAMEChainError]
+// when the answers contain a CNAME cycle (e.g., a -> b -> a) or too long a chain,
+// which misbehaving middleboxes occasionally inject. Otherwise, we return the
+// result of the wrapped Validator.
+//
+// Construct using [NewCNAMEChainValidator].
+type CNAMEChainValidator struct {
+	// MaxLength is the maximum number of CNAME records to follow.
+	//
+	// Set by [NewCNAMEChainValidator] to [DefaultMaxCNAMEChainLength].
+	MaxLength int
+
+	// Validator is the OPTIONAL wrapped [ResponseValidator]. When
+	// nil, we use [dnscodec.ParseResponse].
+	Validator ResponseValidator
+}
+
+// NewCNAMEChainValidator creates a new [*CNAMEChainValidator].
+func NewCNAMEChainValidator() *CNAMEChainValidator {
+	return &CNAMEChainValidator{MaxLength: DefaultMaxCNAMEChainLength}
+}
+
+// Ensure that [*CNAMEChainValidator] implements [ResponseValidator].
+var _ ResponseValidator = &CNAMEChainValidator{}
+
+// ValidateResponse implements [ResponseValidator].
+//
+// We check the chain after the wrapped Validator, so that we do not report loops
+// for responses that do not match the query, and we report loops in place of the
+// other errors (e.g., [dnscodec.ErrNoData]), since they explain such errors.
+func (v *CNAMEChainValidator) ValidateResponse(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+	resp, err := validateResponse(v.Validator, queryMsg, respMsg)
+	if errors.Is(err, dnscodec.ErrInvalidResponse) || errors.Is(err, dnscodec.ErrInvalidQuery) {
+		return nil, err
+	}
+	if len(queryMsg.Question) == 1 {
+		if cerr := checkCNAMEChain(queryMsg.Question[0], respMsg, v.MaxLength); cerr != nil {
+			return nil, cerr
+		}
+	}
+	return resp, err
+}
+
+// checkCNAMEChain follows the CNAME chain starting from the question name and
+// returns a [*CNAMEChainError] if the chain contains a cycle or is too long.
+func checkCNAMEChain(q0 dns.Question, respMsg *dns.Msg, maxLength int) error {
+	// 1. map each owner name to its CNAME target
+	targets := make(map[string]string)
+	for _, rr := range respMsg.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok && cname.Hdr.Class == q0.Qclass {
+			owner := dns.CanonicalName(cname.Hdr.Name)
+			if _, found := targets[owner]; !found {
+				targets[owner] = dns.CanonicalName(cname.Target)
+			}
+		}
+	}
+
+	// 2. follow the chain until it ends, loops, or becomes too long
+	current := dns.CanonicalName(q0.Name)
+	chain := []string{current}
+	seen := map[string]bool{current: true}
+	for {
+		target, found := targets[current]
+		if !found {
+			return nil
+		}
+		chain = append(chain, target)
+		if seen[target] {
+			return &CNAMEChainError{Chain: chain, Err: ErrCNAMELoop}
+		}
+		if len(chain)-1 > maxLength {
+			return &CNAMEChainError{Chain: chain, Err: ErrCNAMEChainTooLong}
+		}
+		seen[target] = true
+		current = target
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCNAMEChainValidator(t *testing.T) {
+	v := NewCNAMEChainValidator()
+	assert.Equal(t, DefaultMaxCNAMEChainLength, v.MaxLength)
+	assert.Nil(t, v.Validator)
+}
+
+func TestCNAMEChainValidator(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the answer records.
+		records []string
+
+		// maxLength is the maximum chain length.
+		maxLength int
+
+		// mismatchID indicates whether the response ID should not match.
+		mismatchID bool
+
+		// wantErr is the expected error or nil.
+		wantErr error
+
+		// wantChain is the expected chain on a [*CNAMEChainError].
+		wantChain []string
+	}
+
+	tests := []testCase{
+		{
+			name:      "no CNAME",
+			records:   []string{"a.example.com. 300 IN A 192.0.2.1"},
+			maxLength: 16,
+		},
+
+		{
+			name: "valid chain",
+			records: []string{
+				"a.example.com. 300 IN CNAME b.example.com.",
+				"b.example.com. 300 IN A 192.0.2.1",
+			},
+			maxLength: 16,
+		},
+
+		{
+			name: "loop",
+			records: []string{
+				"B.example.com. 300 IN CNAME a.example.com.",
+				"a.example.com. 300 IN CNAME b.example.com.",
+			},
+			maxLength: 16,
+			wantErr:   ErrCNAMELoop,
+			wantChain: []string{"a.example.com.", "b.example.com.", "a.example.com."},
+		},
+
+		{
+			name:      "self loop",
+			records:   []string{"a.example.com. 300 IN CNAME a.example.com."},
+			maxLength: 16,
+			wantErr:   ErrCNAMELoop,
+			wantChain: []string{"a.example.com.", "a.example.com."},
+		},
+
+		{
+			name: "chain too long",
+			records: []string{
+				"a.example.com. 300 IN CNAME b.example.com.",
+				"b.example.com. 300 IN CNAME c.example.com.",
+				"c.example.com. 300 IN CNAME d.example.com.",
+				"d.example.com. 300 IN A 192.0.2.1",
+			},
+			maxLength: 2,
+			wantErr:   ErrCNAMEChainTooLong,
+			wantChain: []string{"a.example.com.", "b.example.com.", "c.example.com.", "d.example.com."},
+		},
+
+		{
+			name:       "mismatching response",
+			records:    []string{"a.example.com. 300 IN CNAME a.example.com."},
+			maxLength:  16,
+			mismatchID: true,
+			wantErr:    dnscodec.ErrInvalidResponse,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			queryMsg := new(dns.Msg)
+			queryMsg.SetQuestion("a.example.com.", dns.TypeA)
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.RecursionAvailable = true
+			for _, record := range tc.records {
+				respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+			}
+			if tc.mismatchID {
+				respMsg.Id++
+			}
+			v := NewCNAMEChainValidator()
+			v.MaxLength = tc.maxLength
+
+			resp, err := v.ValidateResponse(queryMsg, respMsg)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, resp)
+				var cerr *CNAMEChainError
+				if errors.As(err, &cerr) {
+					assert.Equal(t, tc.wantChain, cerr.Chain)
+				} else {
+					assert.Nil(t, tc.wantChain)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+		})
+	}
+}
+
+func TestCNAMEChainValidatorUsesWrappedValidator(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	v := NewCNAMEChainValidator()
+	v.Validator = ResponseValidatorFunc(func(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+		return nil, expectedErr
+	})
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("a.example.com.", dns.TypeA)
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+
+	resp, err := v.ValidateResponse(queryMsg, respMsg)
+	require.ErrorIs(t, err, expectedErr)
+	require.Nil(t, resp)
+}
+
+func TestCNAMEChainErrorString(t *testing.T) {
+	err := &CNAMEChainError{Chain: []string{"a.example.com.", "a.example.com."}, Err: ErrCNAMELoop}
+	assert.Equal(t, "CNAME loop: a.example.com. -> a.example.com.", err.Error())
+}
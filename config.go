@@ -0,0 +1,393 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidResolverConfig indicates that a [*ResolverConfig] is not valid.
+var ErrInvalidResolverConfig = errors.New("invalid resolver config")
+
+// ResolverConfig describes how to build a [*Resolver] using several upstreams,
+// which allows deploying measurement agents configured using JSON files.
+//
+// Durations are strings parsed using [time.ParseDuration] (e.g., "5s").
+//
+// Use [LoadResolverConfig] to decode from JSON.
+type ResolverConfig struct {
+	// Upstreams contains the upstreams to use, in order.
+	Upstreams []*UpstreamConfig `json:"upstreams"`
+
+	// Strategy is the OPTIONAL strategy to use the upstreams, either
+	// [UpstreamStrategySequential], which is the default, or
+	// [UpstreamStrategyParallel].
+	Strategy string `json:"strategy,omitempty"`
+
+	// Timeout is the OPTIONAL overall lookup timeout. When empty, we
+	// use [DefaultResolverTimeout].
+	Timeout string `json:"timeout,omitempty"`
+
+	// QPS OPTIONALLY limits the rate of the queries sent by the resolver.
+	QPS float64 `json:"qps,omitempty"`
+}
+
+// UpstreamConfig describes an upstream within [*ResolverConfig].
+type UpstreamConfig struct {
+	// URL is the upstream URL parsed using [NewDNSTransportFromURL].
+	URL string `json:"url"`
+
+	// Timeout is the OPTIONAL timeout of each exchange with this upstream.
+	Timeout string `json:"timeout,omitempty"`
+
+	// QPS OPTIONALLY limits the rate of the queries sent to this upstream.
+	QPS float64 `json:"qps,omitempty"`
+
+	// MaxResponseSize OPTIONALLY overrides the maximum response size
+	// advertised to this upstream using EDNS(0).
+	MaxResponseSize uint16 `json:"max_response_size,omitempty"`
+
+	// DisableEDNS OPTIONALLY omits the EDNS(0) OPT record from queries.
+	DisableEDNS bool `json:"disable_edns,omitempty"`
+
+	// TLS OPTIONALLY configures a DNS over TLS upstream.
+	TLS *UpstreamTLSConfig `json:"tls,omitempty"`
+}
+
+// UpstreamTLSConfig contains the TLS settings of an [*UpstreamConfig].
+type UpstreamTLSConfig struct {
+	// ServerName OPTIONALLY overrides the server name to use for the handshake
+	// and for verifying the certificate, including the URL "sni" parameter.
+	ServerName string `json:"server_name,omitempty"`
+
+	// CAFile is the OPTIONAL path of a PEM file containing the CA roots to use
+	// for verifying the certificate. When empty, we use the system roots.
+	CAFile string `json:"ca_file,omitempty"`
+
+	// InsecureSkipVerify OPTIONALLY disables verifying the certificate.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	// ALPN OPTIONALLY contains the ALPN protocols to negotiate (e.g., "dot").
+	ALPN []string `json:"alpn,omitempty"`
+}
+
+// Strategies for using the upstreams of a [*ResolverConfig].
+const (
+	// UpstreamStrategySequential tries each upstream in order until one succeeds.
+	UpstreamStrategySequential = "sequential"
+
+	// UpstreamStrategyParallel queries all the upstreams at the same time and uses
+	// the first successful response, canceling the other exchanges. When all the
+	// upstreams fail, we return the error of the first upstream.
+	UpstreamStrategyParallel = "parallel"
+)
+
+// LoadResolverConfig decodes a [*ResolverConfig] from JSON.
+//
+// We reject unknown fields, to catch typos in configuration files.
+func LoadResolverConfig(r io.Reader) (*ResolverConfig, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var config ResolverConfig
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// NewResolver creates a new [*Resolver] from the config using the given
+// [NetDialer] to create connections.
+func (c *ResolverConfig) NewResolver(dialer NetDialer) (*Resolver, error) {
+	// 1. validate the resolver-wide settings
+	if len(c.Upstreams) <= 0 {
+		return nil, fmt.Errorf("%w: no upstreams", ErrInvalidResolverConfig)
+	}
+	switch c.Strategy {
+	case "", UpstreamStrategySequential, UpstreamStrategyParallel:
+	default:
+		return nil, fmt.Errorf("%w: unsupported strategy %q", ErrInvalidResolverConfig, c.Strategy)
+	}
+	timeout, err := resolverConfigDuration(c.Timeout, DefaultResolverTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. create the transports
+	transports := make([]DNSTransport, 0, len(c.Upstreams))
+	for _, upstream := range c.Upstreams {
+		txp, err := upstream.newTransport(dialer)
+		if err != nil {
+			return nil, err
+		}
+		transports = append(transports, txp)
+	}
+
+	// 3. create the resolver
+	if c.Strategy == UpstreamStrategyParallel {
+		transports = []DNSTransport{&parallelTransport{transports: transports}}
+	}
+	reso := NewResolver(transports...)
+	reso.Timeout = timeout
+	if c.QPS > 0 {
+		reso.RateLimiter = NewRateLimiter(c.QPS, 1)
+	}
+	return reso, nil
+}
+
+// newTransport creates the [DNSTransport] for the upstream.
+func (u *UpstreamConfig) newTransport(dialer NetDialer) (DNSTransport, error) {
+	txp, err := NewDNSTransportFromURL(dialer, u.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResolverConfig, err)
+	}
+	switch txp := txp.(type) {
+	case *DNSOverUDPTransport:
+		txp.MaxResponseSize = u.MaxResponseSize
+		txp.DisableEDNS = u.DisableEDNS
+	case *dnsStreamDialTransport:
+		txp.maxSize = u.MaxResponseSize
+		txp.disableEDNS = u.DisableEDNS
+	}
+	if err := u.applyTLSConfig(txp); err != nil {
+		return nil, err
+	}
+	timeout, err := resolverConfigDuration(u.Timeout, 0)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 && u.QPS <= 0 {
+		return txp, nil
+	}
+	wrapper := &upstreamTransport{transport: txp, timeout: timeout}
+	if u.QPS > 0 {
+		wrapper.limiter = NewRateLimiter(u.QPS, 1)
+	}
+	return wrapper, nil
+}
+
+// applyTLSConfig applies the TLS settings, if any, to the transport, which
+// must be a DNS over TLS transport when there are TLS settings.
+func (u *UpstreamConfig) applyTLSConfig(txp DNSTransport) error {
+	if u.TLS == nil {
+		return nil
+	}
+	stream, ok := txp.(*dnsStreamDialTransport)
+	if !ok || stream.config == nil {
+		return fmt.Errorf("%w: TLS settings for non-TLS upstream %q", ErrInvalidResolverConfig, u.URL)
+	}
+	if u.TLS.ServerName != "" {
+		stream.config.ServerName = u.TLS.ServerName
+	}
+	if u.TLS.CAFile != "" {
+		data, err := os.ReadFile(u.TLS.CAFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidResolverConfig, err)
+		}
+		stream.config.RootCAs = x509.NewCertPool()
+		if !stream.config.RootCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%w: no certificates in %q", ErrInvalidResolverConfig, u.TLS.CAFile)
+		}
+	}
+	stream.config.InsecureSkipVerify = u.TLS.InsecureSkipVerify
+	stream.config.NextProtos = u.TLS.ALPN
+	return nil
+}
+
+// resolverConfigDuration parses a duration using the given default value when empty.
+func resolverConfigDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidResolverConfig, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%w: non-positive duration %q", ErrInvalidResolverConfig, value)
+	}
+	return duration, nil
+}
+
+// upstreamTransport applies the per-upstream timeout and rate limiting.
+type upstreamTransport struct {
+	// limiter is the rate limiter or nil.
+	limiter *RateLimiter
+
+	// timeout is the exchange timeout or zero.
+	timeout time.Duration
+
+	// transport is the wrapped transport.
+	transport DNSTransport
+}
+
+// Ensure that [*upstreamTransport] implements [DNSExtendedTransport], [DNSMsgTransport], and [io.Closer].
+var (
+	_ DNSExtendedTransport = &upstreamTransport{}
+	_ DNSMsgTransport      = &upstreamTransport{}
+	_ io.Closer            = &upstreamTransport{}
+)
+
+// Exchange implements [DNSTransport].
+func (ut *upstreamTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	ctx, cancel, err := ut.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return ut.transport.Exchange(ctx, query)
+}
+
+// ExchangeExtended implements [DNSExtendedTransport].
+//
+// We return a [*DNSMeasurement] without network details when the rate limiter
+// fails or the wrapped transport does not implement [DNSExtendedTransport].
+func (ut *upstreamTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	ctx, cancel, err := ut.prepare(ctx)
+	if err != nil {
+		m := newDNSMeasurement("", netip.AddrPort{}, query)
+		m.complete(nil, err)
+		return nil, m
+	}
+	defer cancel()
+	return exchangeExtended(ctx, ut.transport, query)
+}
+
+// ExchangeMsg implements [DNSMsgTransport].
+//
+// We fail with [errors.ErrUnsupported] when the wrapped transport does
+// not implement [DNSMsgTransport].
+func (ut *upstreamTransport) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	txp, ok := ut.transport.(DNSMsgTransport)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	ctx, cancel, err := ut.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return txp.ExchangeMsg(ctx, queryMsg)
+}
+
+// prepare waits for the rate limiter, if any, and returns the context
+// to use for the exchange, which honors the timeout, if any.
+func (ut *upstreamTransport) prepare(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if ut.limiter != nil {
+		if err := ut.limiter.Wait(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	if ut.timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, ut.timeout)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+// Close closes the wrapped transport if it implements [io.Closer].
+func (ut *upstreamTransport) Close() error {
+	return transportClose(ut.transport)
+}
+
+// parallelTransport implements [UpstreamStrategyParallel].
+type parallelTransport struct {
+	// transports contains the upstream transports.
+	transports []DNSTransport
+}
+
+// Ensure that [*parallelTransport] implements [DNSExtendedTransport], [DNSMsgTransport], and [io.Closer].
+var (
+	_ DNSExtendedTransport = &parallelTransport{}
+	_ DNSMsgTransport      = &parallelTransport{}
+	_ io.Closer            = &parallelTransport{}
+)
+
+// Exchange implements [DNSTransport].
+func (pt *parallelTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return parallelExchange(ctx, pt.transports,
+		func(ctx context.Context, txp DNSTransport) (*dnscodec.Response, error) {
+			return txp.Exchange(ctx, query)
+		})
+}
+
+// ExchangeExtended implements [DNSExtendedTransport].
+//
+// We return the [*DNSMeasurement] of the successful upstream or, when all
+// the upstreams fail, the one of the first upstream.
+func (pt *parallelTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	m, _ := parallelExchange(ctx, pt.transports,
+		func(ctx context.Context, txp DNSTransport) (*DNSMeasurement, error) {
+			_, m := exchangeExtended(ctx, txp, query)
+			return m, m.Err
+		})
+	return m.Response, m
+}
+
+// ExchangeMsg implements [DNSMsgTransport].
+//
+// The upstreams not implementing [DNSMsgTransport] fail with [errors.ErrUnsupported].
+func (pt *parallelTransport) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	return parallelExchange(ctx, pt.transports,
+		func(ctx context.Context, txp DNSTransport) (*dns.Msg, error) {
+			msgTxp, ok := txp.(DNSMsgTransport)
+			if !ok {
+				return nil, errors.ErrUnsupported
+			}
+			return msgTxp.ExchangeMsg(ctx, queryMsg)
+		})
+}
+
+// Close closes the upstream transports implementing [io.Closer].
+func (pt *parallelTransport) Close() error {
+	var errs []error
+	for _, txp := range pt.transports {
+		errs = append(errs, transportClose(txp))
+	}
+	return errors.Join(errs...)
+}
+
+// parallelExchange runs fx for all the transports at the same time and returns the
+// first successful result, canceling the other exchanges, or the result and the
+// error of the first transport.
+func parallelExchange[T any](ctx context.Context,
+	transports []DNSTransport, fx func(ctx context.Context, txp DNSTransport) (T, error)) (T, error) {
+	// 1. start all the exchanges
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		index int
+		value T
+		err   error
+	}
+	results := make(chan *result, len(transports))
+	for index, txp := range transports {
+		go func() {
+			value, err := fx(ctx, txp)
+			results <- &result{index: index, value: value, err: err}
+		}()
+	}
+
+	// 2. return the first success or the result of the first transport
+	failures := make([]*result, len(transports))
+	for range transports {
+		res := <-results
+		if res.err == nil {
+			return res.value, nil
+		}
+		failures[res.index] = res
+	}
+	return failures[0].value, failures[0].err
+}
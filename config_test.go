@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/bassosimone/pkitest"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverConfigNewResolver(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+
+	rc, err := LoadResolverConfig(strings.NewReader(`{
+		"upstreams": [
+			{"url": "udp://` + server.Address() + `", "timeout": "1s", "qps": 100},
+			{"url": "udp://8.8.8.8", "max_response_size": 4096, "disable_edns": true}
+		],
+		"strategy": "sequential",
+		"timeout": "3s",
+		"qps": 50
+	}`))
+	require.NoError(t, err)
+
+	reso, err := rc.NewResolver(&net.Dialer{})
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, reso.Timeout)
+	assert.NotNil(t, reso.RateLimiter)
+	require.Len(t, reso.Transports, 2)
+
+	wrapper, ok := reso.Transports[0].(*upstreamTransport)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, wrapper.timeout)
+	assert.NotNil(t, wrapper.limiter)
+
+	udp, ok := reso.Transports[1].(*DNSOverUDPTransport)
+	require.True(t, ok)
+	assert.Equal(t, uint16(4096), udp.MaxResponseSize)
+	assert.True(t, udp.DisableEDNS)
+
+	addrs, err := reso.LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+}
+
+func TestResolverConfigNewResolverExchangeMsg(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{PacketConn: pconn, Handler: dns.HandlerFunc(
+		func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(
+				dns.NewRR("_sip._udp.example.com. 300 IN SRV 10 0 5060 sip.example.com.")))
+			w.WriteMsg(respMsg)
+		})})
+
+	// the wrapper must not prevent querying names containing underscores
+	rc := &ResolverConfig{Upstreams: []*UpstreamConfig{
+		{URL: "udp://" + pconn.LocalAddr().String(), Timeout: "1s", QPS: 100},
+	}}
+	reso, err := rc.NewResolver(&net.Dialer{})
+	require.NoError(t, err)
+	require.IsType(t, &upstreamTransport{}, reso.Transports[0])
+	_, srvs, err := reso.LookupSRV(context.Background(), "sip", "udp", "example.com")
+	require.NoError(t, err)
+	require.Len(t, srvs, 1)
+	assert.Equal(t, "sip.example.com.", srvs[0].Target)
+}
+
+func TestResolverConfigStreamUpstreams(t *testing.T) {
+	cert := pkitest.MustNewSelfSignedCert(&pkitest.SelfSignedCertConfig{
+		CommonName:   "dns.example.com",
+		DNSNames:     []string{"dns.example.com"},
+		Organization: []string{"Example"},
+	})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, cert.CertPEM, 0600))
+
+	rc := &ResolverConfig{Upstreams: []*UpstreamConfig{
+		{URL: "tcp://8.8.8.8", MaxResponseSize: 4096, DisableEDNS: true},
+		{URL: "tls://1.1.1.1?sni=one.one.one.one", TLS: &UpstreamTLSConfig{
+			ServerName:         "dns.example.com",
+			CAFile:             caFile,
+			InsecureSkipVerify: true,
+			ALPN:               []string{"dot"},
+		}},
+	}}
+	reso, err := rc.NewResolver(&net.Dialer{})
+	require.NoError(t, err)
+	require.Len(t, reso.Transports, 2)
+
+	tcp, ok := reso.Transports[0].(*dnsStreamDialTransport)
+	require.True(t, ok)
+	assert.Equal(t, uint16(4096), tcp.maxSize)
+	assert.True(t, tcp.disableEDNS)
+
+	dot, ok := reso.Transports[1].(*dnsStreamDialTransport)
+	require.True(t, ok)
+	assert.Equal(t, "dns.example.com", dot.config.ServerName)
+	assert.NotNil(t, dot.config.RootCAs)
+	assert.True(t, dot.config.InsecureSkipVerify)
+	assert.Equal(t, []string{"dot"}, dot.config.NextProtos)
+}
+
+func TestResolverConfigParallelStrategy(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { silent.Close() })
+
+	rc := &ResolverConfig{
+		Upstreams: []*UpstreamConfig{
+			{URL: "udp://" + silent.LocalAddr().String()},
+			{URL: "udp://" + server.Address()},
+		},
+		Strategy: UpstreamStrategyParallel,
+	}
+	reso, err := rc.NewResolver(&net.Dialer{})
+	require.NoError(t, err)
+	require.Len(t, reso.Transports, 1)
+	require.IsType(t, &parallelTransport{}, reso.Transports[0])
+
+	// the answering upstream wins without waiting for the silent one
+	started := time.Now()
+	addrs, err := reso.LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	assert.Less(t, time.Since(started), reso.Timeout)
+}
+
+func TestParallelTransport(t *testing.T) {
+	t.Run("returns the first success and cancels the others", func(t *testing.T) {
+		canceled := make(chan struct{})
+		txp := &parallelTransport{transports: []DNSTransport{
+			transportStub{exchange: func(ctx context.Context, _ *dnscodec.Query) (*dnscodec.Response, error) {
+				<-ctx.Done()
+				close(canceled)
+				return nil, ctx.Err()
+			}},
+			transportStub{exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+				return &dnscodec.Response{}, nil
+			}},
+		}}
+		resp, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		<-canceled
+	})
+
+	t.Run("returns the error of the first transport", func(t *testing.T) {
+		err1, err2 := errors.New("first error"), errors.New("second error")
+		txp := &parallelTransport{transports: []DNSTransport{
+			bothTransportStub{msgTransportStub: msgTransportStub{
+				exchangeMsg: func(context.Context, *dns.Msg) (*dns.Msg, error) {
+					time.Sleep(10 * time.Millisecond)
+					return nil, err1
+				},
+			}},
+			bothTransportStub{msgTransportStub: msgTransportStub{
+				exchangeMsg: func(context.Context, *dns.Msg) (*dns.Msg, error) {
+					return nil, err2
+				},
+			}},
+		}}
+		respMsg, err := txp.ExchangeMsg(context.Background(), new(dns.Msg))
+		require.ErrorIs(t, err, err1)
+		require.Nil(t, respMsg)
+	})
+
+	t.Run("ExchangeExtended returns the measurement of the first transport", func(t *testing.T) {
+		err1, err2 := errors.New("first error"), errors.New("second error")
+		txp := &parallelTransport{transports: []DNSTransport{
+			transportStub{exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+				time.Sleep(10 * time.Millisecond)
+				return nil, err1
+			}},
+			transportStub{exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+				return nil, err2
+			}},
+		}}
+		resp, m := txp.ExchangeExtended(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+		require.Nil(t, resp)
+		require.ErrorIs(t, m.Err, err1)
+	})
+
+	t.Run("ExchangeMsg without DNSMsgTransport", func(t *testing.T) {
+		txp := &parallelTransport{transports: []DNSTransport{transportStub{}}}
+		_, err := txp.ExchangeMsg(context.Background(), new(dns.Msg))
+		require.ErrorIs(t, err, errors.ErrUnsupported)
+	})
+
+	t.Run("closes the transports", func(t *testing.T) {
+		expectedErr := errors.New("mocked error")
+		var closed int
+		txp := &parallelTransport{transports: []DNSTransport{
+			closerTransportStub{close: func() error {
+				closed++
+				return expectedErr
+			}},
+			transportStub{},
+			closerTransportStub{close: func() error {
+				closed++
+				return nil
+			}},
+		}}
+		require.ErrorIs(t, txp.Close(), expectedErr)
+		assert.Equal(t, 2, closed)
+	})
+}
+
+func TestResolverConfigDefaults(t *testing.T) {
+	rc := &ResolverConfig{Upstreams: []*UpstreamConfig{{URL: "udp://8.8.8.8"}}}
+	reso, err := rc.NewResolver(&net.Dialer{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultResolverTimeout, reso.Timeout)
+	assert.Nil(t, reso.RateLimiter)
+	require.Len(t, reso.Transports, 1)
+	assert.IsType(t, &DNSOverUDPTransport{}, reso.Transports[0])
+}
+
+func TestResolverConfigErrors(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the config to use.
+		config *ResolverConfig
+	}
+
+	tests := []testCase{
+		{
+			name:   "no upstreams",
+			config: &ResolverConfig{},
+		},
+
+		{
+			name: "unsupported strategy",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{URL: "udp://8.8.8.8"}},
+				Strategy:  "random",
+			},
+		},
+
+		{
+			name: "invalid timeout",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{URL: "udp://8.8.8.8"}},
+				Timeout:   "forever",
+			},
+		},
+
+		{
+			name: "unsupported URL",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{URL: "https://dns.google/dns-query"}},
+			},
+		},
+
+		{
+			name: "TLS settings for non-TLS upstream",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{URL: "tcp://8.8.8.8", TLS: &UpstreamTLSConfig{}}},
+			},
+		},
+
+		{
+			name: "missing CA file",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{
+					URL: "tls://8.8.8.8",
+					TLS: &UpstreamTLSConfig{CAFile: filepath.Join(t.TempDir(), "nonexistent")},
+				}},
+			},
+		},
+
+		{
+			name: "CA file without certificates",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{
+					URL: "tls://8.8.8.8",
+					TLS: &UpstreamTLSConfig{CAFile: "config_test.go"},
+				}},
+			},
+		},
+
+		{
+			name: "non-positive upstream timeout",
+			config: &ResolverConfig{
+				Upstreams: []*UpstreamConfig{{URL: "udp://8.8.8.8", Timeout: "0s"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reso, err := tc.config.NewResolver(&net.Dialer{})
+			require.ErrorIs(t, err, ErrInvalidResolverConfig)
+			require.Nil(t, reso)
+		})
+	}
+}
+
+func TestLoadResolverConfigErrors(t *testing.T) {
+	for _, input := range []string{`{"upstreams": [], "unknown": true}`, `{`} {
+		_, err := LoadResolverConfig(strings.NewReader(input))
+		require.Error(t, err)
+	}
+}
+
+func TestUpstreamTransport(t *testing.T) {
+	t.Run("applies the timeout", func(t *testing.T) {
+		txp := &upstreamTransport{
+			timeout: time.Hour,
+			transport: transportStub{
+				exchange: func(ctx context.Context, _ *dnscodec.Query) (*dnscodec.Response, error) {
+					_, found := ctx.Deadline()
+					assert.True(t, found)
+					return &dnscodec.Response{}, nil
+				},
+			},
+		}
+		_, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+		require.NoError(t, err)
+	})
+
+	t.Run("honors the rate limiter", func(t *testing.T) {
+		txp := &upstreamTransport{
+			limiter: NewRateLimiter(0.001, 1),
+			transport: transportStub{
+				exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+					return &dnscodec.Response{}, nil
+				},
+			},
+		}
+		query := dnscodec.NewQuery("example.com", dns.TypeA)
+		_, err := txp.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = txp.Exchange(ctx, query)
+		require.Error(t, err)
+	})
+
+	t.Run("ExchangeMsg applies the timeout", func(t *testing.T) {
+		txp := &upstreamTransport{
+			timeout: time.Hour,
+			transport: bothTransportStub{msgTransportStub: msgTransportStub{
+				exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+					_, found := ctx.Deadline()
+					assert.True(t, found)
+					return new(dns.Msg), nil
+				},
+			}},
+		}
+		_, err := txp.ExchangeMsg(context.Background(), new(dns.Msg))
+		require.NoError(t, err)
+	})
+
+	t.Run("ExchangeMsg without DNSMsgTransport", func(t *testing.T) {
+		txp := &upstreamTransport{transport: transportStub{}}
+		_, err := txp.ExchangeMsg(context.Background(), new(dns.Msg))
+		require.ErrorIs(t, err, errors.ErrUnsupported)
+	})
+
+	t.Run("closes the wrapped transport", func(t *testing.T) {
+		var closed bool
+		txp := &upstreamTransport{transport: closerTransportStub{close: func() error {
+			closed = true
+			return nil
+		}}}
+		require.NoError(t, txp.Close())
+		assert.True(t, closed)
+		require.NoError(t, (&upstreamTransport{transport: transportStub{}}).Close())
+	})
+}
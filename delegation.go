@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// LookupNS returns the NS RRset of the given domain.
+//
+// Some servers (e.g., the authoritative servers of the parent zone) answer
+// with the NS RRset in the authority section and an empty answer section. To
+// measure delegations, we use the NS records for the domain found in the
+// authority section when the answer section does not contain any. This only
+// works with transports implementing [DNSMsgTransport], since [DNSTransport]
+// maps empty answers to [dnscodec.ErrNoData] without returning the message.
+func (r *Resolver) LookupNS(ctx context.Context, domain string) ([]*dns.NS, error) {
+	query := r.newQuery(domain, dns.TypeNS)
+	resp, _, err := r.lookupWith(ctx, query, resolverExchangeNS)
+	if err != nil {
+		return nil, NewDNSError(domain, err)
+	}
+	return resolverRecords[*dns.NS](domain, resp)
+}
+
+// LookupSOA returns the SOA record of the given domain, which contains the
+// primary name server (Ns), the responsible mailbox (Mbox), the Serial, and
+// the Refresh, Retry, Expire, and Minttl timers.
+//
+// We only consider the SOA records in the answer section. Unlike a zone apex,
+// a name inside a zone yields [dnscodec.ErrNoData], while a name that does
+// not exist yields [dnscodec.ErrNoName].
+func (r *Resolver) LookupSOA(ctx context.Context, domain string) (*dns.SOA, error) {
+	records, err := resolverLookupRecords[*dns.SOA](ctx, r, domain, dns.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// resolverExchangeNS exchanges the NS query using [DNSMsgTransport] when possible
+// and uses the NS records in the authority section when there are no answers.
+func resolverExchangeNS(ctx context.Context, txp DNSTransport, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. fall back to the ordinary exchange when we cannot access the message
+	mtxp, ok := txp.(DNSMsgTransport)
+	if !ok {
+		return txp.Exchange(ctx, query)
+	}
+
+	// 2. exchange the raw messages
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, err
+	}
+	respMsg, err := mtxp.ExchangeMsg(ctx, queryMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. parse the response and possibly use the authority section
+	resp, err := dnscodec.ParseResponse(queryMsg, respMsg)
+	if !errors.Is(err, dnscodec.ErrNoData) {
+		return resp, err
+	}
+	rrs := authorityNS(queryMsg.Question[0], respMsg)
+	if len(rrs) <= 0 {
+		return nil, err
+	}
+	return &dnscodec.Response{Query: queryMsg, Response: respMsg, ValidRRs: rrs}, nil
+}
+
+// authorityNS returns the NS records in the authority section owned by the queried name.
+func authorityNS(q0 dns.Question, respMsg *dns.Msg) []dns.RR {
+	var rrs []dns.RR
+	for _, rr := range respMsg.Ns {
+		if ns, ok := rr.(*dns.NS); ok && ns.Hdr.Class == q0.Qclass &&
+			dns.CanonicalName(ns.Hdr.Name) == dns.CanonicalName(q0.Name) {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverLookupNS(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// msgTransport indicates whether the transport implements [DNSMsgTransport].
+		msgTransport bool
+
+		// rcode is the response code.
+		rcode int
+
+		// answer contains the answer section records.
+		answer []string
+
+		// authority contains the authority section records.
+		authority []string
+
+		// want contains the expected name servers.
+		want []string
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:   "answer section",
+			answer: []string{"example.com. 300 IN NS a.iana-servers.net.", "example.com. 300 IN NS b.iana-servers.net."},
+			want:   []string{"a.iana-servers.net.", "b.iana-servers.net."},
+		},
+
+		{
+			name:         "answer section using DNSMsgTransport",
+			msgTransport: true,
+			answer:       []string{"example.com. 300 IN NS a.iana-servers.net."},
+			authority:    []string{"example.com. 300 IN NS b.iana-servers.net."},
+			want:         []string{"a.iana-servers.net."},
+		},
+
+		{
+			name:         "authority section using DNSMsgTransport",
+			msgTransport: true,
+			authority:    []string{"EXAMPLE.com. 300 IN NS a.iana-servers.net.", "example.com. 300 IN NS b.iana-servers.net."},
+			want:         []string{"a.iana-servers.net.", "b.iana-servers.net."},
+		},
+
+		{
+			name:         "authority section for another name",
+			msgTransport: true,
+			authority:    []string{"com. 300 IN NS a.gtld-servers.net."},
+			wantErr:      dnscodec.ErrNoData,
+		},
+
+		{
+			name:      "authority section without DNSMsgTransport",
+			authority: []string{"example.com. 300 IN NS a.iana-servers.net."},
+			wantErr:   dnscodec.ErrNoData,
+		},
+
+		{
+			name:         "NXDOMAIN using DNSMsgTransport",
+			msgTransport: true,
+			rcode:        dns.RcodeNameError,
+			authority:    []string{"example.com. 300 IN NS a.iana-servers.net."},
+			wantErr:      dnscodec.ErrNoName,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// newResponse returns the response message for the query message.
+			newResponse := func(queryMsg *dns.Msg) *dns.Msg {
+				respMsg := new(dns.Msg)
+				respMsg.SetRcode(queryMsg, tc.rcode)
+				for _, record := range tc.answer {
+					respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+				}
+				for _, record := range tc.authority {
+					respMsg.Ns = append(respMsg.Ns, runtimex.PanicOnError1(dns.NewRR(record)))
+				}
+				return respMsg
+			}
+
+			txp := transportStub{
+				exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+					queryMsg := runtimex.PanicOnError1(query.NewMsg())
+					return dnscodec.ParseResponse(queryMsg, newResponse(queryMsg))
+				},
+			}
+			var reso *Resolver
+			if tc.msgTransport {
+				reso = NewResolver(bothTransportStub{
+					msgTransportStub: msgTransportStub{
+						exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+							return newResponse(queryMsg), nil
+						},
+					},
+				})
+			} else {
+				reso = NewResolver(txp)
+			}
+
+			records, err := reso.LookupNS(context.Background(), "example.com")
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, records)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, record := range records {
+				got = append(got, record.Ns)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestResolverLookupSOA(t *testing.T) {
+	reso := newRecordsResolver(
+		"example.com. 300 IN SOA ns.icann.org. noc.dns.icann.org. 2024081401 7200 3600 1209600 3600",
+	)
+	soa, err := reso.LookupSOA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ns.icann.org.", soa.Ns)
+	assert.Equal(t, "noc.dns.icann.org.", soa.Mbox)
+	assert.Equal(t, uint32(2024081401), soa.Serial)
+	assert.Equal(t, uint32(7200), soa.Refresh)
+	assert.Equal(t, uint32(3600), soa.Retry)
+	assert.Equal(t, uint32(1209600), soa.Expire)
+	assert.Equal(t, uint32(3600), soa.Minttl)
+
+	soa, err = NewResolver(transportStub{
+		exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			return nil, dnscodec.ErrNoName
+		},
+	}).LookupSOA(context.Background(), "nonexistent.example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+	assert.Nil(t, soa)
+}
@@ -8,8 +8,12 @@ package minest
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
+	"net/netip"
+	"time"
 
 	"github.com/bassosimone/runtimex"
 )
@@ -29,6 +33,44 @@ type DialerResolver interface {
 // This [*Dialer] does not implement happy eyeballs and is instead very
 // simple and focused on measuring network interference.
 type Dialer struct {
+	// Cache is the OPTIONAL [*DialerCache] for lookups.
+	//
+	// When nil, which is the default, we resolve the domain name at every
+	// dial, which is what most measurements want. Set this field to avoid
+	// resolving the same domain name multiple times during a sweep.
+	Cache *DialerCache
+
+	// Limiter OPTIONALLY limits the dials performed by this [*Dialer].
+	Limiter *DialLimiter
+
+	// TLSClientFactory is the [TLSClientFactory] to use for TLS handshakes.
+	//
+	// Set by [NewDialer] to [StdlibTLSClientFactory].
+	TLSClientFactory TLSClientFactory
+
+	// ObserveLookup is an optional hook called after resolving the domain name.
+	//
+	// This hook is not called when dialing an IP address or when
+	// the addresses are already available inside the Cache.
+	ObserveLookup func(*DialerLookupObservation)
+
+	// ObserveConnect is an optional hook called after each connect attempt.
+	ObserveConnect func(*DialerConnectObservation)
+
+	// ObserveTLSHandshake is an optional hook called after each TLS handshake.
+	ObserveTLSHandshake func(*DialerTLSHandshakeObservation)
+
+	// CaptureThenFail OPTIONALLY enables completing the TLS handshake when
+	// the certificate verification fails, so that ObserveTLSHandshake sees the
+	// presented chain and the negotiated parameters, before closing the
+	// connection and returning the verification error. This preserves the
+	// evidence of MITM attempts that a failed handshake would otherwise lose.
+	//
+	// In this mode, we verify the certificate after the handshake, so the
+	// VerifyPeerCertificate and VerifyConnection callbacks of the config see
+	// no verified chains, and so does the ConnectionState of the returned conn.
+	CaptureThenFail bool
+
 	// reso is the resolver to use.
 	reso DialerResolver
 
@@ -36,9 +78,126 @@ type Dialer struct {
 	udialer NetDialer
 }
 
+// DialerLookupObservation describes a lookup performed by [*Dialer].
+type DialerLookupObservation struct {
+	// Domain is the domain name we resolved.
+	Domain string
+
+	// Addrs contains the resolved addresses or nil.
+	Addrs []string
+
+	// Err is the error or nil.
+	Err error
+
+	// Started is when we started the lookup.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// DialerConnectObservation describes a connect attempt performed by [*Dialer].
+type DialerConnectObservation struct {
+	// Network is the network we used.
+	Network string
+
+	// Address is the address we attempted to connect to.
+	Address string
+
+	// Err is the error or nil.
+	Err error
+
+	// Started is when we started the connect attempt.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// DialerTLSHandshakeObservation describes a TLS handshake performed by [*Dialer].
+type DialerTLSHandshakeObservation struct {
+	// Address is the remote address of the underlying connection.
+	Address string
+
+	// ServerName is the SNI we used.
+	ServerName string
+
+	// ConnectionState is the state after the handshake.
+	//
+	// On failure, this field contains whatever state was
+	// available when the handshake failed.
+	ConnectionState tls.ConnectionState
+
+	// PeerCertificates contains the certificate chain presented by the
+	// server, which we also save when the verification fails, so that
+	// one can detect and archive MITM certificates.
+	PeerCertificates []*x509.Certificate
+
+	// Verified is true when the presented chain was successfully verified.
+	Verified bool
+
+	// Err is the error or nil.
+	Err error
+
+	// Started is when we started the TLS handshake.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// DialAttemptError is the error occurred when connecting to a specific address.
+type DialAttemptError struct {
+	// Address is the address we attempted to connect to.
+	Address string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *DialAttemptError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap allows to access the underlying error.
+func (e *DialAttemptError) Unwrap() error {
+	return e.Err
+}
+
+// Failure classifies the underlying error using [ClassifyError].
+func (e *DialAttemptError) Failure() string {
+	return ClassifyError(e.Err)
+}
+
+// DialError is the error returned by [*Dialer] when all the connect attempts fail.
+type DialError struct {
+	// Attempts contains the error of each failed connect attempt.
+	Attempts []*DialAttemptError
+}
+
+// Error implements error.
+func (e *DialError) Error() string {
+	return e.join().Error()
+}
+
+// Unwrap allows to access the underlying errors.
+func (e *DialError) Unwrap() []error {
+	errv := make([]error, 0, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		errv = append(errv, attempt)
+	}
+	return errv
+}
+
+// join joins the underlying errors like [errors.Join] would.
+func (e *DialError) join() error {
+	return errors.Join(e.Unwrap()...)
+}
+
 // NewDialer creates a new [*Dialer] instance.
 func NewDialer(udialer NetDialer, reso DialerResolver) *Dialer {
-	return &Dialer{reso, udialer}
+	return &Dialer{TLSClientFactory: StdlibTLSClientFactory{}, reso: reso, udialer: udialer}
 }
 
 // DialContext creates a new [net.Conn] connection.
@@ -57,24 +216,166 @@ func (d *Dialer) DialContext(ctx context.Context, network string, address string
 	runtimex.Assert(len(addrs) >= 1)
 
 	// 3. attempt to connect sequentially
-	errv := make([]error, 0, len(addrs))
+	derr := &DialError{Attempts: make([]*DialAttemptError, 0, len(addrs))}
 	for _, addr := range addrs {
-		conn, err := d.udialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		endpoint := net.JoinHostPort(addr, port)
+		conn, err := d.connect(ctx, network, endpoint)
 		if err != nil {
-			errv = append(errv, err)
+			derr.Attempts = append(derr.Attempts, &DialAttemptError{Address: endpoint, Err: err})
 			continue
 		}
 		return conn, nil
 	}
 
 	// 4. bail if all the connect attempts failed
-	return nil, errors.Join(errv...)
+	return nil, derr
+}
+
+// DialTLSContext creates a new [TLSConn] connection using the TLSClientFactory.
+//
+// When config is nil or config.ServerName is empty, we use the host contained
+// in the address as the SNI, like [*tls.Dialer] does. Otherwise, we use the
+// configured config.ServerName, which allows to override the SNI.
+func (d *Dialer) DialTLSContext(
+	ctx context.Context, network, address string, config *tls.Config) (TLSConn, error) {
+	// 1. create the underlying connection
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. make sure we have a server name
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		runtimex.Assert(err == nil) // DialContext would have failed otherwise
+		if addr, err := netip.ParseAddr(host); err == nil {
+			host = addr.WithZone("").String() // the zone is meaningless to the server
+		}
+		config.ServerName = host
+	}
+
+	// 3. possibly defer the verification until after the handshake
+	verify := d.CaptureThenFail && !config.InsecureSkipVerify
+	if verify {
+		config.InsecureSkipVerify = true
+	}
+
+	// 4. perform the handshake, possibly verify, and possibly observe
+	tconn := d.TLSClientFactory.NewTLSClient(conn, config)
+	started := time.Now()
+	err = tconn.HandshakeContext(ctx)
+	state := tconn.ConnectionState()
+	if err == nil && verify {
+		state.VerifiedChains, err = tlsVerifyPeerCertificates(config, state.PeerCertificates)
+	}
+	if d.ObserveTLSHandshake != nil {
+		d.ObserveTLSHandshake(&DialerTLSHandshakeObservation{
+			Address:          conn.RemoteAddr().String(),
+			ServerName:       config.ServerName,
+			ConnectionState:  state,
+			PeerCertificates: tlsPeerCertificates(state, err),
+			Verified:         len(state.VerifiedChains) > 0,
+			Err:              err,
+			Started:          started,
+			Elapsed:          time.Since(started),
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tconn, nil
 }
 
-// lookupHost ensures that we short circuit IP addresses.
+// lookupHost ensures that we short circuit IP addresses, including IPv6
+// addresses with a zone (e.g., "fe80::1%eth0"), which [net.ParseIP] rejects.
 func (d *Dialer) lookupHost(ctx context.Context, name string) ([]string, error) {
-	if net.ParseIP(name) != nil {
+	if _, err := netip.ParseAddr(name); err == nil {
 		return []string{name}, nil
 	}
-	return d.reso.LookupHost(ctx, name)
+	if d.Cache != nil {
+		if addrs, found := d.Cache.get(name); found {
+			return addrs, nil
+		}
+	}
+	started := time.Now()
+	addrs, err := d.reso.LookupHost(ctx, name)
+	if d.ObserveLookup != nil {
+		d.ObserveLookup(&DialerLookupObservation{
+			Domain:  name,
+			Addrs:   addrs,
+			Err:     err,
+			Started: started,
+			Elapsed: time.Since(started),
+		})
+	}
+	if err == nil && d.Cache != nil {
+		d.Cache.put(name, addrs)
+	}
+	return addrs, err
+}
+
+// connect performs a single connect attempt and possibly observes it.
+func (d *Dialer) connect(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Limiter != nil {
+		if err := d.Limiter.acquire(ctx, address); err != nil {
+			return nil, err
+		}
+	}
+	started := time.Now()
+	conn, err := d.udialer.DialContext(ctx, network, address)
+	if d.Limiter != nil {
+		d.Limiter.release(address, err)
+	}
+	if d.ObserveConnect != nil {
+		d.ObserveConnect(&DialerConnectObservation{
+			Network: network,
+			Address: address,
+			Err:     err,
+			Started: started,
+			Elapsed: time.Since(started),
+		})
+	}
+	return conn, err
+}
+
+// tlsPeerCertificates returns the certificates presented by the server using the
+// connection state or, when the verification failed, using the error.
+func tlsPeerCertificates(state tls.ConnectionState, err error) []*x509.Certificate {
+	if len(state.PeerCertificates) > 0 {
+		return state.PeerCertificates
+	}
+	var cverr *tls.CertificateVerificationError
+	if errors.As(err, &cverr) {
+		return cverr.UnverifiedCertificates
+	}
+	return nil
+}
+
+// tlsVerifyPeerCertificates verifies the certificates presented by the server
+// like [*tls.Conn] does and returns the verified chains.
+func tlsVerifyPeerCertificates(config *tls.Config, certs []*x509.Certificate) ([][]*x509.Certificate, error) {
+	if len(certs) <= 0 {
+		return nil, errors.New("tls: server did not provide a certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         config.RootCAs,
+		DNSName:       config.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	if config.Time != nil {
+		opts.CurrentTime = config.Time()
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(opts)
+	if err != nil {
+		return nil, &tls.CertificateVerificationError{UnverifiedCertificates: certs, Err: err}
+	}
+	return chains, nil
 }
@@ -4,14 +4,55 @@ package minest
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io"
 	"net"
 	"testing"
 
 	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/pkitest"
+	"github.com/bassosimone/runtimex"
 	"github.com/stretchr/testify/require"
 )
 
+// newTLSServer starts a TLS server for the given name and returns its
+// address along with a cert pool that validates its certificate.
+func newTLSServer(t *testing.T, name string) (string, *x509.CertPool) {
+	t.Helper()
+
+	cert := pkitest.MustNewSelfSignedCert(&pkitest.SelfSignedCertConfig{
+		CommonName:   name,
+		DNSNames:     []string{name},
+		Organization: []string{"Example"},
+	})
+	keyPair := runtimex.PanicOnError1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM))
+	pool := x509.NewCertPool()
+	runtimex.Assert(pool.AppendCertsFromPEM(cert.CertPEM))
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), pool
+}
+
 func TestDialerSplitHostPortFailure(t *testing.T) {
 	dialer := NewDialer(&netstub.FuncDialer{}, &netstub.FuncResolver{})
 	_, err := dialer.DialContext(context.Background(), "tcp", "bad-address")
@@ -62,3 +103,326 @@ func TestDialerShortCircuitIPLiteral(t *testing.T) {
 	require.Equal(t, "tcp", gotNetwork)
 	require.Equal(t, "203.0.113.7:80", gotAddr)
 }
+
+func TestDialerShortCircuitIPv6LiteralWithZone(t *testing.T) {
+	var gotAddr string
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			gotAddr = address
+			return nil, errors.New("dial failed")
+		},
+	}, &netstub.FuncResolver{
+		LookupHostFunc: func(context.Context, string) ([]string, error) {
+			panic("should not be called")
+		},
+	})
+	_, err := dialer.DialContext(context.Background(), "udp", "[fe80::1%eth0]:53")
+	require.Error(t, err)
+	require.Equal(t, "[fe80::1%eth0]:53", gotAddr)
+}
+
+func TestDialerDialTLSContextStripsZoneFromSNI(t *testing.T) {
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		},
+	}, &netstub.FuncResolver{})
+	var observation *DialerTLSHandshakeObservation
+	dialer.ObserveTLSHandshake = func(obs *DialerTLSHandshakeObservation) {
+		observation = obs
+	}
+	_, err := dialer.DialTLSContext(context.Background(), "tcp", "[fe80::1%eth0]:853", nil)
+	require.Error(t, err)
+	require.NotNil(t, observation)
+	require.Equal(t, "fe80::1", observation.ServerName)
+}
+
+func TestDialerObserveLookupAndConnect(t *testing.T) {
+	resolver := &netstub.FuncResolver{
+		LookupHostFunc: func(context.Context, string) ([]string, error) {
+			return []string{"203.0.113.1", "203.0.113.2"}, nil
+		},
+	}
+	expectedErr := errors.New("dial failed")
+	expectedConn := &netstub.FuncConn{}
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(_ context.Context, _ string, address string) (net.Conn, error) {
+			if address == "203.0.113.1:80" {
+				return nil, expectedErr
+			}
+			return expectedConn, nil
+		},
+	}, resolver)
+
+	var (
+		lookups  []*DialerLookupObservation
+		connects []*DialerConnectObservation
+	)
+	dialer.ObserveLookup = func(obs *DialerLookupObservation) {
+		lookups = append(lookups, obs)
+	}
+	dialer.ObserveConnect = func(obs *DialerConnectObservation) {
+		connects = append(connects, obs)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+	require.NoError(t, err)
+	require.Equal(t, expectedConn, conn)
+
+	require.Len(t, lookups, 1)
+	require.Equal(t, "example.com", lookups[0].Domain)
+	require.Equal(t, []string{"203.0.113.1", "203.0.113.2"}, lookups[0].Addrs)
+	require.NoError(t, lookups[0].Err)
+	require.False(t, lookups[0].Started.IsZero())
+
+	require.Len(t, connects, 2)
+	require.Equal(t, "203.0.113.1:80", connects[0].Address)
+	require.ErrorIs(t, connects[0].Err, expectedErr)
+	require.Equal(t, "203.0.113.2:80", connects[1].Address)
+	require.Equal(t, "tcp", connects[1].Network)
+	require.NoError(t, connects[1].Err)
+}
+
+func TestDialerObserveLookupSkippedForIPLiteral(t *testing.T) {
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return nil, errors.New("dial failed")
+		},
+	}, &netstub.FuncResolver{})
+	dialer.ObserveLookup = func(*DialerLookupObservation) {
+		t.Fatal("should not be called")
+	}
+	_, err := dialer.DialContext(context.Background(), "tcp", "203.0.113.7:80")
+	require.Error(t, err)
+}
+
+func TestDialerDialTLSContext(t *testing.T) {
+	address, pool := newTLSServer(t, "dns.example.com")
+	_, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// address is the address to dial.
+		address string
+
+		// config is the TLS config to use.
+		config *tls.Config
+
+		// wantSNI is the SNI we expect to use.
+		wantSNI string
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	tests := []testCase{
+		{
+			name:    "SNI from the address",
+			address: net.JoinHostPort("dns.example.com", port),
+			config:  &tls.Config{RootCAs: pool},
+			wantSNI: "dns.example.com",
+		},
+
+		{
+			name:    "SNI override",
+			address: address,
+			config:  &tls.Config{RootCAs: pool, ServerName: "dns.example.com"},
+			wantSNI: "dns.example.com",
+		},
+
+		{
+			name:    "SNI mismatch",
+			address: net.JoinHostPort("dns.example.com", port),
+			config:  &tls.Config{RootCAs: pool, ServerName: "www.example.com"},
+			wantSNI: "www.example.com",
+			wantErr: true,
+		},
+
+		{
+			name:    "nil config",
+			address: net.JoinHostPort("dns.example.com", port),
+			config:  nil,
+			wantSNI: "dns.example.com",
+			wantErr: true, // the certificate is not in the system pool
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &netstub.FuncResolver{
+				LookupHostFunc: func(context.Context, string) ([]string, error) {
+					return []string{"127.0.0.1"}, nil
+				},
+			}
+			dialer := NewDialer(&net.Dialer{}, resolver)
+			var observations []*DialerTLSHandshakeObservation
+			dialer.ObserveTLSHandshake = func(obs *DialerTLSHandshakeObservation) {
+				observations = append(observations, obs)
+			}
+
+			conn, err := dialer.DialTLSContext(context.Background(), "tcp", tc.address, tc.config)
+
+			require.Len(t, observations, 1)
+			require.Equal(t, tc.wantSNI, observations[0].ServerName)
+			require.Equal(t, address, observations[0].Address)
+			require.NotEmpty(t, observations[0].PeerCertificates)
+			require.Equal(t, !tc.wantErr, observations[0].Verified)
+			if tc.wantErr {
+				require.Error(t, err)
+				require.Error(t, observations[0].Err)
+				require.Nil(t, conn)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, observations[0].Err)
+			require.True(t, observations[0].ConnectionState.HandshakeComplete)
+			require.Equal(t, tc.wantSNI, conn.ConnectionState().ServerName)
+		})
+	}
+}
+
+func TestDialerDialTLSContextCaptureThenFail(t *testing.T) {
+	address, pool := newTLSServer(t, "dns.example.com")
+	_, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the TLS config to use.
+		config *tls.Config
+
+		// wantVerified indicates whether we expect a verified chain.
+		wantVerified bool
+
+		// wantErr indicates whether we expect a verification error.
+		wantErr bool
+	}
+
+	tests := []testCase{
+		{
+			name:         "trusted certificate",
+			config:       &tls.Config{RootCAs: pool},
+			wantVerified: true,
+		},
+
+		{
+			name:    "untrusted certificate",
+			config:  nil, // the certificate is not in the system pool
+			wantErr: true,
+		},
+
+		{
+			name:    "SNI mismatch",
+			config:  &tls.Config{RootCAs: pool, ServerName: "www.example.com"},
+			wantErr: true,
+		},
+
+		{
+			name:   "verification disabled",
+			config: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &netstub.FuncResolver{
+				LookupHostFunc: func(context.Context, string) ([]string, error) {
+					return []string{"127.0.0.1"}, nil
+				},
+			}
+			dialer := NewDialer(&net.Dialer{}, resolver)
+			dialer.CaptureThenFail = true
+			var observations []*DialerTLSHandshakeObservation
+			dialer.ObserveTLSHandshake = func(obs *DialerTLSHandshakeObservation) {
+				observations = append(observations, obs)
+			}
+
+			conn, err := dialer.DialTLSContext(
+				context.Background(), "tcp", net.JoinHostPort("dns.example.com", port), tc.config)
+
+			// the handshake parameters are available regardless of the verification
+			require.Len(t, observations, 1)
+			require.True(t, observations[0].ConnectionState.HandshakeComplete)
+			require.NotZero(t, observations[0].ConnectionState.Version)
+			require.NotEmpty(t, observations[0].PeerCertificates)
+			require.Equal(t, tc.wantVerified, observations[0].Verified)
+			if tc.wantErr {
+				var cverr *tls.CertificateVerificationError
+				require.ErrorAs(t, err, &cverr)
+				require.Equal(t, observations[0].PeerCertificates, cverr.UnverifiedCertificates)
+				require.ErrorIs(t, observations[0].Err, err)
+				require.Nil(t, conn)
+				return
+			}
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
+
+func TestDialerDialTLSContextDialFailure(t *testing.T) {
+	expectedErr := errors.New("dial failed")
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return nil, expectedErr
+		},
+	}, &netstub.FuncResolver{})
+	dialer.ObserveTLSHandshake = func(*DialerTLSHandshakeObservation) {
+		t.Fatal("should not be called")
+	}
+	conn, err := dialer.DialTLSContext(context.Background(), "tcp", "203.0.113.7:853", nil)
+	require.ErrorIs(t, err, expectedErr)
+	require.Nil(t, conn)
+}
+
+func TestDialerDialErrorAttempts(t *testing.T) {
+	expectedErr := errors.New("dial failed")
+	resolver := &netstub.FuncResolver{
+		LookupHostFunc: func(context.Context, string) ([]string, error) {
+			return []string{"203.0.113.1", "2001:db8::1"}, nil
+		},
+	}
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return nil, expectedErr
+		},
+	}, resolver)
+
+	_, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+
+	var derr *DialError
+	require.ErrorAs(t, err, &derr)
+	require.Len(t, derr.Attempts, 2)
+	require.Equal(t, "203.0.113.1:80", derr.Attempts[0].Address)
+	require.Equal(t, "[2001:db8::1]:80", derr.Attempts[1].Address)
+	for _, attempt := range derr.Attempts {
+		require.ErrorIs(t, attempt, expectedErr)
+		require.Equal(t, FailureUnknown, attempt.Failure())
+	}
+	require.Equal(t, "dial failed\ndial failed", err.Error())
+}
+
+func TestDialerDialErrorConnectionRefused(t *testing.T) {
+	// Obtain a port that is most likely closed by binding and closing a listener.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	dialer := NewDialer(&net.Dialer{}, &netstub.FuncResolver{})
+	_, err = dialer.DialContext(context.Background(), "tcp", address)
+
+	var derr *DialError
+	require.ErrorAs(t, err, &derr)
+	require.Len(t, derr.Attempts, 1)
+	require.Equal(t, address, derr.Attempts[0].Address)
+	require.Equal(t, FailureConnectionRefused, derr.Attempts[0].Failure())
+}
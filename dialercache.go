@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// DialerCache is a short-lived cache for the lookups performed by [*Dialer].
+//
+// A [*DialerCache] is safe for concurrent use and can be shared by
+// several [*Dialer] instances. We only cache successful lookups.
+//
+// Construct using [NewDialerCache].
+type DialerCache struct {
+	// TTL is the amount of time for which we cache a lookup result.
+	//
+	// Set by [NewDialerCache] to the user-provided value.
+	TTL time.Duration
+
+	// Clock is the [Clock] to use to expire entries.
+	//
+	// Set by [NewDialerCache] to [RealClock].
+	Clock Clock
+
+	// entries maps domain names to cached addresses.
+	entries map[string]dialerCacheEntry
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+}
+
+// dialerCacheEntry is an entry inside the [*DialerCache].
+type dialerCacheEntry struct {
+	// addrs contains the cached addresses.
+	addrs []string
+
+	// expires is when the entry expires.
+	expires time.Time
+}
+
+// NewDialerCache creates a new [*DialerCache] instance.
+func NewDialerCache(ttl time.Duration) *DialerCache {
+	return &DialerCache{
+		TTL:     ttl,
+		Clock:   RealClock{},
+		entries: map[string]dialerCacheEntry{},
+	}
+}
+
+// get returns the cached addresses for the given domain, if any.
+func (c *DialerCache) get(domain string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, found := c.entries[domain]
+	if !found || !c.Clock.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return slices.Clone(entry.addrs), true
+}
+
+// put caches the addresses for the given domain.
+func (c *DialerCache) put(domain string, addrs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.Clock.Now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[domain] = dialerCacheEntry{
+		addrs:   slices.Clone(addrs),
+		expires: now.Add(c.TTL),
+	}
+}
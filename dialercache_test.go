@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/require"
+)
+
+// newCountingDialer returns a [*Dialer] whose resolver counts the lookups.
+func newCountingDialer(lookups *int, lookupErr error) *Dialer {
+	resolver := &netstub.FuncResolver{
+		LookupHostFunc: func(context.Context, string) ([]string, error) {
+			*lookups++
+			if lookupErr != nil {
+				return nil, lookupErr
+			}
+			return []string{"203.0.113.1"}, nil
+		},
+	}
+	return NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return &netstub.FuncConn{}, nil
+		},
+	}, resolver)
+}
+
+func TestDialerCacheAvoidsRepeatedLookups(t *testing.T) {
+	var lookups int
+	dialer := newCountingDialer(&lookups, nil)
+	dialer.Cache = NewDialerCache(time.Hour)
+	for range 3 {
+		_, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, lookups)
+}
+
+func TestDialerCacheDisabledByDefault(t *testing.T) {
+	var lookups int
+	dialer := newCountingDialer(&lookups, nil)
+	for range 3 {
+		_, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, lookups)
+}
+
+func TestDialerCacheDoesNotCacheFailures(t *testing.T) {
+	var lookups int
+	expectedErr := errors.New("lookup failed")
+	dialer := newCountingDialer(&lookups, expectedErr)
+	dialer.Cache = NewDialerCache(time.Hour)
+	for range 2 {
+		_, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+		require.ErrorIs(t, err, expectedErr)
+	}
+	require.Equal(t, 2, lookups)
+}
+
+func TestDialerCacheExpiration(t *testing.T) {
+	cache := NewDialerCache(0)
+	cache.put("example.com", []string{"203.0.113.1"})
+	_, found := cache.get("example.com")
+	require.False(t, found)
+
+	// make sure we purge expired entries when adding new entries
+	cache.TTL = time.Hour
+	cache.put("example.org", []string{"203.0.113.2"})
+	require.Len(t, cache.entries, 1)
+	addrs, found := cache.get("example.org")
+	require.True(t, found)
+	require.Equal(t, []string{"203.0.113.2"}, addrs)
+}
+
+func TestDialerCacheSimulatedClock(t *testing.T) {
+	clock := NewSimulatedClock(time.Now())
+	cache := NewDialerCache(time.Minute)
+	cache.Clock = clock
+	cache.put("example.com", []string{"203.0.113.1"})
+
+	clock.Advance(time.Minute - time.Second)
+	_, found := cache.get("example.com")
+	require.True(t, found)
+
+	clock.Advance(time.Second)
+	_, found = cache.get("example.com")
+	require.False(t, found)
+}
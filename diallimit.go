@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// DialLimiter limits the dials performed by one or more [*Dialer].
+//
+// Share the same [*DialLimiter] across [*Dialer] instances to enforce
+// global limits for the whole measurement.
+//
+// Construct using [NewDialLimiter].
+type DialLimiter struct {
+	// Backoff is the OPTIONAL time to wait before dialing again an
+	// address after a failed dial. When zero, we do not wait.
+	Backoff time.Duration
+
+	// RateLimiter OPTIONALLY limits the number of dials per second.
+	RateLimiter *RateLimiter
+
+	// Clock is the [Clock] to use for the backoff.
+	//
+	// Set by [NewDialLimiter] to [RealClock].
+	Clock Clock
+
+	// mu provides mutual exclusion for notBefore.
+	mu sync.Mutex
+
+	// notBefore maps addresses to the time we can dial them again. We evict
+	// the expired entries when inserting, so that the map does not grow
+	// without bounds when dialing many failing addresses.
+	notBefore map[string]time.Time
+
+	// sem limits the number of concurrent dials or is nil.
+	sem chan struct{}
+}
+
+// NewDialLimiter creates a new [*DialLimiter] allowing at most maxConcurrent
+// concurrent dials. A zero or negative value means no concurrency limit.
+func NewDialLimiter(maxConcurrent int) *DialLimiter {
+	dl := &DialLimiter{Clock: RealClock{}, notBefore: map[string]time.Time{}}
+	if maxConcurrent > 0 {
+		dl.sem = make(chan struct{}, maxConcurrent)
+	}
+	return dl
+}
+
+// acquire blocks until we are allowed to dial the given address.
+//
+// On success, the caller MUST call release when done dialing.
+func (dl *DialLimiter) acquire(ctx context.Context, address string) error {
+	// 1. honour the per-destination backoff
+	if err := dl.waitBackoff(ctx, address); err != nil {
+		return err
+	}
+
+	// 2. honour the rate limit
+	if dl.RateLimiter != nil {
+		if err := dl.RateLimiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	// 3. honour the concurrency limit
+	if dl.sem != nil {
+		select {
+		case dl.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// release signals that we are done dialing the given address.
+func (dl *DialLimiter) release(address string, err error) {
+	if dl.sem != nil {
+		<-dl.sem
+	}
+	dl.mu.Lock()
+	switch {
+	case err != nil && dl.Backoff > 0:
+		now := dl.Clock.Now()
+		maps.DeleteFunc(dl.notBefore, func(_ string, deadline time.Time) bool {
+			return !deadline.After(now)
+		})
+		dl.notBefore[address] = now.Add(dl.Backoff)
+	default:
+		delete(dl.notBefore, address)
+	}
+	dl.mu.Unlock()
+}
+
+// waitBackoff waits until the backoff for the given address expires.
+func (dl *DialLimiter) waitBackoff(ctx context.Context, address string) error {
+	dl.mu.Lock()
+	delay := dl.notBefore[address].Sub(dl.Clock.Now())
+	dl.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := dl.Clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
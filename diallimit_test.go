@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialLimiterMaxConcurrent(t *testing.T) {
+	// create a dialer blocking until we unblock it
+	var (
+		active    atomic.Int64
+		maxActive atomic.Int64
+	)
+	entered := make(chan struct{}, 8)
+	unblock := make(chan struct{})
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			value := active.Add(1)
+			defer active.Add(-1)
+			for {
+				prev := maxActive.Load()
+				if value <= prev || maxActive.CompareAndSwap(prev, value) {
+					break
+				}
+			}
+			entered <- struct{}{}
+			<-unblock
+			return &netstub.FuncConn{}, nil
+		},
+	}, &netstub.FuncResolver{})
+	dialer.Limiter = NewDialLimiter(2)
+
+	wg := &sync.WaitGroup{}
+	for range 8 {
+		wg.Go(func() {
+			_, err := dialer.DialContext(context.Background(), "tcp", "203.0.113.7:80")
+			assert.NoError(t, err)
+		})
+	}
+
+	// wait for the limit to be reached and then unblock all the dials
+	<-entered
+	<-entered
+	close(unblock)
+	wg.Wait()
+
+	require.Equal(t, int64(2), maxActive.Load())
+}
+
+func TestDialLimiterMaxConcurrentCanceled(t *testing.T) {
+	limiter := NewDialLimiter(1)
+	require.NoError(t, limiter.acquire(context.Background(), "203.0.113.7:80"))
+	defer limiter.release("203.0.113.7:80", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limiter.acquire(ctx, "203.0.113.8:80"), context.DeadlineExceeded)
+}
+
+func TestDialLimiterRateLimiter(t *testing.T) {
+	var count int
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			count++
+			return &netstub.FuncConn{}, nil
+		},
+	}, &netstub.FuncResolver{})
+	dialer.Limiter = NewDialLimiter(0)
+	dialer.Limiter.RateLimiter = NewRateLimiter(0.001, 1)
+
+	_, err := dialer.DialContext(context.Background(), "tcp", "203.0.113.7:80")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = dialer.DialContext(ctx, "tcp", "203.0.113.7:80")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, count)
+}
+
+func TestDialLimiterBackoff(t *testing.T) {
+	expectedErr := errors.New("dial failed")
+	var count int
+	dialer := NewDialer(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			count++
+			return nil, expectedErr
+		},
+	}, &netstub.FuncResolver{})
+	dialer.Limiter = NewDialLimiter(0)
+	dialer.Limiter.Backoff = time.Hour
+
+	// the first dial fails and starts the backoff
+	_, err := dialer.DialContext(context.Background(), "tcp", "203.0.113.7:80")
+	require.ErrorIs(t, err, expectedErr)
+
+	// the second dial to the same address waits for the backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = dialer.DialContext(ctx, "tcp", "203.0.113.7:80")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// a dial to another address is not affected
+	_, err = dialer.DialContext(context.Background(), "tcp", "203.0.113.8:80")
+	require.ErrorIs(t, err, expectedErr)
+	require.Equal(t, 2, count)
+}
+
+func TestDialLimiterBackoffClearedOnSuccess(t *testing.T) {
+	limiter := NewDialLimiter(0)
+	limiter.Backoff = time.Hour
+	limiter.release("203.0.113.7:80", errors.New("dial failed"))
+	require.Len(t, limiter.notBefore, 1)
+	limiter.release("203.0.113.7:80", nil)
+	require.Empty(t, limiter.notBefore)
+}
+
+func TestDialLimiterBackoffEvictsExpiredEntries(t *testing.T) {
+	clock := NewSimulatedClock(time.Now())
+	limiter := NewDialLimiter(0)
+	limiter.Backoff = time.Minute
+	limiter.Clock = clock
+	dialErr := errors.New("dial failed")
+
+	limiter.release("203.0.113.7:80", dialErr)
+	limiter.release("203.0.113.8:80", dialErr)
+	require.Len(t, limiter.notBefore, 2)
+
+	// inserting after the backoff expired evicts the stale entries
+	clock.Advance(time.Minute)
+	limiter.release("203.0.113.9:80", dialErr)
+	require.Len(t, limiter.notBefore, 1)
+	require.Contains(t, limiter.notBefore, "203.0.113.9:80")
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+)
+
+// NewDNSError wraps a lookup error for the given name into a [*net.DNSError],
+// which is what [*Resolver] returns, so that callers can branch on the outcome
+// class using IsNotFound, IsTemporary, and IsTimeout without string matching.
+//
+// The [*net.DNSError] unwraps to err, hence [errors.Is] still distinguishes
+// NXDOMAIN ([dnscodec.ErrNoName]), NODATA ([dnscodec.ErrNoData]), and SERVFAIL
+// ([dnscodec.ErrServerTemporarilyMisbehaving]). Like the standard library, we
+// consider both NXDOMAIN and NODATA as not found. We return err unchanged
+// when it already is a [*net.DNSError].
+//
+// This function panics if err is nil.
+func NewDNSError(name string, err error) *net.DNSError {
+	runtimex.Assert(err != nil)
+	if derr, ok := err.(*net.DNSError); ok {
+		return derr
+	}
+	timeout := errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded)
+	return &net.DNSError{
+		UnwrapErr:   err,
+		Err:         err.Error(),
+		Name:        name,
+		IsTimeout:   timeout,
+		IsTemporary: timeout || errors.Is(err, dnscodec.ErrServerTemporarilyMisbehaving),
+		IsNotFound:  errors.Is(err, dnscodec.ErrNoName) || errors.Is(err, dnscodec.ErrNoData),
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDNSError(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// err is the error to wrap.
+		err error
+
+		// wantNotFound is the expected IsNotFound value.
+		wantNotFound bool
+
+		// wantTemporary is the expected IsTemporary value.
+		wantTemporary bool
+
+		// wantTimeout is the expected IsTimeout value.
+		wantTimeout bool
+	}
+
+	tests := []testCase{
+		{
+			name:         "NXDOMAIN",
+			err:          dnscodec.ErrNoName,
+			wantNotFound: true,
+		},
+
+		{
+			name:         "NODATA",
+			err:          dnscodec.ErrNoData,
+			wantNotFound: true,
+		},
+
+		{
+			name:          "SERVFAIL",
+			err:           fmt.Errorf("wrapped: %w", dnscodec.ErrServerTemporarilyMisbehaving),
+			wantTemporary: true,
+		},
+
+		{
+			name: "other rcode",
+			err:  dnscodec.ErrServerMisbehaving,
+		},
+
+		{
+			name:          "timeout",
+			err:           errors.Join(errors.New("mocked error"), context.DeadlineExceeded),
+			wantTemporary: true,
+			wantTimeout:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			derr := NewDNSError("example.com", tc.err)
+			require.ErrorIs(t, derr, tc.err)
+			assert.Equal(t, "example.com", derr.Name)
+			assert.Equal(t, "lookup example.com: "+tc.err.Error(), derr.Error())
+			assert.Equal(t, tc.wantNotFound, derr.IsNotFound)
+			assert.Equal(t, tc.wantTemporary, derr.IsTemporary)
+			assert.Equal(t, tc.wantTimeout, derr.IsTimeout)
+		})
+	}
+}
+
+func TestNewDNSErrorWithDNSError(t *testing.T) {
+	expected := &net.DNSError{Err: "mocked error", Name: "example.com"}
+	assert.Same(t, expected, NewDNSError("www.example.com", expected))
+}
+
+func TestNewDNSErrorPanicsWithNilError(t *testing.T) {
+	assert.Panics(t, func() {
+		NewDNSError("example.com", nil)
+	})
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DNSOverStreamTransport implements [DNSTransport] and [DNSMsgTransport] using
+// the two-byte length framing defined by RFC 1035 over a caller-provided
+// [io.ReadWriteCloser] (e.g., an SSH channel, a custom tunnel, or a pluggable
+// transport), which decouples the DNS framing from dialing.
+//
+// We perform exchanges sequentially, so that we can reuse the stream for
+// many queries. When the context is done before an exchange completes, we
+// close the stream to interrupt I/O, since an arbitrary stream may not
+// support deadlines, after which the transport is no longer usable.
+//
+// A [*DNSOverStreamTransport] is safe for concurrent use.
+//
+// Construct using [NewDNSOverStreamTransport].
+type DNSOverStreamTransport struct {
+	// Stream is the stream to use.
+	//
+	// Set by [NewDNSOverStreamTransport] to the user-provided value.
+	Stream io.ReadWriteCloser
+
+	// Validator is the OPTIONAL [ResponseValidator] that Exchange uses to
+	// validate the response. When nil, we use [dnscodec.ParseResponse].
+	Validator ResponseValidator
+
+	// mu serializes the exchanges.
+	mu sync.Mutex
+}
+
+// NewDNSOverStreamTransport creates a new [*DNSOverStreamTransport].
+func NewDNSOverStreamTransport(stream io.ReadWriteCloser) *DNSOverStreamTransport {
+	return &DNSOverStreamTransport{Stream: stream}
+}
+
+// Ensure that [*DNSOverStreamTransport] implements [DNSExtendedTransport], [DNSMsgTransport], and [io.Closer].
+var (
+	_ DNSExtendedTransport = &DNSOverStreamTransport{}
+	_ DNSMsgTransport      = &DNSOverStreamTransport{}
+	_ io.Closer            = &DNSOverStreamTransport{}
+)
+
+// Exchange implements [DNSTransport].
+//
+// We use [dnscodec.QueryMaxResponseSizeTCP] as the maximum response size.
+func (dt *DNSOverStreamTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return dt.exchange(ctx, query, nil)
+}
+
+// ExchangeExtended implements [DNSExtendedTransport].
+//
+// We obtain the endpoint from the RemoteAddr method and the TLS connection
+// state from the ConnectionState method of the stream, if available, and we
+// set the network to "dot" when using TLS, to "tcp" when the remote address
+// is a TCP address, and to "stream" otherwise.
+func (dt *DNSOverStreamTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	// 1. describe the stream
+	m := newDNSMeasurement("stream", netip.AddrPort{}, query)
+	if stream, ok := dt.Stream.(interface{ RemoteAddr() net.Addr }); ok {
+		if addr, ok := stream.RemoteAddr().(*net.TCPAddr); ok {
+			m.Network = "tcp"
+			m.Endpoint = addr.AddrPort()
+		}
+	}
+	if stream, ok := dt.Stream.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		state := stream.ConnectionState()
+		m.Network = "dot"
+		m.TLS = &state
+	}
+
+	// 2. perform the exchange
+	m.complete(dt.exchange(ctx, query, m))
+	return m.Response, m
+}
+
+// exchange implements Exchange and ExchangeExtended, saving the raw messages
+// into the given [*DNSMeasurement] unless it is nil.
+func (dt *DNSOverStreamTransport) exchange(
+	ctx context.Context, query *dnscodec.Query, m *DNSMeasurement) (*dnscodec.Response, error) {
+	query = query.Clone()
+	query.MaxSize = dnscodec.QueryMaxResponseSizeTCP
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, err
+	}
+	respMsg, err := dt.exchangeMsg(ctx, queryMsg, m)
+	if err != nil {
+		return nil, err
+	}
+	return validateResponse(dt.Validator, queryMsg, respMsg)
+}
+
+// ExchangeMsg implements [DNSMsgTransport].
+//
+// We ensure that the response matches the query but do not map the
+// response code to errors.
+func (dt *DNSOverStreamTransport) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	respMsg, err := dt.exchangeMsg(ctx, queryMsg, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dnscodec.ValidateResponseForQuery(queryMsg, respMsg); err != nil {
+		return nil, err
+	}
+	return respMsg, nil
+}
+
+// exchangeMsg sends the query message and receives the response message
+// without making sure that the response matches the query, saving the raw
+// messages into the given [*DNSMeasurement] unless it is nil.
+func (dt *DNSOverStreamTransport) exchangeMsg(
+	ctx context.Context, queryMsg *dns.Msg, m *DNSMeasurement) (*dns.Msg, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	// 1. make sure the context interrupts I/O
+	stop := context.AfterFunc(ctx, func() { dt.Stream.Close() })
+	defer stop()
+
+	// 2. send the query and receive the response
+	respMsg, err := dnsStreamRoundTrip(dt.Stream, queryMsg, m)
+	if err != nil {
+		return nil, dnsOverStreamError(ctx, err)
+	}
+	return respMsg, nil
+}
+
+// Close closes the underlying stream.
+func (dt *DNSOverStreamTransport) Close() error {
+	return dt.Stream.Close()
+}
+
+// dnsOverStreamError returns the context error when the context is done, since
+// closing the stream causes I/O to fail with less meaningful errors.
+func dnsOverStreamError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dnsOverStreamPipe hides the [net.Conn] methods of a pipe except the
+// [io.ReadWriteCloser] ones, to simulate an arbitrary stream.
+type dnsOverStreamPipe struct {
+	io.ReadWriteCloser
+}
+
+// newDNSOverStreamServer returns a stream connected to a server answering the
+// queries using the given function until the stream is closed.
+func newDNSOverStreamServer(t *testing.T, respond func(queryMsg *dns.Msg) *dns.Msg) io.ReadWriteCloser {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		for {
+			queryMsg, _, err := dnsStreamReadMsg(server)
+			if err != nil {
+				return
+			}
+			respMsg := respond(queryMsg)
+			if respMsg == nil {
+				continue
+			}
+			if _, err := dnsStreamWriteMsg(server, respMsg); err != nil {
+				return
+			}
+		}
+	}()
+	return dnsOverStreamPipe{client}
+}
+
+// dnsOverStreamAnswer answers with an A record.
+func dnsOverStreamAnswer(queryMsg *dns.Msg) *dns.Msg {
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	respMsg.Answer = append(respMsg.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: queryMsg.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.IPv4(93, 184, 216, 34),
+	})
+	return respMsg
+}
+
+func TestDNSOverStreamTransportReusesStream(t *testing.T) {
+	var queries []*dns.Msg
+	stream := newDNSOverStreamServer(t, func(queryMsg *dns.Msg) *dns.Msg {
+		queries = append(queries, queryMsg)
+		return dnsOverStreamAnswer(queryMsg)
+	})
+	txp := NewDNSOverStreamTransport(stream)
+	defer txp.Close()
+
+	// 1. use Exchange and make sure we use the TCP response size
+	resp, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+
+	// 2. use ExchangeMsg over the same stream
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.org.", dns.TypeA)
+	respMsg, err := txp.ExchangeMsg(context.Background(), queryMsg)
+	require.NoError(t, err)
+	assert.Len(t, respMsg.Answer, 1)
+
+	require.Len(t, queries, 2)
+	require.NotNil(t, queries[0].IsEdns0())
+	assert.Equal(t, uint16(dnscodec.QueryMaxResponseSizeTCP), queries[0].IsEdns0().UDPSize())
+	assert.Nil(t, queries[1].IsEdns0())
+}
+
+func TestDNSOverStreamTransportRcode(t *testing.T) {
+	stream := newDNSOverStreamServer(t, func(queryMsg *dns.Msg) *dns.Msg {
+		respMsg := new(dns.Msg)
+		respMsg.SetRcode(queryMsg, dns.RcodeNameError)
+		return respMsg
+	})
+	txp := NewDNSOverStreamTransport(stream)
+	defer txp.Close()
+
+	// ExchangeMsg does not map the response code to errors
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	respMsg, err := txp.ExchangeMsg(context.Background(), queryMsg)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, respMsg.Rcode)
+
+	// Exchange does
+	_, err = txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+}
+
+func TestDNSOverStreamTransportMismatchedResponse(t *testing.T) {
+	stream := newDNSOverStreamServer(t, func(queryMsg *dns.Msg) *dns.Msg {
+		respMsg := dnsOverStreamAnswer(queryMsg)
+		respMsg.Id++
+		return respMsg
+	})
+	txp := NewDNSOverStreamTransport(stream)
+	defer txp.Close()
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	respMsg, err := txp.ExchangeMsg(context.Background(), queryMsg)
+	require.ErrorIs(t, err, dnscodec.ErrInvalidResponse)
+	assert.Nil(t, respMsg)
+}
+
+func TestDNSOverStreamTransportContextDone(t *testing.T) {
+	stream := newDNSOverStreamServer(t, func(queryMsg *dns.Msg) *dns.Msg {
+		return nil // never respond
+	})
+	txp := NewDNSOverStreamTransport(stream)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	respMsg, err := txp.ExchangeMsg(ctx, queryMsg)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, respMsg)
+
+	// the stream is closed and the transport is no longer usable
+	_, err = txp.ExchangeMsg(context.Background(), queryMsg)
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
@@ -10,8 +10,10 @@ package minest
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net"
 	"net/netip"
+	"slices"
 	"time"
 
 	"github.com/bassosimone/dnscodec"
@@ -42,6 +44,40 @@ type DNSOverUDPTransport struct {
 
 	// ObserveRawResponse is an optional hook called with a copy of the raw DNS response.
 	ObserveRawResponse func([]byte)
+
+	// BufferPool is the OPTIONAL [*BufferPool] from which we obtain the buffers
+	// used to send queries and receive responses. When nil, we allocate new
+	// buffers for each exchange.
+	BufferPool *BufferPool
+
+	// MaxResponseSize OPTIONALLY overrides the maximum response size we
+	// advertise using EDNS(0). When zero, we use [dnscodec.QueryMaxResponseSizeUDP].
+	MaxResponseSize uint16
+
+	// RecvBufferSize OPTIONALLY overrides the size of the buffer used to
+	// receive responses. When zero, we use the advertised maximum response
+	// size. Using a larger buffer allows detecting servers sending responses
+	// larger than what we advertised.
+	RecvBufferSize int
+
+	// DisableEDNS OPTIONALLY omits the EDNS(0) OPT record from queries, which
+	// allows testing servers that mishandle EDNS(0) and EDNS-dependent blocking.
+	// When set, we ignore MaxResponseSize and the query flags requiring EDNS(0).
+	DisableEDNS bool
+
+	// Validator is the OPTIONAL [ResponseValidator] that Exchange uses to
+	// validate the response. When nil, we use [dnscodec.ParseResponse].
+	Validator ResponseValidator
+
+	// Linger OPTIONALLY keeps the socket open for the given duration after
+	// Exchange receives the response, to detect late responses, which are
+	// typical of injection and duplication. We pass the late responses to
+	// ObserveLateResponse. Note that lingering delays returning from Exchange.
+	Linger time.Duration
+
+	// ObserveLateResponse is an optional hook called with a copy of each raw
+	// DNS response received while lingering.
+	ObserveLateResponse func([]byte)
 }
 
 // NewDNSOverUDPTransport creates a new [*DNSOverUDPTransport].
@@ -52,8 +88,8 @@ func NewDNSOverUDPTransport(dialer NetDialer, endpoint netip.AddrPort) *DNSOverU
 	}
 }
 
-// Ensure that [*DNSOverUDPTransport] implements [DNSTransport].
-var _ DNSTransport = &DNSOverUDPTransport{}
+// Ensure that [*DNSOverUDPTransport] implements [DNSExtendedTransport].
+var _ DNSExtendedTransport = &DNSOverUDPTransport{}
 
 // Dial creates a [net.Conn] with the configured endpoint.
 //
@@ -74,16 +110,59 @@ func (dt *DNSOverUDPTransport) Exchange(ctx context.Context, query *dnscodec.Que
 	// 2. Use a single connection for request, which is what the standard library
 	// does as well for and is more robust in terms of residual censorship.
 	//
-	// Make sure we react to context being canceled early.
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	go func() {
-		defer conn.Close()
-		<-ctx.Done()
-	}()
+	// Make sure we react to context being canceled early without
+	// spawning a watchdog goroutine for each exchange.
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// 3. defer to ExchangeWithConn.
-	return dt.ExchangeWithConn(ctx, conn, query)
+	resp, err := dt.ExchangeWithConn(ctx, conn, query)
+
+	// 4. possibly linger unless I/O failed.
+	var nerr net.Error
+	if dt.Linger > 0 && !errors.As(err, &nerr) {
+		dt.linger(ctx, conn)
+	}
+	return resp, err
+}
+
+// linger reads late responses until the Linger window or the context expire.
+func (dt *DNSOverUDPTransport) linger(ctx context.Context, conn net.Conn) {
+	deadline := time.Now().Add(dt.Linger)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	_, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	for {
+		count, err := conn.Read(*buff)
+		if err != nil {
+			return
+		}
+		if dt.ObserveLateResponse != nil {
+			dt.ObserveLateResponse(bytes.Clone((*buff)[:count]))
+		}
+	}
+}
+
+// ExchangeExtended is like Exchange but also returns a [*DNSMeasurement].
+//
+// We perform the exchange using a copy of the transport that chains to
+// the ObserveRawQuery, ObserveRawResponse, and ObserveLateResponse hooks, if any.
+func (dt *DNSOverUDPTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	m := newDNSMeasurement("udp", dt.Endpoint, query)
+	clone := *dt
+	clone.ObserveRawQuery = m.observeRawQuery(dt.ObserveRawQuery)
+	clone.ObserveRawResponse = m.observeRawResponse(dt.ObserveRawResponse)
+	clone.ObserveLateResponse = m.observeLateResponse(dt.ObserveLateResponse)
+	m.complete(clone.Exchange(ctx, query))
+	return m.Response, m
 }
 
 // SendQuery sends a [*dnscodec.Query] using a [net.Conn].
@@ -98,25 +177,73 @@ func (dt *DNSOverUDPTransport) SendQuery(ctx context.Context, conn net.Conn, que
 	}
 
 	// 2. Mutate and serialize the query.
-	query = query.Clone()
-	query.MaxSize = dnscodec.QueryMaxResponseSizeUDP
-	queryMsg, err := query.NewMsg()
+	maxSize, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	queryMsg, rawQuery, err := dnsOverUDPPackQuery(query, maxSize, dt.DisableEDNS, *buff)
 	if err != nil {
 		return nil, err
 	}
-	rawQuery, err := queryMsg.Pack()
-	if err != nil {
-		return nil, err
+
+	// 3. Send the query.
+	if err := dt.sendRawQuery(conn, rawQuery); err != nil {
+		return nil, dnsOverUDPError(ctx, err)
 	}
+	return queryMsg, nil
+}
+
+// sendRawQuery possibly observes and then sends a raw query.
+func (dt *DNSOverUDPTransport) sendRawQuery(conn net.Conn, rawQuery []byte) error {
 	if dt.ObserveRawQuery != nil {
 		dt.ObserveRawQuery(bytes.Clone(rawQuery))
 	}
+	_, err := conn.Write(rawQuery)
+	return err
+}
 
-	// 3. Send the query.
-	if _, err := conn.Write(rawQuery); err != nil {
-		return nil, err
+// dnsOverUDPError returns the context error when the context is done, since
+// we close the socket when the context is done and I/O then fails with
+// a closed socket error rather than with a timeout error.
+func dnsOverUDPError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	return queryMsg, nil
+	return err
+}
+
+// dnsOverUDPSizes returns the maximum response size to advertise and the
+// receive buffer size given the possibly-zero user-configured values.
+func dnsOverUDPSizes(maxSize uint16, recvSize int) (uint16, int) {
+	if maxSize == 0 {
+		maxSize = dnscodec.QueryMaxResponseSizeUDP
+	}
+	if recvSize <= 0 {
+		recvSize = int(maxSize)
+	}
+	return maxSize, recvSize
+}
+
+// dnsOverUDPPackQuery mutates the query for UDP using the given maximum response
+// size, possibly removing the OPT record, and serializes it, using buff as the
+// backing storage when large enough.
+func dnsOverUDPPackQuery(query *dnscodec.Query,
+	maxSize uint16, disableEDNS bool, buff []byte) (*dns.Msg, []byte, error) {
+	query = query.Clone()
+	query.MaxSize = maxSize
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, nil, err
+	}
+	if disableEDNS {
+		queryMsg.Extra = slices.DeleteFunc(queryMsg.Extra, func(rr dns.RR) bool {
+			return rr.Header().Rrtype == dns.TypeOPT
+		})
+	}
+	rawQuery, err := queryMsg.PackBuffer(buff)
+	if err != nil {
+		return nil, nil, err
+	}
+	return queryMsg, rawQuery, nil
 }
 
 // RecvResponse receives a [*dnscodec.Response] using a [net.Conn].
@@ -131,23 +258,32 @@ func (dt *DNSOverUDPTransport) RecvResponse(
 		defer conn.SetDeadline(time.Time{})
 	}
 
-	// 4. Read the response message.
-	buff := make([]byte, dnscodec.QueryMaxResponseSizeUDP)
-	count, err := conn.Read(buff)
+	// 2. Read and parse the response message.
+	respMsg, err := dt.recvMsg(conn)
+	if err != nil {
+		return nil, dnsOverUDPError(ctx, err)
+	}
+	return validateResponse(dt.Validator, queryMsg, respMsg)
+}
+
+// recvMsg reads a raw response, possibly observes it, and unpacks it.
+func (dt *DNSOverUDPTransport) recvMsg(conn net.Conn) (*dns.Msg, error) {
+	_, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	count, err := conn.Read(*buff)
 	if err != nil {
 		return nil, err
 	}
-	rawResp := buff[:count]
+	rawResp := (*buff)[:count]
 	if dt.ObserveRawResponse != nil {
 		dt.ObserveRawResponse(bytes.Clone(rawResp))
 	}
-
-	// 5. Parse the response and possibly log that we received it.
 	respMsg := new(dns.Msg)
 	if err := respMsg.Unpack(rawResp); err != nil {
 		return nil, err
 	}
-	return dnscodec.ParseResponse(queryMsg, respMsg)
+	return respMsg, nil
 }
 
 // ExchangeWithConn sends a [*dnscodec.Query] and receives a [*dnscodec.Response].
@@ -161,3 +297,48 @@ func (dt *DNSOverUDPTransport) ExchangeWithConn(ctx context.Context,
 	}
 	return dt.RecvResponse(ctx, conn, queryMsg)
 }
+
+// ExchangeMsg sends a raw query message and receives the raw response message.
+//
+// Unlike Exchange, we send the query message as is, which allows using flags
+// and EDNS(0) options that [*dnscodec.Query] cannot represent, and we do not
+// map the response code to errors. We only ensure that the response matches
+// the query. MaxResponseSize and DisableEDNS do not apply to this method.
+func (dt *DNSOverUDPTransport) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	// 1. create the connection
+	conn, err := dt.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. make sure we react to context being canceled early and
+	// use the context deadline to limit the lifetime.
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// 3. serialize and send the query
+	_, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	rawQuery, err := queryMsg.PackBuffer(*buff)
+	if err != nil {
+		return nil, err
+	}
+	if err := dt.sendRawQuery(conn, rawQuery); err != nil {
+		return nil, dnsOverUDPError(ctx, err)
+	}
+
+	// 4. receive the response and make sure it matches the query
+	respMsg, err := dt.recvMsg(conn)
+	if err != nil {
+		return nil, dnsOverUDPError(ctx, err)
+	}
+	if _, err := dnscodec.ValidateResponseForQuery(queryMsg, respMsg); err != nil {
+		return nil, err
+	}
+	return respMsg, nil
+}
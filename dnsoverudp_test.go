@@ -3,12 +3,15 @@
 package minest
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"net"
 	"net/netip"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/netstub"
@@ -17,7 +20,7 @@ import (
 )
 
 // buildRawResponseFromQuery packs a valid DNS response from a raw DNS query.
-func buildRawResponseFromQuery(t *testing.T, rawQuery []byte) []byte {
+func buildRawResponseFromQuery(t testing.TB, rawQuery []byte) []byte {
 	t.Helper()
 
 	queryMsg := &dns.Msg{}
@@ -304,3 +307,321 @@ func TestDNSOverUDPTransportExchangeWithConnErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestDNSOverUDPTransportQueryOptions(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// maxSize is the configured MaxResponseSize.
+		maxSize uint16
+
+		// recvSize is the configured RecvBufferSize.
+		recvSize int
+
+		// disableEDNS is the configured DisableEDNS.
+		disableEDNS bool
+
+		// wantMaxSize is the expected advertised EDNS(0) size or zero
+		// when we expect the query to not include EDNS(0).
+		wantMaxSize uint16
+
+		// wantRecvSize is the expected receive buffer size.
+		wantRecvSize int
+	}
+
+	tests := []testCase{
+		{
+			name:         "defaults",
+			wantMaxSize:  dnscodec.QueryMaxResponseSizeUDP,
+			wantRecvSize: dnscodec.QueryMaxResponseSizeUDP,
+		},
+
+		{
+			name:         "custom maximum response size",
+			maxSize:      512,
+			wantMaxSize:  512,
+			wantRecvSize: 512,
+		},
+
+		{
+			name:         "larger receive buffer",
+			maxSize:      512,
+			recvSize:     65535,
+			wantMaxSize:  512,
+			wantRecvSize: 65535,
+		},
+
+		{
+			name:         "EDNS disabled",
+			disableEDNS:  true,
+			wantMaxSize:  0,
+			wantRecvSize: dnscodec.QueryMaxResponseSizeUDP,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				advertised uint16
+				recvSize   int
+			)
+			conn := &netstub.FuncConn{
+				WriteFunc: func(b []byte) (int, error) {
+					queryMsg := &dns.Msg{}
+					require.NoError(t, queryMsg.Unpack(b))
+					if opt := queryMsg.IsEdns0(); opt != nil {
+						advertised = opt.UDPSize()
+					}
+					return len(b), nil
+				},
+				ReadFunc: func(b []byte) (int, error) {
+					recvSize = len(b)
+					return 0, errors.New("read failed")
+				},
+			}
+			transport := NewDNSOverUDPTransport(&netstub.FuncDialer{}, netip.MustParseAddrPort("127.0.0.1:53"))
+			transport.MaxResponseSize = tc.maxSize
+			transport.RecvBufferSize = tc.recvSize
+			transport.DisableEDNS = tc.disableEDNS
+
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			query.Flags |= dnscodec.QueryFlagDNSSec | dnscodec.QueryFlagBlockLengthPadding
+			_, err := transport.ExchangeWithConn(context.Background(), conn, query)
+			require.Error(t, err)
+			require.Equal(t, tc.wantMaxSize, advertised)
+			require.Equal(t, tc.wantRecvSize, recvSize)
+		})
+	}
+}
+
+func TestDNSOverUDPTransportExchangeMsg(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// respond builds the raw response from the raw query.
+		respond func(t *testing.T, rawQuery []byte) []byte
+
+		// wantErr is the error to match, if not nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name: "successful exchange",
+			respond: func(t *testing.T, rawQuery []byte) []byte {
+				return buildRawResponseFromQuery(t, rawQuery)
+			},
+		},
+
+		{
+			name: "SERVFAIL is not an error",
+			respond: func(t *testing.T, rawQuery []byte) []byte {
+				queryMsg := new(dns.Msg)
+				require.NoError(t, queryMsg.Unpack(rawQuery))
+				respMsg := new(dns.Msg)
+				respMsg.SetRcode(queryMsg, dns.RcodeServerFailure)
+				rawResp, err := respMsg.Pack()
+				require.NoError(t, err)
+				return rawResp
+			},
+		},
+
+		{
+			name: "response not matching the query",
+			respond: func(t *testing.T, rawQuery []byte) []byte {
+				rawResp := buildRawResponseFromQuery(t, rawQuery)
+				rawResp[0] ^= 0xff
+				return rawResp
+			},
+			wantErr: dnscodec.ErrInvalidResponse,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var rawQuery []byte
+			conn := &netstub.FuncConn{
+				WriteFunc: func(b []byte) (int, error) {
+					rawQuery = bytes.Clone(b)
+					return len(b), nil
+				},
+				ReadFunc: func(b []byte) (int, error) {
+					return copy(b, tc.respond(t, rawQuery)), nil
+				},
+				CloseFunc: func() error {
+					return nil
+				},
+			}
+			txp := NewDNSOverUDPTransport(&netstub.FuncDialer{
+				DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+					return conn, nil
+				},
+			}, netip.MustParseAddrPort("127.0.0.1:53"))
+
+			queryMsg := new(dns.Msg)
+			queryMsg.SetQuestion("example.com.", dns.TypeA)
+			respMsg, err := txp.ExchangeMsg(context.Background(), queryMsg)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, queryMsg.Id, respMsg.Id)
+		})
+	}
+}
+
+func TestDNSOverUDPTransportLinger(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{
+		PacketConn: pconn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+			answerWithA(w, queryMsg)
+			answerWithA(w, queryMsg)
+		}),
+	})
+	endpoint := netip.MustParseAddrPort(pconn.LocalAddr().String())
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// linger is the linger window.
+		linger time.Duration
+
+		// wantLate is the expected number of late responses.
+		wantLate int
+	}
+
+	tests := []testCase{
+		{name: "without linger", linger: 0, wantLate: 0},
+		{name: "with linger", linger: 250 * time.Millisecond, wantLate: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var observed int
+			txp := NewDNSOverUDPTransport(&net.Dialer{}, endpoint)
+			txp.Linger = tc.linger
+			txp.ObserveLateResponse = func([]byte) { observed++ }
+
+			started := time.Now()
+			resp, m := txp.ExchangeExtended(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+			elapsed := time.Since(started)
+			require.NoError(t, m.Err)
+			require.NotNil(t, resp)
+			require.Equal(t, tc.wantLate, observed)
+			require.Len(t, m.LateResponses, tc.wantLate)
+			require.GreaterOrEqual(t, elapsed, tc.linger)
+			require.Less(t, m.Elapsed, 250*time.Millisecond)
+		})
+	}
+}
+
+func TestDNSOverUDPTransportLingerHonorsContextDeadline(t *testing.T) {
+	var (
+		deadlines []time.Time
+		rawQuery  []byte
+		reads     int
+	)
+	conn := &netstub.FuncConn{
+		WriteFunc: func(b []byte) (int, error) {
+			rawQuery = bytes.Clone(b)
+			return len(b), nil
+		},
+		ReadFunc: func(b []byte) (int, error) {
+			if reads++; reads == 1 {
+				return copy(b, buildRawResponseFromQuery(t, rawQuery)), nil
+			}
+			return 0, os.ErrDeadlineExceeded
+		},
+		CloseFunc: func() error {
+			return nil
+		},
+		SetDeadlineFunc: func(d time.Time) error {
+			deadlines = append(deadlines, d)
+			return nil
+		},
+	}
+	txp := NewDNSOverUDPTransport(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return conn, nil
+		},
+	}, netip.MustParseAddrPort("127.0.0.1:53"))
+	txp.Linger = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+	ctxDeadline, _ := ctx.Deadline()
+	require.Contains(t, deadlines, ctxDeadline)
+	require.Equal(t, 2, reads)
+}
+
+func TestDNSOverUDPTransportTimeout(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	endpoint := netip.MustParseAddrPort(server.LocalAddr().String())
+	txp := NewDNSOverUDPTransport(&net.Dialer{}, endpoint)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.Error(t, err)
+	require.Equal(t, FailureGenericTimeout, ClassifyError(err))
+	require.Nil(t, resp)
+}
+
+func TestDNSOverUDPTransportEndpointWithZone(t *testing.T) {
+	// find the name of the loopback interface to use as the zone
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	zone := ""
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			zone = iface.Name
+			break
+		}
+	}
+	if zone == "" {
+		t.Skip("no loopback interface")
+	}
+
+	// create a server answering a single query over IPv6
+	pconn, err := net.ListenPacket("udp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+	t.Cleanup(func() { pconn.Close() })
+	go func() {
+		buff := make([]byte, 4096)
+		count, client, err := pconn.ReadFrom(buff)
+		if err != nil {
+			return
+		}
+		pconn.WriteTo(buildRawResponseFromQuery(t, buff[:count]), client)
+	}()
+	port := netip.MustParseAddrPort(pconn.LocalAddr().String()).Port()
+	endpoint := netip.AddrPortFrom(netip.MustParseAddr("::1").WithZone(zone), port)
+
+	// make sure the [*Dialer] does not attempt to resolve the zoned address
+	dialer := NewDialer(&net.Dialer{}, &netstub.FuncResolver{
+		LookupHostFunc: func(context.Context, string) ([]string, error) {
+			return nil, errors.New("should not be called")
+		},
+	})
+	txp := NewDNSOverUDPTransport(dialer, endpoint)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	require.Equal(t, []string{"8.8.8.8"}, addrs)
+}
@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DNSOverUDPMuxTransport implements [DNSTransport] for DNS over UDP multiplexing
+// all the outstanding queries over a single socket, to support high-QPS sweeps
+// where using a socket per query would exhaust the ephemeral ports.
+//
+// We match responses to queries using the query ID and the question. When
+// the ID of a query collides with the one of an outstanding query, we replace
+// it with a random ID that is not in use.
+//
+// We lazily create the socket on the first exchange and create a new one
+// if reading from the socket fails. Call Close to close the socket when done.
+//
+// Construct using [NewDNSOverUDPMuxTransport].
+type DNSOverUDPMuxTransport struct {
+	// Dialer is the [NetDialer] to use to create connections.
+	//
+	// Set by [NewDNSOverUDPMuxTransport] to the user-provided value.
+	Dialer NetDialer
+
+	// Endpoint is the server endpoint to use to query.
+	//
+	// Set by [NewDNSOverUDPMuxTransport] to the user-provided value.
+	Endpoint netip.AddrPort
+
+	// ObserveRawQuery is an optional hook called with a copy of the raw DNS query.
+	ObserveRawQuery func([]byte)
+
+	// ObserveRawResponse is an optional hook called with a copy of each raw
+	// DNS response, including responses not matching any outstanding query.
+	ObserveRawResponse func([]byte)
+
+	// BufferPool is the OPTIONAL [*BufferPool] from which we obtain the buffers
+	// used to send queries and receive responses. When nil, we allocate new
+	// buffers for each query and each received datagram.
+	BufferPool *BufferPool
+
+	// MaxResponseSize OPTIONALLY overrides the maximum response size we
+	// advertise using EDNS(0). When zero, we use [dnscodec.QueryMaxResponseSizeUDP].
+	MaxResponseSize uint16
+
+	// RecvBufferSize OPTIONALLY overrides the size of the buffer used to
+	// receive responses. When zero, we use the advertised maximum response
+	// size. Using a larger buffer allows detecting servers sending responses
+	// larger than what we advertised.
+	RecvBufferSize int
+
+	// DisableEDNS OPTIONALLY omits the EDNS(0) OPT record from queries, which
+	// allows testing servers that mishandle EDNS(0) and EDNS-dependent blocking.
+	// When set, we ignore MaxResponseSize and the query flags requiring EDNS(0).
+	DisableEDNS bool
+
+	// Validator is the OPTIONAL [ResponseValidator] that Exchange uses to
+	// validate the response. When nil, we use [dnscodec.ParseResponse].
+	Validator ResponseValidator
+
+	// Rand is the [Rand] to use to replace the IDs already in use.
+	//
+	// Set by [NewDNSOverUDPMuxTransport] to [GlobalRand].
+	Rand Rand
+
+	// closed indicates that Close has been called.
+	closed bool
+
+	// conn is the shared connection or nil.
+	conn net.Conn
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// pending maps query IDs to outstanding queries.
+	pending map[uint16]*dnsOverUDPMuxPending
+}
+
+// dnsOverUDPMuxPending is an outstanding query.
+type dnsOverUDPMuxPending struct {
+	// ch receives the result.
+	ch chan resolverResponse[*dnscodec.Response]
+
+	// queryMsg is the query message.
+	queryMsg *dns.Msg
+
+	// rawResp is a copy of the raw response, set before sending to ch.
+	rawResp []byte
+}
+
+// NewDNSOverUDPMuxTransport creates a new [*DNSOverUDPMuxTransport].
+func NewDNSOverUDPMuxTransport(dialer NetDialer, endpoint netip.AddrPort) *DNSOverUDPMuxTransport {
+	return &DNSOverUDPMuxTransport{
+		Dialer:   dialer,
+		Endpoint: endpoint,
+		Rand:     GlobalRand{},
+		pending:  map[uint16]*dnsOverUDPMuxPending{},
+	}
+}
+
+// Ensure that [*DNSOverUDPMuxTransport] implements [DNSExtendedTransport] and [io.Closer].
+var (
+	_ DNSExtendedTransport = &DNSOverUDPMuxTransport{}
+	_ io.Closer            = &DNSOverUDPMuxTransport{}
+)
+
+// Exchange implements [DNSTransport].
+//
+// We only honor the context for interrupting the exchange, since the
+// socket is shared and we cannot set per-exchange I/O deadlines.
+func (dt *DNSOverUDPMuxTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return dt.exchange(ctx, query, nil)
+}
+
+// ExchangeExtended is like Exchange but also returns a [*DNSMeasurement].
+//
+// The ObserveRawQuery and ObserveRawResponse hooks, if any, are still
+// invoked for all the exchanges using the shared socket.
+func (dt *DNSOverUDPMuxTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	m := newDNSMeasurement("udp", dt.Endpoint, query)
+	m.complete(dt.exchange(ctx, query, m))
+	return m.Response, m
+}
+
+// exchange implements Exchange and ExchangeExtended, saving the raw messages
+// into the given [*DNSMeasurement] unless it is nil.
+func (dt *DNSOverUDPMuxTransport) exchange(
+	ctx context.Context, query *dnscodec.Query, m *DNSMeasurement) (*dnscodec.Response, error) {
+	// 1. obtain the shared connection
+	conn, err := dt.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. mutate and serialize the query and register it
+	maxSize, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	queryMsg, rawQuery, pending, err := dt.register(query, maxSize, *buff)
+	if err != nil {
+		return nil, err
+	}
+	if dt.ObserveRawQuery != nil {
+		dt.ObserveRawQuery(bytes.Clone(rawQuery))
+	}
+	if m != nil {
+		m.RawQuery = bytes.Clone(rawQuery)
+	}
+
+	// 3. send the query
+	if _, err := conn.Write(rawQuery); err != nil {
+		dt.unregister(queryMsg.Id, pending)
+		return nil, err
+	}
+
+	// 4. wait for the response or for the context to be done
+	select {
+	case rr := <-pending.ch:
+		if m != nil {
+			m.Elapsed = time.Since(m.Started)
+			m.RawResponse = pending.rawResp
+		}
+		return rr.Value, rr.Err
+	case <-ctx.Done():
+		dt.unregister(queryMsg.Id, pending)
+		return nil, ctx.Err()
+	}
+}
+
+// connect returns the shared connection, creating it if needed.
+func (dt *DNSOverUDPMuxTransport) connect(ctx context.Context) (net.Conn, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if dt.closed {
+		return nil, net.ErrClosed
+	}
+	if dt.conn != nil {
+		return dt.conn, nil
+	}
+	conn, err := dt.Dialer.DialContext(ctx, "udp", dt.Endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	dt.conn = conn
+	go dt.readLoop(conn)
+	return conn, nil
+}
+
+// register serializes the query into buff and registers it as outstanding.
+func (dt *DNSOverUDPMuxTransport) register(
+	query *dnscodec.Query, maxSize uint16, buff []byte) (*dns.Msg, []byte, *dnsOverUDPMuxPending, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if len(dt.pending) >= 1<<16 {
+		return nil, nil, nil, errors.New("too many outstanding queries")
+	}
+	query = query.Clone()
+	for dt.pending[query.ID] != nil {
+		query.ID = randID(dt.Rand)
+	}
+	queryMsg, rawQuery, err := dnsOverUDPPackQuery(query, maxSize, dt.DisableEDNS, buff)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pending := &dnsOverUDPMuxPending{
+		ch:       make(chan resolverResponse[*dnscodec.Response], 1),
+		queryMsg: queryMsg,
+	}
+	dt.pending[queryMsg.Id] = pending
+	return queryMsg, rawQuery, pending, nil
+}
+
+// unregister removes an outstanding query, if it is still registered.
+func (dt *DNSOverUDPMuxTransport) unregister(id uint16, pending *dnsOverUDPMuxPending) {
+	dt.mu.Lock()
+	if dt.pending[id] == pending {
+		delete(dt.pending, id)
+	}
+	dt.mu.Unlock()
+}
+
+// readLoop reads responses from the connection and dispatches them.
+func (dt *DNSOverUDPMuxTransport) readLoop(conn net.Conn) {
+	_, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	for {
+		// 1. read the next response
+		buff := dt.BufferPool.Get(recvSize)
+		count, err := conn.Read(*buff)
+		if err != nil {
+			dt.BufferPool.Put(buff)
+			dt.fail(conn, err)
+			return
+		}
+		rawResp := (*buff)[:count]
+		if dt.ObserveRawResponse != nil {
+			dt.ObserveRawResponse(bytes.Clone(rawResp))
+		}
+
+		// 2. parse the response and dispatch it
+		respMsg := new(dns.Msg)
+		if err := respMsg.Unpack(rawResp); err == nil {
+			dt.dispatch(respMsg, rawResp)
+		}
+		dt.BufferPool.Put(buff)
+	}
+}
+
+// dispatch delivers a response message to the corresponding outstanding query
+// along with a copy of the raw response, which we do not retain.
+func (dt *DNSOverUDPMuxTransport) dispatch(respMsg *dns.Msg, rawResp []byte) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	pending := dt.pending[respMsg.Id]
+	if pending == nil {
+		return
+	}
+	resp, err := validateResponse(dt.Validator, pending.queryMsg, respMsg)
+	if errors.Is(err, dnscodec.ErrInvalidResponse) {
+		return // most likely a response for another query with the same ID
+	}
+	delete(dt.pending, respMsg.Id)
+	pending.rawResp = bytes.Clone(rawResp)
+	pending.ch <- resolverResponse[*dnscodec.Response]{Err: err, Value: resp}
+}
+
+// fail fails all the outstanding queries and forgets about the connection.
+func (dt *DNSOverUDPMuxTransport) fail(conn net.Conn, err error) {
+	conn.Close()
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if dt.conn == conn {
+		dt.conn = nil
+	}
+	for id, pending := range dt.pending {
+		delete(dt.pending, id)
+		pending.ch <- resolverResponse[*dnscodec.Response]{Err: err}
+	}
+}
+
+// Close closes the shared socket and fails the outstanding queries.
+//
+// After Close, Exchange fails with [net.ErrClosed].
+func (dt *DNSOverUDPMuxTransport) Close() error {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.closed = true
+	if dt.conn == nil {
+		return nil
+	}
+	return dt.conn.Close()
+}
@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDialer wraps a [NetDialer] and counts the dials.
+type countingDialer struct {
+	count  atomic.Int64
+	dialer NetDialer
+}
+
+func (cd *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	cd.count.Add(1)
+	return cd.dialer.DialContext(ctx, network, address)
+}
+
+func TestDNSOverUDPMuxTransportConcurrentQueries(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	for idx := range 32 {
+		config.AddNetipAddr(fmt.Sprintf("%d.example.com", idx), netip.AddrFrom4([4]byte{10, 0, 0, byte(idx)}))
+	}
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+
+	dialer := &countingDialer{dialer: &net.Dialer{}}
+	txp := NewDNSOverUDPMuxTransport(dialer, netip.MustParseAddrPort(server.Address()))
+	defer txp.Close()
+	reso := NewResolver(txp)
+
+	wg := &sync.WaitGroup{}
+	for idx := range 32 {
+		wg.Go(func() {
+			addrs, err := reso.LookupA(context.Background(), fmt.Sprintf("%d.example.com", idx))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{fmt.Sprintf("10.0.0.%d", idx)}, addrs)
+		})
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(1), dialer.count.Load())
+	txp.mu.Lock()
+	require.Empty(t, txp.pending)
+	txp.mu.Unlock()
+}
+
+func TestDNSOverUDPMuxTransportCollidingIDs(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	config.AddNetipAddr("example.org", netip.MustParseAddr("93.184.216.35"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+
+	txp := NewDNSOverUDPMuxTransport(&net.Dialer{}, netip.MustParseAddrPort(server.Address()))
+	defer txp.Close()
+
+	// register an outstanding query with ID 1 to force a collision
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	query.ID = 1
+	_, _, pending, err := txp.register(query, dnscodec.QueryMaxResponseSizeUDP, nil)
+	require.NoError(t, err)
+	defer txp.unregister(1, pending)
+
+	query = dnscodec.NewQuery("example.org", dns.TypeA)
+	query.ID = 1
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, query)
+	require.NoError(t, err)
+	require.NotEqual(t, uint16(1), resp.Query.Id)
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	require.Equal(t, []string{"93.184.216.35"}, addrs)
+}
+
+func TestDNSOverUDPMuxTransportContextCanceled(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	txp := NewDNSOverUDPMuxTransport(&net.Dialer{}, netip.MustParseAddrPort(server.LocalAddr().String()))
+	defer txp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Nil(t, resp)
+
+	txp.mu.Lock()
+	require.Empty(t, txp.pending)
+	txp.mu.Unlock()
+}
+
+func TestDNSOverUDPMuxTransportClose(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	txp := NewDNSOverUDPMuxTransport(&net.Dialer{}, netip.MustParseAddrPort(server.LocalAddr().String()))
+
+	// start a query that will never receive a response
+	errch := make(chan error, 1)
+	go func() {
+		_, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+		errch <- err
+	}()
+
+	// wait for the query to be outstanding and then close the transport
+	require.Eventually(t, func() bool {
+		txp.mu.Lock()
+		defer txp.mu.Unlock()
+		return len(txp.pending) == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, txp.Close())
+	require.ErrorIs(t, <-errch, net.ErrClosed)
+
+	// make sure we cannot use the transport anymore
+	_, err = txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestDNSOverUDPMuxTransportCloseWithoutConnection(t *testing.T) {
+	txp := NewDNSOverUDPMuxTransport(&net.Dialer{}, netip.MustParseAddrPort("127.0.0.1:53"))
+	require.NoError(t, txp.Close())
+}
+
+func TestDNSOverUDPMuxTransportDialFailure(t *testing.T) {
+	expectedErr := errors.New("dial failure")
+	txp := NewDNSOverUDPMuxTransport(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return nil, expectedErr
+		},
+	}, netip.MustParseAddrPort("127.0.0.1:53"))
+	_, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, expectedErr)
+}
+
+func TestDNSOverUDPMuxTransportWriteAndReadFailures(t *testing.T) {
+	writeErr := errors.New("write failed")
+	readErr := errors.New("read failed")
+	readch := make(chan struct{})
+	var dials int
+	txp := NewDNSOverUDPMuxTransport(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			dials++
+			return &netstub.FuncConn{
+				WriteFunc: func([]byte) (int, error) {
+					return 0, writeErr
+				},
+				ReadFunc: func([]byte) (int, error) {
+					<-readch
+					return 0, readErr
+				},
+				CloseFunc: func() error {
+					return nil
+				},
+			}, nil
+		},
+	}, netip.MustParseAddrPort("127.0.0.1:53"))
+
+	// the write error propagates and we unregister the query
+	_, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, writeErr)
+	txp.mu.Lock()
+	require.Empty(t, txp.pending)
+	txp.mu.Unlock()
+
+	// the read error causes us to forget about the connection
+	close(readch)
+	require.Eventually(t, func() bool {
+		txp.mu.Lock()
+		defer txp.mu.Unlock()
+		return txp.conn == nil
+	}, time.Second, time.Millisecond)
+
+	// so we dial again on the next exchange
+	_, err = txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, writeErr)
+	require.Equal(t, 2, dials)
+}
+
+func TestDNSOverUDPMuxTransportIgnoresInvalidResponses(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	go func() {
+		buff := make([]byte, 4096)
+		count, client, err := server.ReadFrom(buff)
+		if err != nil {
+			return
+		}
+		rawResp := buildRawResponseFromQuery(t, buff[:count])
+
+		// junk that we cannot unpack
+		server.WriteTo([]byte{0xde, 0xad}, client)
+
+		// response with same ID but different question
+		respMsg := &dns.Msg{}
+		require.NoError(t, respMsg.Unpack(rawResp))
+		respMsg.Question[0].Name = "example.org."
+		rawOther, err := respMsg.Pack()
+		require.NoError(t, err)
+		server.WriteTo(rawOther, client)
+
+		// the actual response
+		server.WriteTo(rawResp, client)
+	}()
+
+	txp := NewDNSOverUDPMuxTransport(&net.Dialer{}, netip.MustParseAddrPort(server.LocalAddr().String()))
+	defer txp.Close()
+	var responses atomic.Int64
+	txp.ObserveRawResponse = func([]byte) {
+		responses.Add(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, int64(3), responses.Load())
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// NetListenConfig abstracts over [*net.ListenConfig].
+type NetListenConfig interface {
+	ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error)
+}
+
+// Ensure that [*net.ListenConfig] implements [NetListenConfig].
+var _ NetListenConfig = &net.ListenConfig{}
+
+// DNSOverUDPUnconnectedTransport implements [DNSTransport] for DNS over UDP
+// using an unconnected socket, which receives datagrams from any source.
+//
+// The connected sockets used by [*DNSOverUDPTransport] silently drop the
+// datagrams not coming from the endpoint, including responses spoofed by
+// some injectors. Use this transport to observe such datagrams.
+//
+// Construct using [NewDNSOverUDPUnconnectedTransport].
+type DNSOverUDPUnconnectedTransport struct {
+	// ListenConfig is the [NetListenConfig] to use to create sockets.
+	//
+	// Set by [NewDNSOverUDPUnconnectedTransport] to the user-provided value.
+	ListenConfig NetListenConfig
+
+	// Endpoint is the server endpoint to use to query.
+	//
+	// Set by [NewDNSOverUDPUnconnectedTransport] to the user-provided value.
+	Endpoint netip.AddrPort
+
+	// ObserveRawQuery is an optional hook called with a copy of the raw DNS query.
+	ObserveRawQuery func([]byte)
+
+	// ObserveDatagram is an optional hook called for each received datagram.
+	ObserveDatagram func(*DNSOverUDPDatagram)
+
+	// CaptureTTL OPTIONALLY enables capturing the IPv4 TTL or the IPv6 hop
+	// limit of received datagrams using socket control messages. Divergent
+	// TTLs between injected and legitimate responses are a strong signal
+	// of censorship. This is not supported on all platforms.
+	CaptureTTL bool
+
+	// RejectUnexpectedSource OPTIONALLY prevents using datagrams not coming
+	// from the Endpoint as the response. We still report such datagrams
+	// to ObserveDatagram with UnexpectedSource set to true.
+	RejectUnexpectedSource bool
+
+	// BufferPool is the OPTIONAL [*BufferPool] from which we obtain the buffers
+	// used to send queries and receive responses. When nil, we allocate new
+	// buffers for each exchange.
+	BufferPool *BufferPool
+
+	// MaxResponseSize OPTIONALLY overrides the maximum response size we
+	// advertise using EDNS(0). When zero, we use [dnscodec.QueryMaxResponseSizeUDP].
+	MaxResponseSize uint16
+
+	// RecvBufferSize OPTIONALLY overrides the size of the buffer used to
+	// receive responses. When zero, we use the advertised maximum response
+	// size. Using a larger buffer allows detecting servers sending responses
+	// larger than what we advertised.
+	RecvBufferSize int
+
+	// DisableEDNS OPTIONALLY omits the EDNS(0) OPT record from queries, which
+	// allows testing servers that mishandle EDNS(0) and EDNS-dependent blocking.
+	// When set, we ignore MaxResponseSize and the query flags requiring EDNS(0).
+	DisableEDNS bool
+
+	// Validator is the OPTIONAL [ResponseValidator] that Exchange uses to
+	// validate the response. When nil, we use [dnscodec.ParseResponse].
+	Validator ResponseValidator
+}
+
+// DNSOverUDPDatagram is a datagram received by [*DNSOverUDPUnconnectedTransport].
+type DNSOverUDPDatagram struct {
+	// Source is the address that sent the datagram.
+	Source netip.AddrPort
+
+	// RawResponse is a copy of the datagram content.
+	RawResponse []byte
+
+	// Received is when we received the datagram.
+	Received time.Time
+
+	// TTL is the IPv4 TTL or the IPv6 hop limit of the datagram.
+	//
+	// This field is zero unless CaptureTTL is set and the
+	// platform supports capturing the TTL.
+	TTL int
+
+	// UnexpectedSource is true when Source differs from the endpoint
+	// we queried, which is typical of off-path injection.
+	UnexpectedSource bool
+}
+
+// NewDNSOverUDPUnconnectedTransport creates a new [*DNSOverUDPUnconnectedTransport].
+func NewDNSOverUDPUnconnectedTransport(
+	lc NetListenConfig, endpoint netip.AddrPort) *DNSOverUDPUnconnectedTransport {
+	return &DNSOverUDPUnconnectedTransport{
+		ListenConfig: lc,
+		Endpoint:     endpoint,
+	}
+}
+
+// Ensure that [*DNSOverUDPUnconnectedTransport] implements [DNSExtendedTransport].
+var _ DNSExtendedTransport = &DNSOverUDPUnconnectedTransport{}
+
+// Listen creates a [net.PacketConn] suitable to query the configured endpoint.
+//
+// This method enables building long-lived sockets and reusing them across
+// multiple exchanges via [*DNSOverUDPUnconnectedTransport.ExchangeWithConn].
+func (dt *DNSOverUDPUnconnectedTransport) Listen(ctx context.Context) (net.PacketConn, error) {
+	network := "udp6"
+	if dt.Endpoint.Addr().Unmap().Is4() {
+		network = "udp4"
+	}
+	return dt.ListenConfig.ListenPacket(ctx, network, ":0")
+}
+
+// Exchange implements [DNSTransport].
+func (dt *DNSOverUDPUnconnectedTransport) Exchange(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. create the socket
+	pconn, err := dt.Listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. make sure we react to context being canceled early.
+	defer pconn.Close()
+	stop := context.AfterFunc(ctx, func() { pconn.Close() })
+	defer stop()
+
+	// 3. defer to ExchangeWithConn.
+	return dt.ExchangeWithConn(ctx, pconn, query)
+}
+
+// ExchangeExtended is like Exchange but also returns a [*DNSMeasurement]
+// that includes all the datagrams we received.
+//
+// We perform the exchange using a copy of the transport that chains to
+// the ObserveRawQuery and ObserveDatagram hooks, if any.
+func (dt *DNSOverUDPUnconnectedTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	// 1. perform the exchange observing the datagrams
+	m := newDNSMeasurement("udp", dt.Endpoint, query)
+	clone := *dt
+	clone.ObserveRawQuery = m.observeRawQuery(dt.ObserveRawQuery)
+	clone.ObserveDatagram = m.observeDatagram(dt.ObserveDatagram)
+	m.complete(clone.Exchange(ctx, query))
+
+	// 2. unless reading failed, the response is the last datagram, since
+	// we stop reading as soon as we accept a datagram
+	var nerr net.Error
+	if len(m.Datagrams) > 0 && !errors.As(m.Err, &nerr) && !errors.Is(m.Err, context.Canceled) {
+		m.RawResponse = m.Datagrams[len(m.Datagrams)-1].RawResponse
+	}
+	return m.Response, m
+}
+
+// SendQuery sends a [*dnscodec.Query] to the endpoint using a [net.PacketConn].
+//
+// We only honor deadlines from the context; canceling the context without a
+// deadline does not interrupt I/O. This behavior may change in the future.
+func (dt *DNSOverUDPUnconnectedTransport) SendQuery(
+	ctx context.Context, pconn net.PacketConn, query *dnscodec.Query) (*dns.Msg, error) {
+	// 1. Use the context deadline to limit the lifetime.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = pconn.SetDeadline(deadline)
+		defer pconn.SetDeadline(time.Time{})
+	}
+
+	// 2. Mutate and serialize the query.
+	maxSize, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	queryMsg, rawQuery, err := dnsOverUDPPackQuery(query, maxSize, dt.DisableEDNS, *buff)
+	if err != nil {
+		return nil, err
+	}
+	if dt.ObserveRawQuery != nil {
+		dt.ObserveRawQuery(bytes.Clone(rawQuery))
+	}
+
+	// 3. Send the query.
+	if _, err := pconn.WriteTo(rawQuery, net.UDPAddrFromAddrPort(dt.Endpoint)); err != nil {
+		return nil, dnsOverUDPError(ctx, err)
+	}
+	return queryMsg, nil
+}
+
+// RecvResponse receives a [*dnscodec.Response] using a [net.PacketConn].
+//
+// We ignore the datagrams that are not valid responses for the query
+// and keep reading until we receive a valid response or an I/O error
+// occurs, which typically happens when the deadline expires.
+//
+// We only honor deadlines from the context; canceling the context without a
+// deadline does not interrupt I/O. This behavior may change in the future.
+func (dt *DNSOverUDPUnconnectedTransport) RecvResponse(
+	ctx context.Context, pconn net.PacketConn, queryMsg *dns.Msg) (*dnscodec.Response, error) {
+	// 1. Use the context deadline to limit the lifetime.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = pconn.SetDeadline(deadline)
+		defer pconn.SetDeadline(time.Time{})
+	}
+
+	readFrom := dnsOverUDPNewReadFrom(pconn, dt.CaptureTTL)
+	_, recvSize := dnsOverUDPSizes(dt.MaxResponseSize, dt.RecvBufferSize)
+	buff := dt.BufferPool.Get(recvSize)
+	defer dt.BufferPool.Put(buff)
+	for {
+		// 2. Read the next datagram.
+		count, ttl, addr, err := readFrom(*buff)
+		if err != nil {
+			return nil, dnsOverUDPError(ctx, err)
+		}
+		rawResp := (*buff)[:count]
+		source := dnsOverUDPAddrPort(addr)
+		unexpected := !dnsOverUDPSameEndpoint(source, dt.Endpoint)
+		if dt.ObserveDatagram != nil {
+			dt.ObserveDatagram(&DNSOverUDPDatagram{
+				Source:           source,
+				RawResponse:      bytes.Clone(rawResp),
+				Received:         time.Now(),
+				TTL:              ttl,
+				UnexpectedSource: unexpected,
+			})
+		}
+
+		// 3. Possibly skip datagrams coming from unexpected sources.
+		if unexpected && dt.RejectUnexpectedSource {
+			continue
+		}
+
+		// 4. Parse the datagram and skip it if it's not a response for the query.
+		respMsg := new(dns.Msg)
+		if err := respMsg.Unpack(rawResp); err != nil {
+			continue
+		}
+		resp, err := validateResponse(dt.Validator, queryMsg, respMsg)
+		if errors.Is(err, dnscodec.ErrInvalidResponse) {
+			continue
+		}
+		return resp, err
+	}
+}
+
+// dnsOverUDPReadFromFunc reads a datagram along with its TTL.
+type dnsOverUDPReadFromFunc = func(buff []byte) (count int, ttl int, addr net.Addr, err error)
+
+// dnsOverUDPNewReadFrom returns a function reading datagrams from the given socket,
+// possibly capturing the TTL when captureTTL is true and the platform supports it.
+func dnsOverUDPNewReadFrom(pconn net.PacketConn, captureTTL bool) dnsOverUDPReadFromFunc {
+	// 1. try to enable capturing the IPv4 TTL
+	if captureTTL && dnsOverUDPAddrPort(pconn.LocalAddr()).Addr().Is4() {
+		pconn4 := ipv4.NewPacketConn(pconn)
+		if pconn4.SetControlMessage(ipv4.FlagTTL, true) == nil {
+			return func(buff []byte) (int, int, net.Addr, error) {
+				count, cm, addr, err := pconn4.ReadFrom(buff)
+				if cm == nil {
+					return count, 0, addr, err
+				}
+				return count, cm.TTL, addr, err
+			}
+		}
+	}
+
+	// 2. try to enable capturing the IPv6 hop limit
+	if captureTTL && dnsOverUDPAddrPort(pconn.LocalAddr()).Addr().Is6() {
+		pconn6 := ipv6.NewPacketConn(pconn)
+		if pconn6.SetControlMessage(ipv6.FlagHopLimit, true) == nil {
+			return func(buff []byte) (int, int, net.Addr, error) {
+				count, cm, addr, err := pconn6.ReadFrom(buff)
+				if cm == nil {
+					return count, 0, addr, err
+				}
+				return count, cm.HopLimit, addr, err
+			}
+		}
+	}
+
+	// 3. fallback to reading without capturing the TTL
+	return func(buff []byte) (int, int, net.Addr, error) {
+		count, addr, err := pconn.ReadFrom(buff)
+		return count, 0, addr, err
+	}
+}
+
+// dnsOverUDPSameEndpoint returns whether two endpoints are the same, ignoring
+// the difference between IPv4 and IPv4-mapped IPv6 addresses and zones.
+func dnsOverUDPSameEndpoint(a, b netip.AddrPort) bool {
+	return a.Port() == b.Port() && a.Addr().Unmap().WithZone("") == b.Addr().Unmap().WithZone("")
+}
+
+// dnsOverUDPAddrPort converts a [net.Addr] to a [netip.AddrPort].
+func dnsOverUDPAddrPort(addr net.Addr) netip.AddrPort {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		epnt := udpAddr.AddrPort()
+		return netip.AddrPortFrom(epnt.Addr().Unmap(), epnt.Port())
+	}
+	epnt, _ := netip.ParseAddrPort(addr.String())
+	return epnt
+}
+
+// ExchangeWithConn sends a [*dnscodec.Query] and receives a [*dnscodec.Response].
+//
+// This method allows reusing a long-lived socket across multiple exchanges.
+func (dt *DNSOverUDPUnconnectedTransport) ExchangeWithConn(ctx context.Context,
+	pconn net.PacketConn, query *dnscodec.Query) (*dnscodec.Response, error) {
+	queryMsg, err := dt.SendQuery(ctx, pconn, query)
+	if err != nil {
+		return nil, err
+	}
+	return dt.RecvResponse(ctx, pconn, queryMsg)
+}
@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenConfigFunc allows to mock [NetListenConfig].
+type listenConfigFunc func(ctx context.Context, network, address string) (net.PacketConn, error)
+
+func (fx listenConfigFunc) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	return fx(ctx, network, address)
+}
+
+// newSpoofingServer creates a UDP endpoint that never answers queries and
+// instead sends a junk datagram and then the response from another socket,
+// which is what off-path injectors commonly do. It returns the endpoint
+// address and the address of the socket sending the response.
+func newSpoofingServer(t *testing.T) (netip.AddrPort, netip.AddrPort) {
+	t.Helper()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	injector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { injector.Close() })
+
+	go func() {
+		buff := make([]byte, 4096)
+		count, client, err := server.ReadFrom(buff)
+		if err != nil {
+			return
+		}
+		injector.WriteTo([]byte{0xde, 0xad, 0xbe, 0xef}, client)
+		injector.WriteTo(buildRawResponseFromQuery(t, buff[:count]), client)
+	}()
+
+	return netip.MustParseAddrPort(server.LocalAddr().String()),
+		netip.MustParseAddrPort(injector.LocalAddr().String())
+}
+
+func TestDNSOverUDPUnconnectedTransportExchangeSuccess(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	endpoint := netip.MustParseAddrPort(server.Address())
+
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+	var (
+		rawQuery  []byte
+		datagrams []*DNSOverUDPDatagram
+	)
+	txp.ObserveRawQuery = func(p []byte) {
+		rawQuery = p
+	}
+	txp.ObserveDatagram = func(dgram *DNSOverUDPDatagram) {
+		datagrams = append(datagrams, dgram)
+	}
+
+	addrs, err := NewResolver(txp).LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	assert.NotEmpty(t, rawQuery)
+	require.Len(t, datagrams, 1)
+	assert.Equal(t, endpoint, datagrams[0].Source)
+	assert.False(t, datagrams[0].UnexpectedSource)
+	assert.NotEmpty(t, datagrams[0].RawResponse)
+	assert.False(t, datagrams[0].Received.IsZero())
+}
+
+func TestDNSOverUDPUnconnectedTransportReceivesFromOtherSources(t *testing.T) {
+	endpoint, injector := newSpoofingServer(t)
+
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+	var datagrams []*DNSOverUDPDatagram
+	txp.ObserveDatagram = func(dgram *DNSOverUDPDatagram) {
+		datagrams = append(datagrams, dgram)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"8.8.8.8"}, addrs)
+
+	require.Len(t, datagrams, 2)
+	for _, dgram := range datagrams {
+		assert.Equal(t, injector, dgram.Source)
+		assert.True(t, dgram.UnexpectedSource)
+	}
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, datagrams[0].RawResponse)
+}
+
+func TestDNSOverUDPUnconnectedTransportSkipsUnrelatedResponses(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	go func() {
+		buff := make([]byte, 4096)
+		count, client, err := server.ReadFrom(buff)
+		if err != nil {
+			return
+		}
+		rawResp := buildRawResponseFromQuery(t, buff[:count])
+		unrelated := append([]byte{}, rawResp...)
+		unrelated[0] ^= 0xff // change the query ID
+		server.WriteTo(unrelated, client)
+		server.WriteTo(rawResp, client)
+	}()
+
+	endpoint := netip.MustParseAddrPort(server.LocalAddr().String())
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+	var count int
+	txp.ObserveDatagram = func(*DNSOverUDPDatagram) {
+		count++
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, 2, count)
+}
+
+func TestDNSOverUDPUnconnectedTransportTimeout(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	endpoint := netip.MustParseAddrPort(server.LocalAddr().String())
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.Error(t, err)
+	require.Equal(t, FailureGenericTimeout, ClassifyError(err))
+	require.Nil(t, resp)
+}
+
+func TestDNSOverUDPUnconnectedTransportListenFailure(t *testing.T) {
+	expectedErr := errors.New("listen failure")
+	txp := NewDNSOverUDPUnconnectedTransport(listenConfigFunc(
+		func(context.Context, string, string) (net.PacketConn, error) {
+			return nil, expectedErr
+		}), netip.MustParseAddrPort("127.0.0.1:53"))
+	_, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, expectedErr)
+}
+
+func TestDNSOverUDPUnconnectedTransportListenNetwork(t *testing.T) {
+	type testCase struct {
+		// endpoint is the endpoint to query.
+		endpoint string
+
+		// want is the expected network.
+		want string
+	}
+
+	tests := []testCase{
+		{endpoint: "127.0.0.1:53", want: "udp4"},
+		{endpoint: "[::ffff:127.0.0.1]:53", want: "udp4"},
+		{endpoint: "[::1]:53", want: "udp6"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			var network string
+			txp := NewDNSOverUDPUnconnectedTransport(listenConfigFunc(
+				func(_ context.Context, n string, _ string) (net.PacketConn, error) {
+					network = n
+					return nil, errors.New("listen failure")
+				}), netip.MustParseAddrPort(tc.endpoint))
+			_, _ = txp.Listen(context.Background())
+			require.Equal(t, tc.want, network)
+		})
+	}
+}
+
+func TestDNSOverUDPUnconnectedTransportSendQueryFailure(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pconn.Close()
+
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, netip.MustParseAddrPort("127.0.0.1:53"))
+	_, err = txp.ExchangeWithConn(context.Background(), pconn, dnscodec.NewQuery("\t", dns.TypeA))
+	require.Error(t, err)
+}
+
+func TestDNSOverUDPUnconnectedTransportCaptureTTL(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// address is the address where the server should listen.
+		address string
+	}
+
+	tests := []testCase{
+		{name: "IPv4", address: "127.0.0.1:0"},
+		{name: "IPv6", address: "[::1]:0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pconn, err := net.ListenPacket("udp", tc.address)
+			if err != nil {
+				t.Skip("cannot listen on", tc.address)
+			}
+			pconn.Close()
+
+			config := dnstest.NewHandlerConfig()
+			config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+			server := newUDPServer(t, tc.address, dnstest.NewHandler(config))
+
+			txp := NewDNSOverUDPUnconnectedTransport(
+				&net.ListenConfig{}, netip.MustParseAddrPort(server.Address()))
+			txp.CaptureTTL = true
+			var datagrams []*DNSOverUDPDatagram
+			txp.ObserveDatagram = func(dgram *DNSOverUDPDatagram) {
+				datagrams = append(datagrams, dgram)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err = txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+			require.NoError(t, err)
+			require.Len(t, datagrams, 1)
+			if runtime.GOOS == "linux" {
+				require.Greater(t, datagrams[0].TTL, 0)
+			}
+		})
+	}
+}
+
+func TestDNSOverUDPUnconnectedTransportRejectUnexpectedSource(t *testing.T) {
+	endpoint, injector := newSpoofingServer(t)
+
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+	txp.RejectUnexpectedSource = true
+	var datagrams []*DNSOverUDPDatagram
+	txp.ObserveDatagram = func(dgram *DNSOverUDPDatagram) {
+		datagrams = append(datagrams, dgram)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	resp, err := txp.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.Error(t, err)
+	require.Nil(t, resp)
+
+	require.Len(t, datagrams, 2)
+	for _, dgram := range datagrams {
+		assert.Equal(t, injector, dgram.Source)
+		assert.True(t, dgram.UnexpectedSource)
+	}
+}
+
+func TestDNSOverUDPSameEndpoint(t *testing.T) {
+	type testCase struct {
+		// a is the first endpoint.
+		a string
+
+		// b is the second endpoint.
+		b string
+
+		// want is the expected result.
+		want bool
+	}
+
+	tests := []testCase{
+		{a: "127.0.0.1:53", b: "127.0.0.1:53", want: true},
+		{a: "127.0.0.1:53", b: "[::ffff:127.0.0.1]:53", want: true},
+		{a: "[fe80::1%eth0]:53", b: "[fe80::1]:53", want: true},
+		{a: "127.0.0.1:53", b: "127.0.0.1:54", want: false},
+		{a: "127.0.0.1:53", b: "127.0.0.2:53", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			got := dnsOverUDPSameEndpoint(netip.MustParseAddrPort(tc.a), netip.MustParseAddrPort(tc.b))
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
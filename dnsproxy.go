@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSProxyHandler implements [dns.Handler] by forwarding the incoming queries
+// using a [DNSMsgTransport], which allows building custom DNS proxies and
+// honeypots using a [*dns.Server] with minimal glue.
+//
+// We forward each query using a random ID, which we restore when replying,
+// and we reply with SERVFAIL when the exchange fails. We truncate responses
+// exceeding the size that UDP clients can accept.
+//
+// Construct using [NewDNSProxyHandler].
+type DNSProxyHandler struct {
+	// Transport is the [DNSMsgTransport] to use to forward queries.
+	//
+	// Set by [NewDNSProxyHandler] to the user-provided value.
+	Transport DNSMsgTransport
+
+	// Timeout is the timeout of each exchange.
+	//
+	// Set by [NewDNSProxyHandler] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// ObserveExchange is an OPTIONAL hook called after each exchange.
+	ObserveExchange func(*DNSProxyExchange)
+
+	// Rand is the [Rand] to use for the IDs of the forwarded queries.
+	//
+	// Set by [NewDNSProxyHandler] to [GlobalRand].
+	Rand Rand
+}
+
+// DNSProxyExchange describes a query handled by [*DNSProxyHandler].
+type DNSProxyExchange struct {
+	// Client is the address of the client that sent the query.
+	Client net.Addr
+
+	// Query is the query we received.
+	Query *dns.Msg
+
+	// Response is the response we sent or nil if writing failed.
+	Response *dns.Msg
+
+	// Err is the error forwarding the query or writing the response or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we received the query.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// NewDNSProxyHandler creates a new [*DNSProxyHandler].
+func NewDNSProxyHandler(txp DNSMsgTransport) *DNSProxyHandler {
+	return &DNSProxyHandler{
+		Transport: txp,
+		Timeout:   DefaultResolverTimeout,
+		Rand:      GlobalRand{},
+	}
+}
+
+// Ensure that [*DNSProxyHandler] implements [dns.Handler].
+var _ dns.Handler = &DNSProxyHandler{}
+
+// ServeDNS implements [dns.Handler].
+func (h *DNSProxyHandler) ServeDNS(w dns.ResponseWriter, queryMsg *dns.Msg) {
+	exchange := &DNSProxyExchange{Client: w.RemoteAddr(), Query: queryMsg, Started: time.Now()}
+
+	// 1. forward the query unless it is malformed
+	var respMsg *dns.Msg
+	if len(queryMsg.Question) != 1 {
+		respMsg = new(dns.Msg)
+		respMsg.SetRcode(queryMsg, dns.RcodeFormatError)
+	} else if respMsg, exchange.Err = h.forward(queryMsg); exchange.Err != nil {
+		respMsg = new(dns.Msg)
+		respMsg.SetRcode(queryMsg, dns.RcodeServerFailure)
+	}
+
+	// 2. make sure the response fits into the client buffer
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := queryMsg.IsEdns0(); opt != nil {
+			size = max(int(opt.UDPSize()), dns.MinMsgSize)
+		}
+		respMsg.Truncate(size)
+	}
+
+	// 3. write the response
+	if err := w.WriteMsg(respMsg); err != nil {
+		exchange.Err = err
+	} else {
+		exchange.Response = respMsg
+	}
+
+	// 4. possibly observe the exchange
+	exchange.Elapsed = time.Since(exchange.Started)
+	exchange.Failure = ClassifyError(exchange.Err)
+	if h.ObserveExchange != nil {
+		h.ObserveExchange(exchange)
+	}
+}
+
+// forward forwards a copy of the query using a random ID and returns the
+// response using the original ID.
+func (h *DNSProxyHandler) forward(queryMsg *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+	upstreamMsg := queryMsg.Copy()
+	upstreamMsg.Id = randID(h.Rand)
+	respMsg, err := h.Transport.ExchangeMsg(ctx, upstreamMsg)
+	if err != nil {
+		return nil, err
+	}
+	respMsg.Id = queryMsg.Id
+	return respMsg, nil
+}
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDNSProxyServer starts a UDP server using the given handler and returns its
+// address. The server passes all the messages to the handler, including the
+// malformed ones that [*dns.Server] would otherwise reject.
+func newDNSProxyServer(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{
+		PacketConn: pconn,
+		Handler:    handler,
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction {
+			return dns.MsgAccept
+		},
+	})
+	return pconn.LocalAddr().String()
+}
+
+func TestNewDNSProxyHandler(t *testing.T) {
+	h := NewDNSProxyHandler(msgTransportStub{})
+	assert.Equal(t, DefaultResolverTimeout, h.Timeout)
+	assert.Nil(t, h.ObserveExchange)
+}
+
+func TestDNSProxyHandler(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// answers is the number of A records in the upstream response.
+		answers int
+
+		// upstreamErr is the error returned by the upstream transport.
+		upstreamErr error
+
+		// noQuestion removes the question from the query.
+		noQuestion bool
+
+		// edns enables EDNS(0) in the query.
+		edns bool
+
+		// wantRcode is the expected response code.
+		wantRcode int
+
+		// wantAnswers is the expected number of answers.
+		wantAnswers int
+
+		// wantTruncated is true when we expect the TC bit.
+		wantTruncated bool
+
+		// wantForwarded is true when we expect to forward the query.
+		wantForwarded bool
+	}
+
+	tests := []testCase{
+		{
+			name:          "successful exchange",
+			answers:       1,
+			wantRcode:     dns.RcodeSuccess,
+			wantAnswers:   1,
+			wantForwarded: true,
+		},
+
+		{
+			name:          "upstream failure",
+			upstreamErr:   errors.New("mocked error"),
+			wantRcode:     dns.RcodeServerFailure,
+			wantForwarded: true,
+		},
+
+		{
+			name:       "query without question",
+			noQuestion: true,
+			wantRcode:  dns.RcodeFormatError,
+		},
+
+		{
+			name:          "truncation without EDNS",
+			answers:       64,
+			wantRcode:     dns.RcodeSuccess,
+			wantAnswers:   30,
+			wantTruncated: true,
+			wantForwarded: true,
+		},
+
+		{
+			name:          "no truncation with EDNS",
+			answers:       64,
+			edns:          true,
+			wantRcode:     dns.RcodeSuccess,
+			wantAnswers:   64,
+			wantForwarded: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// 1. create the proxy using a stub upstream
+			var forwarded *dns.Msg
+			h := NewDNSProxyHandler(msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+				forwarded = queryMsg
+				if tc.upstreamErr != nil {
+					return nil, tc.upstreamErr
+				}
+				respMsg := new(dns.Msg)
+				respMsg.SetReply(queryMsg)
+				for idx := range tc.answers {
+					respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(
+						dns.NewRR(fmt.Sprintf("example.com. 60 IN A 10.0.0.%d", idx))))
+				}
+				return respMsg, nil
+			}})
+			exchanges := make(chan *DNSProxyExchange, 1)
+			h.ObserveExchange = func(e *DNSProxyExchange) { exchanges <- e }
+			address := newDNSProxyServer(t, h)
+
+			// 2. query the proxy
+			queryMsg := new(dns.Msg)
+			queryMsg.SetQuestion("example.com.", dns.TypeA)
+			if tc.noQuestion {
+				queryMsg.Question = nil
+			}
+			if tc.edns {
+				queryMsg.SetEdns0(4096, false)
+			}
+			clnt := &dns.Client{UDPSize: 4096}
+			respMsg, _, err := clnt.Exchange(queryMsg, address)
+			require.NoError(t, err)
+
+			// 3. check the response
+			assert.Equal(t, queryMsg.Id, respMsg.Id)
+			assert.Equal(t, tc.wantRcode, respMsg.Rcode)
+			assert.Len(t, respMsg.Answer, tc.wantAnswers)
+			assert.Equal(t, tc.wantTruncated, respMsg.Truncated)
+
+			// 4. check what we forwarded after the handler is done
+			exchange := <-exchanges
+			assert.Equal(t, tc.wantForwarded, forwarded != nil)
+			if forwarded != nil {
+				assert.Equal(t, queryMsg.Question, forwarded.Question)
+			}
+
+			// 5. check the observed exchange
+			assert.NotNil(t, exchange.Client)
+			assert.Equal(t, queryMsg.Id, exchange.Query.Id)
+			require.NotNil(t, exchange.Response)
+			assert.Equal(t, tc.wantRcode, exchange.Response.Rcode)
+			assert.Equal(t, tc.upstreamErr, exchange.Err)
+			assert.Equal(t, ClassifyError(tc.upstreamErr), exchange.Failure)
+		})
+	}
+}
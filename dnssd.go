@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ServiceBrowser browses DNS-SD services (RFC 6763).
+//
+// We use a [DNSMsgTransport] rather than a [*Resolver] because service
+// names contain underscores and arbitrary instance labels, which the
+// IDNA encoding of [*dnscodec.Query] rejects.
+//
+// Construct using [NewServiceBrowser].
+type ServiceBrowser struct {
+	// Transport is the [DNSMsgTransport] to use.
+	//
+	// Set by [NewServiceBrowser] to the user-provided value.
+	Transport DNSMsgTransport
+
+	// Timeout is the timeout of each exchange.
+	//
+	// Set by [NewServiceBrowser] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewServiceBrowser] to [GlobalRand].
+	Rand Rand
+}
+
+// ServiceInstance is a DNS-SD service instance.
+type ServiceInstance struct {
+	// Name is the instance name (e.g., "Printer._ipp._tcp.example.com.").
+	Name string
+
+	// Target is the name of the host providing the service or empty.
+	Target string
+
+	// Port is the port of the service or zero.
+	Port uint16
+
+	// Priority is the SRV priority.
+	Priority uint16
+
+	// Weight is the SRV weight.
+	Weight uint16
+
+	// TXT contains the TXT record strings (e.g., "path=/ipp") or nil.
+	TXT []string
+
+	// Err is the error resolving the SRV and TXT records or nil.
+	Err error
+}
+
+// NewServiceBrowser creates a new [*ServiceBrowser].
+func NewServiceBrowser(txp DNSMsgTransport) *ServiceBrowser {
+	return &ServiceBrowser{Transport: txp, Timeout: DefaultResolverTimeout, Rand: GlobalRand{}}
+}
+
+// LookupServiceTypes enumerates the service types in the given domain by
+// querying the _services._dns-sd._udp meta-query name (RFC 6763 Section 9).
+func (sb *ServiceBrowser) LookupServiceTypes(ctx context.Context, domain string) ([]string, error) {
+	return sb.lookupPTR(ctx, "_services._dns-sd._udp."+dns.Fqdn(domain))
+}
+
+// Browse enumerates the instances of the given service (e.g., "_http._tcp")
+// in the given domain and resolves their SRV and TXT records.
+//
+// We return an error only when the PTR enumeration fails. The per-instance
+// resolution errors are inside the returned [*ServiceInstance].
+func (sb *ServiceBrowser) Browse(ctx context.Context, service, domain string) ([]*ServiceInstance, error) {
+	// 1. enumerate the instances
+	names, err := sb.lookupPTR(ctx, dns.Fqdn(service)+dns.Fqdn(domain))
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. resolve each instance
+	instances := make([]*ServiceInstance, 0, len(names))
+	for _, name := range names {
+		instances = append(instances, sb.resolve(ctx, name))
+	}
+	return instances, nil
+}
+
+// resolve resolves the SRV and TXT records of an instance.
+func (sb *ServiceBrowser) resolve(ctx context.Context, name string) *ServiceInstance {
+	instance := &ServiceInstance{Name: name}
+
+	// 1. resolve the SRV record
+	srvs, srvErr := msgLookupRecords[*dns.SRV](ctx, sb.Transport, sb.Rand, sb.Timeout, name, dns.TypeSRV)
+	if len(srvs) > 0 {
+		instance.Target = dns.Fqdn(srvs[0].Target)
+		instance.Port = srvs[0].Port
+		instance.Priority = srvs[0].Priority
+		instance.Weight = srvs[0].Weight
+	}
+
+	// 2. resolve the TXT record
+	txts, txtErr := msgLookupRecords[*dns.TXT](ctx, sb.Transport, sb.Rand, sb.Timeout, name, dns.TypeTXT)
+	for _, txt := range txts {
+		instance.TXT = append(instance.TXT, txt.Txt...)
+	}
+
+	instance.Err = errors.Join(srvErr, txtErr)
+	return instance
+}
+
+// lookupPTR returns the names of the PTR records of the given name.
+func (sb *ServiceBrowser) lookupPTR(ctx context.Context, name string) ([]string, error) {
+	ptrs, err := msgLookupRecords[*dns.PTR](ctx, sb.Transport, sb.Rand, sb.Timeout, name, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(ptrs))
+	for _, ptr := range ptrs {
+		out = append(out, dns.Fqdn(ptr.Ptr))
+	}
+	return out, nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dnssdRecords contains the records of a DNS-SD enabled domain.
+var dnssdRecords = []string{
+	`_services._dns-sd._udp.example.com. 300 IN PTR _ipp._tcp.example.com.`,
+	`_services._dns-sd._udp.example.com. 300 IN PTR _http._tcp.example.com.`,
+	`_ipp._tcp.example.com. 300 IN PTR Office\ Printer._ipp._tcp.example.com.`,
+	`_ipp._tcp.example.com. 300 IN PTR Lab._ipp._tcp.example.com.`,
+	`Office\ Printer._ipp._tcp.example.com. 300 IN SRV 0 10 631 printer.example.com.`,
+	`Office\ Printer._ipp._tcp.example.com. 300 IN TXT "txtvers=1" "rp=ipp/print"`,
+	`Lab._ipp._tcp.example.com. 300 IN SRV 1 5 8631 lab.example.com.`,
+}
+
+// newDNSSDTransport returns a [DNSMsgTransport] answering each query
+// using the [dnssdRecords] matching the query name and type.
+func newDNSSDTransport() DNSMsgTransport {
+	return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		for _, record := range dnssdRecords {
+			rr := runtimex.PanicOnError1(dns.NewRR(record))
+			q0 := queryMsg.Question[0]
+			if dns.CanonicalName(rr.Header().Name) == dns.CanonicalName(q0.Name) && rr.Header().Rrtype == q0.Qtype {
+				respMsg.Answer = append(respMsg.Answer, rr)
+			}
+		}
+		return respMsg, nil
+	}}
+}
+
+func TestServiceBrowserLookupServiceTypes(t *testing.T) {
+	sb := NewServiceBrowser(newDNSSDTransport())
+	types, err := sb.LookupServiceTypes(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_ipp._tcp.example.com.", "_http._tcp.example.com."}, types)
+}
+
+func TestServiceBrowserBrowse(t *testing.T) {
+	sb := NewServiceBrowser(newDNSSDTransport())
+	instances, err := sb.Browse(context.Background(), "_ipp._tcp", "example.com")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+
+	assert.Equal(t, &ServiceInstance{
+		Name:     `Office\ Printer._ipp._tcp.example.com.`,
+		Target:   "printer.example.com.",
+		Port:     631,
+		Priority: 0,
+		Weight:   10,
+		TXT:      []string{"txtvers=1", "rp=ipp/print"},
+	}, instances[0])
+
+	// the second instance lacks the TXT record
+	assert.Equal(t, `Lab._ipp._tcp.example.com.`, instances[1].Name)
+	assert.Equal(t, "lab.example.com.", instances[1].Target)
+	assert.Equal(t, uint16(8631), instances[1].Port)
+	assert.Nil(t, instances[1].TXT)
+	require.ErrorIs(t, instances[1].Err, dnscodec.ErrNoData)
+}
+
+func TestServiceBrowserBrowseFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// transport is the transport to use.
+		transport DNSMsgTransport
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	expectedErr := errors.New("mocked error")
+
+	tests := []testCase{
+		{
+			name:      "no instances",
+			transport: newDNSSDTransport(),
+			wantErr:   dnscodec.ErrNoData,
+		},
+
+		{
+			name: "transport failure",
+			transport: msgTransportStub{exchangeMsg: func(context.Context, *dns.Msg) (*dns.Msg, error) {
+				return nil, expectedErr
+			}},
+			wantErr: expectedErr,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sb := NewServiceBrowser(tc.transport)
+			instances, err := sb.Browse(context.Background(), "_http._tcp", "example.com")
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Nil(t, instances)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DNSSECChain contains the records needed to validate a response offline,
+// from the root zone down to the target RRset.
+type DNSSECChain struct {
+	// Name is the canonical target name.
+	Name string
+
+	// Type is the target query type.
+	Type uint16
+
+	// Zones contains the signed zones from the root to the target.
+	Zones []*DNSSECChainZone
+
+	// Target contains the target RRset and its RRSIG records.
+	Target []dns.RR
+}
+
+// DNSSECChainZone contains the records authenticating a signed zone.
+type DNSSECChainZone struct {
+	// Name is the canonical zone name (e.g., "example.com.").
+	Name string
+
+	// DS contains the DS RRset and its RRSIG records, which are
+	// served by the parent zone. This field is nil for the root zone.
+	DS []dns.RR
+
+	// DNSKEY contains the DNSKEY RRset and its RRSIG records.
+	DNSKEY []dns.RR
+}
+
+// ChainFetch collects the DS, DNSKEY, and RRSIG records from the root zone
+// down to the given name and query type using the configured transports.
+//
+// We find the signed zones by querying for DS records at each label, hence
+// the chain does not include unsigned delegations. We do not validate
+// the chain. Note that a validating upstream answers SERVFAIL for bogus
+// chains, so use a non-validating upstream to archive bogus chains.
+func (r *Resolver) ChainFetch(ctx context.Context, name string, qtype uint16) (*DNSSECChain, error) {
+	name = dns.CanonicalName(name)
+	chain := &DNSSECChain{Name: name, Type: qtype}
+
+	// 1. walk the labels from the root down to the name
+	labels := dns.SplitDomainName(name)
+	for idx := len(labels); idx >= 0; idx-- {
+		zone := dns.Fqdn(strings.Join(labels[idx:], "."))
+
+		// 1.1. find whether this is a signed zone cut using DS
+		var ds []dns.RR
+		if zone != "." {
+			rrs, err := r.chainFetchRRset(ctx, zone, dns.TypeDS)
+			if errors.Is(err, dnscodec.ErrNoData) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			ds = rrs
+		}
+
+		// 1.2. fetch the zone keys
+		dnskey, err := r.chainFetchRRset(ctx, zone, dns.TypeDNSKEY)
+		if err != nil {
+			return nil, err
+		}
+		chain.Zones = append(chain.Zones, &DNSSECChainZone{Name: zone, DS: ds, DNSKEY: dnskey})
+	}
+
+	// 2. fetch the target RRset
+	target, err := r.chainFetchRRset(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	chain.Target = target
+	return chain, nil
+}
+
+// chainFetchRRset fetches the given RRset along with its RRSIG records.
+//
+// We return [dnscodec.ErrNoData] when the response does not contain the RRset.
+func (r *Resolver) chainFetchRRset(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	query := r.newQuery(name, qtype)
+	query.Flags |= dnscodec.QueryFlagDNSSec
+	resp, err := r.lookup(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for _, rr := range resp.Response.Answer {
+		if dns.CanonicalName(rr.Header().Name) != name {
+			continue
+		}
+		if sig, ok := rr.(*dns.RRSIG); (ok && sig.TypeCovered == qtype) || rr.Header().Rrtype == qtype {
+			rrs = append(rrs, rr)
+		}
+	}
+	if len(rrs) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return rrs, nil
+}
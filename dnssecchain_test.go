@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dnssecChainRecords contains the records served by newDNSSECChainTransport,
+// where com and example.com are signed and www.example.com is not a zone cut.
+var dnssecChainRecords = []string{
+	". 172800 IN DNSKEY 257 3 8 AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTOiW1vkIbzxeF3",
+	". 172800 IN RRSIG DNSKEY 8 0 172800 20300101000000 20200101000000 20326 . c2lnbmF0dXJl",
+	"com. 86400 IN DS 19718 13 2 8ACBB0CD28F41250A80A491389424D341522D946B0DA0C0291F2D3D771D7805A",
+	"com. 86400 IN RRSIG DS 8 1 86400 20300101000000 20200101000000 61809 . c2lnbmF0dXJl",
+	"com. 86400 IN DNSKEY 257 3 13 tx8EZRAd2+K/DJRV0S+hbBzaRPS/G6JVNBitHzqpsGlz8huE61Ms9A==",
+	"com. 86400 IN RRSIG DNSKEY 13 1 86400 20300101000000 20200101000000 19718 com. c2lnbmF0dXJl",
+	"example.com. 86400 IN DS 370 13 2 BE74359954660069D5C63D200C39F5603827D7DD02B56F120EE9F3A86764247C",
+	"example.com. 86400 IN RRSIG DS 13 2 86400 20300101000000 20200101000000 4534 com. c2lnbmF0dXJl",
+	"example.com. 3600 IN DNSKEY 257 3 13 kXKkvWU3vGYfTJGl3qBd4qhiWp5aRs7YtkCJxD2d+t7KXqwahww5IgJt",
+	"example.com. 3600 IN RRSIG DNSKEY 13 2 3600 20300101000000 20200101000000 370 example.com. c2lnbmF0dXJl",
+	"www.example.com. 300 IN A 93.184.216.34",
+	"www.example.com. 300 IN RRSIG A 13 3 300 20300101000000 20200101000000 370 example.com. c2lnbmF0dXJl",
+}
+
+// newDNSSECChainTransport returns a [DNSTransport] serving [dnssecChainRecords].
+func newDNSSECChainTransport(t *testing.T, failing string) DNSTransport {
+	return transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		assert.NotZero(t, query.Flags&dnscodec.QueryFlagDNSSec)
+		if query.Name == failing {
+			return nil, errors.New("mocked error")
+		}
+		queryMsg := runtimex.PanicOnError1(query.NewMsg())
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		respMsg.RecursionAvailable = true
+		for _, record := range dnssecChainRecords {
+			rr := runtimex.PanicOnError1(dns.NewRR(record))
+			if rr.Header().Name != query.Name {
+				continue
+			}
+			if sig, ok := rr.(*dns.RRSIG); (ok && sig.TypeCovered == query.Type) || rr.Header().Rrtype == query.Type {
+				respMsg.Answer = append(respMsg.Answer, rr)
+			}
+		}
+		return dnscodec.ParseResponse(queryMsg, respMsg)
+	}}
+}
+
+func TestResolverChainFetch(t *testing.T) {
+	r := NewResolver(newDNSSECChainTransport(t, ""))
+	chain, err := r.ChainFetch(context.Background(), "WWW.Example.COM", dns.TypeA)
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.com.", chain.Name)
+	assert.Equal(t, dns.TypeA, chain.Type)
+
+	type zone struct {
+		name   string
+		ds     int
+		dnskey int
+	}
+	var got []zone
+	for _, z := range chain.Zones {
+		got = append(got, zone{z.Name, len(z.DS), len(z.DNSKEY)})
+	}
+	assert.Equal(t, []zone{
+		{".", 0, 2},
+		{"com.", 2, 2},
+		{"example.com.", 2, 2},
+	}, got)
+	require.Len(t, chain.Target, 2)
+	assert.Equal(t, dns.TypeA, chain.Target[0].Header().Rrtype)
+	assert.Equal(t, dns.TypeRRSIG, chain.Target[1].Header().Rrtype)
+}
+
+func TestResolverChainFetchFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// failing is the name for which the transport fails.
+		failing string
+
+		// qtype is the target query type.
+		qtype uint16
+
+		// wantErr is the expected error or nil to accept any error.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:    "root DNSKEY failure",
+			failing: ".",
+			qtype:   dns.TypeA,
+		},
+
+		{
+			name:    "DS failure",
+			failing: "com.",
+			qtype:   dns.TypeA,
+		},
+
+		{
+			name:    "target failure",
+			failing: "www.example.com.",
+			qtype:   dns.TypeA,
+		},
+
+		{
+			name:    "target without records",
+			qtype:   dns.TypeAAAA,
+			wantErr: dnscodec.ErrNoData,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewResolver(newDNSSECChainTransport(t, tc.failing))
+			chain, err := r.ChainFetch(context.Background(), "www.example.com", tc.qtype)
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+			}
+			assert.Nil(t, chain)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// dnsStreamDialExchangeMsg dials a TCP connection with the endpoint, performs
+// the TLS handshake using the factory when config is not nil, and then calls
+// [dnsStreamExchangeMsg]. When m is not nil, we also save the TLS connection
+// state and the raw messages into it.
+func dnsStreamDialExchangeMsg(ctx context.Context, dialer NetDialer, endpoint netip.AddrPort,
+	factory TLSClientFactory, config *tls.Config, queryMsg *dns.Msg, m *DNSMeasurement) (*dns.Msg, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if config != nil {
+		tconn := factory.NewTLSClient(conn, config)
+		if err := tconn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		if m != nil {
+			state := tconn.ConnectionState()
+			m.TLS = &state
+		}
+		conn = tconn
+	}
+	return dnsStreamExchangeMsg(ctx, conn, queryMsg, m)
+}
+
+// errDNSStreamQueryTooLarge indicates that a query does not fit the two-byte length prefix.
+var errDNSStreamQueryTooLarge = errors.New("query too large for stream framing")
+
+// dnsStreamExchangeMsg sends a query message and receives the response message over a
+// stream connection using the two-byte length framing defined by RFC 1035. We ensure
+// that the response matches the query but do not map the response code to errors.
+//
+// We only honor deadlines from the context; canceling the context without a
+// deadline does not interrupt I/O. When m is not nil, we also save the raw
+// messages into it.
+func dnsStreamExchangeMsg(ctx context.Context, conn net.Conn, queryMsg *dns.Msg, m *DNSMeasurement) (*dns.Msg, error) {
+	// 1. use the context deadline to limit the lifetime
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// 2. send the query and receive the response
+	respMsg, err := dnsStreamRoundTrip(conn, queryMsg, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. make sure the response matches the query
+	if _, err := dnscodec.ValidateResponseForQuery(queryMsg, respMsg); err != nil {
+		return nil, err
+	}
+	return respMsg, nil
+}
+
+// dnsStreamRoundTrip writes the query message and reads the response message
+// without making sure that the response matches the query. When m is not nil,
+// we also save the raw messages into it.
+func dnsStreamRoundTrip(rw io.ReadWriter, queryMsg *dns.Msg, m *DNSMeasurement) (*dns.Msg, error) {
+	rawQuery, err := dnsStreamWriteMsg(rw, queryMsg)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		m.RawQuery = rawQuery
+	}
+	respMsg, rawResp, err := dnsStreamReadMsg(rw)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		m.Elapsed = time.Since(m.Started)
+		m.RawResponse = rawResp
+	}
+	return respMsg, nil
+}
+
+// dnsStreamWriteMsg serializes and writes a message using the two-byte length
+// framing defined by RFC 1035 using a single write and returns the raw message.
+func dnsStreamWriteMsg(w io.Writer, msg *dns.Msg) ([]byte, error) {
+	rawMsg, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawMsg) > dns.MaxMsgSize {
+		return nil, errDNSStreamQueryTooLarge
+	}
+	frame := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(rawMsg)), uint16(len(rawMsg)))
+	if _, err := w.Write(append(frame, rawMsg...)); err != nil {
+		return nil, err
+	}
+	return rawMsg, nil
+}
+
+// dnsStreamReadMsg reads and parses a message using the two-byte length
+// framing defined by RFC 1035 and returns the message and the raw message.
+func dnsStreamReadMsg(r io.Reader) (*dns.Msg, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	rawMsg := make([]byte, binary.BigEndian.Uint16(header))
+	if _, err := io.ReadFull(r, rawMsg); err != nil {
+		return nil, nil, err
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(rawMsg); err != nil {
+		return nil, nil, err
+	}
+	return msg, rawMsg, nil
+}
+
+// dnsStreamDialTransport implements [DNSTransport] and [DNSMsgTransport] by
+// dialing a new connection for each exchange using [dnsStreamDialExchangeMsg],
+// which allows using DNS over TCP and DNS over TLS as [*Resolver] transports.
+type dnsStreamDialTransport struct {
+	// config is the TLS config or nil when using DNS over TCP.
+	config *tls.Config
+
+	// dialer is the [NetDialer] to use.
+	dialer NetDialer
+
+	// disableEDNS causes Exchange to omit the EDNS(0) OPT record.
+	disableEDNS bool
+
+	// endpoint is the server endpoint.
+	endpoint netip.AddrPort
+
+	// factory is the [TLSClientFactory] to use when config is not nil.
+	factory TLSClientFactory
+
+	// maxSize is the maximum response size Exchange advertises or zero
+	// to use [dnscodec.QueryMaxResponseSizeTCP].
+	maxSize uint16
+}
+
+// Ensure that [*dnsStreamDialTransport] implements [DNSExtendedTransport] and [DNSMsgTransport].
+var (
+	_ DNSExtendedTransport = &dnsStreamDialTransport{}
+	_ DNSMsgTransport      = &dnsStreamDialTransport{}
+)
+
+// Exchange implements [DNSTransport].
+func (dt *dnsStreamDialTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return dt.exchange(ctx, query, nil)
+}
+
+// ExchangeExtended implements [DNSExtendedTransport].
+func (dt *dnsStreamDialTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	network := "tcp"
+	if dt.config != nil {
+		network = "dot"
+	}
+	m := newDNSMeasurement(network, dt.endpoint, query)
+	m.complete(dt.exchange(ctx, query, m))
+	return m.Response, m
+}
+
+// exchange implements Exchange and ExchangeExtended, saving the TLS connection
+// state and the raw messages into the given [*DNSMeasurement] unless it is nil.
+func (dt *dnsStreamDialTransport) exchange(
+	ctx context.Context, query *dnscodec.Query, m *DNSMeasurement) (*dnscodec.Response, error) {
+	query = query.Clone()
+	query.MaxSize = dnscodec.QueryMaxResponseSizeTCP
+	if dt.maxSize > 0 {
+		query.MaxSize = dt.maxSize
+	}
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, err
+	}
+	if dt.disableEDNS {
+		queryMsg.Extra = slices.DeleteFunc(queryMsg.Extra, func(rr dns.RR) bool {
+			return rr.Header().Rrtype == dns.TypeOPT
+		})
+	}
+	respMsg, err := dnsStreamDialExchangeMsg(ctx, dt.dialer, dt.endpoint, dt.factory, dt.config, queryMsg, m)
+	if err != nil {
+		return nil, err
+	}
+	return dnscodec.ParseResponse(queryMsg, respMsg)
+}
+
+// ExchangeMsg implements [DNSMsgTransport].
+func (dt *dnsStreamDialTransport) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	return dnsStreamDialExchangeMsg(ctx, dt.dialer, dt.endpoint, dt.factory, dt.config, queryMsg, nil)
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// startDNSServer starts a [*dns.Server] using the configured Listener
+// or PacketConn and shuts it down when the test completes.
+func startDNSServer(t *testing.T, server *dns.Server) {
+	t.Helper()
+
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+}
+
+// newStreamDNSServer starts a TCP [*dns.Server] using the given handler and returns its address.
+func newStreamDNSServer(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{Listener: listener, Handler: handler})
+	return listener.Addr().String()
+}
+
+// answerWithA answers every query with an A record.
+func answerWithA(w dns.ResponseWriter, queryMsg *dns.Msg) {
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	respMsg.Answer = append(respMsg.Answer, &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   queryMsg.Question[0].Name,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		A: net.IPv4(8, 8, 8, 8),
+	})
+	w.WriteMsg(respMsg)
+}
+
+func TestDNSStreamExchangeMsg(t *testing.T) {
+	address := newStreamDNSServer(t, answerWithA)
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	respMsg, err := dnsStreamExchangeMsg(context.Background(), conn, queryMsg, nil)
+	require.NoError(t, err)
+	require.Len(t, respMsg.Answer, 1)
+}
+
+func TestDNSStreamExchangeMsgErrors(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// handler is the server handler.
+		handler dns.HandlerFunc
+
+		// wantErr is the error to match, if not nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name: "response not matching the query",
+			handler: func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+				respMsg := new(dns.Msg)
+				respMsg.SetReply(queryMsg)
+				respMsg.Id++
+				w.WriteMsg(respMsg)
+			},
+			wantErr: dnscodec.ErrInvalidResponse,
+		},
+
+		{
+			name: "connection closed",
+			handler: func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+				w.Close()
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			address := newStreamDNSServer(t, tc.handler)
+			conn, err := net.Dial("tcp", address)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			queryMsg := new(dns.Msg)
+			queryMsg.SetQuestion("example.com.", dns.TypeA)
+			_, err = dnsStreamExchangeMsg(context.Background(), conn, queryMsg, nil)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestDNSStreamExchangeMsgWriteFailure(t *testing.T) {
+	expectedErr := errors.New("write failed")
+	conn := &netstub.FuncConn{
+		WriteFunc: func([]byte) (int, error) {
+			return 0, expectedErr
+		},
+	}
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	_, err := dnsStreamExchangeMsg(context.Background(), conn, queryMsg, nil)
+	require.ErrorIs(t, err, expectedErr)
+}
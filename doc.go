@@ -13,11 +13,18 @@
 // and [Resolver].
 //
 // A [*Resolver] also depends on a [DNSTransport]. This package includes
-// [DNSOverUDPTransport], which implements [DNSTransport] for DNS-over-UDP
-// but you can also use [github.com/bassosimone/dnsoverhttps] and
+// [DNSOverUDPTransport], which implements [DNSTransport] for DNS-over-UDP,
+// [DNSOverUDPUnconnectedTransport], which uses unconnected sockets to also
+// observe responses coming from unexpected sources, and [DNSOverUDPMuxTransport],
+// which multiplexes queries over a single socket. You can also use [github.com/bassosimone/dnsoverhttps] and
 // [github.com/bassosimone/dnsoverstream] as transports. Thus, the [*Resolver]
 // can query using DNS over UDP, TCP, TLS, QUIC, HTTPS, and HTTP3.
 //
+// The transports creating a socket for each exchange do not own resources
+// between exchanges. The [*DNSOverUDPMuxTransport] and [*DNSOverStreamTransport]
+// instead own sockets until closed: call [*Resolver.Close] when done to
+// close all the transports implementing [io.Closer].
+//
 // This package focuses on measuring the internet, therefore it is optimized
 // for simplicity and does not implement performance optimizations such as
 // happy eyeballs inside its [*Dialer].
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// HTTPClient abstracts over [*http.Client].
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Ensure that [*http.Client] implements [HTTPClient].
+var _ HTTPClient = &http.Client{}
+
+// DoHHealthChecker checks the health of a DNS-over-HTTPS endpoint by sending
+// the same query using both GET and POST as documented by RFC 8484.
+//
+// This package does not implement DNS over HTTPS, therefore we use
+// an [HTTPClient] directly, which also allows us to inspect the
+// HTTP version and the server certificate.
+//
+// Construct using [NewDoHHealthChecker].
+type DoHHealthChecker struct {
+	// Client is the [HTTPClient] to use.
+	//
+	// Set by [NewDoHHealthChecker] to the user-provided value.
+	Client HTTPClient
+
+	// URL is the DNS-over-HTTPS URL (e.g., "https://dns.google/dns-query").
+	//
+	// Set by [NewDoHHealthChecker] to the user-provided value.
+	URL string
+
+	// Domain is the domain to query.
+	//
+	// Set by [NewDoHHealthChecker] to "example.com".
+	Domain string
+
+	// Timeout is the timeout of each request.
+	//
+	// Set by [NewDoHHealthChecker] to [DefaultResolverTimeout].
+	Timeout time.Duration
+}
+
+// DoHHealthReport is the report produced by [*DoHHealthChecker].
+type DoHHealthReport struct {
+	// URL is the URL we checked.
+	URL string
+
+	// GET is the result of checking the GET method.
+	GET *DoHMethodHealth
+
+	// POST is the result of checking the POST method.
+	POST *DoHMethodHealth
+
+	// CertificateNotBefore is the beginning of the validity window
+	// of the server certificate or zero if unknown.
+	CertificateNotBefore time.Time
+
+	// CertificateNotAfter is the end of the validity window of
+	// the server certificate or zero if unknown.
+	CertificateNotAfter time.Time
+
+	// CertificateValid is true when we know the server certificate and
+	// the current time is within its validity window.
+	CertificateValid bool
+
+	// CertificateChain is the certificate chain presented by the server,
+	// which we also save when the verification fails, or nil.
+	CertificateChain []*x509.Certificate
+
+	// CertificateVerified is true when the chain was successfully verified.
+	CertificateVerified bool
+}
+
+// Healthy returns true when both methods work and the certificate is valid.
+func (r *DoHHealthReport) Healthy() bool {
+	return r.GET.Err == nil && r.POST.Err == nil && r.CertificateValid
+}
+
+// DoHMethodHealth is the result of checking a single HTTP method.
+type DoHMethodHealth struct {
+	// Method is the HTTP method.
+	Method string
+
+	// StatusCode is the HTTP status code or zero.
+	StatusCode int
+
+	// ContentType is the response content type or empty.
+	ContentType string
+
+	// Proto is the HTTP version (e.g., "HTTP/2.0") or empty.
+	Proto string
+
+	// ALPN is the negotiated ALPN protocol (e.g., "h2") or empty. When the
+	// client offers "h2", using HTTP/1.1 may indicate a downgrade.
+	ALPN string
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Elapsed is the time elapsed performing the request.
+	Elapsed time.Duration
+}
+
+// ErrDoHHealthCheck indicates that the DNS-over-HTTPS endpoint misbehaved.
+var ErrDoHHealthCheck = errors.New("DNS-over-HTTPS health check failed")
+
+// NewDoHHealthChecker creates a new [*DoHHealthChecker].
+func NewDoHHealthChecker(client HTTPClient, URL string) *DoHHealthChecker {
+	return &DoHHealthChecker{
+		Client:  client,
+		URL:     URL,
+		Domain:  "example.com",
+		Timeout: DefaultResolverTimeout,
+	}
+}
+
+// Check checks the health of the endpoint.
+func (hc *DoHHealthChecker) Check(ctx context.Context) *DoHHealthReport {
+	report := &DoHHealthReport{URL: hc.URL}
+	report.GET = hc.checkMethod(ctx, http.MethodGet, report)
+	report.POST = hc.checkMethod(ctx, http.MethodPost, report)
+	if !report.CertificateNotAfter.IsZero() {
+		now := time.Now()
+		report.CertificateValid = !now.Before(report.CertificateNotBefore) &&
+			!now.After(report.CertificateNotAfter)
+	}
+	return report
+}
+
+// checkMethod checks a single HTTP method and records the server
+// certificate validity window inside the report, if available.
+func (hc *DoHHealthChecker) checkMethod(
+	ctx context.Context, method string, report *DoHHealthReport) *DoHMethodHealth {
+	started := time.Now()
+	health := &DoHMethodHealth{Method: method}
+	health.Err = hc.roundTrip(ctx, health, report)
+	health.Failure = ClassifyError(health.Err)
+	health.Elapsed = time.Since(started)
+	return health
+}
+
+// roundTrip performs the round trip for checkMethod.
+func (hc *DoHHealthChecker) roundTrip(
+	ctx context.Context, health *DoHMethodHealth, report *DoHHealthReport) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+
+	// 1. create the query
+	query := dnscodec.NewQuery(hc.Domain, dns.TypeA)
+	query.MaxSize = dnscodec.QueryMaxResponseSizeTCP
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return err
+	}
+
+	// 2. perform the exchange and save the response metadata
+	resp, _, err := dohExchangeMsg(ctx, hc.Client, health.Method, hc.URL, queryMsg)
+	var state tls.ConnectionState
+	if resp != nil && resp.TLS != nil {
+		state = *resp.TLS
+	}
+	if chain := tlsPeerCertificates(state, err); len(chain) > 0 {
+		report.CertificateChain = chain
+		report.CertificateVerified = len(state.VerifiedChains) > 0
+	}
+	if resp != nil {
+		health.StatusCode = resp.StatusCode
+		health.ContentType = resp.Header.Get("Content-Type")
+		health.Proto = resp.Proto
+		if resp.TLS != nil {
+			health.ALPN = resp.TLS.NegotiatedProtocol
+		}
+		if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+			report.CertificateNotBefore = resp.TLS.PeerCertificates[0].NotBefore
+			report.CertificateNotAfter = resp.TLS.PeerCertificates[0].NotAfter
+		}
+	}
+	return err
+}
+
+// dohExchangeMsg sends a query message to the given URL using the given HTTP
+// method and returns the HTTP response, whose body we have already consumed,
+// along with the response message. We return the HTTP response, if any, also
+// in case of failure, to allow inspecting it.
+//
+// We zero the query ID as recommended by RFC 8484 and we ensure that the
+// response matches the query but do not map the response code to errors.
+func dohExchangeMsg(ctx context.Context,
+	client HTTPClient, method, URL string, queryMsg *dns.Msg) (*http.Response, *dns.Msg, error) {
+	// 1. serialize the query using a zero ID
+	queryMsg = queryMsg.Copy()
+	queryMsg.Id = 0
+	rawQuery, err := queryMsg.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2. create the request for the given method
+	var req *http.Request
+	switch method {
+	case http.MethodGet:
+		var parsed *url.URL
+		parsed, err = url.Parse(URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		values := parsed.Query()
+		values.Set("dns", base64.RawURLEncoding.EncodeToString(rawQuery))
+		parsed.RawQuery = values.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	default:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, URL, bytes.NewReader(rawQuery))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/dns-message")
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	// 3. perform the round trip
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	// 4. make sure the response looks like a DNS-over-HTTPS response
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil, fmt.Errorf("%w: unexpected status code %d", ErrDoHHealthCheck, resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/dns-message" {
+		return resp, nil, fmt.Errorf("%w: unexpected content type %q", ErrDoHHealthCheck, contentType)
+	}
+	rawResp, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return resp, nil, err
+	}
+	respMsg := new(dns.Msg)
+	if err := respMsg.Unpack(rawResp); err != nil {
+		return resp, nil, err
+	}
+	if _, err := dnscodec.ValidateResponseForQuery(queryMsg, respMsg); err != nil {
+		return resp, nil, err
+	}
+	return resp, respMsg, nil
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dohHandler is a minimal DNS-over-HTTPS handler answering with empty responses.
+type dohHandler struct {
+	// contentType is the content type to use.
+	contentType string
+
+	// disablePOST causes the handler to reject POST requests.
+	disablePOST bool
+}
+
+func (h *dohHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		rawQuery []byte
+		err      error
+	)
+	switch {
+	case r.Method == http.MethodGet:
+		rawQuery, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case r.Method == http.MethodPost && !h.disablePOST:
+		rawQuery, err = io.ReadAll(r.Body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	queryMsg := new(dns.Msg)
+	if err != nil || queryMsg.Unpack(rawQuery) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	rawResp, _ := respMsg.Pack()
+	w.Header().Set("Content-Type", h.contentType)
+	w.Write(rawResp)
+}
+
+func TestDoHHealthChecker(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// handler is the handler to use.
+		handler *dohHandler
+
+		// tls indicates whether to use TLS.
+		tls bool
+
+		// http2 indicates whether to enable HTTP/2.
+		http2 bool
+
+		// wantProto is the expected HTTP version on success.
+		wantProto string
+
+		// wantALPN is the expected ALPN on success.
+		wantALPN string
+
+		// wantGET is the expected error for GET or nil.
+		wantGET error
+
+		// wantPOST is the expected error for POST or nil.
+		wantPOST error
+
+		// wantHealthy is the expected health.
+		wantHealthy bool
+	}
+
+	tests := []testCase{
+		{
+			name:        "healthy",
+			handler:     &dohHandler{contentType: "application/dns-message"},
+			tls:         true,
+			wantProto:   "HTTP/1.1",
+			wantHealthy: true,
+		},
+
+		{
+			name:        "healthy using HTTP/2",
+			handler:     &dohHandler{contentType: "application/dns-message"},
+			tls:         true,
+			http2:       true,
+			wantProto:   "HTTP/2.0",
+			wantALPN:    "h2",
+			wantHealthy: true,
+		},
+
+		{
+			name:        "wrong content type",
+			handler:     &dohHandler{contentType: "text/plain"},
+			tls:         true,
+			wantGET:     ErrDoHHealthCheck,
+			wantPOST:    ErrDoHHealthCheck,
+			wantHealthy: false,
+		},
+
+		{
+			name:        "POST not supported",
+			handler:     &dohHandler{contentType: "application/dns-message", disablePOST: true},
+			tls:         true,
+			wantPOST:    ErrDoHHealthCheck,
+			wantProto:   "HTTP/1.1",
+			wantHealthy: false,
+		},
+
+		{
+			name:        "no certificate",
+			handler:     &dohHandler{contentType: "application/dns-message"},
+			tls:         false,
+			wantProto:   "HTTP/1.1",
+			wantHealthy: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(tc.handler)
+			server.EnableHTTP2 = tc.http2
+			if tc.tls {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+			defer server.Close()
+
+			checker := NewDoHHealthChecker(server.Client(), server.URL+"/dns-query")
+			report := checker.Check(context.Background())
+			assert.Equal(t, tc.wantHealthy, report.Healthy())
+			assert.Equal(t, tc.tls, report.CertificateValid)
+			assert.Equal(t, tc.tls, report.CertificateVerified)
+			assert.Equal(t, tc.tls, len(report.CertificateChain) > 0)
+
+			for _, entry := range []struct {
+				health *DoHMethodHealth
+				want   error
+			}{{report.GET, tc.wantGET}, {report.POST, tc.wantPOST}} {
+				require.NotNil(t, entry.health)
+				if entry.want != nil {
+					require.ErrorIs(t, entry.health.Err, entry.want)
+					assert.Equal(t, FailureUnknown, entry.health.Failure)
+					continue
+				}
+				require.NoError(t, entry.health.Err)
+				assert.Equal(t, http.StatusOK, entry.health.StatusCode)
+				assert.Equal(t, "application/dns-message", entry.health.ContentType)
+				assert.Equal(t, tc.wantProto, entry.health.Proto)
+				assert.Equal(t, tc.wantALPN, entry.health.ALPN)
+			}
+		})
+	}
+}
+
+func TestDoHHealthCheckerRequestFailure(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	checker := NewDoHHealthChecker(httpClientFunc(func(*http.Request) (*http.Response, error) {
+		return nil, expectedErr
+	}), "https://dns.example.com/dns-query")
+	report := checker.Check(context.Background())
+	require.ErrorIs(t, report.GET.Err, expectedErr)
+	require.ErrorIs(t, report.POST.Err, expectedErr)
+	assert.False(t, report.Healthy())
+}
+
+func TestDoHHealthCheckerUntrustedCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(&dohHandler{contentType: "application/dns-message"})
+	defer server.Close()
+
+	checker := NewDoHHealthChecker(&http.Client{}, server.URL+"/dns-query")
+	report := checker.Check(context.Background())
+	require.Error(t, report.GET.Err)
+	require.Error(t, report.POST.Err)
+	assert.False(t, report.CertificateVerified)
+	require.NotEmpty(t, report.CertificateChain)
+	assert.Equal(t, server.Certificate().Raw, report.CertificateChain[0].Raw)
+}
+
+func TestDoHHealthCheckerURLWithQuery(t *testing.T) {
+	var queries []url.Values
+	handler := &dohHandler{contentType: "application/dns-message"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			queries = append(queries, r.URL.Query())
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	checker := NewDoHHealthChecker(server.Client(), server.URL+"/dns-query?token=abc")
+	report := checker.Check(context.Background())
+	require.NoError(t, report.GET.Err)
+	require.NoError(t, report.POST.Err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "abc", queries[0].Get("token"))
+	assert.NotEmpty(t, queries[0].Get("dns"))
+}
+
+func TestDoHHealthCheckerInvalidDomain(t *testing.T) {
+	checker := NewDoHHealthChecker(http.DefaultClient, "https://dns.example.com/dns-query")
+	checker.Domain = "\t"
+	report := checker.Check(context.Background())
+	require.Error(t, report.GET.Err)
+	require.Error(t, report.POST.Err)
+}
+
+// httpClientFunc allows to mock [HTTPClient].
+type httpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (fx httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return fx(req)
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DuplicateSummary is a compact summary of several responses to the same
+// query (e.g., the responses received while lingering or using an unconnected
+// socket) suitable for measurement records.
+//
+// Construct using [SummarizeDuplicates].
+type DuplicateSummary struct {
+	// Total is the number of responses.
+	Total int
+
+	// Groups contains the groups of identical responses in order of first appearance.
+	Groups []*DuplicateGroup
+
+	// Repeated is true when at least two responses contain the same answers,
+	// regardless of whether they are identical (e.g., differing TTLs).
+	Repeated bool
+
+	// Conflicting is true when at least two responses contain different answers,
+	// which is typical of on-path injection.
+	Conflicting bool
+}
+
+// DuplicateGroup is a group of identical responses within a [*DuplicateSummary].
+type DuplicateGroup struct {
+	// Response is the first response of the group.
+	Response *dnscodec.Response
+
+	// Count is the number of identical responses.
+	Count int
+
+	// Answers contains the sorted type and data of the valid RRs.
+	Answers []string
+}
+
+// SummarizeDuplicates groups the responses that are identical once serialized,
+// counts them, and classifies whether the answers are repeated or conflicting.
+//
+// We ignore nil responses. We compare the message serializations rather than the
+// raw datagrams, hence we consider identical the responses differing only in how
+// names are compressed.
+func SummarizeDuplicates(responses []*dnscodec.Response) *DuplicateSummary {
+	// 1. group the identical responses
+	summary := &DuplicateSummary{}
+	groups := make(map[string]*DuplicateGroup)
+	for _, resp := range responses {
+		if resp == nil {
+			continue
+		}
+		summary.Total++
+		key := duplicateKey(resp.Response)
+		if group := groups[key]; group != nil {
+			group.Count++
+			continue
+		}
+		group := &DuplicateGroup{Response: resp, Count: 1, Answers: duplicateAnswers(resp)}
+		groups[key] = group
+		summary.Groups = append(summary.Groups, group)
+	}
+
+	// 2. classify the answers across groups
+	for idx, group := range summary.Groups {
+		summary.Repeated = summary.Repeated || group.Count > 1
+		for _, other := range summary.Groups[idx+1:] {
+			if slices.Equal(group.Answers, other.Answers) {
+				summary.Repeated = true
+			} else {
+				summary.Conflicting = true
+			}
+		}
+	}
+	return summary
+}
+
+// duplicateKey returns the key used to group identical response messages.
+func duplicateKey(respMsg *dns.Msg) string {
+	rawResp, err := respMsg.Pack()
+	if err != nil {
+		return respMsg.String() // unlikely for a parsed message
+	}
+	return string(rawResp)
+}
+
+// duplicateAnswers returns the sorted type and data of the valid RRs.
+func duplicateAnswers(resp *dnscodec.Response) []string {
+	answers := make([]string, 0, len(resp.ValidRRs))
+	for _, rr := range resp.ValidRRs {
+		answers = append(answers, dns.TypeToString[rr.Header().Rrtype]+" "+strings.TrimSpace(campaignRRData(rr)))
+	}
+	slices.Sort(answers)
+	return answers
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDuplicateResponse returns a response to an A query for example.com
+// containing the given records.
+func newDuplicateResponse(records ...string) *dnscodec.Response {
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	queryMsg.Id = 1
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	respMsg.RecursionAvailable = true
+	for _, record := range records {
+		respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+	}
+	return runtimex.PanicOnError1(dnscodec.ParseResponse(queryMsg, respMsg))
+}
+
+func TestSummarizeDuplicates(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// responses contains the responses to summarize.
+		responses []*dnscodec.Response
+
+		// wantCounts contains the expected count of each group.
+		wantCounts []int
+
+		// wantRepeated is the expected Repeated value.
+		wantRepeated bool
+
+		// wantConflicting is the expected Conflicting value.
+		wantConflicting bool
+	}
+
+	tests := []testCase{
+		{
+			name:       "no responses",
+			responses:  nil,
+			wantCounts: nil,
+		},
+
+		{
+			name:       "single response",
+			responses:  []*dnscodec.Response{newDuplicateResponse("example.com. 300 IN A 192.0.2.1")},
+			wantCounts: []int{1},
+		},
+
+		{
+			name: "identical responses",
+			responses: []*dnscodec.Response{
+				newDuplicateResponse("example.com. 300 IN A 192.0.2.1"),
+				nil,
+				newDuplicateResponse("example.com. 300 IN A 192.0.2.1"),
+			},
+			wantCounts:   []int{2},
+			wantRepeated: true,
+		},
+
+		{
+			name: "same answers with different TTLs",
+			responses: []*dnscodec.Response{
+				newDuplicateResponse("example.com. 300 IN A 192.0.2.1", "example.com. 300 IN A 192.0.2.2"),
+				newDuplicateResponse("example.com. 60 IN A 192.0.2.2", "example.com. 60 IN A 192.0.2.1"),
+			},
+			wantCounts:   []int{1, 1},
+			wantRepeated: true,
+		},
+
+		{
+			name: "conflicting answers",
+			responses: []*dnscodec.Response{
+				newDuplicateResponse("example.com. 300 IN A 10.10.34.35"),
+				newDuplicateResponse("example.com. 300 IN A 192.0.2.1"),
+				newDuplicateResponse("example.com. 300 IN A 192.0.2.1"),
+			},
+			wantCounts:      []int{1, 2},
+			wantRepeated:    true,
+			wantConflicting: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			summary := SummarizeDuplicates(tc.responses)
+			var counts []int
+			total := 0
+			for _, group := range summary.Groups {
+				counts = append(counts, group.Count)
+				total += group.Count
+			}
+			assert.Equal(t, tc.wantCounts, counts)
+			assert.Equal(t, total, summary.Total)
+			assert.Equal(t, tc.wantRepeated, summary.Repeated)
+			assert.Equal(t, tc.wantConflicting, summary.Conflicting)
+		})
+	}
+}
+
+func TestSummarizeDuplicatesAnswers(t *testing.T) {
+	first := newDuplicateResponse("example.com. 300 IN A 192.0.2.2", "example.com. 300 IN A 192.0.2.1")
+	summary := SummarizeDuplicates([]*dnscodec.Response{first})
+	require.Len(t, summary.Groups, 1)
+	assert.Same(t, first, summary.Groups[0].Response)
+	assert.Equal(t, []string{"A 192.0.2.1", "A 192.0.2.2"}, summary.Groups[0].Answers)
+}
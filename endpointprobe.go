@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// EndpointProber sends the same query to a resolver using several protocols
+// and compares the results, which is the canonical experiment to determine
+// whether encrypted DNS is blocked.
+//
+// We probe DNS over UDP, TCP, and TLS and, when DoHURL is set, DNS over
+// HTTPS. We do not probe DNS over QUIC, which this package does not implement.
+//
+// Construct using [NewEndpointProber].
+type EndpointProber struct {
+	// Dialer is the [NetDialer] to use to create connections.
+	//
+	// Set by [NewEndpointProber] to the user-provided value.
+	Dialer NetDialer
+
+	// Domain is the domain to query.
+	//
+	// Set by [NewEndpointProber] to "example.com".
+	Domain string
+
+	// Type is the query type.
+	//
+	// Set by [NewEndpointProber] to [dns.TypeA].
+	Type uint16
+
+	// Do53Port is the port to use for DNS over UDP and TCP.
+	//
+	// Set by [NewEndpointProber] to 53.
+	Do53Port uint16
+
+	// DoTPort is the port to use for DNS over TLS.
+	//
+	// Set by [NewEndpointProber] to 853.
+	DoTPort uint16
+
+	// TLSClientFactory is the [TLSClientFactory] to use for DNS over TLS.
+	//
+	// Set by [NewEndpointProber] to [StdlibTLSClientFactory].
+	TLSClientFactory TLSClientFactory
+
+	// TLSConfig is the OPTIONAL TLS config to use for DNS over TLS. When nil,
+	// we verify the certificate against the resolver IP address.
+	TLSConfig *tls.Config
+
+	// DoHURL is the OPTIONAL URL to use for DNS over HTTPS.
+	DoHURL string
+
+	// HTTPClient is the [HTTPClient] to use for DNS over HTTPS.
+	//
+	// Set by [NewEndpointProber] to [http.DefaultClient].
+	HTTPClient HTTPClient
+
+	// Timeout is the timeout of each protocol probe.
+	//
+	// Set by [NewEndpointProber] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewEndpointProber] to [GlobalRand].
+	Rand Rand
+}
+
+// EndpointReport is the report produced by [*EndpointProber].
+type EndpointReport struct {
+	// Address is the resolver address.
+	Address netip.Addr
+
+	// Results contains the result of each protocol probe.
+	Results []*EndpointProtocolResult
+
+	// AnswersEqual is true when at least two protocols received a response
+	// and all the responses contain the same answers.
+	AnswersEqual bool
+}
+
+// EndpointProtocolResult is the result of probing a single protocol.
+type EndpointProtocolResult struct {
+	// Protocol is the protocol ("udp", "tcp", "dot", or "doh").
+	Protocol string
+
+	// Reachable is true when we received a response matching the query.
+	Reachable bool
+
+	// Rcode is the response code when Reachable is true.
+	Rcode int
+
+	// Answers contains the sorted answers of the query type.
+	Answers []string
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Elapsed is the time elapsed probing the protocol.
+	Elapsed time.Duration
+}
+
+// NewEndpointProber creates a new [*EndpointProber].
+func NewEndpointProber(dialer NetDialer) *EndpointProber {
+	return &EndpointProber{
+		Dialer:           dialer,
+		Domain:           "example.com",
+		Type:             dns.TypeA,
+		Do53Port:         53,
+		DoTPort:          853,
+		TLSClientFactory: StdlibTLSClientFactory{},
+		HTTPClient:       http.DefaultClient,
+		Timeout:          DefaultResolverTimeout,
+		Rand:             GlobalRand{},
+	}
+}
+
+// ProbeEndpoint probes the given resolver address using each protocol.
+func (p *EndpointProber) ProbeEndpoint(ctx context.Context, address netip.Addr) *EndpointReport {
+	// 1. run the probes sequentially, to avoid them interfering
+	endpoint53 := netip.AddrPortFrom(address, p.Do53Port)
+	report := &EndpointReport{Address: address}
+	report.Results = append(report.Results, p.probe(ctx, "udp", func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		return NewDNSOverUDPTransport(p.Dialer, endpoint53).ExchangeMsg(ctx, queryMsg)
+	}))
+	report.Results = append(report.Results, p.probe(ctx, "tcp", func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		return dnsStreamDialExchangeMsg(ctx, p.Dialer, endpoint53, nil, nil, queryMsg, nil)
+	}))
+	report.Results = append(report.Results, p.probe(ctx, "dot", func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		config := &tls.Config{ServerName: address.String()}
+		if p.TLSConfig != nil {
+			config = p.TLSConfig
+		}
+		endpoint := netip.AddrPortFrom(address, p.DoTPort)
+		return dnsStreamDialExchangeMsg(ctx, p.Dialer, endpoint, p.TLSClientFactory, config, queryMsg, nil)
+	}))
+	if p.DoHURL != "" {
+		report.Results = append(report.Results, p.probe(ctx, "doh", func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+			_, respMsg, err := dohExchangeMsg(ctx, p.HTTPClient, http.MethodPost, p.DoHURL, queryMsg)
+			return respMsg, err
+		}))
+	}
+
+	// 2. compare the answers of the reachable protocols
+	var reachable []*EndpointProtocolResult
+	for _, result := range report.Results {
+		if result.Reachable {
+			reachable = append(reachable, result)
+		}
+	}
+	report.AnswersEqual = len(reachable) >= 2
+	for _, result := range reachable[min(1, len(reachable)):] {
+		if result.Rcode != reachable[0].Rcode || !slices.Equal(result.Answers, reachable[0].Answers) {
+			report.AnswersEqual = false
+		}
+	}
+	return report
+}
+
+// probe runs a single protocol probe using the given exchange function.
+func (p *EndpointProber) probe(ctx context.Context, protocol string,
+	exchange func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error)) *EndpointProtocolResult {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	// 1. create the query message
+	result := &EndpointProtocolResult{Protocol: protocol}
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(dns.Fqdn(p.Domain), p.Type)
+	queryMsg.Id = randID(p.Rand)
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+
+	// 2. perform the exchange
+	started := time.Now()
+	respMsg, err := exchange(ctx, queryMsg)
+	result.Elapsed = time.Since(started)
+	result.Err = err
+	result.Failure = ClassifyError(err)
+	if err != nil {
+		return result
+	}
+
+	// 3. save the answers
+	result.Reachable = true
+	result.Rcode = respMsg.Rcode
+	result.Answers = []string{}
+	for _, rr := range respMsg.Answer {
+		if rr.Header().Rrtype == p.Type {
+			result.Answers = append(result.Answers, campaignRRData(rr))
+		}
+	}
+	slices.Sort(result.Answers)
+	return result
+}
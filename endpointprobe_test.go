@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointProber(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// streams enables listening on TCP and TLS.
+		streams bool
+
+		// doh enables probing a DoH server answering with empty responses.
+		doh bool
+
+		// wantReachable is the expected reachability of each protocol.
+		wantReachable map[string]bool
+
+		// wantAnswersEqual is the expected AnswersEqual value.
+		wantAnswersEqual bool
+	}
+
+	tests := []testCase{
+		{
+			name:    "all protocols reachable",
+			streams: true,
+			wantReachable: map[string]bool{
+				"udp": true,
+				"tcp": true,
+				"dot": true,
+			},
+			wantAnswersEqual: true,
+		},
+
+		{
+			name:    "only UDP reachable",
+			streams: false,
+			wantReachable: map[string]bool{
+				"udp": true,
+				"tcp": false,
+				"dot": false,
+			},
+			wantAnswersEqual: false,
+		},
+
+		{
+			name:    "DoH answers differ",
+			streams: true,
+			doh:     true,
+			wantReachable: map[string]bool{
+				"udp": true,
+				"tcp": true,
+				"dot": true,
+				"doh": true,
+			},
+			wantAnswersEqual: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, dotPort := newFingerprintServer(t, &fingerprintServerConfig{streams: tc.streams})
+
+			prober := NewEndpointProber(&net.Dialer{})
+			prober.Do53Port = endpoint.Port()
+			prober.DoTPort = dotPort
+			prober.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+			prober.Timeout = time.Second
+			if tc.doh {
+				server := httptest.NewTLSServer(&dohHandler{contentType: "application/dns-message"})
+				defer server.Close()
+				prober.HTTPClient = server.Client()
+				prober.DoHURL = server.URL + "/dns-query"
+			}
+
+			report := prober.ProbeEndpoint(context.Background(), endpoint.Addr())
+			assert.Equal(t, endpoint.Addr(), report.Address)
+			assert.Equal(t, tc.wantAnswersEqual, report.AnswersEqual)
+			require.Len(t, report.Results, len(tc.wantReachable))
+			for _, result := range report.Results {
+				want, found := tc.wantReachable[result.Protocol]
+				require.True(t, found, result.Protocol)
+				assert.Equal(t, want, result.Reachable, result.Protocol)
+				assert.Positive(t, result.Elapsed)
+				if !want {
+					assert.Error(t, result.Err)
+					assert.NotEmpty(t, result.Failure)
+					continue
+				}
+				require.NoError(t, result.Err)
+				assert.Empty(t, result.Failure)
+				if result.Protocol == "doh" {
+					assert.Empty(t, result.Answers)
+					continue
+				}
+				assert.Equal(t, []string{"93.184.216.34"}, result.Answers)
+			}
+		})
+	}
+}
+
+func TestEndpointProberDefaultTLSConfig(t *testing.T) {
+	endpoint, dotPort := newFingerprintServer(t, &fingerprintServerConfig{streams: true})
+
+	// the self-signed certificate is not valid for the IP address
+	prober := NewEndpointProber(&net.Dialer{})
+	prober.Do53Port = endpoint.Port()
+	prober.DoTPort = dotPort
+	report := prober.ProbeEndpoint(context.Background(), netip.MustParseAddr("127.0.0.1"))
+	require.Len(t, report.Results, 3)
+	assert.True(t, report.Results[1].Reachable)
+	assert.False(t, report.Results[2].Reachable)
+	assert.Equal(t, "dot", report.Results[2].Protocol)
+	var certErr *tls.CertificateVerificationError
+	assert.ErrorAs(t, report.Results[2].Err, &certErr)
+	assert.True(t, report.AnswersEqual)
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidE164Number indicates that a phone number is not a valid E.164 number.
+var ErrInvalidE164Number = errors.New("invalid E.164 number")
+
+// ErrInvalidENUMRule indicates that a NAPTR record contains an invalid regexp rule.
+var ErrInvalidENUMRule = errors.New("invalid ENUM rule")
+
+// ENUMURI is a URI obtained by applying an ENUM NAPTR rule (RFC 6116).
+type ENUMURI struct {
+	// Order is the NAPTR order.
+	Order uint16
+
+	// Preference is the NAPTR preference.
+	Preference uint16
+
+	// Service is the NAPTR service (e.g., "E2U+sip").
+	Service string
+
+	// URI is the resulting URI (e.g., "sip:info@example.com").
+	URI string
+}
+
+// ENUMDomain returns the e164.arpa domain name of the given phone number.
+//
+// The number must start with "+" and contain at most 15 digits. We ignore
+// the visual separators (e.g., "+1 (555) 123-4567").
+func ENUMDomain(number string) (string, error) {
+	digits, err := enumDigits(number)
+	if err != nil {
+		return "", err
+	}
+	labels := make([]string, 0, len(digits)+2)
+	for idx := len(digits) - 1; idx >= 0; idx-- {
+		labels = append(labels, digits[idx:idx+1])
+	}
+	labels = append(labels, "e164", "arpa")
+	return dns.Fqdn(strings.Join(labels, ".")), nil
+}
+
+// LookupNAPTR resolves a domain to its NAPTR records sorted by order
+// and preference, which is the order in which clients should process
+// them (RFC 3403). The Regexp field contains the rule in presentation
+// format, therefore backslashes are escaped.
+func (r *Resolver) LookupNAPTR(ctx context.Context, domain string) ([]*dns.NAPTR, error) {
+	naptrs, err := resolverLookupRecords[*dns.NAPTR](ctx, r, domain, dns.TypeNAPTR)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(naptrs, func(a, b *dns.NAPTR) int {
+		if a.Order != b.Order {
+			return int(a.Order) - int(b.Order)
+		}
+		return int(a.Preference) - int(b.Preference)
+	})
+	return naptrs, nil
+}
+
+// LookupENUM resolves the given phone number to URIs using ENUM.
+//
+// We only consider terminal NAPTR records (i.e., with the "u" flag) whose
+// service is E2U, and we sort the URIs by order and preference. We skip the
+// records with invalid rules and we do not follow non-terminal records. We
+// return [ErrInvalidENUMRule] when none of the records is usable.
+func (r *Resolver) LookupENUM(ctx context.Context, number string) ([]*ENUMURI, error) {
+	// 1. map the number to the domain name
+	domain, err := ENUMDomain(number)
+	if err != nil {
+		return nil, err
+	}
+	digits, _ := enumDigits(number)
+
+	// 2. fetch the NAPTR records
+	naptrs, err := r.LookupNAPTR(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. apply the terminal E2U rules, which preserves the ordering
+	var out []*ENUMURI
+	for _, naptr := range naptrs {
+		if !strings.EqualFold(naptr.Flags, "u") || !strings.HasPrefix(strings.ToUpper(naptr.Service), "E2U") {
+			continue
+		}
+		uri, err := ENUMApplyRule(unescapeCharacterString(naptr.Regexp), "+"+digits)
+		if err != nil {
+			continue
+		}
+		out = append(out, &ENUMURI{
+			Order:      naptr.Order,
+			Preference: naptr.Preference,
+			Service:    naptr.Service,
+			URI:        uri,
+		})
+	}
+	if len(out) <= 0 {
+		return nil, ErrInvalidENUMRule
+	}
+	return out, nil
+}
+
+// ENUMApplyRule applies a NAPTR regexp rule (e.g., "!^.*$!sip:info@example.com!")
+// to the given application unique string (e.g., "+15551234567").
+//
+// The first character of the rule is the delimiter and the only supported
+// flag is "i", which makes the match case insensitive (RFC 3402 Section 3.2).
+func ENUMApplyRule(rule, aus string) (string, error) {
+	// 1. split the rule into its parts
+	if len(rule) < 4 {
+		return "", ErrInvalidENUMRule
+	}
+	parts := strings.Split(rule[1:], rule[:1])
+	if len(parts) != 3 || (parts[2] != "" && parts[2] != "i") {
+		return "", ErrInvalidENUMRule
+	}
+
+	// 2. compile the regular expression
+	pattern := parts[0]
+	if parts[2] == "i" {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", errors.Join(ErrInvalidENUMRule, err)
+	}
+
+	// 3. apply the replacement
+	match := re.FindStringSubmatchIndex(aus)
+	if match == nil {
+		return "", ErrInvalidENUMRule
+	}
+	return string(re.ExpandString(nil, enumTemplate(parts[1]), aus, match)), nil
+}
+
+// enumTemplate converts a NAPTR replacement into a [*regexp.Regexp] template.
+func enumTemplate(repl string) string {
+	var sb strings.Builder
+	for idx := 0; idx < len(repl); idx++ {
+		switch ch := repl[idx]; {
+		case ch == '\\' && idx+1 < len(repl) && repl[idx+1] >= '1' && repl[idx+1] <= '9':
+			sb.WriteString("${" + repl[idx+1:idx+2] + "}")
+			idx++
+		case ch == '\\' && idx+1 < len(repl):
+			sb.WriteByte(repl[idx+1])
+			idx++
+		case ch == '$':
+			sb.WriteString("$$")
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+// enumDigits returns the digits of the given E.164 phone number.
+func enumDigits(number string) (string, error) {
+	number, found := strings.CutPrefix(strings.TrimSpace(number), "+")
+	if !found {
+		return "", ErrInvalidE164Number
+	}
+	var digits strings.Builder
+	for _, ch := range number {
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits.WriteRune(ch)
+		case strings.ContainsRune(" -.()", ch):
+			// visual separator
+		default:
+			return "", ErrInvalidE164Number
+		}
+	}
+	if digits.Len() <= 0 || digits.Len() > 15 {
+		return "", ErrInvalidE164Number
+	}
+	return digits.String(), nil
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestENUMDomain(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// number is the phone number.
+		number string
+
+		// wantDomain is the expected domain name.
+		wantDomain string
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:       "compact number",
+			number:     "+442079460123",
+			wantDomain: "3.2.1.0.6.4.9.7.0.2.4.4.e164.arpa.",
+		},
+
+		{
+			name:       "number with separators",
+			number:     " +1 (555) 123-4567 ",
+			wantDomain: "7.6.5.4.3.2.1.5.5.5.1.e164.arpa.",
+		},
+
+		{
+			name:    "missing plus sign",
+			number:  "15551234567",
+			wantErr: ErrInvalidE164Number,
+		},
+
+		{
+			name:    "invalid character",
+			number:  "+1555CALLNOW",
+			wantErr: ErrInvalidE164Number,
+		},
+
+		{
+			name:    "too many digits",
+			number:  "+1234567890123456",
+			wantErr: ErrInvalidE164Number,
+		},
+
+		{
+			name:    "no digits",
+			number:  "+",
+			wantErr: ErrInvalidE164Number,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			domain, err := ENUMDomain(tc.number)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantDomain, domain)
+		})
+	}
+}
+
+func TestENUMApplyRule(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// rule is the NAPTR regexp rule.
+		rule string
+
+		// wantURI is the expected URI.
+		wantURI string
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	tests := []testCase{
+		{
+			name:    "constant replacement",
+			rule:    "!^.*$!sip:info@example.com!",
+			wantURI: "sip:info@example.com",
+		},
+
+		{
+			name:    "back reference",
+			rule:    `!^\+44(.*)$!tel:+44-\1;svc=voice!`,
+			wantURI: "tel:+44-2079460123;svc=voice",
+		},
+
+		{
+			name:    "case insensitive with custom delimiter",
+			rule:    "/^\\+44.*$/mailto:INFO$@example.com/i",
+			wantURI: "mailto:INFO$@example.com",
+		},
+
+		{
+			name:    "escaped character",
+			rule:    `!^.*$!sip:\\info@example.com!`,
+			wantURI: `sip:\info@example.com`,
+		},
+
+		{
+			name:    "too short",
+			rule:    "!!!",
+			wantErr: true,
+		},
+
+		{
+			name:    "missing flags part",
+			rule:    "!^.*$!sip:info@example.com",
+			wantErr: true,
+		},
+
+		{
+			name:    "unsupported flag",
+			rule:    "!^.*$!sip:info@example.com!x",
+			wantErr: true,
+		},
+
+		{
+			name:    "invalid regexp",
+			rule:    "!^(.*$!sip:info@example.com!",
+			wantErr: true,
+		},
+
+		{
+			name:    "no match",
+			rule:    `!^\+1.*$!sip:info@example.com!`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			uri, err := ENUMApplyRule(tc.rule, "+442079460123")
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidENUMRule)
+				assert.Empty(t, uri)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantURI, uri)
+		})
+	}
+}
+
+func TestResolverLookupENUM(t *testing.T) {
+	const domain = "3.2.1.0.6.4.9.7.0.2.4.4.e164.arpa."
+	reso := NewResolver(newRecordsTransport(dns.TypeNAPTR,
+		domain+` 300 IN NAPTR 100 20 "u" "E2U+email:mailto" "!^.*$!mailto:info@example.com!" .`,
+		domain+` 300 IN NAPTR 100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`,
+		domain+` 300 IN NAPTR 100 30 "u" "E2U+web:http" "!^.*$!http://www\046example\046com/!" .`,
+		domain+` 300 IN NAPTR 50 10 "u" "E2U+voice:tel" "!^(.*)$!tel:\\1!" .`,
+		domain+` 300 IN NAPTR 10 10 "" "E2U+sip" "" next.example.com.`,
+		domain+` 300 IN NAPTR 10 10 "u" "E2U+sip" "!^(.*$!sip:broken@example.com!" .`,
+	))
+	uris, err := reso.LookupENUM(context.Background(), "+44 20 7946 0123")
+	require.NoError(t, err)
+	assert.Equal(t, []*ENUMURI{
+		{Order: 50, Preference: 10, Service: "E2U+voice:tel", URI: "tel:+442079460123"},
+		{Order: 100, Preference: 10, Service: "E2U+sip", URI: "sip:info@example.com"},
+		{Order: 100, Preference: 20, Service: "E2U+email:mailto", URI: "mailto:info@example.com"},
+		{Order: 100, Preference: 30, Service: "E2U+web:http", URI: "http://www.example.com/"},
+	}, uris)
+}
+
+func TestResolverLookupENUMFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// number is the phone number.
+		number string
+
+		// records contains the NAPTR records to serve.
+		records []string
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:    "invalid number",
+			number:  "442079460123",
+			wantErr: ErrInvalidE164Number,
+		},
+
+		{
+			name:    "no records",
+			number:  "+442079460123",
+			wantErr: dnscodec.ErrNoData,
+		},
+
+		{
+			name:   "no usable records",
+			number: "+442079460123",
+			records: []string{
+				`3.2.1.0.6.4.9.7.0.2.4.4.e164.arpa. 300 IN NAPTR 100 10 "u" "SIP+D2U" "!^.*$!sip:info@example.com!" .`,
+			},
+			wantErr: ErrInvalidENUMRule,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reso := NewResolver(newRecordsTransport(dns.TypeNAPTR, tc.records...))
+			uris, err := reso.LookupENUM(context.Background(), tc.number)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Nil(t, uris)
+		})
+	}
+}
+
+func TestResolverLookupNAPTR(t *testing.T) {
+	reso := NewResolver(newRecordsTransport(dns.TypeNAPTR,
+		`example.com. 300 IN NAPTR 100 50 "s" "SIP+D2T" "" _sip._tcp.example.com.`,
+		`example.com. 300 IN NAPTR 100 10 "s" "SIP+D2U" "" _sip._udp.example.com.`,
+		`example.com. 300 IN NAPTR 90 50 "s" "SIPS+D2T" "" _sips._tcp.example.com.`,
+		`example.com. 300 IN NAPTR 100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`,
+	))
+	naptrs, err := reso.LookupNAPTR(context.Background(), "example.com")
+	require.NoError(t, err)
+
+	type naptr struct {
+		order, preference                   uint16
+		flags, service, regexp, replacement string
+	}
+	var got []naptr
+	for _, rr := range naptrs {
+		got = append(got, naptr{rr.Order, rr.Preference, rr.Flags, rr.Service, rr.Regexp, rr.Replacement})
+	}
+	assert.Equal(t, []naptr{
+		{90, 50, "s", "SIPS+D2T", "", "_sips._tcp.example.com."},
+		{100, 10, "s", "SIP+D2U", "", "_sip._udp.example.com."},
+		{100, 10, "u", "E2U+sip", "!^.*$!sip:info@example.com!", "."},
+		{100, 50, "s", "SIP+D2T", "", "_sip._tcp.example.com."},
+	}, got)
+
+	naptrs, err = NewResolver(newRecordsTransport(dns.TypeNAPTR)).LookupNAPTR(context.Background(), "example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, naptrs)
+}
@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net/netip"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// EscalatingTransport implements [DNSTransport] and [DNSMsgTransport] using
+// the classic stub resolver escalation: we query using UDP, we fall back to
+// TCP upon truncation or timeout, and we OPTIONALLY upgrade to DNS over TLS
+// when TCP fails. This models real client behavior and records which stage
+// succeeded. Pass it to [NewResolver] to perform lookups using escalation.
+//
+// Construct using [NewEscalatingTransport].
+type EscalatingTransport struct {
+	// Dialer is the [NetDialer] to use to create connections.
+	//
+	// Set by [NewEscalatingTransport] to the user-provided value.
+	Dialer NetDialer
+
+	// Address is the resolver address.
+	//
+	// Set by [NewEscalatingTransport] to the user-provided value.
+	Address netip.Addr
+
+	// Do53Port is the port to use for DNS over UDP and TCP.
+	//
+	// Set by [NewEscalatingTransport] to 53.
+	Do53Port uint16
+
+	// DoTPort is the port to use for DNS over TLS.
+	//
+	// Set by [NewEscalatingTransport] to 853.
+	DoTPort uint16
+
+	// TLSClientFactory is the [TLSClientFactory] to use for DNS over TLS.
+	//
+	// Set by [NewEscalatingTransport] to [StdlibTLSClientFactory].
+	TLSClientFactory TLSClientFactory
+
+	// TLSConfig is the OPTIONAL TLS config enabling the upgrade to
+	// DNS over TLS. When nil, we do not use DNS over TLS.
+	TLSConfig *tls.Config
+
+	// UDPTimeout is the timeout of the UDP stage.
+	//
+	// Set by [NewEscalatingTransport] to 5 seconds, like glibc.
+	UDPTimeout time.Duration
+
+	// StreamTimeout is the timeout of the TCP and TLS stages.
+	//
+	// Set by [NewEscalatingTransport] to [DefaultResolverTimeout].
+	StreamTimeout time.Duration
+
+	// ObserveEscalation is an OPTIONAL hook called after each exchange.
+	ObserveEscalation func(*Escalation)
+}
+
+// Escalation describes an exchange performed by [*EscalatingTransport].
+type Escalation struct {
+	// Stages contains the stages we attempted, in order.
+	Stages []*EscalationStage
+
+	// Protocol is the protocol of the successful stage or empty.
+	Protocol string
+
+	// Response is the response or nil.
+	Response *dns.Msg
+
+	// Err is the error of the last stage or nil.
+	Err error
+}
+
+// EscalationStage is a single stage of an [*Escalation].
+type EscalationStage struct {
+	// Protocol is the protocol ("udp", "tcp", or "dot").
+	Protocol string
+
+	// Truncated is true when the response had the TC bit set.
+	Truncated bool
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the stage.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// NewEscalatingTransport creates a new [*EscalatingTransport].
+func NewEscalatingTransport(dialer NetDialer, address netip.Addr) *EscalatingTransport {
+	return &EscalatingTransport{
+		Dialer:           dialer,
+		Address:          address,
+		Do53Port:         53,
+		DoTPort:          853,
+		TLSClientFactory: StdlibTLSClientFactory{},
+		UDPTimeout:       5 * time.Second,
+		StreamTimeout:    DefaultResolverTimeout,
+	}
+}
+
+// Ensure that [*EscalatingTransport] implements [DNSExtendedTransport] and [DNSMsgTransport].
+var (
+	_ DNSExtendedTransport = &EscalatingTransport{}
+	_ DNSMsgTransport      = &EscalatingTransport{}
+)
+
+// Exchange implements [DNSTransport].
+func (et *EscalatingTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return et.exchange(ctx, query, nil)
+}
+
+// ExchangeExtended implements [DNSExtendedTransport].
+//
+// The [*DNSMeasurement] describes the last stage we attempted, while Started
+// and Elapsed cover the whole exchange. Use ObserveEscalation to observe
+// all the stages.
+func (et *EscalatingTransport) ExchangeExtended(
+	ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	m := newDNSMeasurement("", netip.AddrPort{}, query)
+	m.complete(et.exchange(ctx, query, m))
+	return m.Response, m
+}
+
+// exchange implements Exchange and ExchangeExtended, saving the details of
+// the last stage into the given [*DNSMeasurement] unless it is nil.
+func (et *EscalatingTransport) exchange(
+	ctx context.Context, query *dnscodec.Query, m *DNSMeasurement) (*dnscodec.Response, error) {
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, err
+	}
+	escalation := et.escalate(ctx, queryMsg, m)
+	if escalation.Err != nil {
+		return nil, escalation.Err
+	}
+	return dnscodec.ParseResponse(queryMsg, escalation.Response)
+}
+
+// ExchangeMsg implements [DNSMsgTransport].
+func (et *EscalatingTransport) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	escalation := et.Escalate(ctx, queryMsg)
+	return escalation.Response, escalation.Err
+}
+
+// Escalate performs the exchange escalating as needed and returns the [*Escalation].
+//
+// We only fall back to TCP when UDP times out or the response is truncated,
+// since other UDP errors (e.g., connection refused) are final for a stub.
+func (et *EscalatingTransport) Escalate(ctx context.Context, queryMsg *dns.Msg) *Escalation {
+	return et.escalate(ctx, queryMsg, nil)
+}
+
+// escalate implements Escalate, saving the details of the last stage
+// into the given [*DNSMeasurement] unless it is nil.
+func (et *EscalatingTransport) escalate(ctx context.Context, queryMsg *dns.Msg, m *DNSMeasurement) *Escalation {
+	escalation := &Escalation{}
+	endpoint53 := netip.AddrPortFrom(et.Address, et.Do53Port)
+	endpoint853 := netip.AddrPortFrom(et.Address, et.DoTPort)
+
+	// 1. query using UDP
+	respMsg, stage := et.stage(ctx, "udp", endpoint53, et.UDPTimeout, m, func(ctx context.Context) (*dns.Msg, error) {
+		txp := NewDNSOverUDPTransport(et.Dialer, endpoint53)
+		if m != nil {
+			txp.ObserveRawQuery = m.observeRawQuery(nil)
+			txp.ObserveRawResponse = m.observeRawResponse(nil)
+		}
+		return txp.ExchangeMsg(ctx, queryMsg)
+	})
+	escalation.Stages = append(escalation.Stages, stage)
+	if stage.Err != nil && stage.Failure != FailureGenericTimeout {
+		return et.finish(escalation, "", nil, stage.Err)
+	}
+	if stage.Err == nil && !stage.Truncated {
+		return et.finish(escalation, "udp", respMsg, nil)
+	}
+
+	// 2. fall back to TCP
+	respMsg, stage = et.stage(ctx, "tcp", endpoint53, et.StreamTimeout, m, func(ctx context.Context) (*dns.Msg, error) {
+		return dnsStreamDialExchangeMsg(ctx, et.Dialer, endpoint53, nil, nil, queryMsg, m)
+	})
+	escalation.Stages = append(escalation.Stages, stage)
+	if stage.Err == nil {
+		return et.finish(escalation, "tcp", respMsg, nil)
+	}
+	if et.TLSConfig == nil {
+		return et.finish(escalation, "", nil, stage.Err)
+	}
+
+	// 3. upgrade to DNS over TLS
+	respMsg, stage = et.stage(ctx, "dot", endpoint853, et.StreamTimeout, m, func(ctx context.Context) (*dns.Msg, error) {
+		return dnsStreamDialExchangeMsg(ctx, et.Dialer, endpoint853, et.TLSClientFactory, et.TLSConfig, queryMsg, m)
+	})
+	escalation.Stages = append(escalation.Stages, stage)
+	if stage.Err != nil {
+		return et.finish(escalation, "", nil, stage.Err)
+	}
+	return et.finish(escalation, "dot", respMsg, nil)
+}
+
+// stage runs a single stage using the given exchange function and timeout. When m is not
+// nil, we reset it to describe this stage, preserving the query and the start time.
+func (et *EscalatingTransport) stage(ctx context.Context, protocol string, endpoint netip.AddrPort,
+	timeout time.Duration, m *DNSMeasurement,
+	exchange func(ctx context.Context) (*dns.Msg, error)) (*dns.Msg, *EscalationStage) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if m != nil {
+		*m = DNSMeasurement{Network: protocol, Endpoint: endpoint, Query: m.Query, Started: m.Started}
+	}
+	stage := &EscalationStage{Protocol: protocol, Started: time.Now()}
+	respMsg, err := exchange(ctx)
+	stage.Elapsed = time.Since(stage.Started)
+	stage.Err = err
+	stage.Failure = ClassifyError(err)
+	if err != nil {
+		return nil, stage
+	}
+	stage.Truncated = respMsg.Truncated
+	return respMsg, stage
+}
+
+// finish completes and emits the escalation.
+func (et *EscalatingTransport) finish(
+	escalation *Escalation, protocol string, respMsg *dns.Msg, err error) *Escalation {
+	escalation.Protocol = protocol
+	escalation.Response = respMsg
+	escalation.Err = err
+	if et.ObserveEscalation != nil {
+		et.ObserveEscalation(escalation)
+	}
+	return escalation
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/pkitest"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// escalationServerConfig configures newEscalationServer.
+type escalationServerConfig struct {
+	// udp is the UDP behavior ("answer", "truncate", or "silent").
+	udp string
+
+	// tcp enables listening on TCP.
+	tcp bool
+
+	// dot enables listening on TLS.
+	dot bool
+}
+
+// newEscalationServer creates a server using the given config and returns
+// the UDP endpoint, which is also used for TCP, and the DoT port.
+func newEscalationServer(t *testing.T, config *escalationServerConfig) (netip.AddrPort, uint16) {
+	t.Helper()
+
+	// newHandler returns a handler answering with an A record and
+	// possibly setting the TC bit and omitting the answer.
+	newHandler := func(truncate bool) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.Truncated = truncate
+			if !truncate {
+				respMsg.Answer = append(respMsg.Answer,
+					runtimex.PanicOnError1(dns.NewRR(queryMsg.Question[0].Name+" 60 IN A 93.184.216.34")))
+			}
+			w.WriteMsg(respMsg)
+		}
+	}
+
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	endpoint := netip.MustParseAddrPort(pconn.LocalAddr().String())
+	if config.udp == "silent" {
+		t.Cleanup(func() { pconn.Close() })
+	} else {
+		startDNSServer(t, &dns.Server{PacketConn: pconn, Handler: newHandler(config.udp == "truncate")})
+	}
+
+	if config.tcp {
+		listener, err := net.Listen("tcp", endpoint.String())
+		require.NoError(t, err)
+		startDNSServer(t, &dns.Server{Listener: listener, Handler: newHandler(false)})
+	}
+
+	if !config.dot {
+		return endpoint, 1 // nobody should be listening on this port
+	}
+	cert := pkitest.MustNewSelfSignedCert(&pkitest.SelfSignedCertConfig{
+		CommonName:   "dns.example.com",
+		DNSNames:     []string{"dns.example.com"},
+		Organization: []string{"Example"},
+	})
+	keyPair := runtimex.PanicOnError1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM))
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+	})
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{Listener: tlsListener, Handler: newHandler(false)})
+	return endpoint, netip.MustParseAddrPort(tlsListener.Addr().String()).Port()
+}
+
+func TestEscalatingTransport(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the server config.
+		config *escalationServerConfig
+
+		// enableDoT enables the upgrade to DNS over TLS.
+		enableDoT bool
+
+		// wantStages maps the protocol of each expected stage to its failure.
+		wantStages map[string]string
+
+		// wantProtocol is the expected successful protocol or empty.
+		wantProtocol string
+	}
+
+	tests := []testCase{
+		{
+			name:         "UDP succeeds",
+			config:       &escalationServerConfig{udp: "answer", tcp: true},
+			wantStages:   map[string]string{"udp": ""},
+			wantProtocol: "udp",
+		},
+
+		{
+			name:         "truncation falls back to TCP",
+			config:       &escalationServerConfig{udp: "truncate", tcp: true},
+			wantStages:   map[string]string{"udp": "", "tcp": ""},
+			wantProtocol: "tcp",
+		},
+
+		{
+			name:         "timeout falls back to TCP",
+			config:       &escalationServerConfig{udp: "silent", tcp: true},
+			wantStages:   map[string]string{"udp": FailureGenericTimeout, "tcp": ""},
+			wantProtocol: "tcp",
+		},
+
+		{
+			name:       "TCP failure without DoT",
+			config:     &escalationServerConfig{udp: "truncate"},
+			wantStages: map[string]string{"udp": "", "tcp": FailureConnectionRefused},
+		},
+
+		{
+			name:         "TCP failure upgrades to DoT",
+			config:       &escalationServerConfig{udp: "silent", dot: true},
+			enableDoT:    true,
+			wantStages:   map[string]string{"udp": FailureGenericTimeout, "tcp": FailureConnectionRefused, "dot": ""},
+			wantProtocol: "dot",
+		},
+
+		{
+			name:       "all stages fail",
+			config:     &escalationServerConfig{udp: "silent"},
+			enableDoT:  true,
+			wantStages: map[string]string{"udp": FailureGenericTimeout, "tcp": FailureConnectionRefused, "dot": FailureConnectionRefused},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, dotPort := newEscalationServer(t, tc.config)
+			et := NewEscalatingTransport(&net.Dialer{}, endpoint.Addr())
+			et.Do53Port = endpoint.Port()
+			et.DoTPort = dotPort
+			et.UDPTimeout = 100 * time.Millisecond
+			if tc.enableDoT {
+				et.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+			}
+			var observed *Escalation
+			et.ObserveEscalation = func(e *Escalation) { observed = e }
+
+			queryMsg := new(dns.Msg)
+			queryMsg.SetQuestion("example.com.", dns.TypeA)
+			respMsg, err := et.ExchangeMsg(context.Background(), queryMsg)
+
+			require.NotNil(t, observed)
+			assert.Equal(t, tc.wantProtocol, observed.Protocol)
+			require.Len(t, observed.Stages, len(tc.wantStages))
+			for _, stage := range observed.Stages {
+				want, found := tc.wantStages[stage.Protocol]
+				require.True(t, found, stage.Protocol)
+				assert.Equal(t, want, stage.Failure, stage.Protocol)
+				assert.Equal(t, stage.Protocol == "udp" && tc.config.udp == "truncate", stage.Truncated)
+			}
+			if tc.wantProtocol == "" {
+				require.Error(t, err)
+				assert.Nil(t, respMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, respMsg.Answer, 1)
+			assert.False(t, respMsg.Truncated)
+		})
+	}
+}
+
+func TestEscalatingTransportUDPFailure(t *testing.T) {
+	et := NewEscalatingTransport(&net.Dialer{}, netip.MustParseAddr("127.0.0.1"))
+	et.Do53Port = 1 // nobody should be listening on this port
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	escalation := et.Escalate(context.Background(), queryMsg)
+	require.Error(t, escalation.Err)
+	require.Len(t, escalation.Stages, 1)
+	assert.Equal(t, FailureConnectionRefused, escalation.Stages[0].Failure)
+	assert.Empty(t, escalation.Protocol)
+}
+
+func TestEscalatingTransportWithResolver(t *testing.T) {
+	endpoint, dotPort := newEscalationServer(t, &escalationServerConfig{udp: "truncate", tcp: true})
+	et := NewEscalatingTransport(&net.Dialer{}, endpoint.Addr())
+	et.Do53Port = endpoint.Port()
+	et.DoTPort = dotPort
+	var observed *Escalation
+	et.ObserveEscalation = func(e *Escalation) { observed = e }
+
+	addrs, err := NewResolver(et).LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	require.NotNil(t, observed)
+	assert.Equal(t, "tcp", observed.Protocol)
+}
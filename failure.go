@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// Failure strings returned by [ClassifyError].
+//
+// We use the same strings used by OONI, to simplify comparing results.
+const (
+	// FailureConnectionRefused indicates that the connection was refused.
+	FailureConnectionRefused = "connection_refused"
+
+	// FailureConnectionReset indicates that the connection was reset.
+	FailureConnectionReset = "connection_reset"
+
+	// FailureDNSNoAnswer indicates that the response contained no pertinent answer.
+	FailureDNSNoAnswer = "dns_no_answer"
+
+	// FailureDNSNXDOMAIN indicates that the response code is NXDOMAIN.
+	FailureDNSNXDOMAIN = "dns_nxdomain_error"
+
+	// FailureDNSServerMisbehaving indicates that the response code is
+	// neither NOERROR, nor NXDOMAIN, nor SERVFAIL.
+	FailureDNSServerMisbehaving = "dns_server_misbehaving"
+
+	// FailureDNSServfail indicates that the response code is SERVFAIL.
+	FailureDNSServfail = "dns_servfail_error"
+
+	// FailureGenericTimeout indicates that an operation timed out.
+	FailureGenericTimeout = "generic_timeout_error"
+
+	// FailureHostUnreachable indicates that the host is unreachable.
+	FailureHostUnreachable = "host_unreachable"
+
+	// FailureInterrupted indicates that the context was canceled.
+	FailureInterrupted = "interrupted"
+
+	// FailureNetworkUnreachable indicates that the network is unreachable.
+	FailureNetworkUnreachable = "network_unreachable"
+
+	// FailureUnknown indicates an error we could not classify.
+	FailureUnknown = "unknown_failure"
+)
+
+// ClassifyError maps the given error to a failure string.
+//
+// The return value is empty when the error is nil.
+func ClassifyError(err error) string {
+	// 1. handle the case of no error
+	if err == nil {
+		return ""
+	}
+
+	// 2. handle DNS errors
+	switch {
+	case errors.Is(err, dnscodec.ErrNoName):
+		return FailureDNSNXDOMAIN
+	case errors.Is(err, dnscodec.ErrNoData):
+		return FailureDNSNoAnswer
+	case errors.Is(err, dnscodec.ErrServerTemporarilyMisbehaving):
+		return FailureDNSServfail
+	case errors.Is(err, dnscodec.ErrServerMisbehaving):
+		return FailureDNSServerMisbehaving
+	}
+
+	// 3. handle system errors, which depend on the platform
+	if failure := classifySyscallError(err); failure != "" {
+		return failure
+	}
+
+	// 4. handle context errors and timeouts
+	if errors.Is(err, context.Canceled) {
+		return FailureInterrupted
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return FailureGenericTimeout
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return FailureGenericTimeout
+	}
+
+	// 5. fallback to the unknown failure
+	return FailureUnknown
+}
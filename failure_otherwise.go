@@ -0,0 +1,11 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !unix && !windows
+
+package minest
+
+// classifySyscallError always returns an empty string because we do not
+// know how to map system errors to failure strings on this platform.
+func classifySyscallError(err error) string {
+	return ""
+}
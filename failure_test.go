@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/stretchr/testify/assert"
+)
+
+// timeoutError is a [net.Error] that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return false }
+
+func TestClassifyError(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// err is the error to classify.
+		err error
+
+		// want is the expected failure string.
+		want string
+	}
+
+	tests := []testCase{
+		{
+			name: "nil error",
+			err:  nil,
+			want: "",
+		},
+
+		{
+			name: "NXDOMAIN",
+			err:  fmt.Errorf("lookup failed: %w", dnscodec.ErrNoName),
+			want: FailureDNSNXDOMAIN,
+		},
+
+		{
+			name: "no answer",
+			err:  dnscodec.ErrNoData,
+			want: FailureDNSNoAnswer,
+		},
+
+		{
+			name: "SERVFAIL",
+			err:  dnscodec.ErrServerTemporarilyMisbehaving,
+			want: FailureDNSServfail,
+		},
+
+		{
+			name: "server misbehaving",
+			err:  dnscodec.ErrServerMisbehaving,
+			want: FailureDNSServerMisbehaving,
+		},
+
+		{
+			name: "context canceled",
+			err:  fmt.Errorf("wrapped: %w", context.Canceled),
+			want: FailureInterrupted,
+		},
+
+		{
+			name: "context deadline exceeded",
+			err:  context.DeadlineExceeded,
+			want: FailureGenericTimeout,
+		},
+
+		{
+			name: "I/O deadline exceeded",
+			err:  &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded},
+			want: FailureGenericTimeout,
+		},
+
+		{
+			name: "net.Error timeout",
+			err:  timeoutError{},
+			want: FailureGenericTimeout,
+		},
+
+		{
+			name: "unknown error",
+			err:  errors.New("mocked error"),
+			want: FailureUnknown,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ClassifyError(tc.err))
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build unix
+
+package minest
+
+import (
+	"errors"
+	"syscall"
+)
+
+// classifySyscallError maps Unix system errors to failure strings.
+//
+// The return value is empty when the error is not a known system error.
+func classifySyscallError(err error) string {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return FailureConnectionReset
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return FailureHostUnreachable
+	case errors.Is(err, syscall.ENETUNREACH):
+		return FailureNetworkUnreachable
+	case errors.Is(err, syscall.ETIMEDOUT):
+		return FailureGenericTimeout
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build unix
+
+package minest
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyErrorSyscall(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// err is the error to classify.
+		err error
+
+		// want is the expected failure string.
+		want string
+	}
+
+	tests := []testCase{
+		{
+			name: "connection refused",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			want: FailureConnectionRefused,
+		},
+
+		{
+			name: "connection reset",
+			err:  &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			want: FailureConnectionReset,
+		},
+
+		{
+			name: "host unreachable",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)},
+			want: FailureHostUnreachable,
+		},
+
+		{
+			name: "network unreachable",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)},
+			want: FailureNetworkUnreachable,
+		},
+
+		{
+			name: "timed out",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ETIMEDOUT)},
+			want: FailureGenericTimeout,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ClassifyError(tc.err))
+		})
+	}
+}
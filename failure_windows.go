@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build windows
+
+package minest
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// classifySyscallError maps Windows system errors to failure strings.
+//
+// The return value is empty when the error is not a known system error.
+func classifySyscallError(err error) string {
+	switch {
+	case errors.Is(err, windows.WSAECONNREFUSED):
+		return FailureConnectionRefused
+	case errors.Is(err, windows.WSAECONNRESET):
+		return FailureConnectionReset
+	case errors.Is(err, windows.WSAEHOSTUNREACH):
+		return FailureHostUnreachable
+	case errors.Is(err, windows.WSAENETUNREACH):
+		return FailureNetworkUnreachable
+	case errors.Is(err, windows.WSAETIMEDOUT):
+		return FailureGenericTimeout
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build windows
+
+package minest
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestClassifyErrorSyscall(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// err is the error to classify.
+		err error
+
+		// want is the expected failure string.
+		want string
+	}
+
+	tests := []testCase{
+		{
+			name: "connection refused",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", windows.WSAECONNREFUSED)},
+			want: FailureConnectionRefused,
+		},
+
+		{
+			name: "connection reset",
+			err:  &net.OpError{Op: "read", Err: os.NewSyscallError("read", windows.WSAECONNRESET)},
+			want: FailureConnectionReset,
+		},
+
+		{
+			name: "host unreachable",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", windows.WSAEHOSTUNREACH)},
+			want: FailureHostUnreachable,
+		},
+
+		{
+			name: "network unreachable",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", windows.WSAENETUNREACH)},
+			want: FailureNetworkUnreachable,
+		},
+
+		{
+			name: "timed out",
+			err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", windows.WSAETIMEDOUT)},
+			want: FailureGenericTimeout,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ClassifyError(tc.err))
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrFamilyUnavailable indicates that the resolver has no address for the address family.
+var ErrFamilyUnavailable = errors.New("no resolver address for the address family")
+
+// FamilyComparer runs the same lookup using the IPv4 and the IPv6 addresses
+// of a dual-stack resolver and reports divergence, since blocking often
+// differs by address family.
+//
+// Construct using [NewFamilyComparer].
+type FamilyComparer struct {
+	// Resolver is the [DialerResolver] to use to resolve the resolver name.
+	//
+	// Set by [NewFamilyComparer] to the user-provided value.
+	Resolver DialerResolver
+
+	// NewTransport creates the [DNSMsgTransport] to use to query
+	// the resolver using the given address.
+	//
+	// Set by [NewFamilyComparer] to a function creating a
+	// [*DNSOverUDPTransport] for port 53 using the given dialer.
+	NewTransport func(addr netip.Addr) DNSMsgTransport
+
+	// Timeout is the timeout of each lookup.
+	//
+	// Set by [NewFamilyComparer] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewFamilyComparer] to [GlobalRand].
+	Rand Rand
+}
+
+// FamilyComparison is the comparison produced by [*FamilyComparer].
+type FamilyComparison struct {
+	// Server is the resolver name.
+	Server string
+
+	// IPv4 is the result of the lookup using IPv4 or nil if Err is set.
+	IPv4 *FamilyLookupResult
+
+	// IPv6 is the result of the lookup using IPv6 or nil if Err is set.
+	IPv6 *FamilyLookupResult
+
+	// Divergent is true when both families have an address and the
+	// lookups failed differently or returned different answers.
+	Divergent bool
+
+	// Err is the error resolving the resolver name or nil.
+	Err error
+}
+
+// FamilyLookupResult is the result of a lookup using a single address family.
+type FamilyLookupResult struct {
+	// Address is the resolver address or the zero value.
+	Address netip.Addr
+
+	// Reachable is true when we received a response matching the query.
+	Reachable bool
+
+	// Rcode is the response code when Reachable is true.
+	Rcode int
+
+	// Answers contains the sorted answers of the query type.
+	Answers []string
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Elapsed is the time elapsed performing the lookup.
+	Elapsed time.Duration
+}
+
+// NewFamilyComparer creates a new [*FamilyComparer].
+func NewFamilyComparer(dialer NetDialer, reso DialerResolver) *FamilyComparer {
+	return &FamilyComparer{
+		Resolver: reso,
+		NewTransport: func(addr netip.Addr) DNSMsgTransport {
+			return NewDNSOverUDPTransport(dialer, netip.AddrPortFrom(addr, 53))
+		},
+		Timeout: DefaultResolverTimeout,
+		Rand:    GlobalRand{},
+	}
+}
+
+// Compare resolves the given resolver name and queries its first IPv4
+// address and its first IPv6 address for the given domain and query type.
+func (fc *FamilyComparer) Compare(ctx context.Context, server, domain string, qtype uint16) *FamilyComparison {
+	comparison := &FamilyComparison{Server: server}
+
+	// 1. resolve the resolver name and pick an address per family
+	addrs, err := fc.Resolver.LookupHost(ctx, server)
+	if err != nil {
+		comparison.Err = err
+		return comparison
+	}
+	var addr4, addr6 netip.Addr
+	for _, entry := range addrs {
+		addr, err := netip.ParseAddr(entry)
+		switch {
+		case err != nil:
+		case addr.Unmap().Is4() && !addr4.IsValid():
+			addr4 = addr.Unmap()
+		case addr.Is6() && !addr.Is4In6() && !addr6.IsValid():
+			addr6 = addr
+		}
+	}
+
+	// 2. run the lookups sequentially, to avoid them interfering
+	comparison.IPv4 = fc.lookup(ctx, addr4, domain, qtype)
+	comparison.IPv6 = fc.lookup(ctx, addr6, domain, qtype)
+
+	// 3. compare the results
+	r4, r6 := comparison.IPv4, comparison.IPv6
+	comparison.Divergent = addr4.IsValid() && addr6.IsValid() && (r4.Failure != r6.Failure ||
+		r4.Rcode != r6.Rcode || !slices.Equal(r4.Answers, r6.Answers))
+	return comparison
+}
+
+// lookup performs the lookup using the given resolver address.
+func (fc *FamilyComparer) lookup(ctx context.Context, addr netip.Addr, domain string, qtype uint16) *FamilyLookupResult {
+	// 1. handle the case of a missing address
+	result := &FamilyLookupResult{Address: addr}
+	if !addr.IsValid() {
+		result.Err = ErrFamilyUnavailable
+		result.Failure = ClassifyError(result.Err)
+		return result
+	}
+
+	// 2. create the query message
+	ctx, cancel := context.WithTimeout(ctx, fc.Timeout)
+	defer cancel()
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(dns.Fqdn(domain), qtype)
+	queryMsg.Id = randID(fc.Rand)
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+
+	// 3. perform the exchange
+	started := time.Now()
+	respMsg, err := fc.NewTransport(addr).ExchangeMsg(ctx, queryMsg)
+	result.Elapsed = time.Since(started)
+	result.Err = err
+	result.Failure = ClassifyError(err)
+	if err != nil {
+		return result
+	}
+
+	// 4. save the answers
+	result.Reachable = true
+	result.Rcode = respMsg.Rcode
+	result.Answers = []string{}
+	for _, rr := range respMsg.Answer {
+		if rr.Header().Rrtype == qtype {
+			result.Answers = append(result.Answers, campaignRRData(rr))
+		}
+	}
+	slices.Sort(result.Answers)
+	return result
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFamilyResponse creates a response containing the given A record.
+func newFamilyResponse(queryMsg *dns.Msg, record string) *dns.Msg {
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+	return respMsg
+}
+
+func TestFamilyComparer(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// addrs contains the addresses of the resolver name.
+		addrs []string
+
+		// respond returns the response of the given address or an error.
+		respond func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error)
+
+		// wantDivergent is the expected Divergent value.
+		wantDivergent bool
+
+		// wantFailure4 is the expected IPv4 failure.
+		wantFailure4 string
+
+		// wantFailure6 is the expected IPv6 failure.
+		wantFailure6 string
+	}
+
+	consistent := func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+		return newFamilyResponse(queryMsg, "example.com. 300 IN A 93.184.216.34"), nil
+	}
+
+	tests := []testCase{
+		{
+			name:    "consistent families",
+			addrs:   []string{"2001:4860:4860::8888", "8.8.8.8", "8.8.4.4"},
+			respond: consistent,
+		},
+
+		{
+			name:  "IPv4 blocked",
+			addrs: []string{"8.8.8.8", "2001:4860:4860::8888"},
+			respond: func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+				if addr.Is4() {
+					return nil, context.DeadlineExceeded
+				}
+				return consistent(addr, queryMsg)
+			},
+			wantDivergent: true,
+			wantFailure4:  FailureGenericTimeout,
+		},
+
+		{
+			name:  "IPv6 answers differ",
+			addrs: []string{"8.8.8.8", "2001:4860:4860::8888"},
+			respond: func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+				if addr.Is6() {
+					return newFamilyResponse(queryMsg, "example.com. 300 IN A 10.10.34.34"), nil
+				}
+				return consistent(addr, queryMsg)
+			},
+			wantDivergent: true,
+		},
+
+		{
+			name:         "IPv4 only",
+			addrs:        []string{"::ffff:8.8.8.8", "invalid"},
+			respond:      consistent,
+			wantFailure6: FailureUnknown,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := NewFamilyComparer(&net.Dialer{}, &netstub.FuncResolver{
+				LookupHostFunc: func(ctx context.Context, name string) ([]string, error) {
+					assert.Equal(t, "dns.google", name)
+					return tc.addrs, nil
+				},
+			})
+			var queried []netip.Addr
+			fc.NewTransport = func(addr netip.Addr) DNSMsgTransport {
+				queried = append(queried, addr)
+				return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+					assert.Equal(t, "example.com.", queryMsg.Question[0].Name)
+					return tc.respond(addr, queryMsg)
+				}}
+			}
+
+			comparison := fc.Compare(context.Background(), "dns.google", "example.com", dns.TypeA)
+			require.NoError(t, comparison.Err)
+			assert.Equal(t, "dns.google", comparison.Server)
+			assert.Equal(t, tc.wantDivergent, comparison.Divergent)
+			assert.Equal(t, tc.wantFailure4, comparison.IPv4.Failure)
+			assert.Equal(t, tc.wantFailure6, comparison.IPv6.Failure)
+			assert.Equal(t, netip.MustParseAddr("8.8.8.8"), comparison.IPv4.Address)
+			assert.Equal(t, tc.wantFailure4 == "", comparison.IPv4.Reachable)
+			for _, addr := range queried {
+				assert.True(t, addr == comparison.IPv4.Address || addr == comparison.IPv6.Address)
+			}
+			if tc.wantFailure6 == FailureUnknown {
+				require.ErrorIs(t, comparison.IPv6.Err, ErrFamilyUnavailable)
+				assert.False(t, comparison.IPv6.Address.IsValid())
+				assert.Len(t, queried, 1)
+			}
+		})
+	}
+}
+
+func TestFamilyComparerLookupFailure(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	fc := NewFamilyComparer(&net.Dialer{}, &netstub.FuncResolver{
+		LookupHostFunc: func(ctx context.Context, name string) ([]string, error) {
+			return nil, expectedErr
+		},
+	})
+	comparison := fc.Compare(context.Background(), "dns.google", "example.com", dns.TypeA)
+	require.ErrorIs(t, comparison.Err, expectedErr)
+	assert.Nil(t, comparison.IPv4)
+	assert.Nil(t, comparison.IPv6)
+	assert.False(t, comparison.Divergent)
+}
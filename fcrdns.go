@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net/netip"
+)
+
+// FCrDNSResult is the result of [*Resolver.LookupFCrDNS].
+type FCrDNSResult struct {
+	// Address is the address we reverse resolved.
+	Address netip.Addr
+
+	// Names contains the result of the forward lookup of each name
+	// returned by the reverse lookup, in the same order.
+	Names []*FCrDNSName
+
+	// Confirmed contains the names whose forward lookup includes Address.
+	Confirmed []string
+}
+
+// FCrDNSName is the forward lookup of a name within a [*FCrDNSResult].
+type FCrDNSName struct {
+	// Name is the name returned by the reverse lookup.
+	Name string
+
+	// Addrs contains the addresses returned by the forward lookup.
+	Addrs []string
+
+	// Confirmed is true when Addrs includes the reverse resolved address.
+	Confirmed bool
+
+	// Err is the error of the forward lookup or nil.
+	Err error
+}
+
+// LookupFCrDNS performs a forward-confirmed reverse DNS lookup: we reverse
+// resolve the address using [*Resolver.LookupAddr], forward resolve each name
+// using [*Resolver.LookupHost], and report which names resolve back to the
+// original address. A name that fails to resolve does not confirm.
+//
+// We only fail when the address is invalid or the reverse lookup fails.
+func (r *Resolver) LookupFCrDNS(ctx context.Context, addr string) (*FCrDNSResult, error) {
+	// 1. parse the address and perform the reverse lookup
+	address, err := netip.ParseAddr(addr)
+	if err != nil {
+		return nil, NewDNSError(addr, err)
+	}
+	address = address.Unmap()
+	names, err := r.LookupAddr(ctx, address.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. forward resolve each name and check for the original address
+	result := &FCrDNSResult{Address: address}
+	for _, name := range names {
+		entry := &FCrDNSName{Name: name}
+		entry.Addrs, entry.Err = r.LookupHost(ctx, name)
+		entry.Confirmed = fcrdnsContains(entry.Addrs, address)
+		if entry.Confirmed {
+			result.Confirmed = append(result.Confirmed, name)
+		}
+		result.Names = append(result.Names, entry)
+	}
+	return result, nil
+}
+
+// fcrdnsContains returns whether the addresses contain the given address.
+func fcrdnsContains(addrs []string, address netip.Addr) bool {
+	for _, addr := range addrs {
+		if candidate, err := netip.ParseAddr(addr); err == nil && candidate.Unmap() == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverLookupFCrDNS(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// addr is the address to check.
+		addr string
+
+		// wantConfirmed contains the expected confirmed names.
+		wantConfirmed []string
+
+		// wantNames contains the expected names with their confirmation status.
+		wantNames map[string]bool
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	reso := newRecordsResolver(
+		"1.2.0.192.in-addr.arpa. 300 IN PTR a.example.com.",
+		"1.2.0.192.in-addr.arpa. 300 IN PTR b.example.com.",
+		"1.2.0.192.in-addr.arpa. 300 IN PTR c.example.com.",
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. 300 IN PTR a.example.com.",
+		"a.example.com. 300 IN A 192.0.2.1",
+		"a.example.com. 300 IN AAAA 2001:db8::1",
+		"b.example.com. 300 IN A 192.0.2.2",
+	)
+
+	tests := []testCase{
+		{
+			name:          "IPv4 with confirming, mismatching, and failing names",
+			addr:          "192.0.2.1",
+			wantConfirmed: []string{"a.example.com."},
+			wantNames:     map[string]bool{"a.example.com.": true, "b.example.com.": false, "c.example.com.": false},
+		},
+
+		{
+			name:          "IPv4-mapped IPv6",
+			addr:          "::ffff:192.0.2.1",
+			wantConfirmed: []string{"a.example.com."},
+			wantNames:     map[string]bool{"a.example.com.": true, "b.example.com.": false, "c.example.com.": false},
+		},
+
+		{
+			name:          "IPv6",
+			addr:          "2001:db8::1",
+			wantConfirmed: []string{"a.example.com."},
+			wantNames:     map[string]bool{"a.example.com.": true},
+		},
+
+		{
+			name:    "reverse lookup failure",
+			addr:    "192.0.2.2",
+			wantErr: true,
+		},
+
+		{
+			name:    "invalid address",
+			addr:    "invalid",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := reso.LookupFCrDNS(context.Background(), tc.addr)
+			if tc.wantErr {
+				var dnsErr *net.DNSError
+				require.ErrorAs(t, err, &dnsErr)
+				require.Nil(t, result)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantConfirmed, result.Confirmed)
+			names := make(map[string]bool)
+			for _, entry := range result.Names {
+				names[entry.Name] = entry.Confirmed
+				if entry.Name == "c.example.com." {
+					assert.Error(t, entry.Err)
+					assert.Nil(t, entry.Addrs)
+				}
+			}
+			assert.Equal(t, tc.wantNames, names)
+		})
+	}
+}
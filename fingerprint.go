@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// Fingerprinter probes a DNS server endpoint to discover its capabilities.
+//
+// We probe DNS over UDP, TCP, and TLS. We do not probe DNS over QUIC, which
+// this package does not implement, nor DNS over HTTPS, which requires knowing
+// the URL (use [*DoHHealthChecker] instead).
+//
+// Construct using [NewFingerprinter].
+type Fingerprinter struct {
+	// Dialer is the [NetDialer] to use to create connections.
+	//
+	// Set by [NewFingerprinter] to the user-provided value.
+	Dialer NetDialer
+
+	// Domain is an existing domain used by the probes.
+	//
+	// Set by [NewFingerprinter] to "example.com".
+	Domain string
+
+	// BogusDomain is a domain with broken DNSSEC signatures, which a
+	// validating resolver should fail to resolve with SERVFAIL.
+	//
+	// Set by [NewFingerprinter] to "dnssec-failed.org".
+	BogusDomain string
+
+	// QNAMEMinimizationDomain is a domain whose TXT record contains "HOORAY"
+	// only when the resolver uses QNAME minimization (RFC 9156).
+	//
+	// Set by [NewFingerprinter] to "qnamemintest.internet.nl".
+	QNAMEMinimizationDomain string
+
+	// DoTPort is the port to use for probing DNS over TLS.
+	//
+	// Set by [NewFingerprinter] to 853.
+	DoTPort uint16
+
+	// TLSClientFactory is the [TLSClientFactory] to use for probing DNS over TLS.
+	//
+	// Set by [NewFingerprinter] to [StdlibTLSClientFactory].
+	TLSClientFactory TLSClientFactory
+
+	// Rand is the [Rand] for query IDs, cookies, and the 0x20 probe.
+	//
+	// Set by [NewFingerprinter] to [GlobalRand].
+	Rand Rand
+
+	// Timeout is the timeout of each probe.
+	//
+	// Set by [NewFingerprinter] to [DefaultResolverTimeout].
+	Timeout time.Duration
+}
+
+// FingerprintReport is the report produced by [*Fingerprinter].
+//
+// Capabilities are false when the corresponding probe failed. In such a
+// case, Failures maps the probe name to the failure string.
+type FingerprintReport struct {
+	// Endpoint is the endpoint we probed.
+	Endpoint netip.AddrPort
+
+	// UDP is true when the server successfully answers over UDP.
+	UDP bool
+
+	// EDNS is true when the server includes an OPT record in responses.
+	EDNS bool
+
+	// MaxUDPPayload is the UDP payload size advertised by the server or zero.
+	MaxUDPPayload uint16
+
+	// Cookies is true when the server answers with a server cookie (RFC 7873).
+	Cookies bool
+
+	// TCP is true when the server successfully answers over TCP.
+	TCP bool
+
+	// DoT is true when the server successfully answers over TLS on DoTPort. We
+	// do not verify the certificate, since we only probe for availability.
+	DoT bool
+
+	// DNSSECValidation is true when the server fails resolving BogusDomain
+	// with SERVFAIL while successfully resolving Domain.
+	DNSSECValidation bool
+
+	// QNAMEMinimization is true when the server uses QNAME minimization.
+	QNAMEMinimization bool
+
+	// Echo0x20 is true when the server preserves the case of the question.
+	Echo0x20 bool
+
+	// Failures maps the name of failed probes ("udp", "tcp", "dot", "dnssec",
+	// "qname_minimization", and "0x20") to failure strings.
+	Failures map[string]string
+}
+
+// NewFingerprinter creates a new [*Fingerprinter].
+func NewFingerprinter(dialer NetDialer) *Fingerprinter {
+	return &Fingerprinter{
+		Dialer:                  dialer,
+		Domain:                  "example.com",
+		BogusDomain:             "dnssec-failed.org",
+		QNAMEMinimizationDomain: "qnamemintest.internet.nl",
+		DoTPort:                 853,
+		TLSClientFactory:        StdlibTLSClientFactory{},
+		Rand:                    GlobalRand{},
+		Timeout:                 DefaultResolverTimeout,
+	}
+}
+
+// Fingerprint probes the given endpoint and returns a report.
+func (f *Fingerprinter) Fingerprint(ctx context.Context, endpoint netip.AddrPort) *FingerprintReport {
+	report := &FingerprintReport{Endpoint: endpoint, Failures: map[string]string{}}
+	txp := NewDNSOverUDPTransport(f.Dialer, endpoint)
+
+	// 1. probe UDP, EDNS(0), and cookies
+	queryMsg := f.newQueryMsg(f.Domain, dns.TypeA)
+	clientCookie := make([]byte, 8)
+	randRead(f.Rand, clientCookie)
+	queryMsg.IsEdns0().Option = append(queryMsg.IsEdns0().Option, &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: hex.EncodeToString(clientCookie),
+	})
+	respMsg, err := f.exchangeUDP(ctx, txp, queryMsg)
+	f.record(report, "udp", err)
+	if err == nil {
+		report.UDP = respMsg.Rcode == dns.RcodeSuccess
+		if opt := respMsg.IsEdns0(); opt != nil {
+			report.EDNS = true
+			report.MaxUDPPayload = opt.UDPSize()
+			for _, option := range opt.Option {
+				if cookie, ok := option.(*dns.EDNS0_COOKIE); ok {
+					report.Cookies = len(cookie.Cookie) > 2*len(clientCookie)
+				}
+			}
+		}
+	}
+
+	// 2. probe whether the server echoes the case of the question
+	queryMsg = f.newQueryMsg(fingerprintMixCase(f.Rand, f.Domain), dns.TypeA)
+	respMsg, err = f.exchangeUDP(ctx, txp, queryMsg)
+	f.record(report, "0x20", err)
+	if err == nil {
+		report.Echo0x20 = respMsg.Question[0].Name == queryMsg.Question[0].Name
+	}
+
+	// 3. probe DNSSEC validation, which requires succeeding for Domain
+	queryMsg = f.newQueryMsg(f.BogusDomain, dns.TypeA)
+	queryMsg.IsEdns0().SetDo()
+	respMsg, err = f.exchangeUDP(ctx, txp, queryMsg)
+	f.record(report, "dnssec", err)
+	if err == nil {
+		report.DNSSECValidation = report.UDP && respMsg.Rcode == dns.RcodeServerFailure
+	}
+
+	// 4. probe QNAME minimization
+	queryMsg = f.newQueryMsg(f.QNAMEMinimizationDomain, dns.TypeTXT)
+	respMsg, err = f.exchangeUDP(ctx, txp, queryMsg)
+	f.record(report, "qname_minimization", err)
+	if err == nil {
+		for _, rr := range respMsg.Answer {
+			if txt, ok := rr.(*dns.TXT); ok && strings.Contains(strings.Join(txt.Txt, ""), "HOORAY") {
+				report.QNAMEMinimization = true
+			}
+		}
+	}
+
+	// 5. probe TCP
+	respMsg, err = f.exchangeStream(ctx, endpoint, false)
+	f.record(report, "tcp", err)
+	report.TCP = err == nil && respMsg.Rcode == dns.RcodeSuccess
+
+	// 6. probe DNS over TLS
+	dotEndpoint := netip.AddrPortFrom(endpoint.Addr(), f.DoTPort)
+	respMsg, err = f.exchangeStream(ctx, dotEndpoint, true)
+	f.record(report, "dot", err)
+	report.DoT = err == nil && respMsg.Rcode == dns.RcodeSuccess
+
+	return report
+}
+
+// newQueryMsg creates a recursive query message using EDNS(0).
+func (f *Fingerprinter) newQueryMsg(name string, qtype uint16) *dns.Msg {
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(dns.Fqdn(name), qtype)
+	queryMsg.Id = randID(f.Rand)
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+	return queryMsg
+}
+
+// record records the failure of a probe, if any.
+func (f *Fingerprinter) record(report *FingerprintReport, probe string, err error) {
+	if err != nil {
+		report.Failures[probe] = ClassifyError(err)
+	}
+}
+
+// exchangeUDP performs an exchange over UDP using the configured timeout.
+func (f *Fingerprinter) exchangeUDP(
+	ctx context.Context, txp *DNSOverUDPTransport, queryMsg *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+	return txp.ExchangeMsg(ctx, queryMsg)
+}
+
+// exchangeStream queries Domain over TCP or TLS using the configured timeout.
+func (f *Fingerprinter) exchangeStream(
+	ctx context.Context, endpoint netip.AddrPort, useTLS bool) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	var config *tls.Config
+	if useTLS {
+		config = &tls.Config{
+			// We only probe for availability and the server name is unknown.
+			InsecureSkipVerify: true,
+			ServerName:         endpoint.Addr().WithZone("").String(),
+		}
+	}
+	queryMsg := f.newQueryMsg(f.Domain, dns.TypeA)
+	queryMsg.IsEdns0().SetUDPSize(dnscodec.QueryMaxResponseSizeTCP)
+	return dnsStreamDialExchangeMsg(ctx, f.Dialer, endpoint, f.TLSClientFactory, config, queryMsg, nil)
+}
+
+// fingerprintMixCase randomly changes the case of the letters in name using
+// the given [Rand], making sure that at least one letter is uppercase.
+func fingerprintMixCase(r Rand, name string) string {
+	rng := randNew(r)
+	out := []byte(strings.ToLower(name))
+	first := -1
+	for idx, ch := range out {
+		if ch < 'a' || ch > 'z' {
+			continue
+		}
+		if first < 0 {
+			first = idx
+		}
+		if rng.IntN(2) == 1 {
+			out[idx] = ch - 'a' + 'A'
+		}
+	}
+	if first >= 0 && string(out) == strings.ToLower(name) {
+		out[first] -= 'a' - 'A'
+	}
+	return string(out)
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/pkitest"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fingerprintServerConfig configures the server created by newFingerprintServer.
+type fingerprintServerConfig struct {
+	// cookies enables answering with server cookies.
+	cookies bool
+
+	// edns enables including an OPT record in responses.
+	edns bool
+
+	// lowercase lowercases the question name in responses.
+	lowercase bool
+
+	// qnamemin enables answering HOORAY to the QNAME minimization test.
+	qnamemin bool
+
+	// streams enables listening on TCP and TLS.
+	streams bool
+
+	// validating enables answering SERVFAIL for the bogus domain.
+	validating bool
+}
+
+// newFingerprintServer creates a server using the given config and returns
+// the UDP endpoint, which is also used for TCP, and the DoT port.
+func newFingerprintServer(t *testing.T, config *fingerprintServerConfig) (netip.AddrPort, uint16) {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		if config.lowercase {
+			respMsg.Question[0].Name = strings.ToLower(respMsg.Question[0].Name)
+		}
+		q0 := queryMsg.Question[0]
+		switch {
+		case strings.EqualFold(q0.Name, "dnssec-failed.org.") && config.validating:
+			respMsg.Rcode = dns.RcodeServerFailure
+		case strings.EqualFold(q0.Name, "qnamemintest.internet.nl.") && config.qnamemin:
+			respMsg.Answer = append(respMsg.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: q0.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"HOORAY - QNAME minimisation is enabled on your resolver :)!"},
+			})
+		case q0.Qtype == dns.TypeA:
+			respMsg.Answer = append(respMsg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q0.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(93, 184, 216, 34),
+			})
+		}
+		if config.edns {
+			opt := respMsg.SetEdns0(1232, false).IsEdns0()
+			if queryOpt := queryMsg.IsEdns0(); queryOpt != nil && config.cookies {
+				for _, option := range queryOpt.Option {
+					if cookie, ok := option.(*dns.EDNS0_COOKIE); ok {
+						opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{
+							Code:   dns.EDNS0COOKIE,
+							Cookie: cookie.Cookie + "0102030405060708",
+						})
+					}
+				}
+			}
+		}
+		w.WriteMsg(respMsg)
+	})
+
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{PacketConn: pconn, Handler: handler})
+	endpoint := netip.MustParseAddrPort(pconn.LocalAddr().String())
+
+	if !config.streams {
+		return endpoint, 1 // nobody should be listening on this port
+	}
+
+	listener, err := net.Listen("tcp", endpoint.String())
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{Listener: listener, Handler: handler})
+
+	cert := pkitest.MustNewSelfSignedCert(&pkitest.SelfSignedCertConfig{
+		CommonName:   "dns.example.com",
+		DNSNames:     []string{"dns.example.com"},
+		Organization: []string{"Example"},
+	})
+	keyPair := runtimex.PanicOnError1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM))
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+	})
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{Listener: tlsListener, Handler: handler})
+	dotEndpoint := netip.MustParseAddrPort(tlsListener.Addr().String())
+
+	return endpoint, dotEndpoint.Port()
+}
+
+func TestFingerprinter(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the server config.
+		config *fingerprintServerConfig
+
+		// check checks the report.
+		check func(t *testing.T, report *FingerprintReport)
+	}
+
+	tests := []testCase{
+		{
+			name: "capable server",
+			config: &fingerprintServerConfig{
+				cookies:    true,
+				edns:       true,
+				qnamemin:   true,
+				streams:    true,
+				validating: true,
+			},
+			check: func(t *testing.T, report *FingerprintReport) {
+				assert.True(t, report.UDP)
+				assert.True(t, report.EDNS)
+				assert.Equal(t, uint16(1232), report.MaxUDPPayload)
+				assert.True(t, report.Cookies)
+				assert.True(t, report.TCP)
+				assert.True(t, report.DoT)
+				assert.True(t, report.DNSSECValidation)
+				assert.True(t, report.QNAMEMinimization)
+				assert.True(t, report.Echo0x20)
+				assert.Empty(t, report.Failures)
+			},
+		},
+
+		{
+			name:   "minimal server",
+			config: &fingerprintServerConfig{lowercase: true},
+			check: func(t *testing.T, report *FingerprintReport) {
+				assert.True(t, report.UDP)
+				assert.False(t, report.EDNS)
+				assert.Zero(t, report.MaxUDPPayload)
+				assert.False(t, report.Cookies)
+				assert.False(t, report.TCP)
+				assert.False(t, report.DoT)
+				assert.False(t, report.DNSSECValidation)
+				assert.False(t, report.QNAMEMinimization)
+				assert.False(t, report.Echo0x20)
+				assert.Equal(t, map[string]string{
+					"tcp": FailureConnectionRefused,
+					"dot": FailureConnectionRefused,
+				}, report.Failures)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, dotPort := newFingerprintServer(t, tc.config)
+			fp := NewFingerprinter(&net.Dialer{})
+			fp.DoTPort = dotPort
+			fp.Timeout = time.Second
+			tc.check(t, fp.Fingerprint(context.Background(), endpoint))
+		})
+	}
+}
+
+func TestFingerprinterUnreachable(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pconn.Close()
+
+	fp := NewFingerprinter(&net.Dialer{})
+	fp.DoTPort = 1
+	fp.Timeout = 50 * time.Millisecond
+	report := fp.Fingerprint(context.Background(), netip.MustParseAddrPort(pconn.LocalAddr().String()))
+	assert.False(t, report.UDP)
+	for _, probe := range []string{"udp", "0x20", "dnssec", "qname_minimization"} {
+		assert.NotEmpty(t, report.Failures[probe])
+	}
+}
+
+func TestFingerprintMixCase(t *testing.T) {
+	for range 32 {
+		name := fingerprintMixCase(GlobalRand{}, "example.com")
+		assert.True(t, strings.EqualFold("example.com", name))
+		assert.NotEqual(t, "example.com", name)
+	}
+	assert.Equal(t, "1.2.3.4", fingerprintMixCase(GlobalRand{}, "1.2.3.4"))
+}
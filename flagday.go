@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/miekg/dns"
+)
+
+// flagDayUnknownOption is the unassigned EDNS(0) option code we use to check
+// whether the server ignores unknown options, like the ednscomp tool does.
+const flagDayUnknownOption = 100
+
+// FlagDayReport is the DNS Flag Day compliance report produced by [*Fingerprinter].
+type FlagDayReport struct {
+	// Endpoint is the endpoint we probed.
+	Endpoint netip.AddrPort
+
+	// Checks contains the checks we performed, in order.
+	Checks []*FlagDayCheck
+
+	// Compliant is true when all the checks passed.
+	Compliant bool
+}
+
+// FlagDayCheck is a single check within a [*FlagDayReport].
+type FlagDayCheck struct {
+	// Name is the check name ("edns", "edns_version", "edns_unknown_option", or "tcp").
+	Name string
+
+	// Passed is true when the server behaved as the flag day requires.
+	Passed bool
+
+	// Failure is the result of applying [ClassifyError] to the exchange
+	// error, which is empty when we received a response.
+	Failure string
+
+	// Reason explains why the check did not pass or is empty.
+	Reason string
+}
+
+// FlagDay checks whether the given endpoint complies with the DNS Flag Day
+// requirements, checking that:
+//
+//  1. the server answers EDNS(0) queries including an OPT record;
+//
+//  2. the server answers EDNS version 1 queries with BADVERS and version 0;
+//
+//  3. the server ignores unknown EDNS(0) options rather than echoing them;
+//
+//  4. the server answers queries over TCP.
+//
+// We use Domain for all the checks. A timeout is always a failure, since
+// the 2019 flag day removed the workarounds for unresponsive servers.
+func (f *Fingerprinter) FlagDay(ctx context.Context, endpoint netip.AddrPort) *FlagDayReport {
+	report := &FlagDayReport{Endpoint: endpoint}
+	txp := NewDNSOverUDPTransport(f.Dialer, endpoint)
+
+	// 1. check plain EDNS(0)
+	queryMsg := f.newQueryMsg(f.Domain, dns.TypeA)
+	respMsg, err := f.exchangeUDP(ctx, txp, queryMsg)
+	f.checkFlagDay(report, "edns", respMsg, err, func(respMsg *dns.Msg) string {
+		return flagDayCheckEDNS(respMsg, dns.RcodeSuccess)
+	})
+
+	// 2. check EDNS version negotiation
+	queryMsg = f.newQueryMsg(f.Domain, dns.TypeA)
+	queryMsg.IsEdns0().SetVersion(1)
+	respMsg, err = f.exchangeUDP(ctx, txp, queryMsg)
+	f.checkFlagDay(report, "edns_version", respMsg, err, func(respMsg *dns.Msg) string {
+		if reason := flagDayCheckEDNS(respMsg, dns.RcodeBadVers); reason != "" {
+			return reason
+		}
+		if len(respMsg.Answer) > 0 {
+			return "unexpected answers"
+		}
+		return ""
+	})
+
+	// 3. check unknown EDNS(0) options handling
+	queryMsg = f.newQueryMsg(f.Domain, dns.TypeA)
+	queryMsg.IsEdns0().Option = append(queryMsg.IsEdns0().Option, &dns.EDNS0_LOCAL{
+		Code: flagDayUnknownOption,
+		Data: []byte{},
+	})
+	respMsg, err = f.exchangeUDP(ctx, txp, queryMsg)
+	f.checkFlagDay(report, "edns_unknown_option", respMsg, err, func(respMsg *dns.Msg) string {
+		if reason := flagDayCheckEDNS(respMsg, dns.RcodeSuccess); reason != "" {
+			return reason
+		}
+		for _, option := range respMsg.IsEdns0().Option {
+			if option.Option() == flagDayUnknownOption {
+				return "unknown option echoed"
+			}
+		}
+		return ""
+	})
+
+	// 4. check TCP
+	respMsg, err = f.exchangeStream(ctx, endpoint, false)
+	f.checkFlagDay(report, "tcp", respMsg, err, func(respMsg *dns.Msg) string {
+		if respMsg.Rcode != dns.RcodeSuccess {
+			return fmt.Sprintf("unexpected rcode %s", dns.RcodeToString[respMsg.Rcode])
+		}
+		return ""
+	})
+
+	// 5. summarize
+	report.Compliant = true
+	for _, check := range report.Checks {
+		report.Compliant = report.Compliant && check.Passed
+	}
+	return report
+}
+
+// checkFlagDay appends a [*FlagDayCheck] to the report using the given exchange
+// result and validate function returning the reason for not passing.
+func (f *Fingerprinter) checkFlagDay(report *FlagDayReport, name string,
+	respMsg *dns.Msg, err error, validate func(respMsg *dns.Msg) string) {
+	check := &FlagDayCheck{Name: name}
+	if err != nil {
+		check.Failure = ClassifyError(err)
+		check.Reason = "no response"
+	} else {
+		check.Reason = validate(respMsg)
+		check.Passed = check.Reason == ""
+	}
+	report.Checks = append(report.Checks, check)
+}
+
+// flagDayCheckEDNS returns why the response does not have the expected rcode
+// and an EDNS version 0 OPT record or an empty string.
+func flagDayCheckEDNS(respMsg *dns.Msg, rcode int) string {
+	if respMsg.Rcode != rcode {
+		return fmt.Sprintf("unexpected rcode %s", dns.RcodeToString[respMsg.Rcode])
+	}
+	opt := respMsg.IsEdns0()
+	if opt == nil {
+		return "missing OPT record"
+	}
+	if opt.Version() != 0 {
+		return fmt.Sprintf("unexpected EDNS version %d", opt.Version())
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flagDayServerConfig configures the server created by newFlagDayServer.
+type flagDayServerConfig struct {
+	// dropEDNS disables answering queries with an OPT record.
+	dropEDNS bool
+
+	// echoOptions enables echoing the query EDNS(0) options.
+	echoOptions bool
+
+	// ignoreVersion disables answering BADVERS to EDNS version 1 queries.
+	ignoreVersion bool
+
+	// tcp enables listening on TCP.
+	tcp bool
+}
+
+// newFlagDayServer creates a server using the given config and returns
+// the endpoint, which is also used for TCP.
+func newFlagDayServer(t *testing.T, config *flagDayServerConfig) netip.AddrPort {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+		queryOpt := queryMsg.IsEdns0()
+		if queryOpt != nil && config.dropEDNS {
+			return
+		}
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		if queryOpt == nil {
+			w.WriteMsg(respMsg)
+			return
+		}
+		opt := respMsg.SetEdns0(1232, false).IsEdns0()
+		if queryOpt.Version() != 0 && !config.ignoreVersion {
+			respMsg.Rcode = dns.RcodeBadVers
+			w.WriteMsg(respMsg)
+			return
+		}
+		if config.echoOptions {
+			opt.Option = queryOpt.Option
+		}
+		respMsg.Answer = append(respMsg.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: queryMsg.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.IPv4(93, 184, 216, 34),
+		})
+		w.WriteMsg(respMsg)
+	})
+
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{PacketConn: pconn, Handler: handler})
+	endpoint := netip.MustParseAddrPort(pconn.LocalAddr().String())
+
+	if config.tcp {
+		listener, err := net.Listen("tcp", endpoint.String())
+		require.NoError(t, err)
+		startDNSServer(t, &dns.Server{Listener: listener, Handler: handler})
+	}
+	return endpoint
+}
+
+func TestFingerprinterFlagDay(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the server config.
+		config *flagDayServerConfig
+
+		// wantReasons maps the name of each check to the expected reason.
+		wantReasons map[string]string
+	}
+
+	tests := []testCase{
+		{
+			name:   "compliant server",
+			config: &flagDayServerConfig{tcp: true},
+		},
+
+		{
+			name:   "server ignoring the EDNS version",
+			config: &flagDayServerConfig{ignoreVersion: true, tcp: true},
+			wantReasons: map[string]string{
+				"edns_version": "unexpected rcode NOERROR",
+			},
+		},
+
+		{
+			name:   "server echoing unknown options",
+			config: &flagDayServerConfig{echoOptions: true, tcp: true},
+			wantReasons: map[string]string{
+				"edns_unknown_option": "unknown option echoed",
+			},
+		},
+
+		{
+			name:   "server dropping EDNS queries without TCP",
+			config: &flagDayServerConfig{dropEDNS: true},
+			wantReasons: map[string]string{
+				"edns":                "no response",
+				"edns_version":        "no response",
+				"edns_unknown_option": "no response",
+				"tcp":                 "no response",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := newFlagDayServer(t, tc.config)
+			f := NewFingerprinter(&net.Dialer{})
+			f.Timeout = 250 * time.Millisecond
+			report := f.FlagDay(context.Background(), endpoint)
+
+			assert.Equal(t, endpoint, report.Endpoint)
+			var names []string
+			for _, check := range report.Checks {
+				names = append(names, check.Name)
+				assert.Equal(t, tc.wantReasons[check.Name], check.Reason, check.Name)
+				assert.Equal(t, check.Reason == "no response", check.Failure != "", check.Name)
+				assert.Equal(t, check.Reason == "", check.Passed, check.Name)
+			}
+			assert.Equal(t, []string{"edns", "edns_version", "edns_unknown_option", "tcp"}, names)
+			assert.Equal(t, len(tc.wantReasons) == 0, report.Compliant)
+		})
+	}
+}
+
+func TestFlagDayCheckEDNS(t *testing.T) {
+	respMsg := new(dns.Msg)
+	assert.Equal(t, "missing OPT record", flagDayCheckEDNS(respMsg, dns.RcodeSuccess))
+	respMsg.SetEdns0(1232, false).IsEdns0().SetVersion(1)
+	assert.Equal(t, "unexpected EDNS version 1", flagDayCheckEDNS(respMsg, dns.RcodeSuccess))
+	assert.Equal(t, "unexpected rcode NOERROR", flagDayCheckEDNS(respMsg, dns.RcodeBadVers))
+}
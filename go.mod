@@ -6,19 +6,21 @@ require (
 	github.com/bassosimone/dnscodec v0.0.0-20260708085128-509089cc75f8
 	github.com/bassosimone/dnstest v0.0.0-20260708095631-cc76beccfa05
 	github.com/bassosimone/netstub v0.0.0-20260708092707-84f2b5087f74
+	github.com/bassosimone/pkitest v0.0.0-20260708093733-a6664538a85c
 	github.com/bassosimone/runtimex v0.0.0-20260708083610-01df83158243
 	github.com/miekg/dns v1.1.72
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/net v0.56.0
+	golang.org/x/sys v0.47.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rogpeppe/go-internal v1.15.0 // indirect
 	golang.org/x/mod v0.37.0 // indirect
-	golang.org/x/net v0.56.0 // indirect
 	golang.org/x/sync v0.22.0 // indirect
-	golang.org/x/sys v0.47.0 // indirect
 	golang.org/x/text v0.39.0 // indirect
 	golang.org/x/tools v0.47.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// HostAddr is an address returned by [*Resolver.LookupHostExtended].
+type HostAddr struct {
+	// Address is the IPv4 or IPv6 address.
+	Address netip.Addr
+
+	// Qtype is the query type that returned the address, either
+	// [dns.TypeA] or [dns.TypeAAAA].
+	Qtype uint16
+
+	// TTL is the TTL of the record containing the address.
+	TTL uint32
+
+	// CNAMEChain contains the canonical names we followed, in order, to
+	// reach the name owning the address. It is empty when the queried
+	// name directly owns the address.
+	CNAMEChain []string
+
+	// Transport is the index within the [*Resolver] Transports of
+	// the transport that answered.
+	Transport int
+}
+
+// LookupHostExtended is like [*Resolver.LookupHost] but returns a
+// [*HostAddr] for each address, allowing measurement code to record
+// the TTLs, the CNAME chain, and the transport that answered without
+// parsing the responses again.
+func (r *Resolver) LookupHostExtended(ctx context.Context, domain string) ([]*HostAddr, error) {
+	addrs, err := resolverLookupHost(ctx, r, domain, r.lookupHostAddrsA, r.lookupHostAddrsAAAA)
+	if err != nil {
+		return nil, NewDNSError(domain, err)
+	}
+	return addrs, nil
+}
+
+// LookupNetip is like [*Resolver.LookupHost] but returns [netip.Addr] values,
+// therefore the caller does not need to parse the addresses.
+func (r *Resolver) LookupNetip(ctx context.Context, domain string) ([]netip.Addr, error) {
+	hostAddrs, err := r.LookupHostExtended(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]netip.Addr, 0, len(hostAddrs))
+	for _, hostAddr := range hostAddrs {
+		addrs = append(addrs, hostAddr.Address)
+	}
+	return addrs, nil
+}
+
+// lookupHostAddrsA returns the [*HostAddr] for the A records.
+func (r *Resolver) lookupHostAddrsA(ctx context.Context, domain string) ([]*HostAddr, error) {
+	return r.lookupHostAddrs(ctx, domain, dns.TypeA)
+}
+
+// lookupHostAddrsAAAA returns the [*HostAddr] for the AAAA records.
+func (r *Resolver) lookupHostAddrsAAAA(ctx context.Context, domain string) ([]*HostAddr, error) {
+	return r.lookupHostAddrs(ctx, domain, dns.TypeAAAA)
+}
+
+// lookupHostAddrs queries for the given type and returns the [*HostAddr]
+// for the valid addresses or [dnscodec.ErrNoData] if there are none.
+func (r *Resolver) lookupHostAddrs(ctx context.Context, domain string, qtype uint16) ([]*HostAddr, error) {
+	// 1. perform the lookup
+	query := r.newQuery(domain, qtype)
+	resp, transport, err := r.lookupTransport(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. reconstruct the CNAME chain leading to each owner name
+	//
+	// The valid RRs only contain the CNAMEs forming the chain that
+	// starts from the query name, in the order we should follow them.
+	chains := map[string][]string{dns.CanonicalName(query.Name): nil}
+	var chain []string
+	for _, rr := range resp.ValidRRs {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			target := dns.CanonicalName(cname.Target)
+			if _, found := chains[target]; !found {
+				chain = append(chain, target)
+				chains[target] = chain[:len(chain):len(chain)]
+			}
+		}
+	}
+
+	// 3. collect the well-formed addresses
+	var addrs []*HostAddr
+	for _, rr := range resp.ValidRRs {
+		addr, ok := hostAddrFromRR(rr, qtype)
+		if !ok {
+			continue
+		}
+		addrs = append(addrs, &HostAddr{
+			Address:    addr,
+			Qtype:      qtype,
+			TTL:        rr.Header().Ttl,
+			CNAMEChain: chains[dns.CanonicalName(rr.Header().Name)],
+			Transport:  transport,
+		})
+	}
+	if len(addrs) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return addrs, nil
+}
+
+// RecordsNetipA is like [*dnscodec.Response.RecordsA] but returns [netip.Addr]
+// values, skipping malformed addresses, or [dnscodec.ErrNoData] if there are none.
+func RecordsNetipA(resp *dnscodec.Response) ([]netip.Addr, error) {
+	return recordsNetip(resp, dns.TypeA)
+}
+
+// RecordsNetipAAAA is like [*dnscodec.Response.RecordsAAAA] but returns [netip.Addr]
+// values, skipping malformed addresses, or [dnscodec.ErrNoData] if there are none.
+func RecordsNetipAAAA(resp *dnscodec.Response) ([]netip.Addr, error) {
+	return recordsNetip(resp, dns.TypeAAAA)
+}
+
+// recordsNetip returns the well-formed addresses of the given type in the
+// valid RRs or [dnscodec.ErrNoData] if there are none.
+func recordsNetip(resp *dnscodec.Response, qtype uint16) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, rr := range resp.ValidRRs {
+		if addr, ok := hostAddrFromRR(rr, qtype); ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return addrs, nil
+}
+
+// hostAddrFromRR returns the address of an A or AAAA record when the record
+// has the given type and contains a well-formed address.
+func hostAddrFromRR(rr dns.RR, qtype uint16) (netip.Addr, bool) {
+	switch rr := rr.(type) {
+	case *dns.A:
+		if qtype == dns.TypeA {
+			return netip.AddrFromSlice(rr.A.To4())
+		}
+	case *dns.AAAA:
+		if qtype == dns.TypeAAAA {
+			return netip.AddrFromSlice(rr.AAAA.To16())
+		}
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverLookupHostExtended(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records maps the query type to the answer records.
+		records map[uint16][]string
+
+		// want contains the expected addresses.
+		want []*HostAddr
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name: "direct answers",
+			records: map[uint16][]string{
+				dns.TypeA:    {"example.com. 300 IN A 192.0.2.1"},
+				dns.TypeAAAA: {"example.com. 60 IN AAAA 2001:db8::1"},
+			},
+			want: []*HostAddr{{
+				Address:   netip.MustParseAddr("192.0.2.1"),
+				Qtype:     dns.TypeA,
+				TTL:       300,
+				Transport: 1,
+			}, {
+				Address:   netip.MustParseAddr("2001:db8::1"),
+				Qtype:     dns.TypeAAAA,
+				TTL:       60,
+				Transport: 1,
+			}},
+		},
+
+		{
+			name: "answers via CNAME chain",
+			records: map[uint16][]string{
+				dns.TypeA: {
+					"example.com. 300 IN CNAME B.example.net.",
+					"b.example.net. 200 IN CNAME c.example.org.",
+					"c.example.org. 100 IN A 192.0.2.1",
+				},
+			},
+			want: []*HostAddr{{
+				Address:    netip.MustParseAddr("192.0.2.1"),
+				Qtype:      dns.TypeA,
+				TTL:        100,
+				CNAMEChain: []string{"b.example.net.", "c.example.org."},
+				Transport:  1,
+			}},
+		},
+
+		{
+			name:    "no addresses",
+			records: map[uint16][]string{dns.TypeA: {"example.com. 300 IN CNAME example.net."}},
+			wantErr: dnscodec.ErrNoData,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// the first transport always fails so that the second one answers
+			failing := transportStub{
+				exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+					return nil, errors.New("mocked error")
+				},
+			}
+			answering := transportStub{
+				exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+					queryMsg := runtimex.PanicOnError1(query.NewMsg())
+					respMsg := new(dns.Msg)
+					respMsg.SetReply(queryMsg)
+					for _, record := range tc.records[query.Type] {
+						respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+					}
+					return dnscodec.ParseResponse(queryMsg, respMsg)
+				},
+			}
+			reso := NewResolver(failing, answering)
+
+			addrs, err := reso.LookupHostExtended(context.Background(), "example.com")
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				var dnsErr *net.DNSError
+				require.ErrorAs(t, err, &dnsErr)
+				assert.True(t, dnsErr.IsNotFound)
+				require.Nil(t, addrs)
+				return
+			}
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, addrs)
+		})
+	}
+}
+
+func TestResolverLookupNetip(t *testing.T) {
+	reso := newRecordsResolver("example.com. 300 IN A 192.0.2.1", "example.com. 300 IN AAAA 2001:db8::1")
+	addrs, err := reso.LookupNetip(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")}, addrs)
+
+	addrs, err = newRecordsResolver().LookupNetip(context.Background(), "example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, addrs)
+}
+
+func TestResolverLookupHostExtendedMalformedAddress(t *testing.T) {
+	reso := NewResolver(transportStub{
+		exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			queryMsg := runtimex.PanicOnError1(query.NewMsg())
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.Answer = append(respMsg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.IP{192, 0, 2},
+			})
+			return dnscodec.ParseResponse(queryMsg, respMsg)
+		},
+	})
+	reso.AddressFamily = AddressFamilyIPv4Only
+	addrs, err := reso.LookupNetip(context.Background(), "example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, addrs)
+}
+
+func TestRecordsNetip(t *testing.T) {
+	resp := &dnscodec.Response{ValidRRs: []dns.RR{
+		runtimex.PanicOnError1(dns.NewRR("example.com. 300 IN A 192.0.2.1")),
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.IP{192, 0, 2}},
+		runtimex.PanicOnError1(dns.NewRR("example.com. 300 IN AAAA 2001:db8::1")),
+		runtimex.PanicOnError1(dns.NewRR("example.com. 300 IN A 192.0.2.2")),
+	}}
+
+	addrs, err := RecordsNetipA(resp)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")}, addrs)
+
+	addrs, err = RecordsNetipAAAA(resp)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("2001:db8::1")}, addrs)
+
+	addrs, err = RecordsNetipAAAA(&dnscodec.Response{})
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, addrs)
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// HTTPSAwareDialer is a [*Dialer] using the HTTPS record of the target
+// domain (RFC 9460) to choose the addresses, port, and ALPN, which allows
+// to measure whether the SVCB connection hints work in the real world.
+//
+// Construct using [NewHTTPSAwareDialer].
+type HTTPSAwareDialer struct {
+	// Dialer is the [*Dialer] to use for connecting.
+	//
+	// Set by [NewHTTPSAwareDialer] to the user-provided value.
+	Dialer *Dialer
+
+	// Resolver is the [*Resolver] to use for fetching the HTTPS record.
+	//
+	// Set by [NewHTTPSAwareDialer] to the user-provided value.
+	Resolver *Resolver
+
+	// ObserveHints is an OPTIONAL hook called after each dial.
+	ObserveHints func(*HTTPSHintsObservation)
+}
+
+// HTTPSHintsObservation describes a dial performed by [*HTTPSAwareDialer].
+type HTTPSHintsObservation struct {
+	// Domain is the domain name we dialed.
+	Domain string
+
+	// Record is the selected HTTPS record or nil.
+	Record *dns.HTTPS
+
+	// LookupErr is the HTTPS lookup error or nil.
+	LookupErr error
+
+	// Target is the target name of the selected record or the domain.
+	Target string
+
+	// Port is the port we used, possibly taken from the record.
+	Port string
+
+	// ALPN contains the ALPN values taken from the record.
+	ALPN []string
+
+	// Hints contains the ipv4hint and ipv6hint addresses.
+	Hints []string
+
+	// HintsErr is the error of connecting to the hints or nil.
+	HintsErr error
+
+	// HintsWorked indicates whether we connected using the hints.
+	HintsWorked bool
+
+	// Address is the address of the established connection or empty.
+	Address string
+
+	// Err is the error or nil.
+	Err error
+}
+
+// NewHTTPSAwareDialer creates a new [*HTTPSAwareDialer].
+func NewHTTPSAwareDialer(dialer *Dialer, reso *Resolver) *HTTPSAwareDialer {
+	return &HTTPSAwareDialer{Dialer: dialer, Resolver: reso}
+}
+
+// DialTLSContext creates a new [TLSConn] connection.
+//
+// We select the HTTPS record in ServiceMode with the lowest priority and
+// connect to its ipv4hint and ipv6hint addresses using its port. When the
+// hints are missing or do not work, we fall back to resolving the target
+// name. When config.NextProtos is empty, we use the ALPN values of the record.
+// When there is no usable HTTPS record, we behave like [*Dialer.DialTLSContext].
+// We do not follow AliasMode records.
+func (d *HTTPSAwareDialer) DialTLSContext(
+	ctx context.Context, network, address string, config *tls.Config) (TLSConn, error) {
+	// 1. split the address and short circuit IP addresses
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return d.Dialer.DialTLSContext(ctx, network, address, config)
+	}
+	obs := &HTTPSHintsObservation{Domain: host, Target: host, Port: port}
+
+	// 2. fetch and select the HTTPS record
+	records, err := d.Resolver.LookupHTTPS(ctx, host)
+	obs.LookupErr = err
+	obs.Record = httpsSelectRecord(records)
+	if obs.Record == nil {
+		conn, err := d.Dialer.DialTLSContext(ctx, network, address, config)
+		return d.finish(obs, conn, err)
+	}
+
+	// 3. extract the connection parameters
+	record := NewSVCBRecord(&obs.Record.SVCB)
+	if record.Target != "." {
+		obs.Target = record.Target
+	}
+	if record.Port != 0 {
+		obs.Port = strconv.Itoa(int(record.Port))
+	}
+	obs.ALPN = record.ALPN
+	for _, addr := range append(record.IPv4Hint, record.IPv6Hint...) {
+		obs.Hints = append(obs.Hints, addr.String())
+	}
+
+	// 4. make sure the SNI is the origin and apply the ALPN
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if len(config.NextProtos) <= 0 {
+		config.NextProtos = obs.ALPN
+	}
+
+	// 5. attempt to use the hints
+	var errv []error
+	for _, hint := range obs.Hints {
+		conn, err := d.Dialer.DialTLSContext(ctx, network, net.JoinHostPort(hint, obs.Port), config)
+		if err == nil {
+			obs.HintsWorked = true
+			return d.finish(obs, conn, nil)
+		}
+		errv = append(errv, err)
+	}
+	obs.HintsErr = errors.Join(errv...)
+
+	// 6. fall back to resolving the target name
+	conn, err := d.Dialer.DialTLSContext(ctx, network, net.JoinHostPort(obs.Target, obs.Port), config)
+	return d.finish(obs, conn, err)
+}
+
+// finish completes and emits the observation and returns the connection.
+func (d *HTTPSAwareDialer) finish(
+	obs *HTTPSHintsObservation, conn TLSConn, err error) (TLSConn, error) {
+	obs.Err = err
+	if conn != nil {
+		obs.Address = conn.RemoteAddr().String()
+	}
+	if d.ObserveHints != nil {
+		d.ObserveHints(obs)
+	}
+	return conn, err
+}
+
+// httpsSelectRecord returns the ServiceMode record with the lowest priority or nil.
+func httpsSelectRecord(records []*dns.HTTPS) *dns.HTTPS {
+	var selected *dns.HTTPS
+	for _, rr := range records {
+		if rr.Priority == 0 {
+			continue // AliasMode
+		}
+		if selected == nil || rr.Priority < selected.Priority {
+			selected = rr
+		}
+	}
+	return selected
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverLookupHTTPS(t *testing.T) {
+	reso := NewResolver(newRecordsTransport(dns.TypeHTTPS,
+		"example.com. 300 IN HTTPS 1 . alpn=h2",
+		"example.com. 300 IN HTTPS 0 svc.example.com.",
+	))
+	records, err := reso.LookupHTTPS(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, uint16(1), records[0].Priority)
+
+	reso = NewResolver(newRecordsTransport(dns.TypeHTTPS))
+	records, err = reso.LookupHTTPS(context.Background(), "example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, records)
+}
+
+func TestHTTPSAwareDialer(t *testing.T) {
+	address, pool := newTLSServer(t, "example.com")
+	_, port := runtimex.PanicOnError2(net.SplitHostPort(address))
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the HTTPS records to serve.
+		records []string
+
+		// address is the address to dial.
+		address string
+
+		// wantRecord indicates whether we expect a selected record.
+		wantRecord bool
+
+		// wantHints is the expected list of hints.
+		wantHints []string
+
+		// wantHintsWorked is the expected HintsWorked value.
+		wantHintsWorked bool
+	}
+
+	tests := []testCase{
+		{
+			name:            "hints work",
+			records:         []string{"example.com. 300 IN HTTPS 1 . alpn=h2 port=" + port + " ipv4hint=127.0.0.1"},
+			address:         "example.com:443",
+			wantRecord:      true,
+			wantHints:       []string{"127.0.0.1"},
+			wantHintsWorked: true,
+		},
+
+		{
+			name:       "hints do not work",
+			records:    []string{"example.com. 300 IN HTTPS 1 . port=" + port + " ipv4hint=127.0.0.2"},
+			address:    "example.com:443",
+			wantRecord: true,
+			wantHints:  []string{"127.0.0.2"},
+		},
+
+		{
+			name: "lowest priority without hints",
+			records: []string{
+				"example.com. 300 IN HTTPS 2 . port=1 ipv4hint=127.0.0.2",
+				"example.com. 300 IN HTTPS 1 . port=" + port,
+				"example.com. 300 IN HTTPS 0 svc.example.com.",
+			},
+			address:    "example.com:443",
+			wantRecord: true,
+		},
+
+		{
+			name:    "without HTTPS records",
+			address: "example.com:" + port,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := NewDialer(&net.Dialer{}, &netstub.FuncResolver{
+				LookupHostFunc: func(ctx context.Context, name string) ([]string, error) {
+					assert.Equal(t, "example.com", name)
+					return []string{"127.0.0.1"}, nil
+				},
+			})
+			hd := NewHTTPSAwareDialer(dialer, NewResolver(newRecordsTransport(dns.TypeHTTPS, tc.records...)))
+			var obs *HTTPSHintsObservation
+			hd.ObserveHints = func(o *HTTPSHintsObservation) { obs = o }
+
+			conn, err := hd.DialTLSContext(context.Background(), "tcp", tc.address, &tls.Config{RootCAs: pool})
+			require.NoError(t, err)
+			defer conn.Close()
+			assert.Equal(t, "example.com", conn.ConnectionState().ServerName)
+
+			require.NotNil(t, obs)
+			assert.Equal(t, "example.com", obs.Domain)
+			assert.Equal(t, tc.wantRecord, obs.Record != nil)
+			assert.Equal(t, tc.wantRecord, obs.LookupErr == nil)
+			assert.Equal(t, tc.wantHints, obs.Hints)
+			assert.Equal(t, tc.wantHintsWorked, obs.HintsWorked)
+			assert.Equal(t, len(tc.wantHints) > 0 && !tc.wantHintsWorked, obs.HintsErr != nil)
+			assert.Equal(t, port, obs.Port)
+			assert.Equal(t, address, obs.Address)
+			assert.NoError(t, obs.Err)
+		})
+	}
+}
+
+func TestHTTPSAwareDialerALPN(t *testing.T) {
+	address, pool := newTLSServer(t, "example.com")
+	_, port := runtimex.PanicOnError2(net.SplitHostPort(address))
+	dialer := NewDialer(&net.Dialer{}, &netstub.FuncResolver{})
+	hd := NewHTTPSAwareDialer(dialer, NewResolver(newRecordsTransport(dns.TypeHTTPS,
+		"example.com. 300 IN HTTPS 1 svc.example.com. alpn=h2,http/1.1 port="+port+" ipv4hint=127.0.0.1",
+	)))
+	var obs *HTTPSHintsObservation
+	hd.ObserveHints = func(o *HTTPSHintsObservation) { obs = o }
+
+	conn, err := hd.DialTLSContext(context.Background(), "tcp", "example.com:443", &tls.Config{RootCAs: pool})
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NotNil(t, obs)
+	assert.Equal(t, []string{"h2", "http/1.1"}, obs.ALPN)
+	assert.Equal(t, "svc.example.com.", obs.Target)
+	assert.True(t, obs.HintsWorked)
+}
+
+func TestHTTPSAwareDialerFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// address is the address to dial.
+		address string
+	}
+
+	tests := []testCase{
+		{
+			name:    "invalid address",
+			address: "example.com",
+		},
+
+		{
+			name:    "IP address",
+			address: "127.0.0.1:1",
+		},
+
+		{
+			name:    "hints and fallback fail",
+			address: "example.com:443",
+		},
+	}
+
+	expectedErr := errors.New("mocked error")
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := NewDialer(&netstub.FuncDialer{
+				DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return nil, expectedErr
+				},
+			}, &netstub.FuncResolver{
+				LookupHostFunc: func(ctx context.Context, name string) ([]string, error) {
+					return []string{"127.0.0.1"}, nil
+				},
+			})
+			hd := NewHTTPSAwareDialer(dialer, NewResolver(newRecordsTransport(dns.TypeHTTPS,
+				"example.com. 300 IN HTTPS 1 . ipv4hint=127.0.0.2",
+			)))
+			conn, err := hd.DialTLSContext(context.Background(), "tcp", tc.address, nil)
+			require.Error(t, err)
+			assert.Nil(t, conn)
+		})
+	}
+}
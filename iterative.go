@@ -0,0 +1,317 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrIterativeInvalidReferral indicates that a non-authoritative response
+// does not contain a referral to a zone closer to the queried name.
+var ErrIterativeInvalidReferral = errors.New("iterative resolution: invalid referral")
+
+// ErrIterativeTooManyQueries indicates that the iterative resolution
+// exceeded the configured maximum number of queries.
+var ErrIterativeTooManyQueries = errors.New("iterative resolution: too many queries")
+
+// IterativeResolver resolves names starting from the root servers and
+// following referrals, like a recursive resolver would do.
+//
+// Comparing the iterative resolution with the one performed by a recursive
+// resolver allows detecting interference with the recursive resolver. Each
+// intermediate exchange is recorded in the [*IterativeResolution].
+//
+// We only use IPv4 glue records and addresses to contact the servers.
+//
+// Construct using [NewIterativeResolver].
+type IterativeResolver struct {
+	// NewTransport creates the [DNSMsgTransport] to use to query the
+	// server with the given address.
+	//
+	// Set by [NewIterativeResolver] to a function creating a
+	// [*DNSOverUDPTransport] for port 53 using the given dialer.
+	NewTransport func(addr netip.Addr) DNSMsgTransport
+
+	// RootServers contains the addresses of the root servers. Use
+	// [*RootPrimer] to obtain the current root servers.
+	//
+	// Set by [NewIterativeResolver] to the IPv4 addresses of [DefaultRootHints].
+	RootServers []netip.Addr
+
+	// MaxQueries is the maximum number of queries of a resolution, including
+	// the ones to resolve name servers without glue and to follow CNAMEs.
+	//
+	// Set by [NewIterativeResolver] to 64.
+	MaxQueries int
+
+	// Timeout is the timeout of each query.
+	//
+	// Set by [NewIterativeResolver] to 5 seconds.
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewIterativeResolver] to [GlobalRand].
+	Rand Rand
+
+	// ObserveStep is an OPTIONAL hook called after each query.
+	ObserveStep func(step *IterativeStep)
+}
+
+// IterativeStep describes a query performed by [*IterativeResolver].
+type IterativeStep struct {
+	// Zone is the zone we believe the server is authoritative for.
+	Zone string
+
+	// Server is the server address.
+	Server netip.Addr
+
+	// Query is the query we sent.
+	Query *dns.Msg
+
+	// Response is the response or nil.
+	Response *dns.Msg
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the query.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// IterativeResolution is the result of [*IterativeResolver.Resolve].
+type IterativeResolution struct {
+	// Response is the final response or nil. When following CNAMEs, we
+	// prepend the CNAME records we followed to the answer section.
+	Response *dns.Msg
+
+	// Steps contains the queries we performed in order.
+	Steps []*IterativeStep
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+}
+
+// NewIterativeResolver creates a new [*IterativeResolver].
+func NewIterativeResolver(dialer NetDialer) *IterativeResolver {
+	return &IterativeResolver{
+		NewTransport: func(addr netip.Addr) DNSMsgTransport {
+			return NewDNSOverUDPTransport(dialer, netip.AddrPortFrom(addr, 53))
+		},
+		RootServers: DefaultRootHints().IPv4(),
+		MaxQueries:  64,
+		Timeout:     5 * time.Second,
+		Rand:        GlobalRand{},
+	}
+}
+
+// Resolve resolves the given name and query type iteratively.
+func (ir *IterativeResolver) Resolve(ctx context.Context, name string, qtype uint16) *IterativeResolution {
+	res := &IterativeResolution{}
+	res.Response, res.Err = ir.resolve(ctx, res, dns.Fqdn(name), qtype)
+	res.Failure = ClassifyError(res.Err)
+	return res
+}
+
+// resolve resolves the given name recording the steps into res.
+func (ir *IterativeResolver) resolve(
+	ctx context.Context, res *IterativeResolution, name string, qtype uint16) (*dns.Msg, error) {
+	var cnames []dns.RR
+	zone, servers := ".", ir.RootServers
+	for {
+		// 1. query the servers of the current zone
+		respMsg, err := ir.query(ctx, res, zone, servers, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+
+		// 2. answers and authoritative responses end the resolution unless
+		// we need to restart from the root to follow a CNAME
+		if respMsg.Rcode != dns.RcodeSuccess || respMsg.Authoritative || len(respMsg.Answer) > 0 {
+			target, chain := iterativeCNAMEChain(respMsg, name, qtype)
+			if target == "" && len(cnames) > 0 {
+				respMsg = respMsg.Copy() // do not modify the recorded step
+				respMsg.Answer = append(cnames, respMsg.Answer...)
+			}
+			if target == "" {
+				return respMsg, nil
+			}
+			cnames = append(cnames, chain...)
+			name, zone, servers = target, ".", ir.RootServers
+			continue
+		}
+
+		// 3. otherwise, follow the referral, resolving the name
+		// servers addresses when there is no glue
+		child, nsNames := iterativeReferral(respMsg, zone, name)
+		if child == "" {
+			return nil, ErrIterativeInvalidReferral
+		}
+		addrs := iterativeGlue(respMsg, nsNames)
+		if len(addrs) <= 0 {
+			if addrs, err = ir.resolveNameServers(ctx, res, nsNames); err != nil {
+				return nil, err
+			}
+		}
+		zone, servers = child, addrs
+	}
+}
+
+// resolveNameServers resolves the IPv4 addresses of the given name servers
+// stopping at the first name server that resolves.
+func (ir *IterativeResolver) resolveNameServers(
+	ctx context.Context, res *IterativeResolution, nsNames []string) ([]netip.Addr, error) {
+	err := error(dnscodec.ErrNoData)
+	for _, nsName := range nsNames {
+		var respMsg *dns.Msg
+		respMsg, err = ir.resolve(ctx, res, nsName, dns.TypeA)
+		if errors.Is(err, ErrIterativeTooManyQueries) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		if addrs := iterativeAddrs(respMsg.Answer, nil); len(addrs) > 0 {
+			return addrs, nil
+		}
+		err = dnscodec.ErrNoData
+	}
+	return nil, err
+}
+
+// query queries the given servers in order until one of them responds.
+func (ir *IterativeResolver) query(ctx context.Context, res *IterativeResolution,
+	zone string, servers []netip.Addr, name string, qtype uint16) (*dns.Msg, error) {
+	err := error(dnscodec.ErrNoData)
+	for _, server := range servers {
+		if len(res.Steps) >= ir.MaxQueries {
+			return nil, ErrIterativeTooManyQueries
+		}
+		var respMsg *dns.Msg
+		respMsg, err = ir.exchange(ctx, res, zone, server, name, qtype)
+		if err == nil {
+			return respMsg, nil
+		}
+	}
+	return nil, err
+}
+
+// exchange sends a non-recursive query to the given server and records the step.
+func (ir *IterativeResolver) exchange(ctx context.Context, res *IterativeResolution,
+	zone string, server netip.Addr, name string, qtype uint16) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, ir.Timeout)
+	defer cancel()
+
+	// 1. create the query message
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(name, qtype)
+	queryMsg.Id = randID(ir.Rand)
+	queryMsg.RecursionDesired = false
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+
+	// 2. perform the exchange
+	step := &IterativeStep{Zone: zone, Server: server, Query: queryMsg, Started: time.Now()}
+	step.Response, step.Err = ir.NewTransport(server).ExchangeMsg(ctx, queryMsg)
+	step.Elapsed = time.Since(step.Started)
+	step.Failure = ClassifyError(step.Err)
+
+	// 3. record the step
+	res.Steps = append(res.Steps, step)
+	if ir.ObserveStep != nil {
+		ir.ObserveStep(step)
+	}
+	return step.Response, step.Err
+}
+
+// iterativeCNAMEChain returns the target of the CNAME chain starting at name
+// along with the chain records when the response does not contain records
+// of the query type for the final target. Otherwise, it returns an empty target.
+func iterativeCNAMEChain(respMsg *dns.Msg, name string, qtype uint16) (string, []dns.RR) {
+	var chain []dns.RR
+	target := name
+	for len(chain) <= len(respMsg.Answer) {
+		var next *dns.CNAME
+		for _, rr := range respMsg.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok && dns.CanonicalName(cname.Hdr.Name) == dns.CanonicalName(target) {
+				next = cname
+			}
+		}
+		if next == nil {
+			break
+		}
+		chain = append(chain, next)
+		target = next.Target
+	}
+	if len(chain) <= 0 || qtype == dns.TypeCNAME {
+		return "", nil
+	}
+	for _, rr := range respMsg.Answer {
+		if rr.Header().Rrtype == qtype && dns.CanonicalName(rr.Header().Name) == dns.CanonicalName(target) {
+			return "", nil
+		}
+	}
+	return target, chain
+}
+
+// iterativeReferral returns the child zone and its name servers when the
+// response is a referral from zone towards name. Otherwise, it returns an
+// empty child zone.
+func iterativeReferral(respMsg *dns.Msg, zone, name string) (string, []string) {
+	var (
+		child   string
+		nsNames []string
+	)
+	for _, rr := range respMsg.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := dns.CanonicalName(ns.Hdr.Name)
+		if !dns.IsSubDomain(owner, name) || dns.CountLabel(owner) <= dns.CountLabel(zone) {
+			continue
+		}
+		if child != "" && child != owner {
+			continue
+		}
+		child = owner
+		nsNames = append(nsNames, dns.CanonicalName(ns.Ns))
+	}
+	return child, nsNames
+}
+
+// iterativeGlue returns the IPv4 glue addresses for the given name servers.
+func iterativeGlue(respMsg *dns.Msg, nsNames []string) []netip.Addr {
+	return iterativeAddrs(respMsg.Extra, nsNames)
+}
+
+// iterativeAddrs returns the IPv4 addresses of the given names within the given
+// records or all the IPv4 addresses when names is nil.
+func iterativeAddrs(rrs []dns.RR, names []string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, rr := range rrs {
+		a, ok := rr.(*dns.A)
+		if !ok || (names != nil && !slices.Contains(names, dns.CanonicalName(a.Hdr.Name))) {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(a.A); ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// iterativeServer emulates an authoritative server by appending
+// records to the response and returning whether it is authoritative.
+type iterativeServer func(q0 dns.Question, respMsg *dns.Msg) bool
+
+// iterativeReferralTo returns an [iterativeServer] delegating the given
+// zone to the given name server with the OPTIONAL glue address.
+func iterativeReferralTo(zone, ns, glue string) iterativeServer {
+	return func(q0 dns.Question, respMsg *dns.Msg) bool {
+		if !dns.IsSubDomain(zone, q0.Name) {
+			respMsg.Rcode = dns.RcodeNameError
+			return true
+		}
+		respMsg.Ns = append(respMsg.Ns, &dns.NS{
+			Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 60},
+			Ns:  ns,
+		})
+		if glue != "" {
+			respMsg.Extra = append(respMsg.Extra, &dns.A{
+				Hdr: dns.RR_Header{Name: ns, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP(glue),
+			})
+		}
+		return false
+	}
+}
+
+// iterativeZone returns an [iterativeServer] serving the given records.
+func iterativeZone(records ...string) iterativeServer {
+	return func(q0 dns.Question, respMsg *dns.Msg) bool {
+		for _, record := range records {
+			rr := runtimex.PanicOnError1(dns.NewRR(record))
+			if rr.Header().Name == q0.Name && (rr.Header().Rrtype == q0.Qtype || rr.Header().Rrtype == dns.TypeCNAME) {
+				respMsg.Answer = append(respMsg.Answer, rr)
+			}
+		}
+		if q0.Name == "lame.example.com." {
+			return false
+		}
+		if len(respMsg.Answer) <= 0 {
+			respMsg.Rcode = dns.RcodeNameError
+		}
+		return true
+	}
+}
+
+// newIterativeResolverForTesting creates a [*IterativeResolver] whose root
+// servers are 10.0.0.99, which is unreachable, and 10.0.0.1.
+//
+// The com zone delegates example.com to ns1.example.net without glue, while
+// the net zone delegates example.net to ns.example.net with glue.
+func newIterativeResolverForTesting() *IterativeResolver {
+	root := func(q0 dns.Question, respMsg *dns.Msg) bool {
+		if dns.IsSubDomain("net.", q0.Name) {
+			return iterativeReferralTo("net.", "a.gtld-servers.net.", "10.0.0.4")(q0, respMsg)
+		}
+		return iterativeReferralTo("com.", "a.gtld-servers.net.", "10.0.0.2")(q0, respMsg)
+	}
+	servers := map[netip.Addr]iterativeServer{
+		netip.MustParseAddr("10.0.0.1"): root,
+		netip.MustParseAddr("10.0.0.2"): iterativeReferralTo("example.com.", "ns1.example.net.", ""),
+		netip.MustParseAddr("10.0.0.3"): iterativeZone(
+			"www.example.com. 60 IN A 93.184.216.34",
+			"alias.example.com. 60 IN CNAME www.example.net.",
+		),
+		netip.MustParseAddr("10.0.0.4"): iterativeReferralTo("example.net.", "ns.example.net.", "10.0.0.5"),
+		netip.MustParseAddr("10.0.0.5"): iterativeZone(
+			"ns.example.net. 60 IN A 10.0.0.5",
+			"ns1.example.net. 60 IN A 10.0.0.3",
+			"www.example.net. 60 IN A 93.184.216.35",
+		),
+	}
+
+	ir := NewIterativeResolver(&net.Dialer{})
+	ir.RootServers = []netip.Addr{netip.MustParseAddr("10.0.0.99"), netip.MustParseAddr("10.0.0.1")}
+	ir.NewTransport = func(addr netip.Addr) DNSMsgTransport {
+		return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+			server, found := servers[addr]
+			if !found {
+				return nil, errors.New("host unreachable")
+			}
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.Authoritative = server(queryMsg.Question[0], respMsg)
+			return respMsg, nil
+		}}
+	}
+	return ir
+}
+
+func TestIterativeResolver(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// domain is the domain to resolve.
+		domain string
+
+		// wantRcode is the expected response code.
+		wantRcode int
+
+		// wantAnswers contains the expected answers.
+		wantAnswers []string
+	}
+
+	tests := []testCase{
+		{
+			name:      "referral without glue",
+			domain:    "www.example.com",
+			wantRcode: dns.RcodeSuccess,
+			wantAnswers: []string{
+				"www.example.com.\t60\tIN\tA\t93.184.216.34",
+			},
+		},
+
+		{
+			name:      "CNAME to another zone",
+			domain:    "alias.example.com",
+			wantRcode: dns.RcodeSuccess,
+			wantAnswers: []string{
+				"alias.example.com.\t60\tIN\tCNAME\twww.example.net.",
+				"www.example.net.\t60\tIN\tA\t93.184.216.35",
+			},
+		},
+
+		{
+			name:        "NXDOMAIN",
+			domain:      "missing.example.com",
+			wantRcode:   dns.RcodeNameError,
+			wantAnswers: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ir := newIterativeResolverForTesting()
+			var observed []*IterativeStep
+			ir.ObserveStep = func(step *IterativeStep) {
+				observed = append(observed, step)
+			}
+
+			res := ir.Resolve(context.Background(), tc.domain, dns.TypeA)
+			require.NoError(t, res.Err)
+			assert.Empty(t, res.Failure)
+			require.NotNil(t, res.Response)
+			assert.Equal(t, tc.wantRcode, res.Response.Rcode)
+			var answers []string
+			for _, rr := range res.Response.Answer {
+				answers = append(answers, rr.String())
+			}
+			assert.Equal(t, tc.wantAnswers, answers)
+
+			// we always start from the unreachable root server
+			assert.Equal(t, observed, res.Steps)
+			require.NotEmpty(t, res.Steps)
+			assert.Equal(t, ".", res.Steps[0].Zone)
+			assert.Equal(t, netip.MustParseAddr("10.0.0.99"), res.Steps[0].Server)
+			assert.Error(t, res.Steps[0].Err)
+			for _, step := range res.Steps {
+				assert.Equal(t, step.Server == ir.RootServers[0], step.Err != nil)
+				assert.False(t, step.Query.RecursionDesired)
+			}
+		})
+	}
+}
+
+func TestIterativeResolverSteps(t *testing.T) {
+	ir := newIterativeResolverForTesting()
+	res := ir.Resolve(context.Background(), "www.example.com", dns.TypeA)
+	require.NoError(t, res.Err)
+
+	type step struct {
+		zone   string
+		server string
+		name   string
+	}
+	var got []step
+	for _, s := range res.Steps {
+		got = append(got, step{s.Zone, s.Server.String(), s.Query.Question[0].Name})
+	}
+	assert.Equal(t, []step{
+		{".", "10.0.0.99", "www.example.com."},
+		{".", "10.0.0.1", "www.example.com."},
+		{"com.", "10.0.0.2", "www.example.com."},
+		{".", "10.0.0.99", "ns1.example.net."},
+		{".", "10.0.0.1", "ns1.example.net."},
+		{"net.", "10.0.0.4", "ns1.example.net."},
+		{"example.net.", "10.0.0.5", "ns1.example.net."},
+		{"example.com.", "10.0.0.3", "www.example.com."},
+	}, got)
+}
+
+func TestIterativeResolverFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// domain is the domain to resolve.
+		domain string
+
+		// maxQueries is the maximum number of queries.
+		maxQueries int
+
+		// rootServers OPTIONALLY overrides the root servers.
+		rootServers []netip.Addr
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:       "too many queries",
+			domain:     "www.example.com",
+			maxQueries: 4,
+			wantErr:    ErrIterativeTooManyQueries,
+		},
+
+		{
+			name:       "invalid referral",
+			domain:     "lame.example.com",
+			maxQueries: 64,
+			wantErr:    ErrIterativeInvalidReferral,
+		},
+
+		{
+			name:        "no root servers",
+			domain:      "www.example.com",
+			maxQueries:  64,
+			rootServers: []netip.Addr{},
+			wantErr:     nil, // any error is fine
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ir := newIterativeResolverForTesting()
+			ir.MaxQueries = tc.maxQueries
+			if tc.rootServers != nil {
+				ir.RootServers = tc.rootServers
+			}
+			res := ir.Resolve(context.Background(), tc.domain, dns.TypeA)
+			require.Error(t, res.Err)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, res.Err, tc.wantErr)
+			}
+			assert.Nil(t, res.Response)
+			assert.NotEmpty(t, res.Failure)
+			assert.LessOrEqual(t, len(res.Steps), tc.maxQueries)
+		})
+	}
+}
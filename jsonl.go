@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// JSONLSink is a [Sink] serializing each value as a JSON line, which allows
+// long campaigns to stream results to disk. Besides [*CampaignRecord], it
+// can serialize any value, including [*AtlasDNSResult] and [*OONIDNSQuery].
+//
+// We open the output lazily before writing the first line, and open a new
+// output after closing the current one whenever ShouldRotate says so.
+//
+// This type is safe for concurrent use. Construct using [NewJSONLSink].
+type JSONLSink struct {
+	// Open opens the next output.
+	//
+	// Set by [NewJSONLSink] to the user-provided value.
+	Open func() (io.WriteCloser, error)
+
+	// FlushEvery OPTIONALLY configures flushing after the given number of
+	// lines. When zero, we flush after each line.
+	FlushEvery int
+
+	// ShouldRotate is an OPTIONAL hook called before writing each line with
+	// the bytes and lines written to the current output. When it returns
+	// true, we close the current output and open a new one.
+	ShouldRotate func(bytes int64, lines int) bool
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// out is the current output or nil.
+	out io.WriteCloser
+
+	// bw buffers writes to out.
+	bw *bufio.Writer
+
+	// bytes is the number of bytes written to out.
+	bytes int64
+
+	// lines is the number of lines written to out.
+	lines int
+
+	// pending is the number of lines not flushed yet.
+	pending int
+}
+
+// NewJSONLSink creates a new [*JSONLSink].
+//
+// For example, to write into a single file, use:
+//
+//	sink := minest.NewJSONLSink(func() (io.WriteCloser, error) {
+//		return os.OpenFile("results.jsonl", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+//	})
+func NewJSONLSink(open func() (io.WriteCloser, error)) *JSONLSink {
+	return &JSONLSink{Open: open}
+}
+
+// Ensure that [*JSONLSink] implements [Sink].
+var _ Sink = &JSONLSink{}
+
+// WriteRecord implements [Sink].
+func (s *JSONLSink) WriteRecord(record *CampaignRecord) error {
+	return s.Write(record)
+}
+
+// Write serializes the given value as a JSON line.
+func (s *JSONLSink) Write(value any) error {
+	// 1. serialize outside of the critical section
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 2. rotate or open the output if needed
+	if s.out != nil && s.ShouldRotate != nil && s.ShouldRotate(s.bytes, s.lines) {
+		if err := s.closeLocked(); err != nil {
+			return err
+		}
+	}
+	if s.out == nil {
+		out, err := s.Open()
+		if err != nil {
+			return err
+		}
+		s.out, s.bw, s.bytes, s.lines, s.pending = out, bufio.NewWriter(out), 0, 0, 0
+	}
+
+	// 3. write and possibly flush
+	count, err := s.bw.Write(data)
+	s.bytes += int64(count)
+	if err != nil {
+		return err
+	}
+	s.lines++
+	s.pending++
+	if s.pending >= max(s.FlushEvery, 1) {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+// Flush flushes the lines written to the current output, if any.
+func (s *JSONLSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked()
+}
+
+// flushLocked is like Flush but assumes we're holding the mutex.
+func (s *JSONLSink) flushLocked() error {
+	if s.bw == nil {
+		return nil
+	}
+	s.pending = 0
+	return s.bw.Flush()
+}
+
+// Close flushes and closes the current output, if any. A subsequent
+// Write opens a new output using Open.
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+// closeLocked is like Close but assumes we're holding the mutex.
+func (s *JSONLSink) closeLocked() error {
+	if s.out == nil {
+		return nil
+	}
+	err := errors.Join(s.flushLocked(), s.out.Close())
+	s.out, s.bw = nil, nil
+	return err
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonlOutput is an in-memory output for [*JSONLSink].
+type jsonlOutput struct {
+	bytes.Buffer
+
+	// closed is true after Close.
+	closed bool
+}
+
+func (o *jsonlOutput) Close() error {
+	o.closed = true
+	return nil
+}
+
+func TestJSONLSink(t *testing.T) {
+	var outputs []*jsonlOutput
+	sink := NewJSONLSink(func() (io.WriteCloser, error) {
+		out := &jsonlOutput{}
+		outputs = append(outputs, out)
+		return out, nil
+	})
+	sink.FlushEvery = 2
+	sink.ShouldRotate = func(bytes int64, lines int) bool {
+		assert.Positive(t, bytes)
+		return lines >= 3
+	}
+
+	// 1. write the first line, which is buffered
+	require.NoError(t, sink.WriteRecord(&CampaignRecord{Domain: "example.com", Resolver: "a"}))
+	require.Len(t, outputs, 1)
+	assert.Zero(t, outputs[0].Len())
+
+	// 2. write the second line, which causes flushing
+	require.NoError(t, sink.Write(map[string]int{"value": 2}))
+	assert.Equal(t, 2, strings.Count(outputs[0].String(), "\n"))
+
+	// 3. write the third line and explicitly flush
+	require.NoError(t, sink.Write(map[string]int{"value": 3}))
+	require.NoError(t, sink.Flush())
+	assert.Equal(t, 3, strings.Count(outputs[0].String(), "\n"))
+
+	// 4. write the fourth line, which causes rotation
+	require.NoError(t, sink.Write(map[string]int{"value": 4}))
+	require.Len(t, outputs, 2)
+	assert.True(t, outputs[0].closed)
+
+	// 5. close and make sure everything was written
+	require.NoError(t, sink.Close())
+	assert.True(t, outputs[1].closed)
+	assert.Equal(t, "{\"value\":4}\n", outputs[1].String())
+	var record CampaignRecord
+	line, _, _ := strings.Cut(outputs[0].String(), "\n")
+	require.NoError(t, json.Unmarshal([]byte(line), &record))
+	assert.Equal(t, "example.com", record.Domain)
+
+	// 6. closing again is a no-op
+	require.NoError(t, sink.Close())
+}
+
+func TestJSONLSinkErrors(t *testing.T) {
+	t.Run("open failure", func(t *testing.T) {
+		expectedErr := errors.New("open failed")
+		sink := NewJSONLSink(func() (io.WriteCloser, error) {
+			return nil, expectedErr
+		})
+		require.ErrorIs(t, sink.Write(1), expectedErr)
+		require.NoError(t, sink.Flush())
+	})
+
+	t.Run("marshal failure", func(t *testing.T) {
+		sink := NewJSONLSink(func() (io.WriteCloser, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		})
+		require.Error(t, sink.Write(make(chan int)))
+	})
+}
+
+func TestJSONLSinkConcurrentWrites(t *testing.T) {
+	out := &jsonlOutput{}
+	sink := NewJSONLSink(func() (io.WriteCloser, error) {
+		return out, nil
+	})
+	wg := &sync.WaitGroup{}
+	for idx := range 16 {
+		wg.Go(func() {
+			require.NoError(t, sink.Write(idx))
+		})
+	}
+	wg.Wait()
+	require.NoError(t, sink.Close())
+	assert.Equal(t, 16, strings.Count(out.String(), "\n"))
+}
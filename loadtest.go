@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+)
+
+// LoadTest sends queries to a [DNSTransport] at a fixed rate, which is
+// useful to validate the capacity of a resolver you operate.
+//
+// Only run load tests against resolvers you are allowed to stress.
+//
+// Construct using [NewLoadTest].
+type LoadTest struct {
+	// Transport is the [DNSTransport] to use.
+	//
+	// Set by [NewLoadTest] to the user-provided value.
+	Transport DNSTransport
+
+	// Domain is the domain to query.
+	//
+	// Set by [NewLoadTest] to the user-provided value.
+	Domain string
+
+	// Type is the query type.
+	//
+	// Set by [NewLoadTest] to the user-provided value.
+	Type uint16
+
+	// QPS is the target number of queries per second.
+	//
+	// Set by [NewLoadTest] to the user-provided value.
+	QPS float64
+
+	// Duration is the duration of the load test.
+	//
+	// Set by [NewLoadTest] to the user-provided value.
+	Duration time.Duration
+
+	// Timeout is the timeout of each query.
+	//
+	// Set by [NewLoadTest] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// RandomizeNames OPTIONALLY prepends a random label to Domain for each
+	// query, to measure the performance without the resolver cache.
+	RandomizeNames bool
+
+	// Rand is the [Rand] to use for the random labels and the query IDs.
+	//
+	// Set by [NewLoadTest] to [GlobalRand].
+	Rand Rand
+}
+
+// LoadTestReport is the result of running a [*LoadTest].
+type LoadTestReport struct {
+	// Sent is the number of queries we sent.
+	Sent int
+
+	// Succeeded is the number of successful queries.
+	Succeeded int
+
+	// Failures maps failure strings (see [ClassifyError]) to their count.
+	Failures map[string]int
+
+	// Elapsed is the time elapsed from the first query until we
+	// received the last response or the last query timed out.
+	Elapsed time.Duration
+
+	// AchievedQPS is the number of queries sent per second.
+	AchievedQPS float64
+
+	// ErrorRate is the fraction of queries that failed.
+	ErrorRate float64
+
+	// Latency contains the latency statistics of the successful queries.
+	Latency LatencyStats
+}
+
+// NewLoadTest creates a new [*LoadTest]. This function panics if qps is not positive.
+func NewLoadTest(txp DNSTransport,
+	domain string, qtype uint16, qps float64, duration time.Duration) *LoadTest {
+	runtimex.Assert(qps > 0)
+	return &LoadTest{
+		Transport: txp,
+		Domain:    domain,
+		Type:      qtype,
+		QPS:       qps,
+		Duration:  duration,
+		Timeout:   DefaultResolverTimeout,
+		Rand:      GlobalRand{},
+	}
+}
+
+// Run runs the load test until Duration elapses or the context is done
+// and waits for all the outstanding queries to complete.
+func (lt *LoadTest) Run(ctx context.Context) *LoadTestReport {
+	// 1. prepare for sending at the configured rate
+	limiter := NewRateLimiter(lt.QPS, 1)
+	sendctx, cancel := context.WithTimeout(ctx, lt.Duration)
+	defer cancel()
+
+	// 2. send queries until the deadline
+	var (
+		failures  = map[string]int{}
+		latencies []time.Duration
+		mu        sync.Mutex
+		sent      int
+		wg        = &sync.WaitGroup{}
+	)
+	started := time.Now()
+	for sendctx.Err() == nil && limiter.Wait(sendctx) == nil {
+		sent++
+		wg.Go(func() {
+			elapsed, err := lt.exchange(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[ClassifyError(err)]++
+				return
+			}
+			latencies = append(latencies, elapsed)
+		})
+	}
+	sendElapsed := time.Since(started)
+
+	// 3. wait for outstanding queries and assemble the report
+	wg.Wait()
+	report := &LoadTestReport{
+		Sent:      sent,
+		Succeeded: len(latencies),
+		Failures:  failures,
+		Elapsed:   time.Since(started),
+		Latency:   NewLatencyStats(latencies),
+	}
+	if sendElapsed > 0 {
+		report.AchievedQPS = float64(sent) / sendElapsed.Seconds()
+	}
+	if sent > 0 {
+		report.ErrorRate = float64(sent-len(latencies)) / float64(sent)
+	}
+	return report
+}
+
+// exchange performs a single exchange and returns its latency.
+func (lt *LoadTest) exchange(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, lt.Timeout)
+	defer cancel()
+	domain := lt.Domain
+	if lt.RandomizeNames {
+		domain = fmt.Sprintf("%08x.%s", uint32(randSource(lt.Rand).Uint64()), domain)
+	}
+	query := dnscodec.NewQuery(domain, lt.Type)
+	query.ID = randID(lt.Rand)
+	started := time.Now()
+	_, err := lt.Transport.Exchange(ctx, query)
+	return time.Since(started), err
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTestRun(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	txp := transportStub{
+		exchange: func(_ context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			mu.Lock()
+			names = append(names, query.Name)
+			count := len(names)
+			mu.Unlock()
+			if count%2 == 0 {
+				return nil, dnscodec.ErrServerTemporarilyMisbehaving
+			}
+			return &dnscodec.Response{}, nil
+		},
+	}
+	lt := NewLoadTest(txp, "example.com", dns.TypeA, 200, 100*time.Millisecond)
+	lt.RandomizeNames = true
+
+	report := lt.Run(context.Background())
+	require.Positive(t, report.Sent)
+	assert.Equal(t, report.Sent, report.Succeeded+report.Failures[FailureDNSServfail])
+	assert.Equal(t, report.Succeeded, report.Latency.Count)
+	assert.InDelta(t, 0.5, report.ErrorRate, 0.1)
+	assert.Positive(t, report.AchievedQPS)
+	assert.LessOrEqual(t, report.AchievedQPS, 400.0)
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		assert.True(t, strings.HasSuffix(name, ".example.com"))
+		seen[name] = true
+	}
+	assert.Len(t, seen, len(names))
+}
+
+func TestLoadTestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lt := NewLoadTest(transportStub{}, "example.com", dns.TypeA, 10, time.Hour)
+	report := lt.Run(ctx)
+	assert.Zero(t, report.Sent)
+	assert.Zero(t, report.ErrorRate)
+	assert.Empty(t, report.Failures)
+}
+
+func TestLoadTestRandomizeNamesWithNilRand(t *testing.T) {
+	var names []string
+	txp := transportStub{
+		exchange: func(_ context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			names = append(names, query.Name)
+			return &dnscodec.Response{}, nil
+		},
+	}
+	lt := &LoadTest{Transport: txp, Domain: "example.com", Type: dns.TypeA, Timeout: time.Second}
+	lt.RandomizeNames = true
+
+	_, err := lt.exchange(context.Background())
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+	assert.True(t, strings.HasSuffix(names[0], ".example.com"))
+}
@@ -0,0 +1,405 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidSPFRecord indicates that the SPF record is duplicated or malformed.
+var ErrInvalidSPFRecord = errors.New("invalid SPF record")
+
+// ErrSPFTooManyLookups indicates that the SPF record exceeds the DNS lookups limit.
+var ErrSPFTooManyLookups = errors.New("SPF record exceeds the DNS lookups limit")
+
+// ErrInvalidDMARCRecord indicates that the DMARC record is duplicated or malformed.
+var ErrInvalidDMARCRecord = errors.New("invalid DMARC record")
+
+// ErrInvalidDKIMRecord indicates that the DKIM record is malformed.
+var ErrInvalidDKIMRecord = errors.New("invalid DKIM record")
+
+// MailAuthChecker fetches and parses the SPF (RFC 7208), DMARC (RFC 7489),
+// and DKIM (RFC 6376) records of a domain, to scan its mail-security posture.
+//
+// We use a [DNSMsgTransport] rather than a [*Resolver] because DMARC and
+// DKIM names contain underscores, which IDNA encoding rejects.
+//
+// Construct using [NewMailAuthChecker].
+type MailAuthChecker struct {
+	// Transport is the [DNSMsgTransport] to use.
+	//
+	// Set by [NewMailAuthChecker] to the user-provided value.
+	Transport DNSMsgTransport
+
+	// MaxSPFLookups is the maximum number of SPF terms causing DNS lookups.
+	//
+	// Set by [NewMailAuthChecker] to 10, as mandated by RFC 7208.
+	MaxSPFLookups int
+
+	// Timeout is the timeout of each exchange.
+	//
+	// Set by [NewMailAuthChecker] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewMailAuthChecker] to [GlobalRand].
+	Rand Rand
+}
+
+// NewMailAuthChecker creates a new [*MailAuthChecker].
+func NewMailAuthChecker(txp DNSMsgTransport) *MailAuthChecker {
+	return &MailAuthChecker{
+		Transport:     txp,
+		MaxSPFLookups: 10,
+		Timeout:       DefaultResolverTimeout,
+		Rand:          GlobalRand{},
+	}
+}
+
+// SPFRecord is a parsed SPF record.
+type SPFRecord struct {
+	// Domain is the domain owning the record.
+	Domain string
+
+	// Raw is the record content.
+	Raw string
+
+	// Terms contains the parsed terms.
+	Terms []*SPFTerm
+
+	// Includes contains the records referenced by the include
+	// mechanisms and by the redirect modifier, in order.
+	Includes []*SPFRecord
+
+	// Err is the error fetching or parsing this record, which we only
+	// set for the records inside Includes, or nil.
+	Err error
+}
+
+// SPFTerm is a mechanism or modifier of an SPF record.
+type SPFTerm struct {
+	// Qualifier is the mechanism qualifier ("+", "-", "~", or "?")
+	// or empty for modifiers.
+	Qualifier string
+
+	// Name is the lowercase mechanism or modifier name (e.g., "include").
+	Name string
+
+	// Value is the mechanism or modifier value or empty.
+	Value string
+
+	// Modifier indicates whether this term is a modifier (e.g., "redirect=").
+	Modifier bool
+}
+
+// LookupSPF fetches and parses the SPF record of the given domain and
+// recursively fetches the records referenced by include and redirect.
+//
+// We return an error when the record of the domain cannot be fetched or
+// parsed. The errors of the referenced records are inside the Includes. We
+// do not chase the domains containing macros (e.g., "%{d}").
+func (c *MailAuthChecker) LookupSPF(ctx context.Context, domain string) (*SPFRecord, error) {
+	var lookups int
+	record := c.lookupSPF(ctx, domain, &lookups)
+	if record.Err != nil {
+		return nil, record.Err
+	}
+	return record, nil
+}
+
+// lookupSPF fetches the SPF record and updates the number of lookups.
+func (c *MailAuthChecker) lookupSPF(ctx context.Context, domain string, lookups *int) *SPFRecord {
+	record := &SPFRecord{Domain: dns.Fqdn(domain)}
+
+	// 1. fetch the record
+	raws, err := c.lookupTXT(ctx, domain, "v=spf1")
+	if err != nil {
+		record.Err = err
+		return record
+	}
+	if len(raws) != 1 {
+		record.Err = ErrInvalidSPFRecord
+		return record
+	}
+	record.Raw = raws[0]
+
+	// 2. parse the record
+	terms, err := parseSPF(record.Raw)
+	if err != nil {
+		record.Err = err
+		return record
+	}
+	record.Terms = terms
+
+	// 3. chase the referenced records
+	for _, term := range terms {
+		switch term.Name {
+		case "include", "a", "mx", "ptr", "exists", "redirect":
+			*lookups++
+		default:
+			continue
+		}
+		if (term.Name != "include" && term.Name != "redirect") || strings.Contains(term.Value, "%") {
+			continue
+		}
+		if *lookups > c.MaxSPFLookups {
+			record.Includes = append(record.Includes, &SPFRecord{
+				Domain: dns.Fqdn(term.Value),
+				Err:    ErrSPFTooManyLookups,
+			})
+			continue
+		}
+		record.Includes = append(record.Includes, c.lookupSPF(ctx, term.Value, lookups))
+	}
+	return record
+}
+
+// parseSPF parses the terms of an SPF record.
+func parseSPF(raw string) ([]*SPFTerm, error) {
+	fields := strings.Fields(raw)
+	if len(fields) <= 0 || !strings.EqualFold(fields[0], "v=spf1") {
+		return nil, ErrInvalidSPFRecord
+	}
+	var terms []*SPFTerm
+	for _, field := range fields[1:] {
+		// 1. handle modifiers
+		if name, value, found := strings.Cut(field, "="); found && !strings.ContainsAny(name, ":/") {
+			if name == "" {
+				return nil, ErrInvalidSPFRecord
+			}
+			terms = append(terms, &SPFTerm{Name: strings.ToLower(name), Value: value, Modifier: true})
+			continue
+		}
+
+		// 2. handle mechanisms with an optional qualifier and value
+		term := &SPFTerm{Qualifier: "+"}
+		if strings.ContainsAny(field[:1], "+-~?") {
+			term.Qualifier, field = field[:1], field[1:]
+		}
+		term.Name = field
+		if idx := strings.IndexAny(field, ":/"); idx >= 0 {
+			term.Name, term.Value = field[:idx], strings.TrimPrefix(field[idx:], ":")
+		}
+		term.Name = strings.ToLower(term.Name)
+		switch term.Name {
+		case "all", "include", "a", "mx", "ptr", "ip4", "ip6", "exists":
+		default:
+			return nil, ErrInvalidSPFRecord
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// DMARCPolicy is a parsed DMARC record.
+type DMARCPolicy struct {
+	// Domain is the domain owning the record (e.g., "_dmarc.example.com.").
+	Domain string
+
+	// Raw is the record content.
+	Raw string
+
+	// Tags contains all the record tags.
+	Tags map[string]string
+
+	// Policy is the requested policy ("none", "quarantine", or "reject").
+	Policy string
+
+	// SubdomainPolicy is the policy for subdomains, which defaults to Policy.
+	SubdomainPolicy string
+
+	// Percent is the percentage of messages subject to the policy.
+	Percent int
+
+	// AggregateReportURIs contains the aggregate reports URIs or nil.
+	AggregateReportURIs []string
+
+	// FailureReportURIs contains the failure reports URIs or nil.
+	FailureReportURIs []string
+}
+
+// LookupDMARC fetches and parses the DMARC record of the given domain.
+//
+// We do not fall back to the organizational domain, since that would
+// require the public suffix list. We return [dnscodec.ErrNoData] when
+// the domain does not publish a DMARC record.
+func (c *MailAuthChecker) LookupDMARC(ctx context.Context, domain string) (*DMARCPolicy, error) {
+	// 1. fetch the record
+	name := "_dmarc." + dns.Fqdn(domain)
+	raws, err := c.lookupTXT(ctx, name, "v=DMARC1")
+	if err != nil {
+		return nil, err
+	}
+	if len(raws) != 1 {
+		return nil, ErrInvalidDMARCRecord
+	}
+
+	// 2. parse the tags
+	tags, ok := parseTagList(raws[0])
+	if !ok || !strings.EqualFold(tags["v"], "DMARC1") || tags["p"] == "" {
+		return nil, ErrInvalidDMARCRecord
+	}
+	policy := &DMARCPolicy{
+		Domain:          name,
+		Raw:             raws[0],
+		Tags:            tags,
+		Policy:          strings.ToLower(tags["p"]),
+		SubdomainPolicy: strings.ToLower(tags["sp"]),
+		Percent:         100,
+	}
+	if policy.SubdomainPolicy == "" {
+		policy.SubdomainPolicy = policy.Policy
+	}
+	if value, found := tags["pct"]; found {
+		pct, err := strconv.Atoi(value)
+		if err != nil || pct < 0 || pct > 100 {
+			return nil, ErrInvalidDMARCRecord
+		}
+		policy.Percent = pct
+	}
+	policy.AggregateReportURIs = splitTagValue(tags["rua"], ",")
+	policy.FailureReportURIs = splitTagValue(tags["ruf"], ",")
+	return policy, nil
+}
+
+// DKIMKey is a parsed DKIM key record.
+type DKIMKey struct {
+	// Domain is the domain owning the record (e.g., "sel._domainkey.example.com.").
+	Domain string
+
+	// Raw is the record content.
+	Raw string
+
+	// Tags contains all the record tags.
+	Tags map[string]string
+
+	// KeyType is the key type (e.g., "rsa" or "ed25519").
+	KeyType string
+
+	// PublicKey contains the decoded public key or nil.
+	PublicKey []byte
+
+	// Revoked indicates that the public key is empty.
+	Revoked bool
+
+	// HashAlgorithms contains the acceptable hash algorithms or nil.
+	HashAlgorithms []string
+
+	// Flags contains the record flags (e.g., "y" for testing) or nil.
+	Flags []string
+}
+
+// LookupDKIM fetches and parses the DKIM key published by the given domain
+// for the given selector. We use the first record containing a key.
+func (c *MailAuthChecker) LookupDKIM(ctx context.Context, selector, domain string) (*DKIMKey, error) {
+	// 1. fetch the records
+	name := selector + "._domainkey." + dns.Fqdn(domain)
+	raws, err := c.lookupTXT(ctx, name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. parse the first record containing a key
+	for _, raw := range raws {
+		tags, ok := parseTagList(raw)
+		if !ok {
+			continue
+		}
+		value, found := tags["p"]
+		if !found || (tags["v"] != "" && tags["v"] != "DKIM1") {
+			continue
+		}
+		key := &DKIMKey{
+			Domain:         name,
+			Raw:            raw,
+			Tags:           tags,
+			KeyType:        strings.ToLower(tags["k"]),
+			Revoked:        value == "",
+			HashAlgorithms: splitTagValue(tags["h"], ":"),
+			Flags:          splitTagValue(tags["t"], ":"),
+		}
+		if key.KeyType == "" {
+			key.KeyType = "rsa"
+		}
+		if !key.Revoked {
+			key.PublicKey, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+			if err != nil {
+				return nil, errors.Join(ErrInvalidDKIMRecord, err)
+			}
+		}
+		return key, nil
+	}
+	return nil, ErrInvalidDKIMRecord
+}
+
+// lookupTXT returns the TXT records of the given name starting with the
+// given version tag (e.g., "v=spf1"), or all the records if the prefix is
+// empty. We return [dnscodec.ErrNoData] if there are no such records.
+func (c *MailAuthChecker) lookupTXT(ctx context.Context, name, version string) ([]string, error) {
+	txts, err := msgLookupRecords[*dns.TXT](ctx, c.Transport, c.Rand, c.Timeout, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, txt := range txts {
+		// A record may be split into several strings, which we must concatenate
+		var sb strings.Builder
+		for _, value := range txt.Txt {
+			sb.WriteString(unescapeCharacterString(value))
+		}
+		raw := sb.String()
+		if version != "" {
+			head, _, _ := strings.Cut(strings.TrimSpace(raw), " ")
+			head, _, _ = strings.Cut(head, ";")
+			if !strings.EqualFold(head, version) {
+				continue
+			}
+		}
+		out = append(out, raw)
+	}
+	if len(out) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return out, nil
+}
+
+// parseTagList parses a DKIM-style tag list (e.g., "v=DMARC1; p=reject")
+// and returns whether the list is well formed.
+func parseTagList(raw string) (map[string]string, bool) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(raw, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue // allow for a trailing semicolon
+		}
+		name, value, found := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, false
+		}
+		if _, dup := tags[name]; dup {
+			return nil, false
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, true
+}
+
+// splitTagValue splits a tag value using the given separator and trims spaces.
+func splitTagValue(value, sep string) []string {
+	var out []string
+	for _, entry := range strings.Split(value, sep) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
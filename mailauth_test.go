@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMailAuthTransport returns a [DNSMsgTransport] answering TXT queries
+// using the given records and failing for the given name.
+func newMailAuthTransport(failing string, records ...string) DNSMsgTransport {
+	return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		q0 := queryMsg.Question[0]
+		if q0.Qtype != dns.TypeTXT {
+			return nil, errors.New("unexpected query type")
+		}
+		if dns.CanonicalName(q0.Name) == failing {
+			return nil, errors.New("mocked error")
+		}
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		for _, record := range records {
+			rr := runtimex.PanicOnError1(dns.NewRR(record))
+			if dns.CanonicalName(rr.Header().Name) == dns.CanonicalName(q0.Name) {
+				respMsg.Answer = append(respMsg.Answer, rr)
+			}
+		}
+		return respMsg, nil
+	}}
+}
+
+func TestNewMailAuthChecker(t *testing.T) {
+	c := NewMailAuthChecker(newMailAuthTransport(""))
+	assert.Equal(t, 10, c.MaxSPFLookups)
+	assert.Equal(t, DefaultResolverTimeout, c.Timeout)
+}
+
+func TestMailAuthCheckerLookupSPF(t *testing.T) {
+	c := NewMailAuthChecker(newMailAuthTransport("broken.example.net.",
+		`example.com. 300 IN TXT "google-site-verification=abc"`,
+		`example.com. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 a/24 mx:mail.example.com " "include:_spf.example.net ~all"`,
+		`_spf.example.net. 300 IN TXT "v=spf1 ip6:2001:db8::/32 include:broken.example.net include:%{d}.example.org redirect=final.example.org"`,
+		`final.example.org. 300 IN TXT "V=SPF1 -ALL exp=explain.example.org"`,
+	))
+	record, err := c.LookupSPF(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com.", record.Domain)
+	assert.Equal(t, "v=spf1 ip4:192.0.2.0/24 a/24 mx:mail.example.com include:_spf.example.net ~all", record.Raw)
+	assert.Equal(t, []*SPFTerm{
+		{Qualifier: "+", Name: "ip4", Value: "192.0.2.0/24"},
+		{Qualifier: "+", Name: "a", Value: "/24"},
+		{Qualifier: "+", Name: "mx", Value: "mail.example.com"},
+		{Qualifier: "+", Name: "include", Value: "_spf.example.net"},
+		{Qualifier: "~", Name: "all"},
+	}, record.Terms)
+	assert.NoError(t, record.Err)
+
+	// the include mechanism is chased along with its includes and redirect
+	require.Len(t, record.Includes, 1)
+	include := record.Includes[0]
+	assert.Equal(t, "_spf.example.net.", include.Domain)
+	assert.Equal(t, []*SPFTerm{
+		{Qualifier: "+", Name: "ip6", Value: "2001:db8::/32"},
+		{Qualifier: "+", Name: "include", Value: "broken.example.net"},
+		{Qualifier: "+", Name: "include", Value: "%{d}.example.org"},
+		{Name: "redirect", Value: "final.example.org", Modifier: true},
+	}, include.Terms)
+	require.Len(t, include.Includes, 2)
+	assert.Equal(t, "broken.example.net.", include.Includes[0].Domain)
+	assert.Error(t, include.Includes[0].Err)
+	assert.Equal(t, "final.example.org.", include.Includes[1].Domain)
+	assert.Equal(t, []*SPFTerm{
+		{Qualifier: "-", Name: "all"},
+		{Name: "exp", Value: "explain.example.org", Modifier: true},
+	}, include.Includes[1].Terms)
+}
+
+func TestMailAuthCheckerLookupSPFTooManyLookups(t *testing.T) {
+	c := NewMailAuthChecker(newMailAuthTransport("",
+		`example.com. 300 IN TXT "v=spf1 a mx include:a.example.com include:b.example.com -all"`,
+		`a.example.com. 300 IN TXT "v=spf1 -all"`,
+		`b.example.com. 300 IN TXT "v=spf1 -all"`,
+	))
+	c.MaxSPFLookups = 3
+	record, err := c.LookupSPF(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Len(t, record.Includes, 2)
+	assert.NoError(t, record.Includes[0].Err)
+	assert.ErrorIs(t, record.Includes[1].Err, ErrSPFTooManyLookups)
+	assert.Nil(t, record.Includes[1].Terms)
+}
+
+func TestMailAuthCheckerLookupSPFFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the TXT records to serve.
+		records []string
+
+		// wantErr is the expected error or nil to accept any error.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:    "no SPF record",
+			records: []string{`example.com. 300 IN TXT "v=spf10 -all"`},
+			wantErr: dnscodec.ErrNoData,
+		},
+
+		{
+			name: "duplicate SPF records",
+			records: []string{
+				`example.com. 300 IN TXT "v=spf1 -all"`,
+				`example.com. 300 IN TXT "v=spf1 +all"`,
+			},
+			wantErr: ErrInvalidSPFRecord,
+		},
+
+		{
+			name:    "unknown mechanism",
+			records: []string{`example.com. 300 IN TXT "v=spf1 ipv4:192.0.2.1 -all"`},
+			wantErr: ErrInvalidSPFRecord,
+		},
+
+		{
+			name:    "empty modifier name",
+			records: []string{`example.com. 300 IN TXT "v=spf1 =value -all"`},
+			wantErr: ErrInvalidSPFRecord,
+		},
+
+		{
+			name: "transport failure",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			failing := ""
+			if tc.records == nil {
+				failing = "example.com."
+			}
+			c := NewMailAuthChecker(newMailAuthTransport(failing, tc.records...))
+			record, err := c.LookupSPF(context.Background(), "example.com")
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+			}
+			assert.Nil(t, record)
+		})
+	}
+}
+
+func TestMailAuthCheckerLookupDMARC(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the TXT records to serve.
+		records []string
+
+		// wantPolicy is the expected policy.
+		wantPolicy *DMARCPolicy
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name: "full policy",
+			records: []string{
+				`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=Reject; sp=quarantine; pct=50; rua=mailto:a@example.com, mailto:b@example.com; ruf=mailto:f@example.com;"`,
+			},
+			wantPolicy: &DMARCPolicy{
+				Domain: "_dmarc.example.com.",
+				Raw:    "v=DMARC1; p=Reject; sp=quarantine; pct=50; rua=mailto:a@example.com, mailto:b@example.com; ruf=mailto:f@example.com;",
+				Tags: map[string]string{
+					"v":   "DMARC1",
+					"p":   "Reject",
+					"sp":  "quarantine",
+					"pct": "50",
+					"rua": "mailto:a@example.com, mailto:b@example.com",
+					"ruf": "mailto:f@example.com",
+				},
+				Policy:              "reject",
+				SubdomainPolicy:     "quarantine",
+				Percent:             50,
+				AggregateReportURIs: []string{"mailto:a@example.com", "mailto:b@example.com"},
+				FailureReportURIs:   []string{"mailto:f@example.com"},
+			},
+		},
+
+		{
+			name:    "minimal policy",
+			records: []string{`_dmarc.example.com. 300 IN TXT "v=DMARC1;p=none"`},
+			wantPolicy: &DMARCPolicy{
+				Domain:          "_dmarc.example.com.",
+				Raw:             "v=DMARC1;p=none",
+				Tags:            map[string]string{"v": "DMARC1", "p": "none"},
+				Policy:          "none",
+				SubdomainPolicy: "none",
+				Percent:         100,
+			},
+		},
+
+		{
+			name:    "no record",
+			wantErr: dnscodec.ErrNoData,
+		},
+
+		{
+			name: "duplicate records",
+			records: []string{
+				`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=none"`,
+				`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`,
+			},
+			wantErr: ErrInvalidDMARCRecord,
+		},
+
+		{
+			name:    "missing policy",
+			records: []string{`_dmarc.example.com. 300 IN TXT "v=DMARC1; rua=mailto:a@example.com"`},
+			wantErr: ErrInvalidDMARCRecord,
+		},
+
+		{
+			name:    "invalid percentage",
+			records: []string{`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=none; pct=150"`},
+			wantErr: ErrInvalidDMARCRecord,
+		},
+
+		{
+			name:    "duplicate tag",
+			records: []string{`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=none; p=reject"`},
+			wantErr: ErrInvalidDMARCRecord,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewMailAuthChecker(newMailAuthTransport("", tc.records...))
+			policy, err := c.LookupDMARC(context.Background(), "example.com")
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantPolicy, policy)
+		})
+	}
+}
+
+func TestMailAuthCheckerLookupDKIM(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the TXT records to serve.
+		records []string
+
+		// wantKey is the expected key.
+		wantKey *DKIMKey
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name: "ed25519 key split across strings",
+			records: []string{
+				`sel._domainkey.example.com. 300 IN TXT "v=DKIM1; k=ed25519; h=sha256; t=y:s; p=AAEC" "AwQF"`,
+			},
+			wantKey: &DKIMKey{
+				Domain: "sel._domainkey.example.com.",
+				Raw:    "v=DKIM1; k=ed25519; h=sha256; t=y:s; p=AAECAwQF",
+				Tags: map[string]string{
+					"v": "DKIM1",
+					"k": "ed25519",
+					"h": "sha256",
+					"t": "y:s",
+					"p": "AAECAwQF",
+				},
+				KeyType:        "ed25519",
+				PublicKey:      []byte{0, 1, 2, 3, 4, 5},
+				HashAlgorithms: []string{"sha256"},
+				Flags:          []string{"y", "s"},
+			},
+		},
+
+		{
+			name: "revoked key without version",
+			records: []string{
+				`sel._domainkey.example.com. 300 IN TXT "not a tag list"`,
+				`sel._domainkey.example.com. 300 IN TXT "p="`,
+			},
+			wantKey: &DKIMKey{
+				Domain:  "sel._domainkey.example.com.",
+				Raw:     "p=",
+				Tags:    map[string]string{"p": ""},
+				KeyType: "rsa",
+				Revoked: true,
+			},
+		},
+
+		{
+			name:    "no record",
+			wantErr: dnscodec.ErrNoData,
+		},
+
+		{
+			name:    "wrong version",
+			records: []string{`sel._domainkey.example.com. 300 IN TXT "v=DKIM2; p=AAECAwQF"`},
+			wantErr: ErrInvalidDKIMRecord,
+		},
+
+		{
+			name:    "invalid base64",
+			records: []string{`sel._domainkey.example.com. 300 IN TXT "v=DKIM1; p=!!!"`},
+			wantErr: ErrInvalidDKIMRecord,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewMailAuthChecker(newMailAuthTransport("", tc.records...))
+			key, err := c.LookupDKIM(context.Background(), "sel", "example.com")
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantKey, key)
+		})
+	}
+}
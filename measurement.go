@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net/netip"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// DNSExtendedTransport is a [DNSTransport] that can also describe each
+// exchange using a [*DNSMeasurement]. All the transports in this package
+// implement this interface, and the wrappers (e.g., [*BreakerTransport])
+// forward to the wrapped transport when it implements this interface.
+type DNSExtendedTransport interface {
+	DNSTransport
+	ExchangeExtended(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement)
+}
+
+// DNSMeasurement is the structured result of a DNS exchange including the raw
+// messages, which allows serializing it using several data formats.
+type DNSMeasurement struct {
+	// Network is the network we used ("udp", "tcp", "dot", "stream" when
+	// using a stream that is neither TCP nor TLS, or empty when unknown).
+	Network string
+
+	// Endpoint is the server endpoint or the zero value when unknown.
+	Endpoint netip.AddrPort
+
+	// TLS is the TLS connection state when using DNS over TLS or nil.
+	TLS *tls.ConnectionState
+
+	// Query is the query we sent.
+	Query *dnscodec.Query
+
+	// RawQuery is the raw query or nil if we could not send it.
+	RawQuery []byte
+
+	// RawResponse is the raw response or nil if we did not receive it.
+	RawResponse []byte
+
+	// LateResponses contains the raw responses received while lingering
+	// after the response (see [*DNSOverUDPTransport] Linger field).
+	LateResponses [][]byte
+
+	// Datagrams contains all the datagrams we received, including duplicate
+	// and unexpected responses, when using [*DNSOverUDPUnconnectedTransport].
+	Datagrams []*DNSOverUDPDatagram
+
+	// Response is the response or nil.
+	Response *dnscodec.Response
+
+	// MinimalANY is true when Response is an RFC 8482 minimal response
+	// to an ANY query (see [IsMinimalANYResponse]).
+	MinimalANY bool
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the exchange.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started until we received the
+	// response or the exchange failed, which excludes lingering.
+	Elapsed time.Duration
+}
+
+// newDNSMeasurement creates a new [*DNSMeasurement] for an exchange starting now.
+func newDNSMeasurement(network string, endpoint netip.AddrPort, query *dnscodec.Query) *DNSMeasurement {
+	return &DNSMeasurement{
+		Network:  network,
+		Endpoint: endpoint,
+		Query:    query,
+		Started:  time.Now(),
+	}
+}
+
+// observeRawQuery returns a hook saving the raw query and chaining to next, if not nil.
+func (m *DNSMeasurement) observeRawQuery(next func([]byte)) func([]byte) {
+	return func(rawQuery []byte) {
+		m.RawQuery = rawQuery
+		if next != nil {
+			next(rawQuery)
+		}
+	}
+}
+
+// observeRawResponse returns a hook saving the raw response and the elapsed
+// time and chaining to next, if not nil.
+func (m *DNSMeasurement) observeRawResponse(next func([]byte)) func([]byte) {
+	return func(rawResp []byte) {
+		m.Elapsed = time.Since(m.Started)
+		m.RawResponse = rawResp
+		if next != nil {
+			next(rawResp)
+		}
+	}
+}
+
+// observeLateResponse returns a hook saving late responses and chaining to next, if not nil.
+func (m *DNSMeasurement) observeLateResponse(next func([]byte)) func([]byte) {
+	return func(rawResp []byte) {
+		m.LateResponses = append(m.LateResponses, rawResp)
+		if next != nil {
+			next(rawResp)
+		}
+	}
+}
+
+// observeDatagram returns a hook saving the datagram and chaining to next, if not nil.
+func (m *DNSMeasurement) observeDatagram(next func(*DNSOverUDPDatagram)) func(*DNSOverUDPDatagram) {
+	return func(datagram *DNSOverUDPDatagram) {
+		m.Datagrams = append(m.Datagrams, datagram)
+		if next != nil {
+			next(datagram)
+		}
+	}
+}
+
+// exchangeExtended calls ExchangeExtended when txp implements [DNSExtendedTransport]
+// and otherwise calls Exchange and returns a [*DNSMeasurement] without the network
+// details and the raw messages, which allows wrappers to forward ExchangeExtended.
+func exchangeExtended(
+	ctx context.Context, txp DNSTransport, query *dnscodec.Query) (*dnscodec.Response, *DNSMeasurement) {
+	if etxp, ok := txp.(DNSExtendedTransport); ok {
+		return etxp.ExchangeExtended(ctx, query)
+	}
+	m := newDNSMeasurement("", netip.AddrPort{}, query)
+	m.complete(txp.Exchange(ctx, query))
+	return m.Response, m
+}
+
+// complete records the outcome of the exchange, setting Elapsed unless we
+// already set it when receiving the response.
+func (m *DNSMeasurement) complete(resp *dnscodec.Response, err error) {
+	if m.RawResponse == nil {
+		m.Elapsed = time.Since(m.Started)
+	}
+	m.Response = resp
+	m.MinimalANY = resp != nil && IsMinimalANYResponse(resp.Response)
+	m.Err = err
+	m.Failure = ClassifyError(err)
+}
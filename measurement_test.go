@@ -0,0 +1,377 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeExtended(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	endpoint := netip.MustParseAddrPort(server.Address())
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// newTransport creates the transport, setting hooks that save
+		// the raw messages into the given pointers.
+		newTransport func(t *testing.T, rawQuery, rawResp *[]byte) DNSExtendedTransport
+
+		// wantDatagrams is the expected number of datagrams.
+		wantDatagrams int
+	}
+
+	tests := []testCase{
+		{
+			name: "DNSOverUDPTransport",
+			newTransport: func(t *testing.T, rawQuery, rawResp *[]byte) DNSExtendedTransport {
+				txp := NewDNSOverUDPTransport(&net.Dialer{}, endpoint)
+				txp.ObserveRawQuery = func(b []byte) { *rawQuery = b }
+				txp.ObserveRawResponse = func(b []byte) { *rawResp = b }
+				return txp
+			},
+		},
+
+		{
+			name: "DNSOverUDPUnconnectedTransport",
+			newTransport: func(t *testing.T, rawQuery, rawResp *[]byte) DNSExtendedTransport {
+				txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+				txp.ObserveRawQuery = func(b []byte) { *rawQuery = b }
+				txp.ObserveDatagram = func(d *DNSOverUDPDatagram) { *rawResp = d.RawResponse }
+				return txp
+			},
+			wantDatagrams: 1,
+		},
+
+		{
+			name: "DNSOverUDPMuxTransport",
+			newTransport: func(t *testing.T, rawQuery, rawResp *[]byte) DNSExtendedTransport {
+				txp := NewDNSOverUDPMuxTransport(&net.Dialer{}, endpoint)
+				t.Cleanup(func() { txp.Close() })
+				txp.ObserveRawQuery = func(b []byte) { *rawQuery = b }
+				txp.ObserveRawResponse = func(b []byte) { *rawResp = b }
+				return txp
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var rawQuery, rawResp []byte
+			txp := tc.newTransport(t, &rawQuery, &rawResp)
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			resp, m := txp.ExchangeExtended(ctx, query)
+			require.NoError(t, m.Err)
+			require.NotNil(t, resp)
+			assert.Same(t, resp, m.Response)
+			assert.Empty(t, m.Failure)
+			assert.Equal(t, "udp", m.Network)
+			assert.Equal(t, endpoint, m.Endpoint)
+			assert.Same(t, query, m.Query)
+			assert.False(t, m.Started.IsZero())
+			assert.Positive(t, m.Elapsed)
+			assert.Len(t, m.Datagrams, tc.wantDatagrams)
+
+			// make sure we have chained to the hooks
+			assert.NotEmpty(t, m.RawQuery)
+			assert.Equal(t, rawQuery, m.RawQuery)
+			assert.NotEmpty(t, m.RawResponse)
+			assert.Equal(t, rawResp, m.RawResponse)
+
+			respMsg := new(dns.Msg)
+			require.NoError(t, respMsg.Unpack(m.RawResponse))
+			assert.Equal(t, resp.Response.Id, respMsg.Id)
+		})
+	}
+}
+
+func TestExchangeExtendedStreams(t *testing.T) {
+	endpoint, dotPort := newEscalationServer(t, &escalationServerConfig{udp: "truncate", tcp: true, dot: true})
+	dotEndpoint := netip.AddrPortFrom(endpoint.Addr(), dotPort)
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// newTransport creates the transport.
+		newTransport func(t *testing.T) DNSExtendedTransport
+
+		// wantNetwork is the expected network.
+		wantNetwork string
+
+		// wantEndpoint is the expected endpoint.
+		wantEndpoint netip.AddrPort
+
+		// wantTLS indicates whether we expect the TLS connection state.
+		wantTLS bool
+	}
+
+	tests := []testCase{
+		{
+			name: "dnsStreamDialTransport using TCP",
+			newTransport: func(t *testing.T) DNSExtendedTransport {
+				return &dnsStreamDialTransport{dialer: &net.Dialer{}, endpoint: endpoint}
+			},
+			wantNetwork:  "tcp",
+			wantEndpoint: endpoint,
+		},
+
+		{
+			name: "dnsStreamDialTransport using TLS",
+			newTransport: func(t *testing.T) DNSExtendedTransport {
+				return &dnsStreamDialTransport{
+					config:   tlsConfig,
+					dialer:   &net.Dialer{},
+					endpoint: dotEndpoint,
+					factory:  StdlibTLSClientFactory{},
+				}
+			},
+			wantNetwork:  "dot",
+			wantEndpoint: dotEndpoint,
+			wantTLS:      true,
+		},
+
+		{
+			name: "DNSOverStreamTransport using TCP",
+			newTransport: func(t *testing.T) DNSExtendedTransport {
+				conn, err := net.Dial("tcp", endpoint.String())
+				require.NoError(t, err)
+				txp := NewDNSOverStreamTransport(conn)
+				t.Cleanup(func() { txp.Close() })
+				return txp
+			},
+			wantNetwork:  "tcp",
+			wantEndpoint: endpoint,
+		},
+
+		{
+			name: "DNSOverStreamTransport using TLS",
+			newTransport: func(t *testing.T) DNSExtendedTransport {
+				conn, err := tls.Dial("tcp", dotEndpoint.String(), tlsConfig)
+				require.NoError(t, err)
+				txp := NewDNSOverStreamTransport(conn)
+				t.Cleanup(func() { txp.Close() })
+				return txp
+			},
+			wantNetwork:  "dot",
+			wantEndpoint: dotEndpoint,
+			wantTLS:      true,
+		},
+
+		{
+			name: "DNSOverStreamTransport using an opaque stream",
+			newTransport: func(t *testing.T) DNSExtendedTransport {
+				txp := NewDNSOverStreamTransport(newDNSOverStreamServer(t, dnsOverStreamAnswer))
+				t.Cleanup(func() { txp.Close() })
+				return txp
+			},
+			wantNetwork: "stream",
+		},
+
+		{
+			name: "EscalatingTransport",
+			newTransport: func(t *testing.T) DNSExtendedTransport {
+				et := NewEscalatingTransport(&net.Dialer{}, endpoint.Addr())
+				et.Do53Port = endpoint.Port()
+				return et
+			},
+			wantNetwork:  "tcp",
+			wantEndpoint: endpoint,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			txp := tc.newTransport(t)
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			resp, m := txp.ExchangeExtended(ctx, query)
+			require.NoError(t, m.Err)
+			require.NotNil(t, resp)
+			assert.Same(t, resp, m.Response)
+			assert.Equal(t, tc.wantNetwork, m.Network)
+			assert.Equal(t, tc.wantEndpoint, m.Endpoint)
+			assert.Same(t, query, m.Query)
+			assert.Positive(t, m.Elapsed)
+			if tc.wantTLS {
+				require.NotNil(t, m.TLS)
+				assert.True(t, m.TLS.HandshakeComplete)
+			} else {
+				assert.Nil(t, m.TLS)
+			}
+
+			queryMsg, respMsg := new(dns.Msg), new(dns.Msg)
+			require.NoError(t, queryMsg.Unpack(m.RawQuery))
+			require.NoError(t, respMsg.Unpack(m.RawResponse))
+			assert.Equal(t, queryMsg.Id, respMsg.Id)
+			assert.Equal(t, resp.Response.Id, respMsg.Id)
+		})
+	}
+}
+
+func TestExchangeExtendedWrappers(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	endpoint := netip.MustParseAddrPort(server.Address())
+	udp := NewDNSOverUDPTransport(&net.Dialer{}, endpoint)
+	stub := transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return udp.Exchange(ctx, query)
+	}}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// txp is the wrapper transport.
+		txp DNSExtendedTransport
+
+		// wantNetwork is the expected network, which is empty when
+		// the wrapped transport does not implement [DNSExtendedTransport].
+		wantNetwork string
+	}
+
+	tests := []testCase{
+		{
+			name:        "BreakerTransport",
+			txp:         NewBreakerTransport(udp),
+			wantNetwork: "udp",
+		},
+
+		{
+			name: "BreakerTransport without DNSExtendedTransport",
+			txp:  NewBreakerTransport(stub),
+		},
+
+		{
+			name:        "upstreamTransport",
+			txp:         &upstreamTransport{transport: udp, timeout: 5 * time.Second},
+			wantNetwork: "udp",
+		},
+
+		{
+			name: "upstreamTransport without DNSExtendedTransport",
+			txp:  &upstreamTransport{transport: stub},
+		},
+
+		{
+			name:        "parallelTransport",
+			txp:         &parallelTransport{transports: []DNSTransport{udp, udp}},
+			wantNetwork: "udp",
+		},
+
+		{
+			name: "parallelTransport without DNSExtendedTransport",
+			txp:  &parallelTransport{transports: []DNSTransport{stub}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			resp, m := tc.txp.ExchangeExtended(context.Background(), query)
+			require.NoError(t, m.Err)
+			require.NotNil(t, resp)
+			assert.Same(t, resp, m.Response)
+			assert.Same(t, query, m.Query)
+			assert.Equal(t, tc.wantNetwork, m.Network)
+			if tc.wantNetwork == "" {
+				assert.Equal(t, netip.AddrPort{}, m.Endpoint)
+				assert.Nil(t, m.RawResponse)
+				return
+			}
+			assert.Equal(t, endpoint, m.Endpoint)
+			assert.NotEmpty(t, m.RawResponse)
+		})
+	}
+}
+
+func TestExchangeExtendedFailure(t *testing.T) {
+	expectedErr := errors.New("read failed")
+	txp := NewDNSOverUDPTransport(&netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			return &netstub.FuncConn{
+				WriteFunc: func(b []byte) (int, error) {
+					return len(b), nil
+				},
+				ReadFunc: func([]byte) (int, error) {
+					return 0, expectedErr
+				},
+				CloseFunc: func() error {
+					return nil
+				},
+			}, nil
+		},
+	}, netip.MustParseAddrPort("8.8.8.8:53"))
+
+	resp, m := txp.ExchangeExtended(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.Nil(t, resp)
+	require.ErrorIs(t, m.Err, expectedErr)
+	assert.Equal(t, FailureUnknown, m.Failure)
+	assert.NotEmpty(t, m.RawQuery)
+	assert.Nil(t, m.RawResponse)
+	assert.Nil(t, txp.ObserveRawQuery)
+}
+
+func TestDNSOverUDPUnconnectedTransportExchangeExtendedSpoofing(t *testing.T) {
+	endpoint, injector := newSpoofingServer(t)
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, m := txp.ExchangeExtended(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, m.Err)
+	require.NotNil(t, resp)
+	require.Len(t, m.Datagrams, 2)
+	assert.Equal(t, injector, m.Datagrams[1].Source)
+	assert.Equal(t, m.Datagrams[1].RawResponse, m.RawResponse)
+}
+
+func TestDNSOverUDPUnconnectedTransportExchangeExtendedTimeout(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pconn.Close()
+	endpoint := netip.MustParseAddrPort(pconn.LocalAddr().String())
+
+	// send a junk datagram that we must not confuse with the response
+	txp := NewDNSOverUDPUnconnectedTransport(&net.ListenConfig{}, endpoint)
+	txp.ObserveRawQuery = func([]byte) {
+		go func() {
+			buff := make([]byte, 4096)
+			_, client, err := pconn.ReadFrom(buff)
+			if err == nil {
+				pconn.WriteTo([]byte{0xde, 0xad}, client)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	resp, m := txp.ExchangeExtended(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.Nil(t, resp)
+	require.Error(t, m.Err)
+	assert.Len(t, m.Datagrams, 1)
+	assert.Nil(t, m.RawResponse)
+}
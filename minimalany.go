@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import "github.com/miekg/dns"
+
+// IsMinimalANYResponse returns whether the given response to an ANY query is
+// an RFC 8482 minimal response, i.e., a synthesized HINFO record in place of
+// the actual RRsets (the CPU field is typically "RFC8482").
+//
+// Surveys should treat such responses as the server refusing ANY queries
+// rather than as ordinary data, since the HINFO record does not exist.
+func IsMinimalANYResponse(respMsg *dns.Msg) bool {
+	if len(respMsg.Question) != 1 || respMsg.Question[0].Qtype != dns.TypeANY {
+		return false
+	}
+	var hinfo int
+	for _, rr := range respMsg.Answer {
+		switch rr.Header().Rrtype {
+		case dns.TypeHINFO:
+			hinfo++
+		case dns.TypeRRSIG:
+			// RFC 8482 allows signing the synthesized record
+		default:
+			return false
+		}
+	}
+	return hinfo == 1
+}
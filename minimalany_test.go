@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsMinimalANYResponse(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// qtype is the query type.
+		qtype uint16
+
+		// answers contains the answer RRs.
+		answers []string
+
+		// want is the expected result.
+		want bool
+	}
+
+	tests := []testCase{
+		{
+			name:    "synthesized HINFO",
+			qtype:   dns.TypeANY,
+			answers: []string{`example.com. 3789 IN HINFO "RFC8482" ""`},
+			want:    true,
+		},
+
+		{
+			name:  "signed synthesized HINFO",
+			qtype: dns.TypeANY,
+			answers: []string{
+				`example.com. 3789 IN HINFO "RFC8482" ""`,
+				`example.com. 3789 IN RRSIG HINFO 13 2 3789 20261016000000 20261014000000 2371 example.com. AAAA`,
+			},
+			want: true,
+		},
+
+		{
+			name:  "full ANY response",
+			qtype: dns.TypeANY,
+			answers: []string{
+				`example.com. 300 IN A 93.184.216.34`,
+				`example.com. 300 IN HINFO "x86" "Linux"`,
+			},
+			want: false,
+		},
+
+		{
+			name:  "empty ANY response",
+			qtype: dns.TypeANY,
+			want:  false,
+		},
+
+		{
+			name:    "HINFO query",
+			qtype:   dns.TypeHINFO,
+			answers: []string{`example.com. 300 IN HINFO "x86" "Linux"`},
+			want:    false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respMsg := new(dns.Msg)
+			respMsg.SetQuestion("example.com.", tc.qtype)
+			for _, answer := range tc.answers {
+				respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(answer)))
+			}
+			assert.Equal(t, tc.want, IsMinimalANYResponse(respMsg))
+		})
+	}
+}
+
+func TestExchangeExtendedMinimalANY(t *testing.T) {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{PacketConn: pconn, Handler: dns.HandlerFunc(
+		func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.Answer = append(respMsg.Answer, &dns.HINFO{
+				Hdr: dns.RR_Header{Name: queryMsg.Question[0].Name, Rrtype: dns.TypeHINFO, Class: dns.ClassINET, Ttl: 3789},
+				Cpu: "RFC8482",
+			})
+			w.WriteMsg(respMsg)
+		})})
+	endpoint := netip.MustParseAddrPort(pconn.LocalAddr().String())
+
+	txp := NewDNSOverUDPTransport(&net.Dialer{}, endpoint)
+	for _, qtype := range []uint16{dns.TypeANY, dns.TypeHINFO} {
+		resp, m := txp.ExchangeExtended(context.Background(), dnscodec.NewQuery("example.com", qtype))
+		require.NoError(t, m.Err)
+		require.NotNil(t, resp)
+		assert.Equal(t, qtype == dns.TypeANY, m.MinimalANY)
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// OONIDNSQuery is a DNS measurement result using the OONI data format.
+//
+// See https://github.com/ooni/spec/blob/master/data-formats/df-002-dnst.md.
+//
+// Construct using [NewOONIDNSQuery].
+type OONIDNSQuery struct {
+	// Answers contains the answers or is empty.
+	Answers []*OONIDNSAnswer `json:"answers"`
+
+	// Engine is the network we used (e.g., "udp").
+	Engine string `json:"engine"`
+
+	// Failure is the failure string or nil.
+	Failure *string `json:"failure"`
+
+	// Hostname is the queried domain.
+	Hostname string `json:"hostname"`
+
+	// QueryType is the query type (e.g., "A").
+	QueryType string `json:"query_type"`
+
+	// RawResponse is the base64 encoded raw response or empty.
+	RawResponse string `json:"raw_response,omitempty"`
+
+	// Rcode is the response code or zero.
+	Rcode int `json:"rcode,omitempty"`
+
+	// ResolverAddress is the server endpoint.
+	ResolverAddress string `json:"resolver_address"`
+
+	// T0 is when we started the exchange, in seconds since the zero time.
+	T0 float64 `json:"t0"`
+
+	// T is when we finished the exchange, in seconds since the zero time.
+	T float64 `json:"t"`
+}
+
+// OONIDNSAnswer is an answer within [*OONIDNSQuery].
+type OONIDNSAnswer struct {
+	// AnswerType is the record type (e.g., "A").
+	AnswerType string `json:"answer_type"`
+
+	// Hostname is the target of CNAME, NS, and PTR records.
+	Hostname string `json:"hostname,omitempty"`
+
+	// IPv4 is the address of A records.
+	IPv4 string `json:"ipv4,omitempty"`
+
+	// IPv6 is the address of AAAA records.
+	IPv6 string `json:"ipv6,omitempty"`
+
+	// Text is the content of TXT records.
+	Text string `json:"text,omitempty"`
+
+	// TTL is the time to live.
+	TTL uint32 `json:"ttl"`
+}
+
+// NewOONIDNSQuery converts a [*DNSMeasurement] to a [*OONIDNSQuery] using
+// the given zero time, which is usually when the OONI measurement started.
+//
+// We parse the answers from the raw response, such that we also include
+// them when the response code is an error.
+func NewOONIDNSQuery(m *DNSMeasurement, zeroTime time.Time) *OONIDNSQuery {
+	// 1. fill the fields that do not depend on the raw response
+	t0 := m.Started.Sub(zeroTime)
+	query := &OONIDNSQuery{
+		Answers:         []*OONIDNSAnswer{},
+		Engine:          m.Network,
+		ResolverAddress: m.Endpoint.String(),
+		T0:              t0.Seconds(),
+		T:               (t0 + m.Elapsed).Seconds(),
+	}
+	if m.Query != nil {
+		query.Hostname = strings.TrimSuffix(m.Query.Name, ".")
+		query.QueryType = dns.TypeToString[m.Query.Type]
+	}
+	if m.Failure != "" {
+		failure := m.Failure
+		query.Failure = &failure
+	}
+
+	// 2. fill the fields that depend on the raw response
+	respMsg := new(dns.Msg)
+	if m.RawResponse == nil || respMsg.Unpack(m.RawResponse) != nil {
+		return query
+	}
+	query.RawResponse = base64.StdEncoding.EncodeToString(m.RawResponse)
+	query.Rcode = respMsg.Rcode
+	for _, rr := range respMsg.Answer {
+		answer := &OONIDNSAnswer{
+			AnswerType: dns.TypeToString[rr.Header().Rrtype],
+			TTL:        rr.Header().Ttl,
+		}
+		switch rr := rr.(type) {
+		case *dns.A:
+			answer.IPv4 = rr.A.String()
+		case *dns.AAAA:
+			answer.IPv6 = rr.AAAA.String()
+		case *dns.CNAME:
+			answer.Hostname = rr.Target
+		case *dns.NS:
+			answer.Hostname = rr.Ns
+		case *dns.PTR:
+			answer.Hostname = rr.Ptr
+		case *dns.TXT:
+			answer.Text = strings.Join(rr.Txt, "")
+		default:
+			continue
+		}
+		query.Answers = append(query.Answers, answer)
+	}
+	return query
+}
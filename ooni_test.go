@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOONIDNSQuery(t *testing.T) {
+	zeroTime := time.Unix(1700000000, 0)
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("www.example.com.", dns.TypeA)
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	respMsg.Answer = []dns.RR{
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 30},
+			Target: "example.com.",
+		},
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.IPv4(93, 184, 216, 34),
+		},
+		&dns.AAAA{
+			Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60},
+			AAAA: net.ParseIP("2001:db8::1"),
+		},
+		&dns.MX{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 60},
+			Mx:  "mx.example.com.",
+		},
+	}
+	rawResp, err := respMsg.Pack()
+	require.NoError(t, err)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// measurement is the measurement to convert.
+		measurement *DNSMeasurement
+
+		// expect is the expected query.
+		expect *OONIDNSQuery
+	}
+
+	failure := FailureGenericTimeout
+	tests := []testCase{
+		{
+			name: "successful measurement",
+			measurement: &DNSMeasurement{
+				Network:     "udp",
+				Endpoint:    netip.MustParseAddrPort("8.8.8.8:53"),
+				Query:       dnscodec.NewQuery("www.example.com", dns.TypeA),
+				RawResponse: rawResp,
+				Started:     zeroTime.Add(time.Second),
+				Elapsed:     500 * time.Millisecond,
+			},
+			expect: &OONIDNSQuery{
+				Answers: []*OONIDNSAnswer{
+					{AnswerType: "CNAME", Hostname: "example.com.", TTL: 30},
+					{AnswerType: "A", IPv4: "93.184.216.34", TTL: 60},
+					{AnswerType: "AAAA", IPv6: "2001:db8::1", TTL: 60},
+				},
+				Engine:          "udp",
+				Hostname:        "www.example.com",
+				QueryType:       "A",
+				RawResponse:     base64.StdEncoding.EncodeToString(rawResp),
+				ResolverAddress: "8.8.8.8:53",
+				T0:              1,
+				T:               1.5,
+			},
+		},
+
+		{
+			name: "timeout",
+			measurement: &DNSMeasurement{
+				Network:  "udp",
+				Endpoint: netip.MustParseAddrPort("8.8.8.8:53"),
+				Query:    dnscodec.NewQuery("www.example.com", dns.TypeAAAA),
+				Failure:  FailureGenericTimeout,
+				Started:  zeroTime,
+				Elapsed:  2 * time.Second,
+			},
+			expect: &OONIDNSQuery{
+				Answers:         []*OONIDNSAnswer{},
+				Engine:          "udp",
+				Failure:         &failure,
+				Hostname:        "www.example.com",
+				QueryType:       "AAAA",
+				ResolverAddress: "8.8.8.8:53",
+				T0:              0,
+				T:               2,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, NewOONIDNSQuery(tc.measurement, zeroTime))
+		})
+	}
+}
+
+func TestOONIDNSQueryJSON(t *testing.T) {
+	query := NewOONIDNSQuery(&DNSMeasurement{
+		Network:  "udp",
+		Endpoint: netip.MustParseAddrPort("8.8.8.8:53"),
+		Query:    dnscodec.NewQuery("example.com", dns.TypeA),
+	}, time.Time{})
+	data, err := json.Marshal(query)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"answers": [],
+		"engine": "udp",
+		"failure": null,
+		"hostname": "example.com",
+		"query_type": "A",
+		"resolver_address": "8.8.8.8:53",
+		"t0": 0,
+		"t": 0
+	}`, string(data))
+}
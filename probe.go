@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// Probe repeats the same query several times using a [DNSTransport] and
+// computes latency statistics, to compare the performance of resolvers.
+//
+// Construct using [NewProbe].
+type Probe struct {
+	// Transport is the [DNSTransport] to use.
+	//
+	// Set by [NewProbe] to the user-provided value.
+	Transport DNSTransport
+
+	// Domain is the domain to query.
+	//
+	// Set by [NewProbe] to the user-provided value.
+	Domain string
+
+	// Type is the query type.
+	//
+	// Set by [NewProbe] to the user-provided value.
+	Type uint16
+
+	// Count is the number of attempts.
+	//
+	// Set by [NewProbe] to the user-provided value.
+	Count int
+
+	// Interval OPTIONALLY configures starting an attempt at each interval
+	// regardless of whether previous attempts have completed. When zero, we
+	// run attempts serially, starting each one when the previous one completes.
+	Interval time.Duration
+
+	// Timeout is the timeout of each attempt.
+	//
+	// Set by [NewProbe] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewProbe] to [GlobalRand].
+	Rand Rand
+}
+
+// ProbeAttempt is the outcome of a single [*Probe] attempt.
+type ProbeAttempt struct {
+	// Response is the response or nil.
+	Response *dnscodec.Response
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the attempt.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// ProbeResult is the result of running a [*Probe].
+type ProbeResult struct {
+	// Attempts contains the attempts in the order in which we started them.
+	Attempts []*ProbeAttempt
+
+	// Latency contains the latency statistics of the successful attempts.
+	Latency LatencyStats
+}
+
+// NewProbe creates a new [*Probe].
+func NewProbe(txp DNSTransport, domain string, qtype uint16, count int) *Probe {
+	return &Probe{
+		Transport: txp,
+		Domain:    domain,
+		Type:      qtype,
+		Count:     count,
+		Timeout:   DefaultResolverTimeout,
+		Rand:      GlobalRand{},
+	}
+}
+
+// Run runs the probe and returns the result.
+//
+// When the context is done, we stop starting new attempts.
+func (p *Probe) Run(ctx context.Context) *ProbeResult {
+	// 1. run the attempts serially or at fixed rate
+	attempts := make([]*ProbeAttempt, 0, p.Count)
+	if p.Interval <= 0 {
+		for range p.Count {
+			if ctx.Err() != nil {
+				break
+			}
+			attempts = append(attempts, p.attempt(ctx))
+		}
+	} else {
+		var (
+			limiter = NewRateLimiter(float64(time.Second)/float64(p.Interval), 1)
+			mu      sync.Mutex
+			wg      = &sync.WaitGroup{}
+		)
+		for range p.Count {
+			if ctx.Err() != nil || limiter.Wait(ctx) != nil {
+				break
+			}
+			mu.Lock()
+			attempts = append(attempts, nil)
+			idx := len(attempts) - 1
+			mu.Unlock()
+			wg.Go(func() {
+				attempt := p.attempt(ctx)
+				mu.Lock()
+				attempts[idx] = attempt
+				mu.Unlock()
+			})
+		}
+		wg.Wait()
+	}
+
+	// 2. compute the statistics
+	var latencies []time.Duration
+	for _, attempt := range attempts {
+		if attempt.Err == nil {
+			latencies = append(latencies, attempt.Elapsed)
+		}
+	}
+	return &ProbeResult{Attempts: attempts, Latency: NewLatencyStats(latencies)}
+}
+
+// attempt runs a single attempt.
+func (p *Probe) attempt(ctx context.Context) *ProbeAttempt {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	started := time.Now()
+	query := dnscodec.NewQuery(p.Domain, p.Type)
+	query.ID = randID(p.Rand)
+	resp, err := p.Transport.Exchange(ctx, query)
+	return &ProbeAttempt{
+		Response: resp,
+		Err:      err,
+		Failure:  ClassifyError(err),
+		Started:  started,
+		Elapsed:  time.Since(started),
+	}
+}
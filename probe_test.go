@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeRun(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// interval is the probe interval.
+		interval time.Duration
+	}
+
+	tests := []testCase{
+		{name: "serial", interval: 0},
+		{name: "fixed rate", interval: time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var count atomic.Int64
+			probe := NewProbe(transportStub{
+				exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+					if count.Add(1) == 3 {
+						return nil, dnscodec.ErrNoName
+					}
+					time.Sleep(time.Millisecond)
+					return &dnscodec.Response{}, nil
+				},
+			}, "example.com", dns.TypeA, 10)
+			probe.Interval = tc.interval
+
+			result := probe.Run(context.Background())
+			require.Len(t, result.Attempts, 10)
+			var failures int
+			for _, attempt := range result.Attempts {
+				require.NotNil(t, attempt)
+				if attempt.Err != nil {
+					failures++
+					assert.Equal(t, FailureDNSNXDOMAIN, attempt.Failure)
+					assert.Nil(t, attempt.Response)
+				}
+			}
+			assert.Equal(t, 1, failures)
+			assert.Equal(t, 9, result.Latency.Count)
+			assert.GreaterOrEqual(t, result.Latency.Min, time.Millisecond)
+		})
+	}
+}
+
+func TestProbeContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	probe := NewProbe(transportStub{
+		exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+			cancel()
+			return nil, context.Canceled
+		},
+	}, "example.com", dns.TypeA, 10)
+
+	result := probe.Run(ctx)
+	require.Len(t, result.Attempts, 1)
+	assert.Equal(t, FailureInterrupted, result.Attempts[0].Failure)
+	assert.Zero(t, result.Latency.Count)
+}
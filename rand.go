@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+)
+
+// Rand is a source of randomness, which allows making the query IDs, the
+// 0x20 case randomization, the jitter, the random labels, and the random
+// local ports reproducible in tests and replayed measurements.
+//
+// This interface is compatible with [rand.Source], hence one can also use
+// the sources of [math/rand/v2] when they are not used concurrently.
+//
+// Query messages created using [*dns.Msg.SetQuestion] or [dnscodec.NewQuery]
+// outside of the types using a [Rand] obtain their ID from [dns.Id], which the
+// miekg/dns package allows replacing.
+type Rand interface {
+	// Uint64 returns a random 64-bit value.
+	Uint64() uint64
+}
+
+// GlobalRand is the [Rand] using the global source of [math/rand/v2].
+type GlobalRand struct{}
+
+// Ensure that [GlobalRand] implements [Rand].
+var _ Rand = GlobalRand{}
+
+// Uint64 implements [Rand].
+func (GlobalRand) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+// SeededRand is a deterministic [Rand] generating the same sequence for the same seed.
+//
+// A [*SeededRand] is safe for concurrent use.
+//
+// Construct using [NewSeededRand].
+type SeededRand struct {
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// source is the underlying source.
+	source *rand.PCG
+}
+
+// NewSeededRand creates a new [*SeededRand] using the given seed.
+func NewSeededRand(seed uint64) *SeededRand {
+	return &SeededRand{source: rand.NewPCG(seed, seed)}
+}
+
+// Ensure that [*SeededRand] implements [Rand].
+var _ Rand = &SeededRand{}
+
+// Uint64 implements [Rand].
+func (r *SeededRand) Uint64() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.source.Uint64()
+}
+
+// randSource returns the given [Rand] or [GlobalRand] when it is nil, such
+// that the types using a [Rand] also work when constructed as literals.
+func randSource(r Rand) Rand {
+	if r == nil {
+		return GlobalRand{}
+	}
+	return r
+}
+
+// randNew returns a [*rand.Rand] using the given [Rand] as its source.
+func randNew(r Rand) *rand.Rand {
+	return rand.New(randSource(r))
+}
+
+// randID returns a random query ID using the given [Rand].
+func randID(r Rand) uint16 {
+	return uint16(randSource(r).Uint64())
+}
+
+// randRead fills the buffer with random bytes using the given [Rand].
+func randRead(r Rand, buff []byte) {
+	var word [8]byte
+	for len(buff) > 0 {
+		binary.LittleEndian.PutUint64(word[:], randSource(r).Uint64())
+		buff = buff[copy(buff, word[:]):]
+	}
+}
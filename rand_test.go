@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeededRand(t *testing.T) {
+	r1, r2 := NewSeededRand(7), NewSeededRand(7)
+	for range 16 {
+		assert.Equal(t, r1.Uint64(), r2.Uint64())
+	}
+	assert.NotEqual(t, NewSeededRand(7).Uint64(), NewSeededRand(8).Uint64())
+}
+
+func TestSeededRandConcurrentUse(t *testing.T) {
+	r := NewSeededRand(7)
+	wg := &sync.WaitGroup{}
+	for range 8 {
+		wg.Go(func() {
+			for range 100 {
+				r.Uint64()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestGlobalRand(t *testing.T) {
+	// a collision among several 64-bit values is practically impossible
+	values := make(map[uint64]bool)
+	for range 16 {
+		values[GlobalRand{}.Uint64()] = true
+	}
+	assert.Len(t, values, 16)
+}
+
+func TestRandRead(t *testing.T) {
+	for _, size := range []int{0, 1, 8, 13} {
+		buff1, buff2 := make([]byte, size), make([]byte, size)
+		randRead(NewSeededRand(7), buff1)
+		randRead(NewSeededRand(7), buff2)
+		assert.Equal(t, buff1, buff2)
+	}
+	buff := make([]byte, 13)
+	randRead(NewSeededRand(7), buff)
+	assert.NotEqual(t, make([]byte, 13), buff)
+}
+
+func TestResolverRandReproducibleIDs(t *testing.T) {
+	lookupIDs := func(seed uint64) []uint16 {
+		var ids []uint16
+		reso := NewResolver(transportStub{
+			exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+				ids = append(ids, query.ID)
+				return nil, errors.New("mocked error")
+			},
+		})
+		reso.Rand = NewSeededRand(seed)
+		for range 4 {
+			_, err := reso.LookupA(context.Background(), "example.com")
+			require.Error(t, err)
+		}
+		return ids
+	}
+	assert.Equal(t, lookupIDs(7), lookupIDs(7))
+	assert.NotEqual(t, lookupIDs(7), lookupIDs(8))
+}
+
+func TestFingerprintMixCaseReproducible(t *testing.T) {
+	name := "a-rather-long-domain-name.example.com"
+	assert.Equal(t, fingerprintMixCase(NewSeededRand(7), name), fingerprintMixCase(NewSeededRand(7), name))
+}
+
+func TestDNSProxyHandlerRandIDs(t *testing.T) {
+	var ids []uint16
+	handler := NewDNSProxyHandler(msgTransportStub{
+		exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+			ids = append(ids, queryMsg.Id)
+			return nil, errors.New("mocked error")
+		},
+	})
+	handler.Rand = NewSeededRand(7)
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	_, err := handler.forward(queryMsg)
+	require.Error(t, err)
+	require.Equal(t, []uint16{randID(NewSeededRand(7))}, ids)
+}
+
+func TestRandNilFallsBackToGlobalRand(t *testing.T) {
+	var ids []uint16
+	reso := &Resolver{Timeout: time.Second, Transports: []DNSTransport{transportStub{
+		exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			ids = append(ids, query.ID)
+			return nil, errors.New("mocked error")
+		},
+	}}}
+	_, err := reso.LookupA(context.Background(), "example.com")
+	require.Error(t, err)
+	require.Len(t, ids, 1)
+}
+
+func TestRandQueryIDs(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// run runs the component using the given transport and [Rand].
+		run func(txp msgTransportStub, r Rand)
+	}
+
+	tests := []testCase{
+		{
+			name: "AnycastMapper",
+			run: func(txp msgTransportStub, r Rand) {
+				mapper := NewAnycastMapper(txp, 1)
+				mapper.Rand = r
+				mapper.Run(context.Background())
+			},
+		},
+
+		{
+			name: "IterativeResolver",
+			run: func(txp msgTransportStub, r Rand) {
+				ir := NewIterativeResolver(&netstub.FuncDialer{})
+				ir.NewTransport = func(netip.Addr) DNSMsgTransport { return txp }
+				ir.Rand = r
+				ir.Resolve(context.Background(), "example.com", dns.TypeA)
+			},
+		},
+
+		{
+			name: "MailAuthChecker",
+			run: func(txp msgTransportStub, r Rand) {
+				checker := NewMailAuthChecker(txp)
+				checker.Rand = r
+				checker.LookupDMARC(context.Background(), "example.com")
+			},
+		},
+
+		{
+			name: "RootPrimer",
+			run: func(txp msgTransportStub, r Rand) {
+				primer := NewRootPrimer(&netstub.FuncDialer{})
+				primer.NewTransport = func(netip.Addr) DNSMsgTransport { return txp }
+				primer.Rand = r
+				primer.Prime(context.Background())
+			},
+		},
+
+		{
+			name: "ServfailDiagnoser",
+			run: func(txp msgTransportStub, r Rand) {
+				diagnoser := NewServfailDiagnoser(txp, &netstub.FuncDialer{})
+				diagnoser.Rand = r
+				diagnoser.Diagnose(context.Background(), "example.com", dns.TypeA)
+			},
+		},
+
+		{
+			name: "ServiceBrowser",
+			run: func(txp msgTransportStub, r Rand) {
+				browser := NewServiceBrowser(txp)
+				browser.Rand = r
+				browser.LookupServiceTypes(context.Background(), "example.com")
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var ids []uint16
+			tc.run(msgTransportStub{
+				exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+					ids = append(ids, queryMsg.Id)
+					return nil, errors.New("mocked error")
+				},
+			}, NewSeededRand(7))
+			require.NotEmpty(t, ids)
+			assert.Equal(t, randID(NewSeededRand(7)), ids[0])
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+)
+
+// RateLimiter is a token-bucket rate limiter.
+//
+// A [*RateLimiter] is safe for concurrent use and can be shared, for
+// example, by several [*Dialer] instances through a [*DialLimiter].
+//
+// Construct using [NewRateLimiter].
+type RateLimiter struct {
+	// Clock is the [Clock] to use to refill tokens and wait.
+	//
+	// Set by [NewRateLimiter] to [RealClock].
+	Clock Clock
+
+	// burst is the maximum number of tokens.
+	burst float64
+
+	// last is when we last updated tokens or zero if we never did.
+	last time.Time
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// rate is the number of tokens added per second.
+	rate float64
+
+	// tokens is the number of available tokens, which becomes
+	// negative when there are goroutines waiting for tokens.
+	tokens float64
+}
+
+// NewRateLimiter creates a new [*RateLimiter] allowing rate events per second
+// with the given burst. This function panics if rate or burst are not positive.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	runtimex.Assert(rate > 0 && burst > 0)
+	return &RateLimiter{
+		Clock:  RealClock{},
+		burst:  float64(burst),
+		rate:   rate,
+		tokens: float64(burst),
+	}
+}
+
+// Wait blocks until a token is available or the context is done.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	// 1. reserve a token and compute how long we should wait for it
+	delay := rl.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	// 2. wait for the token to become available
+	timer := rl.Clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		rl.unreserve()
+		return ctx.Err()
+	}
+}
+
+// reserve reserves a token and returns how long to wait before using it.
+func (rl *RateLimiter) reserve() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.Clock.Now()
+	if rl.last.IsZero() {
+		rl.last = now
+	}
+	rl.tokens = min(rl.burst, rl.tokens+now.Sub(rl.last).Seconds()*rl.rate)
+	rl.last = now
+	rl.tokens--
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+}
+
+// unreserve returns a previously reserved token.
+func (rl *RateLimiter) unreserve() {
+	rl.mu.Lock()
+	rl.tokens = min(rl.burst, rl.tokens+1)
+	rl.mu.Unlock()
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	rl := NewRateLimiter(100, 1)
+	started := time.Now()
+	for range 3 {
+		require.NoError(t, rl.Wait(context.Background()))
+	}
+	// The first token is immediately available, then we wait 10 ms per token.
+	require.GreaterOrEqual(t, time.Since(started), 15*time.Millisecond)
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := NewRateLimiter(0.001, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for range 4 {
+		require.NoError(t, rl.Wait(ctx))
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	rl := NewRateLimiter(0.001, 1)
+	require.NoError(t, rl.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, rl.Wait(ctx), context.DeadlineExceeded)
+
+	// make sure we returned the reserved token
+	rl.mu.Lock()
+	tokens := rl.tokens
+	rl.mu.Unlock()
+	require.InDelta(t, 0, tokens, 0.01)
+}
+
+func TestNewRateLimiterPanicsWithInvalidArguments(t *testing.T) {
+	require.Panics(t, func() { NewRateLimiter(0, 1) })
+	require.Panics(t, func() { NewRateLimiter(1, 0) })
+}
+
+func TestRateLimiterSimulatedClock(t *testing.T) {
+	clock := NewSimulatedClock(time.Now())
+	rl := NewRateLimiter(1, 1)
+	rl.Clock = clock
+	require.NoError(t, rl.Wait(context.Background()))
+
+	// the second token becomes available only after a second
+	done := make(chan error, 1)
+	go func() { done <- rl.Wait(context.Background()) }()
+	for clock.PendingTimers() <= 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	require.NoError(t, <-done)
+}
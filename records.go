@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// msgLookupRecords queries for the given name and type using the given
+// [DNSMsgTransport] and a query ID obtained from the given [Rand], and
+// returns the valid records having type T or [dnscodec.ErrNoData] if
+// there are none.
+//
+// Unlike [*Resolver], we do not IDNA encode the name, hence we can query
+// names containing underscores (e.g., "_dmarc.example.com").
+func msgLookupRecords[T dns.RR](ctx context.Context, txp DNSMsgTransport,
+	r Rand, timeout time.Duration, name string, qtype uint16) ([]T, error) {
+	// 1. create the query
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(dns.Fqdn(name), qtype)
+	queryMsg.Id = randID(r)
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+
+	// 2. perform the exchange
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	respMsg, err := txp.ExchangeMsg(ctx, queryMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. parse the response and filter the records
+	resp, err := dnscodec.ParseResponse(queryMsg, respMsg)
+	if err != nil {
+		return nil, err
+	}
+	var out []T
+	for _, rr := range resp.ValidRRs {
+		if rr, ok := rr.(T); ok {
+			out = append(out, rr)
+		}
+	}
+	if len(out) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return out, nil
+}
+
+// unescapeCharacterString converts a character string from the presentation format
+// used by [*dns.TXT] and [*dns.NAPTR] (e.g., `\\1` or `\046`) to its wire format (e.g.,
+// `\1` or `.`).
+func unescapeCharacterString(value string) string {
+	var sb strings.Builder
+	for idx := 0; idx < len(value); idx++ {
+		ch := value[idx]
+		switch {
+		case ch != '\\' || idx+1 >= len(value):
+			sb.WriteByte(ch)
+		case idx+3 < len(value) && isDecimalEscape(value[idx+1:idx+4]):
+			d := value[idx+1 : idx+4]
+			sb.WriteByte((d[0]-'0')*100 + (d[1]-'0')*10 + (d[2] - '0'))
+			idx += 3
+		default:
+			sb.WriteByte(value[idx+1])
+			idx++
+		}
+	}
+	return sb.String()
+}
+
+// isDecimalEscape returns whether the given three characters are a decimal escape.
+func isDecimalEscape(s string) bool {
+	return s[0] >= '0' && s[0] <= '2' && s[1] >= '0' && s[1] <= '9' && s[2] >= '0' && s[2] <= '9'
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnescapeCharacterString(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// input is the presentation format string.
+		input string
+
+		// want is the expected wire format string.
+		want string
+	}
+
+	tests := []testCase{
+		{
+			name:  "no escapes",
+			input: "v=spf1 -all",
+			want:  "v=spf1 -all",
+		},
+
+		{
+			name:  "escaped characters",
+			input: `\"quoted\" \\1 \;`,
+			want:  `"quoted" \1 ;`,
+		},
+
+		{
+			name:  "decimal escapes",
+			input: `www\046example\046com\255`,
+			want:  "www.example.com\xff",
+		},
+
+		{
+			name:  "trailing backslash",
+			input: `value\`,
+			want:  `value\`,
+		},
+
+		{
+			name:  "short decimal escape",
+			input: `\04`,
+			want:  `04`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, unescapeCharacterString(tc.input))
+		})
+	}
+}
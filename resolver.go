@@ -5,7 +5,7 @@ package minest
 import (
 	"context"
 	"errors"
-	"sync"
+	"io"
 	"time"
 
 	"github.com/bassosimone/dnscodec"
@@ -21,6 +21,12 @@ type DNSTransport interface {
 	Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error)
 }
 
+// DNSMsgTransport exchanges raw DNS messages without mapping the response
+// code to errors. [*DNSOverUDPTransport] implements this interface.
+type DNSMsgTransport interface {
+	ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error)
+}
+
 // Resolver behaves like [*net.Resolver] but uses a [DNSTransport].
 //
 // Construct using [NewResolver].
@@ -34,14 +40,110 @@ type Resolver struct {
 	//
 	// Set by [NewResolver] to [DefaultResolverTimeout].
 	Timeout time.Duration
+
+	// RateLimiter OPTIONALLY limits the rate of outgoing queries. Share the
+	// same [*RateLimiter] across several resolvers to enforce a common
+	// queries-per-second budget for a given server.
+	RateLimiter *RateLimiter
+
+	// LookupHostPolicy controls how [*Resolver.LookupHost] merges the
+	// A and AAAA lookups (one of [LookupHostAny], [LookupHostBoth], and
+	// [LookupHostFirst]). Unknown values behave like [LookupHostAny].
+	//
+	// Set by [NewResolver] to [LookupHostAny].
+	LookupHostPolicy string
+
+	// AddressFamily controls which address families [*Resolver.LookupHost]
+	// queries for and how it orders the addresses (one of [AddressFamilyAny],
+	// [AddressFamilyIPv4Only], [AddressFamilyIPv6Only], and [AddressFamilyPreferIPv6]).
+	// Unknown values behave like [AddressFamilyAny].
+	//
+	// Set by [NewResolver] to [AddressFamilyAny].
+	AddressFamily string
+
+	// Failover OPTIONALLY decides whether to try the next transport after
+	// a transport failed with the given error. When nil, we try the next
+	// transport after any error, which gives a second opinion on NXDOMAIN
+	// and NODATA responses. Use [FailoverUnlessNotFound] to instead return
+	// these responses immediately, like production stub resolvers do.
+	Failover func(err error) bool
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewResolver] to [GlobalRand].
+	Rand Rand
 }
 
+// FailoverUnlessNotFound is a [*Resolver] Failover policy that tries the next
+// transport after any error except NXDOMAIN and NODATA, which are final.
+func FailoverUnlessNotFound(err error) bool {
+	return !errors.Is(err, dnscodec.ErrNoName) && !errors.Is(err, dnscodec.ErrNoData)
+}
+
+// Policies for merging A and AAAA lookups in [*Resolver.LookupHost].
+const (
+	// LookupHostAny waits for both lookups, joins their addresses, and
+	// only fails when both lookups fail.
+	LookupHostAny = "any"
+
+	// LookupHostBoth waits for both lookups, joins their addresses, and
+	// fails when either lookup fails.
+	LookupHostBoth = "both"
+
+	// LookupHostFirst returns the addresses of the first lookup that
+	// succeeds without waiting for the other one, and only fails when
+	// both lookups fail.
+	LookupHostFirst = "first"
+)
+
+// Address families for [*Resolver.LookupHost].
+const (
+	// AddressFamilyAny queries for A and AAAA and returns the IPv4
+	// addresses before the IPv6 addresses.
+	AddressFamilyAny = "any"
+
+	// AddressFamilyIPv4Only only queries for A.
+	AddressFamilyIPv4Only = "ipv4only"
+
+	// AddressFamilyIPv6Only only queries for AAAA.
+	AddressFamilyIPv6Only = "ipv6only"
+
+	// AddressFamilyPreferIPv6 queries for A and AAAA and returns the
+	// IPv6 addresses before the IPv4 addresses.
+	AddressFamilyPreferIPv6 = "preferipv6"
+)
+
 // NewResolver creactes a new [*Resolver] instance.
 func NewResolver(transport ...DNSTransport) *Resolver {
 	return &Resolver{
-		Transports: transport,
-		Timeout:    DefaultResolverTimeout,
+		Transports:       transport,
+		Timeout:          DefaultResolverTimeout,
+		LookupHostPolicy: LookupHostAny,
+		AddressFamily:    AddressFamilyAny,
+		Rand:             GlobalRand{},
+	}
+}
+
+// Close closes the Transports implementing [io.Closer], such as
+// [*DNSOverUDPMuxTransport] and [*DNSOverStreamTransport], which own
+// sockets outliving a single exchange. Long-running code should call
+// Close when it no longer needs the [*Resolver] to release them.
+//
+// The transports creating a socket for each exchange do not need closing.
+func (r *Resolver) Close() error {
+	var errv []error
+	for _, txp := range r.Transports {
+		errv = append(errv, transportClose(txp))
 	}
+	return errors.Join(errv...)
+}
+
+// transportClose closes the transport if it implements [io.Closer].
+func transportClose(txp any) error {
+	if closer, ok := txp.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 // resolverResponse is an asynchronous DNS response.
@@ -54,47 +156,99 @@ type resolverResponse[T any] struct {
 }
 
 // LookupHost resolves a domain to IPv4 and IPv6 addrs.
+//
+// We perform the A and AAAA lookups in parallel and merge their
+// results according to the LookupHostPolicy. The AddressFamily
+// allows to only perform one lookup or to prefer IPv6.
+//
+// Like the other lookup methods, we fail with a [*net.DNSError]
+// constructed using [NewDNSError].
 func (r *Resolver) LookupHost(ctx context.Context, domain string) ([]string, error) {
-	// prepare for asynchronous lookup
-	ach := make(chan resolverResponse[[]string], 1)
-	aaaach := make(chan resolverResponse[[]string], 1)
-	wg := &sync.WaitGroup{}
-
-	// async lookup A
-	wg.Go(func() {
-		var rr resolverResponse[[]string]
-		rr.Value, rr.Err = r.LookupA(ctx, domain)
-		ach <- rr
-	})
+	addrs, err := r.lookupHost(ctx, domain)
+	if err != nil {
+		return nil, NewDNSError(domain, err)
+	}
+	return addrs, nil
+}
 
-	// async lookup AAAA
-	wg.Go(func() {
-		var rr resolverResponse[[]string]
-		rr.Value, rr.Err = r.LookupAAAA(ctx, domain)
-		aaaach <- rr
-	})
+// lookupHost implements [*Resolver.LookupHost] without wrapping errors.
+func (r *Resolver) lookupHost(ctx context.Context, domain string) ([]string, error) {
+	return resolverLookupHost(ctx, r, domain, r.lookupA, r.lookupAAAA)
+}
 
-	// be patient
-	wg.Wait()
+// resolverLookupHost runs the A and AAAA lookups in parallel and merges
+// their results according to the LookupHostPolicy and AddressFamily.
+func resolverLookupHost[T any](ctx context.Context, r *Resolver, domain string,
+	lookupA, lookupAAAA func(ctx context.Context, domain string) ([]T, error)) ([]T, error) {
+	// 1. handle the single family cases
+	switch r.AddressFamily {
+	case AddressFamilyIPv4Only:
+		return lookupA(ctx, domain)
+	case AddressFamilyIPv6Only:
+		return lookupAAAA(ctx, domain)
+	}
 
-	// read results
-	ares := <-ach
-	aaaares := <-aaaach
+	// 2. start the A and AAAA lookups in parallel
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // interrupts the pending lookup when we return early
+	ach := make(chan resolverResponse[[]T], 1)
+	aaaach := make(chan resolverResponse[[]T], 1)
+	go func() {
+		var rr resolverResponse[[]T]
+		rr.Value, rr.Err = lookupA(ctx, domain)
+		ach <- rr
+	}()
+	go func() {
+		var rr resolverResponse[[]T]
+		rr.Value, rr.Err = lookupAAAA(ctx, domain)
+		aaaach <- rr
+	}()
+
+	// 3. collect the results, possibly returning the first success
+	var ares, aaaares *resolverResponse[[]T]
+	for ares == nil || aaaares == nil {
+		var rr resolverResponse[[]T]
+		select {
+		case rr = <-ach:
+			ares = &rr
+		case rr = <-aaaach:
+			aaaares = &rr
+		}
+		if r.LookupHostPolicy == LookupHostFirst && rr.Err == nil {
+			return rr.Value, nil
+		}
+	}
 
-	// merge errors if both failed
-	if ares.Err != nil && aaaares.Err != nil {
+	// 4. merge the errors according to the policy
+	switch {
+	case ares.Err != nil && aaaares.Err != nil:
+		return nil, errors.Join(ares.Err, aaaares.Err)
+	case r.LookupHostPolicy == LookupHostBoth && (ares.Err != nil || aaaares.Err != nil):
 		return nil, errors.Join(ares.Err, aaaares.Err)
 	}
 
-	// join addresses and deal with no data
-	addrs := append(ares.Value, aaaares.Value...)
+	// 5. join addresses in the order of preference
+	first, second := ares.Value, aaaares.Value
+	if r.AddressFamily == AddressFamilyPreferIPv6 {
+		first, second = second, first
+	}
+	addrs := append(first, second...)
 	runtimex.Assert(len(addrs) >= 1)
 	return addrs, nil
 }
 
 // LookupA resolves a domain to IPv4 addrs.
 func (r *Resolver) LookupA(ctx context.Context, domain string) ([]string, error) {
-	query := dnscodec.NewQuery(domain, dns.TypeA)
+	addrs, err := r.lookupA(ctx, domain)
+	if err != nil {
+		return nil, NewDNSError(domain, err)
+	}
+	return addrs, nil
+}
+
+// lookupA implements [*Resolver.LookupA] without wrapping errors.
+func (r *Resolver) lookupA(ctx context.Context, domain string) ([]string, error) {
+	query := r.newQuery(domain, dns.TypeA)
 	resp, err := r.lookup(ctx, query)
 	if err != nil {
 		return nil, err
@@ -104,7 +258,16 @@ func (r *Resolver) LookupA(ctx context.Context, domain string) ([]string, error)
 
 // LookupAAAA resolves a domain to IPv6 addrs.
 func (r *Resolver) LookupAAAA(ctx context.Context, domain string) ([]string, error) {
-	query := dnscodec.NewQuery(domain, dns.TypeAAAA)
+	addrs, err := r.lookupAAAA(ctx, domain)
+	if err != nil {
+		return nil, NewDNSError(domain, err)
+	}
+	return addrs, nil
+}
+
+// lookupAAAA implements [*Resolver.LookupAAAA] without wrapping errors.
+func (r *Resolver) lookupAAAA(ctx context.Context, domain string) ([]string, error) {
+	query := r.newQuery(domain, dns.TypeAAAA)
 	resp, err := r.lookup(ctx, query)
 	if err != nil {
 		return nil, err
@@ -114,24 +277,158 @@ func (r *Resolver) LookupAAAA(ctx context.Context, domain string) ([]string, err
 
 // LookupCNAME resolves a domain to its CNAME.
 func (r *Resolver) LookupCNAME(ctx context.Context, domain string) (string, error) {
-	query := dnscodec.NewQuery(domain, dns.TypeCNAME)
+	query := r.newQuery(domain, dns.TypeCNAME)
 	resp, err := r.lookup(ctx, query)
 	if err != nil {
-		return "", err
+		return "", NewDNSError(domain, err)
 	}
 	cnames, err := resp.RecordsCNAME()
 	if err != nil {
-		return "", err
+		return "", NewDNSError(domain, err)
 	}
 	runtimex.Assert(len(cnames) > 0)
 	return cnames[0], nil
 }
 
+// LookupHTTPS resolves a domain to its HTTPS records (RFC 9460).
+//
+// Names with a port prefix (e.g., _8443._https.example.com) contain underscores,
+// hence we need transports implementing [DNSMsgTransport] for them.
+func (r *Resolver) LookupHTTPS(ctx context.Context, domain string) ([]*dns.HTTPS, error) {
+	return resolverLookupServiceRecords[*dns.HTTPS](ctx, r, domain, dns.TypeHTTPS)
+}
+
+// LookupCAA resolves a domain to its CAA records (RFC 8659).
+//
+// We return the records of the queried name only: like the CAs, the caller
+// should climb the domain tree when there are no records.
+func (r *Resolver) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	return resolverLookupRecords[*dns.CAA](ctx, r, domain, dns.TypeCAA)
+}
+
+// LookupRR resolves a domain to the valid records of the given query type,
+// which allows measuring types without a dedicated method (e.g., LOC, SSHFP,
+// and DNSKEY). We omit the CNAME records leading to the records unless the
+// query type is CNAME or ANY, and we fail with [dnscodec.ErrNoData] when
+// there are no records. Since names such as TLSA names contain underscores,
+// we need transports implementing [DNSMsgTransport] to query for them.
+func (r *Resolver) LookupRR(ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	rrs, err := resolverLookupServiceRecords[dns.RR](ctx, r, domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if qtype == dns.TypeANY {
+		return rrs, nil
+	}
+	var out []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qtype {
+			out = append(out, rr)
+		}
+	}
+	if len(out) <= 0 {
+		return nil, NewDNSError(domain, dnscodec.ErrNoData)
+	}
+	return out, nil
+}
+
+// resolverLookupRecords queries for the given name and type and returns the
+// valid records having type T or [dnscodec.ErrNoData] if there are none,
+// wrapping errors using [NewDNSError].
+func resolverLookupRecords[T dns.RR](ctx context.Context, r *Resolver, name string, qtype uint16) ([]T, error) {
+	query := r.newQuery(name, qtype)
+	resp, err := r.lookup(ctx, query)
+	if err != nil {
+		return nil, NewDNSError(name, err)
+	}
+	return resolverRecords[T](name, resp)
+}
+
+// resolverLookupServiceRecords is like resolverLookupRecords but uses
+// resolverExchangeMsg, which allows querying names containing underscores.
+func resolverLookupServiceRecords[T dns.RR](ctx context.Context, r *Resolver, name string, qtype uint16) ([]T, error) {
+	query := r.newQuery(name, qtype)
+	resp, _, err := r.lookupWith(ctx, query, resolverExchangeMsg)
+	if err != nil {
+		return nil, NewDNSError(name, err)
+	}
+	return resolverRecords[T](name, resp)
+}
+
+// resolverRecords returns the valid records having type T or [dnscodec.ErrNoData]
+// if there are none, wrapping errors using [NewDNSError].
+func resolverRecords[T dns.RR](name string, resp *dnscodec.Response) ([]T, error) {
+	var out []T
+	for _, rr := range resp.ValidRRs {
+		if rr, ok := rr.(T); ok {
+			out = append(out, rr)
+		}
+	}
+	if len(out) <= 0 {
+		return nil, NewDNSError(name, dnscodec.ErrNoData)
+	}
+	return out, nil
+}
+
+// newQuery creates a new query using an ID obtained from Rand.
+func (r *Resolver) newQuery(name string, qtype uint16) *dnscodec.Query {
+	query := dnscodec.NewQuery(name, qtype)
+	query.ID = randID(r.Rand)
+	return query
+}
+
 // lookup is the function performing the actual lookup.
 func (r *Resolver) lookup(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	resp, _, err := r.lookupTransport(ctx, query)
+	return resp, err
+}
+
+// lookupTransport is like lookup but also returns the index within
+// Transports of the transport that answered.
+func (r *Resolver) lookupTransport(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, int, error) {
+	return r.lookupWith(ctx, query, resolverExchange)
+}
+
+// resolverExchange exchanges the query using [DNSTransport].
+func resolverExchange(ctx context.Context, txp DNSTransport, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return txp.Exchange(ctx, query)
+}
+
+// resolverExchangeMsg exchanges the query using [DNSMsgTransport], when the transport
+// implements it, creating the query message using resolverNewMsg. Otherwise, we use
+// [DNSTransport], which fails for names containing underscores.
+func resolverExchangeMsg(ctx context.Context, txp DNSTransport, query *dnscodec.Query) (*dnscodec.Response, error) {
+	mtxp, ok := txp.(DNSMsgTransport)
+	if !ok {
+		return txp.Exchange(ctx, query)
+	}
+	queryMsg := resolverNewMsg(query)
+	respMsg, err := mtxp.ExchangeMsg(ctx, queryMsg)
+	if err != nil {
+		return nil, err
+	}
+	return dnscodec.ParseResponse(queryMsg, respMsg)
+}
+
+// resolverNewMsg is like [*dnscodec.Query.NewMsg] but does not IDNA encode the
+// name, which rejects the underscore labels used by service records such as SRV,
+// and ignores [dnscodec.QueryFlagBlockLengthPadding].
+func resolverNewMsg(query *dnscodec.Query) *dns.Msg {
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(dns.Fqdn(query.Name), query.Type)
+	queryMsg.Id = query.ID
+	queryMsg.SetEdns0(query.MaxSize, query.Flags&dnscodec.QueryFlagDNSSec != 0)
+	return queryMsg
+}
+
+// lookupWith is like lookupTransport but uses the given function to
+// exchange the query with each transport.
+func (r *Resolver) lookupWith(ctx context.Context, query *dnscodec.Query,
+	exchange func(ctx context.Context, txp DNSTransport, query *dnscodec.Query) (*dnscodec.Response, error),
+) (*dnscodec.Response, int, error) {
 	// Handle the case where there are no transports
 	if len(r.Transports) <= 0 {
-		return nil, errors.New("no configured transport")
+		return nil, 0, errors.New("no configured transport")
 	}
 
 	// Honour the configured lookup timeout
@@ -140,20 +437,29 @@ func (r *Resolver) lookup(ctx context.Context, query *dnscodec.Query) (*dnscodec
 
 	// Try with each transport
 	errv := make([]error, 0, len(r.Transports))
-	for _, exc := range r.Transports {
+	for idx, exc := range r.Transports {
 		if ctx.Err() != nil {
 			errv = append(errv, ctx.Err())
 			break
 		}
-		resp, err := exc.Exchange(ctx, query)
+		if r.RateLimiter != nil {
+			if err := r.RateLimiter.Wait(ctx); err != nil {
+				errv = append(errv, err)
+				break
+			}
+		}
+		resp, err := exchange(ctx, exc, query)
 		if err != nil {
 			errv = append(errv, err)
+			if r.Failover != nil && !r.Failover(err) {
+				break
+			}
 			continue
 		}
-		return resp, nil
+		return resp, idx, nil
 	}
 
 	// Assemble a composed error
 	runtimex.Assert(len(errv) >= 1)
-	return nil, errors.Join(errv...)
+	return nil, 0, errors.Join(errv...)
 }
@@ -4,24 +4,44 @@ package minest
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/netip"
 	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/dnstest"
+	"github.com/bassosimone/runtimex"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// newUDPServer creates a UDP test server listening at the given address.
+//
+// We wait for the server to answer a query before returning, since closing
+// a server that has not started serving yet causes a panic.
+func newUDPServer(t *testing.T, address string, handler *dnstest.Handler) *dnstest.UDPServer {
+	t.Helper()
+
+	server := dnstest.MustNewUDPServer(&net.ListenConfig{}, address, handler)
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	_, _, err := (&dns.Client{Timeout: 5 * time.Second}).Exchange(query, server.Address())
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
 // newResolver creates a resolver backed by a UDP test server.
 func newResolver(t *testing.T, handler *dnstest.Handler) *Resolver {
 	t.Helper()
 
-	server := dnstest.MustNewUDPServer(&net.ListenConfig{}, "127.0.0.1:0", handler)
-	t.Cleanup(server.Close)
+	server := newUDPServer(t, "127.0.0.1:0", handler)
 
 	endpoint, err := netip.ParseAddrPort(server.Address())
 	require.NoError(t, err)
@@ -68,6 +88,76 @@ func (ts transportStub) Exchange(ctx context.Context, query *dnscodec.Query) (*d
 	return ts.exchange(ctx, query)
 }
 
+// newRecordsTransport returns a [DNSTransport] answering queries for the given
+// type using the given records and failing for any other query type.
+func newRecordsTransport(qtype uint16, records ...string) DNSTransport {
+	return transportStub{exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		if query.Type != qtype {
+			return nil, errors.New("unexpected query type")
+		}
+		queryMsg := runtimex.PanicOnError1(query.NewMsg())
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		for _, record := range records {
+			respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+		}
+		return dnscodec.ParseResponse(queryMsg, respMsg)
+	}}
+}
+
+// newRecordsResolver returns a [*Resolver] answering using the given records
+// whose type matches the query type.
+func newRecordsResolver(records ...string) *Resolver {
+	// newResponse returns the response message for the query message.
+	newResponse := func(queryMsg *dns.Msg) *dns.Msg {
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		for _, record := range records {
+			rr := runtimex.PanicOnError1(dns.NewRR(record))
+			if rr.Header().Rrtype == queryMsg.Question[0].Qtype {
+				respMsg.Answer = append(respMsg.Answer, rr)
+			}
+		}
+		return respMsg
+	}
+	return NewResolver(bothTransportStub{
+		transportStub: transportStub{
+			exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+				queryMsg := runtimex.PanicOnError1(query.NewMsg())
+				return dnscodec.ParseResponse(queryMsg, newResponse(queryMsg))
+			},
+		},
+		msgTransportStub: msgTransportStub{
+			exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+				return newResponse(queryMsg), nil
+			},
+		},
+	})
+}
+
+// bothTransportStub implements both [DNSTransport] and [DNSMsgTransport].
+type bothTransportStub struct {
+	transportStub
+	msgTransportStub
+}
+
+type closerTransportStub struct {
+	transportStub
+	close func() error
+}
+
+func (ts closerTransportStub) Close() error {
+	return ts.close()
+}
+
+type msgTransportStub struct {
+	exchangeMsg func(context.Context, *dns.Msg) (*dns.Msg, error)
+}
+
+func (ts msgTransportStub) ExchangeMsg(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+	return ts.exchangeMsg(ctx, queryMsg)
+}
+
 func TestResolverLookupSuccess(t *testing.T) {
 
 	type testCase struct {
@@ -181,7 +271,10 @@ func TestResolverLookupNXDOMAIN(t *testing.T) {
 			config := dnstest.NewHandlerConfig()
 			reso := newResolver(t, dnstest.NewHandler(config))
 			got, err := tc.lookup(reso, context.Background())
-			require.Error(t, err)
+			require.ErrorIs(t, err, dnscodec.ErrNoName)
+			var derr *net.DNSError
+			require.ErrorAs(t, err, &derr)
+			assert.True(t, derr.IsNotFound)
 			assert.Empty(t, got)
 		})
 	}
@@ -234,6 +327,9 @@ func TestResolverLookupNoAnswer(t *testing.T) {
 			got, err := tc.lookup(reso, context.Background())
 			require.Error(t, err)
 			assert.ErrorIs(t, err, dnscodec.ErrNoData)
+			var derr *net.DNSError
+			require.ErrorAs(t, err, &derr)
+			assert.True(t, derr.IsNotFound)
 			assert.Empty(t, got)
 		})
 	}
@@ -293,3 +389,419 @@ func TestResolverLookupCNAMEWithOnlyARecords(t *testing.T) {
 	require.ErrorIs(t, err, dnscodec.ErrNoData)
 	assert.Empty(t, cname)
 }
+
+func TestResolverRateLimiter(t *testing.T) {
+	var count int
+	reso := NewResolver(transportStub{
+		exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+			count++
+			return nil, errors.New("exchange failed")
+		},
+	})
+	reso.RateLimiter = NewRateLimiter(1, 1)
+
+	// the first query consumes the only available token
+	_, err := reso.LookupA(context.Background(), "example.com")
+	require.Error(t, err)
+	require.Equal(t, 1, count)
+
+	// the second query must wait for a token and the context expires first
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = reso.LookupA(ctx, "example.com")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, count)
+}
+
+func TestResolverLookupHostPolicy(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// policy is the LookupHostPolicy to use.
+		policy string
+
+		// behavior maps the query type to "answer", "fail", or "block".
+		behavior map[uint16]string
+
+		// wantAddrs contains the expected addresses.
+		wantAddrs []string
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	tests := []testCase{
+		{
+			name:      "any with a failing family",
+			policy:    LookupHostAny,
+			behavior:  map[uint16]string{dns.TypeA: "answer", dns.TypeAAAA: "fail"},
+			wantAddrs: []string{"192.0.2.1"},
+		},
+
+		{
+			name:     "any with both families failing",
+			policy:   LookupHostAny,
+			behavior: map[uint16]string{dns.TypeA: "fail", dns.TypeAAAA: "fail"},
+			wantErr:  true,
+		},
+
+		{
+			name:      "both with both families answering",
+			policy:    LookupHostBoth,
+			behavior:  map[uint16]string{dns.TypeA: "answer", dns.TypeAAAA: "answer"},
+			wantAddrs: []string{"192.0.2.1", "2001:db8::1"},
+		},
+
+		{
+			name:     "both with a failing family",
+			policy:   LookupHostBoth,
+			behavior: map[uint16]string{dns.TypeA: "answer", dns.TypeAAAA: "fail"},
+			wantErr:  true,
+		},
+
+		{
+			name:      "first does not wait for the other family",
+			policy:    LookupHostFirst,
+			behavior:  map[uint16]string{dns.TypeA: "answer", dns.TypeAAAA: "block"},
+			wantAddrs: []string{"192.0.2.1"},
+		},
+
+		{
+			name:      "first skips a failing family",
+			policy:    LookupHostFirst,
+			behavior:  map[uint16]string{dns.TypeA: "fail", dns.TypeAAAA: "answer"},
+			wantAddrs: []string{"2001:db8::1"},
+		},
+
+		{
+			name:     "first with both families failing",
+			policy:   LookupHostFirst,
+			behavior: map[uint16]string{dns.TypeA: "fail", dns.TypeAAAA: "fail"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reso := NewResolver(transportStub{
+				exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+					switch tc.behavior[query.Type] {
+					case "fail":
+						return nil, errors.New("mocked error")
+					case "block":
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					queryMsg := runtimex.PanicOnError1(query.NewMsg())
+					respMsg := new(dns.Msg)
+					respMsg.SetReply(queryMsg)
+					record := "example.com. 300 IN A 192.0.2.1"
+					if query.Type == dns.TypeAAAA {
+						record = "example.com. 300 IN AAAA 2001:db8::1"
+					}
+					respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(record)))
+					return dnscodec.ParseResponse(queryMsg, respMsg)
+				},
+			})
+			assert.Equal(t, LookupHostAny, reso.LookupHostPolicy)
+			reso.LookupHostPolicy = tc.policy
+
+			addrs, err := reso.LookupHost(context.Background(), "example.com")
+			if tc.wantErr {
+				require.Error(t, err)
+				require.Nil(t, addrs)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantAddrs, addrs)
+		})
+	}
+}
+
+func TestResolverFailover(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// failover is the Failover policy to use.
+		failover func(err error) bool
+
+		// err is the error returned by the first transport.
+		err error
+
+		// wantSecond indicates whether we expect to use the second transport.
+		wantSecond bool
+	}
+
+	tests := []testCase{
+		{
+			name:       "default policy with NXDOMAIN",
+			failover:   nil,
+			err:        dnscodec.ErrNoName,
+			wantSecond: true,
+		},
+
+		{
+			name:       "FailoverUnlessNotFound with NXDOMAIN",
+			failover:   FailoverUnlessNotFound,
+			err:        dnscodec.ErrNoName,
+			wantSecond: false,
+		},
+
+		{
+			name:       "FailoverUnlessNotFound with NODATA",
+			failover:   FailoverUnlessNotFound,
+			err:        dnscodec.ErrNoData,
+			wantSecond: false,
+		},
+
+		{
+			name:       "FailoverUnlessNotFound with SERVFAIL",
+			failover:   FailoverUnlessNotFound,
+			err:        dnscodec.ErrServerTemporarilyMisbehaving,
+			wantSecond: true,
+		},
+
+		{
+			name:       "FailoverUnlessNotFound with timeout",
+			failover:   FailoverUnlessNotFound,
+			err:        context.DeadlineExceeded,
+			wantSecond: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var second bool
+			reso := NewResolver(
+				transportStub{exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+					return nil, tc.err
+				}},
+				transportStub{exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+					second = true
+					return nil, errors.New("mocked error")
+				}},
+			)
+			reso.Failover = tc.failover
+
+			_, err := reso.LookupA(context.Background(), "example.com")
+			require.ErrorIs(t, err, tc.err)
+			require.Equal(t, tc.wantSecond, second)
+		})
+	}
+}
+
+func TestResolverClose(t *testing.T) {
+	var closed int
+	expectedErr := errors.New("mocked error")
+	reso := NewResolver(
+		closerTransportStub{close: func() error {
+			closed++
+			return nil
+		}},
+		transportStub{},
+		closerTransportStub{close: func() error {
+			closed++
+			return expectedErr
+		}},
+	)
+	require.ErrorIs(t, reso.Close(), expectedErr)
+	assert.Equal(t, 2, closed)
+
+	require.NoError(t, NewResolver(transportStub{}).Close())
+}
+
+func TestResolverLookupCAA(t *testing.T) {
+	reso := newRecordsResolver(
+		`example.com. 300 IN CAA 0 issue "letsencrypt.org"`,
+		`example.com. 300 IN CAA 128 iodef "mailto:security@example.com"`,
+	)
+	records, err := reso.LookupCAA(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, uint8(0), records[0].Flag)
+	assert.Equal(t, "issue", records[0].Tag)
+	assert.Equal(t, "letsencrypt.org", records[0].Value)
+	assert.Equal(t, uint8(128), records[1].Flag)
+	assert.Equal(t, "iodef", records[1].Tag)
+
+	records, err = newRecordsResolver().LookupCAA(context.Background(), "example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, records)
+}
+
+func TestResolverLookupRR(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// domain is the domain to query.
+		domain string
+
+		// qtype is the query type.
+		qtype uint16
+
+		// want contains the expected owner names and types.
+		want []string
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:   "SSHFP records",
+			domain: "host.example.com",
+			qtype:  dns.TypeSSHFP,
+			want:   []string{"host.example.com. SSHFP"},
+		},
+
+		{
+			name:   "TLSA records with underscores",
+			domain: "_443._tcp.example.com",
+			qtype:  dns.TypeTLSA,
+			want:   []string{"_443._tcp.example.com. TLSA"},
+		},
+
+		{
+			name:   "omits the CNAME chain",
+			domain: "www.example.com",
+			qtype:  dns.TypeLOC,
+			want:   []string{"example.com. LOC"},
+		},
+
+		{
+			name:   "returns the CNAME when querying for it",
+			domain: "www.example.com",
+			qtype:  dns.TypeCNAME,
+			want:   []string{"www.example.com. CNAME"},
+		},
+
+		{
+			name:    "fails with only the CNAME chain",
+			domain:  "www.example.com",
+			qtype:   dns.TypeSSHFP,
+			wantErr: dnscodec.ErrNoData,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reso := NewResolver(bothTransportStub{
+				msgTransportStub: msgTransportStub{
+					exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+						respMsg := new(dns.Msg)
+						respMsg.SetReply(queryMsg)
+						for _, record := range []string{
+							"www.example.com. 300 IN CNAME example.com.",
+							"example.com. 300 IN LOC 51 30 12.748 N 00 07 39.611 W 0m 0m 0m 0m",
+							"host.example.com. 300 IN SSHFP 4 2 123456789abcdef67890123456789abcdef67890123456789abcdef123456789a",
+							"_443._tcp.example.com. 300 IN TLSA 3 1 1 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+						} {
+							rr := runtimex.PanicOnError1(dns.NewRR(record))
+							if dns.CanonicalName(rr.Header().Name) == queryMsg.Question[0].Name ||
+								rr.Header().Rrtype == dns.TypeLOC {
+								respMsg.Answer = append(respMsg.Answer, rr)
+							}
+						}
+						return respMsg, nil
+					},
+				},
+			})
+
+			rrs, err := reso.LookupRR(context.Background(), tc.domain, tc.qtype)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, rrs)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, rr := range rrs {
+				got = append(got, rr.Header().Name+" "+dns.TypeToString[rr.Header().Rrtype])
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestResolverAddressFamily(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// family is the AddressFamily to use.
+		family string
+
+		// wantQueries contains the expected query types.
+		wantQueries []uint16
+
+		// wantAddrs contains the expected addresses.
+		wantAddrs []string
+	}
+
+	tests := []testCase{
+		{
+			name:        "any",
+			family:      AddressFamilyAny,
+			wantQueries: []uint16{dns.TypeA, dns.TypeAAAA},
+			wantAddrs:   []string{"192.0.2.1", "2001:db8::1"},
+		},
+
+		{
+			name:        "IPv4 only",
+			family:      AddressFamilyIPv4Only,
+			wantQueries: []uint16{dns.TypeA},
+			wantAddrs:   []string{"192.0.2.1"},
+		},
+
+		{
+			name:        "IPv6 only",
+			family:      AddressFamilyIPv6Only,
+			wantQueries: []uint16{dns.TypeAAAA},
+			wantAddrs:   []string{"2001:db8::1"},
+		},
+
+		{
+			name:        "prefer IPv6",
+			family:      AddressFamilyPreferIPv6,
+			wantQueries: []uint16{dns.TypeA, dns.TypeAAAA},
+			wantAddrs:   []string{"2001:db8::1", "192.0.2.1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				queries []uint16
+			)
+			reso := newRecordsResolver("example.com. 300 IN A 192.0.2.1", "example.com. 300 IN AAAA 2001:db8::1")
+			txp := reso.Transports[0].(bothTransportStub)
+			reso.Transports[0] = transportStub{
+				exchange: func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+					mu.Lock()
+					queries = append(queries, query.Type)
+					mu.Unlock()
+					return txp.Exchange(ctx, query)
+				},
+			}
+			assert.Equal(t, AddressFamilyAny, reso.AddressFamily)
+			reso.AddressFamily = tc.family
+
+			addrs, err := reso.LookupHost(context.Background(), "example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantAddrs, addrs)
+			assert.ElementsMatch(t, tc.wantQueries, queries)
+
+			hostAddrs, err := reso.LookupHostExtended(context.Background(), "example.com")
+			require.NoError(t, err)
+			var got []string
+			for _, addr := range hostAddrs {
+				got = append(got, addr.Address.String())
+			}
+			assert.Equal(t, tc.wantAddrs, got)
+		})
+	}
+}
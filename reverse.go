@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ReverseName returns the fully qualified in-addr.arpa name of an IPv4 address
+// or ip6.arpa name of an IPv6 address for querying the PTR records. We treat
+// IPv4-mapped IPv6 addresses as IPv4 addresses and ignore the IPv6 zone.
+//
+// The address MUST be valid, i.e., not the zero [netip.Addr].
+func ReverseName(addr netip.Addr) string {
+	var builder strings.Builder
+	addr = addr.Unmap()
+	if addr.Is4() {
+		raw := addr.As4()
+		for idx := len(raw) - 1; idx >= 0; idx-- {
+			builder.WriteString(strconv.Itoa(int(raw[idx])))
+			builder.WriteByte('.')
+		}
+		builder.WriteString("in-addr.arpa.")
+		return builder.String()
+	}
+	const hexdigits = "0123456789abcdef"
+	raw := addr.As16()
+	for idx := len(raw) - 1; idx >= 0; idx-- {
+		builder.WriteByte(hexdigits[raw[idx]&0x0f])
+		builder.WriteByte('.')
+		builder.WriteByte(hexdigits[raw[idx]>>4])
+		builder.WriteByte('.')
+	}
+	builder.WriteString("ip6.arpa.")
+	return builder.String()
+}
+
+// LookupAddr performs a reverse lookup of the given IPv4 or IPv6 address
+// and returns the names obtained from the PTR records.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	address, err := netip.ParseAddr(addr)
+	if err != nil {
+		return nil, NewDNSError(addr, err)
+	}
+	ptrs, err := resolverLookupRecords[*dns.PTR](ctx, r, ReverseName(address), dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(ptrs))
+	for _, ptr := range ptrs {
+		names = append(names, ptr.Ptr)
+	}
+	return names, nil
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseName(t *testing.T) {
+	type testCase struct {
+		// addr is the address to reverse.
+		addr string
+
+		// want is the expected name.
+		want string
+	}
+
+	tests := []testCase{
+		{addr: "192.0.2.1", want: "1.2.0.192.in-addr.arpa."},
+		{addr: "::ffff:192.0.2.1", want: "1.2.0.192.in-addr.arpa."},
+		{addr: "2001:db8::1", want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{addr: "fe80::1%eth0", want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa."},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			assert.Equal(t, tc.want, ReverseName(netip.MustParseAddr(tc.addr)))
+			if addr := netip.MustParseAddr(tc.addr); addr.Zone() == "" {
+				expect, err := dns.ReverseAddr(tc.addr)
+				require.NoError(t, err)
+				assert.Equal(t, expect, ReverseName(addr))
+			}
+		})
+	}
+}
+
+func TestResolverLookupAddr(t *testing.T) {
+	reso := newRecordsResolver(
+		"1.2.0.192.in-addr.arpa. 300 IN PTR a.example.com.",
+		"1.2.0.192.in-addr.arpa. 300 IN PTR b.example.com.",
+	)
+	names, err := reso.LookupAddr(context.Background(), "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com.", "b.example.com."}, names)
+
+	names, err = reso.LookupAddr(context.Background(), "192.0.2.2")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, names)
+
+	names, err = reso.LookupAddr(context.Background(), "invalid")
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+	assert.Equal(t, "invalid", dnsErr.Name)
+	assert.Nil(t, names)
+}
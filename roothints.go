@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidRootHints indicates that the root hints do not contain any root server.
+var ErrInvalidRootHints = errors.New("invalid root hints")
+
+// defaultNamedRoot contains the built-in root hints using the named.root format.
+const defaultNamedRoot = `
+.                        3600000      NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+A.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:ba3e::2:30
+.                        3600000      NS    B.ROOT-SERVERS.NET.
+B.ROOT-SERVERS.NET.      3600000      A     170.247.170.2
+B.ROOT-SERVERS.NET.      3600000      AAAA  2801:1b8:10::b
+.                        3600000      NS    C.ROOT-SERVERS.NET.
+C.ROOT-SERVERS.NET.      3600000      A     192.33.4.12
+C.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:2::c
+.                        3600000      NS    D.ROOT-SERVERS.NET.
+D.ROOT-SERVERS.NET.      3600000      A     199.7.91.13
+D.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:2d::d
+.                        3600000      NS    E.ROOT-SERVERS.NET.
+E.ROOT-SERVERS.NET.      3600000      A     192.203.230.10
+E.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:a8::e
+.                        3600000      NS    F.ROOT-SERVERS.NET.
+F.ROOT-SERVERS.NET.      3600000      A     192.5.5.241
+F.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:2f::f
+.                        3600000      NS    G.ROOT-SERVERS.NET.
+G.ROOT-SERVERS.NET.      3600000      A     192.112.36.4
+G.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:12::d0d
+.                        3600000      NS    H.ROOT-SERVERS.NET.
+H.ROOT-SERVERS.NET.      3600000      A     198.97.190.53
+H.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:1::53
+.                        3600000      NS    I.ROOT-SERVERS.NET.
+I.ROOT-SERVERS.NET.      3600000      A     192.36.148.17
+I.ROOT-SERVERS.NET.      3600000      AAAA  2001:7fe::53
+.                        3600000      NS    J.ROOT-SERVERS.NET.
+J.ROOT-SERVERS.NET.      3600000      A     192.58.128.30
+J.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:c27::2:30
+.                        3600000      NS    K.ROOT-SERVERS.NET.
+K.ROOT-SERVERS.NET.      3600000      A     193.0.14.129
+K.ROOT-SERVERS.NET.      3600000      AAAA  2001:7fd::1
+.                        3600000      NS    L.ROOT-SERVERS.NET.
+L.ROOT-SERVERS.NET.      3600000      A     199.7.83.42
+L.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:9f::42
+.                        3600000      NS    M.ROOT-SERVERS.NET.
+M.ROOT-SERVERS.NET.      3600000      A     202.12.27.33
+M.ROOT-SERVERS.NET.      3600000      AAAA  2001:dc3::35
+`
+
+// RootHint describes a root server.
+type RootHint struct {
+	// Name is the lowercase name of the root server (e.g., "a.root-servers.net.").
+	Name string
+
+	// Addrs contains the IPv4 and IPv6 addresses of the root server.
+	Addrs []netip.Addr
+}
+
+// RootHints contains the root servers.
+type RootHints []*RootHint
+
+// DefaultRootHints returns the built-in root hints.
+func DefaultRootHints() RootHints {
+	return runtimex.PanicOnError1(ParseRootHints(strings.NewReader(defaultNamedRoot)))
+}
+
+// ParseRootHints parses root hints using the named.root format.
+//
+// We return the root servers in the order of the NS records, ignoring
+// the addresses of names that are not root servers.
+func ParseRootHints(r io.Reader) (RootHints, error) {
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(r, ".", "named.root")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	return newRootHints(rrs)
+}
+
+// newRootHints creates [RootHints] from the root NS records and the
+// corresponding A and AAAA records.
+func newRootHints(rrs []dns.RR) (RootHints, error) {
+	// 1. collect the root server names and their addresses
+	var (
+		hints RootHints
+		addrs = make(map[string][]netip.Addr)
+	)
+	for _, rr := range rrs {
+		owner := dns.CanonicalName(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.NS:
+			if owner == "." {
+				hints = append(hints, &RootHint{Name: dns.CanonicalName(rr.Ns)})
+			}
+		case *dns.A:
+			if addr, ok := netip.AddrFromSlice(rr.A); ok {
+				addrs[owner] = append(addrs[owner], addr.Unmap())
+			}
+		case *dns.AAAA:
+			if addr, ok := netip.AddrFromSlice(rr.AAAA); ok {
+				addrs[owner] = append(addrs[owner], addr)
+			}
+		}
+	}
+
+	// 2. associate the addresses with the root servers
+	for _, hint := range hints {
+		hint.Addrs = addrs[hint.Name]
+	}
+	if len(hints) <= 0 {
+		return nil, ErrInvalidRootHints
+	}
+	return hints, nil
+}
+
+// IPv4 returns the IPv4 addresses of the root servers.
+func (h RootHints) IPv4() []netip.Addr {
+	return h.addrs(netip.Addr.Is4)
+}
+
+// IPv6 returns the IPv6 addresses of the root servers.
+func (h RootHints) IPv6() []netip.Addr {
+	return h.addrs(netip.Addr.Is6)
+}
+
+// addrs returns the addresses of the root servers matching the given filter.
+func (h RootHints) addrs(filter func(netip.Addr) bool) []netip.Addr {
+	var addrs []netip.Addr
+	for _, hint := range h {
+		for _, addr := range hint.Addrs {
+			if filter(addr) {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// RootPrimer performs priming queries (RFC 8109) to obtain the current
+// list of root servers, which also measures the root servers reachability.
+//
+// We query the hints addresses in order until one of them answers. Shuffle
+// the hints to distribute the queries, as RFC 8109 recommends.
+//
+// Construct using [NewRootPrimer].
+type RootPrimer struct {
+	// Hints contains the root servers to query.
+	//
+	// Set by [NewRootPrimer] to [DefaultRootHints].
+	Hints RootHints
+
+	// NewTransport creates the [DNSMsgTransport] to use to query the
+	// root server with the given address.
+	//
+	// Set by [NewRootPrimer] to a function creating a
+	// [*DNSOverUDPTransport] for port 53 using the given dialer.
+	NewTransport func(addr netip.Addr) DNSMsgTransport
+
+	// Filter OPTIONALLY selects the addresses to query (e.g., [netip.Addr.Is4]).
+	Filter func(addr netip.Addr) bool
+
+	// Timeout is the timeout of each priming query.
+	//
+	// Set by [NewRootPrimer] to 5 seconds.
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewRootPrimer] to [GlobalRand].
+	Rand Rand
+}
+
+// RootPrimingAttempt is a priming query sent by [*RootPrimer].
+type RootPrimingAttempt struct {
+	// Server is the root server address.
+	Server netip.Addr
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Started is when we started the attempt.
+	Started time.Time
+
+	// Elapsed is the time elapsed since Started.
+	Elapsed time.Duration
+}
+
+// RootPriming is the result of [*RootPrimer.Prime].
+type RootPriming struct {
+	// Attempts contains the priming queries we sent in order.
+	Attempts []*RootPrimingAttempt
+
+	// Response is the priming response or nil.
+	Response *dns.Msg
+
+	// Hints contains the root servers listed by the priming response or nil.
+	Hints RootHints
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+}
+
+// NewRootPrimer creates a new [*RootPrimer].
+func NewRootPrimer(dialer NetDialer) *RootPrimer {
+	return &RootPrimer{
+		Hints: DefaultRootHints(),
+		NewTransport: func(addr netip.Addr) DNSMsgTransport {
+			return NewDNSOverUDPTransport(dialer, netip.AddrPortFrom(addr, 53))
+		},
+		Timeout: 5 * time.Second,
+		Rand:    GlobalRand{},
+	}
+}
+
+// Prime sends priming queries until a root server answers.
+func (rp *RootPrimer) Prime(ctx context.Context) *RootPriming {
+	priming := &RootPriming{Err: ErrInvalidRootHints}
+	for _, addr := range rp.Hints.addrs(func(addr netip.Addr) bool { return rp.Filter == nil || rp.Filter(addr) }) {
+		respMsg, err := rp.attempt(ctx, priming, addr)
+		priming.Err = err
+		if err != nil {
+			continue
+		}
+		priming.Response = respMsg
+		priming.Hints, priming.Err = newRootHints(append(slices.Clone(respMsg.Answer), respMsg.Extra...))
+		break
+	}
+	priming.Failure = ClassifyError(priming.Err)
+	return priming
+}
+
+// attempt sends a priming query to the given address and records the attempt.
+func (rp *RootPrimer) attempt(ctx context.Context, priming *RootPriming, addr netip.Addr) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, rp.Timeout)
+	defer cancel()
+
+	// 1. create the priming query (RFC 8109 Section 3.1)
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(".", dns.TypeNS)
+	queryMsg.Id = randID(rp.Rand)
+	queryMsg.RecursionDesired = false
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, false)
+
+	// 2. perform the exchange and validate the response
+	attempt := &RootPrimingAttempt{Server: addr, Started: time.Now()}
+	respMsg, err := rp.NewTransport(addr).ExchangeMsg(ctx, queryMsg)
+	if err == nil && (respMsg.Rcode != dns.RcodeSuccess || !respMsg.Authoritative) {
+		err = dnscodec.ErrInvalidResponse
+	}
+	attempt.Elapsed = time.Since(attempt.Started)
+	attempt.Err = err
+	attempt.Failure = ClassifyError(err)
+	priming.Attempts = append(priming.Attempts, attempt)
+	return respMsg, err
+}
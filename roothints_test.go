@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultRootHints(t *testing.T) {
+	hints := DefaultRootHints()
+	require.Len(t, hints, 13)
+	assert.Equal(t, "a.root-servers.net.", hints[0].Name)
+	assert.Equal(t, []netip.Addr{
+		netip.MustParseAddr("198.41.0.4"),
+		netip.MustParseAddr("2001:503:ba3e::2:30"),
+	}, hints[0].Addrs)
+	assert.Len(t, hints.IPv4(), 13)
+	assert.Len(t, hints.IPv6(), 13)
+	assert.Equal(t, netip.MustParseAddr("202.12.27.33"), hints.IPv4()[12])
+}
+
+func TestParseRootHints(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// input is the named.root content.
+		input string
+
+		// wantHints is the expected result.
+		wantHints RootHints
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name: "with comments and unrelated records",
+			input: `; This file holds the information on root name servers
+;       last update:     July 03, 2023
+.                        3600000      NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+.                        3600000      NS    B.ROOT-SERVERS.NET.
+B.ROOT-SERVERS.NET.      3600000      AAAA  2801:1b8:10::b
+EXAMPLE.COM.             3600000      A     93.184.216.34
+; End of file`,
+			wantHints: RootHints{
+				{Name: "a.root-servers.net.", Addrs: []netip.Addr{netip.MustParseAddr("198.41.0.4")}},
+				{Name: "b.root-servers.net.", Addrs: []netip.Addr{netip.MustParseAddr("2801:1b8:10::b")}},
+			},
+		},
+
+		{
+			name:    "without root servers",
+			input:   "A.ROOT-SERVERS.NET. 3600000 A 198.41.0.4\n",
+			wantErr: ErrInvalidRootHints,
+		},
+
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: ErrInvalidRootHints,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hints, err := ParseRootHints(strings.NewReader(tc.input))
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				assert.Nil(t, hints)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantHints, hints)
+		})
+	}
+}
+
+func TestParseRootHintsSyntaxError(t *testing.T) {
+	hints, err := ParseRootHints(strings.NewReader("A.ROOT-SERVERS.NET. 3600000 A 198.41.0\n"))
+	require.Error(t, err)
+	assert.Nil(t, hints)
+}
+
+// newRootPrimingResponse creates a priming response listing a single root server.
+func newRootPrimingResponse(queryMsg *dns.Msg) *dns.Msg {
+	respMsg := new(dns.Msg)
+	respMsg.SetReply(queryMsg)
+	respMsg.Authoritative = true
+	respMsg.Answer = append(respMsg.Answer, runtimex.PanicOnError1(dns.NewRR(". 518400 IN NS a.root-servers.net.")))
+	respMsg.Extra = append(respMsg.Extra,
+		runtimex.PanicOnError1(dns.NewRR("a.root-servers.net. 518400 IN A 198.41.0.4")),
+		runtimex.PanicOnError1(dns.NewRR("a.root-servers.net. 518400 IN AAAA 2001:503:ba3e::2:30")),
+	)
+	return respMsg
+}
+
+func TestRootPrimer(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// respond returns the response of the given server or an error.
+		respond func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error)
+
+		// filter is the OPTIONAL address filter.
+		filter func(addr netip.Addr) bool
+
+		// wantAttempts is the expected number of attempts.
+		wantAttempts int
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	expectedErr := errors.New("mocked error")
+
+	tests := []testCase{
+		{
+			name: "first server answers",
+			respond: func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+				return newRootPrimingResponse(queryMsg), nil
+			},
+			wantAttempts: 1,
+		},
+
+		{
+			name: "first server fails",
+			respond: func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+				if addr == netip.MustParseAddr("198.41.0.4") {
+					return nil, expectedErr
+				}
+				return newRootPrimingResponse(queryMsg), nil
+			},
+			wantAttempts: 2,
+		},
+
+		{
+			name: "non authoritative response",
+			respond: func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+				respMsg := newRootPrimingResponse(queryMsg)
+				respMsg.Authoritative = false
+				return respMsg, nil
+			},
+			filter:       netip.Addr.Is4,
+			wantAttempts: 13,
+			wantErr:      dnscodec.ErrInvalidResponse,
+		},
+
+		{
+			name: "all servers fail",
+			respond: func(addr netip.Addr, queryMsg *dns.Msg) (*dns.Msg, error) {
+				return nil, expectedErr
+			},
+			wantAttempts: 26,
+			wantErr:      expectedErr,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rp := NewRootPrimer(&net.Dialer{})
+			rp.Filter = tc.filter
+			rp.NewTransport = func(addr netip.Addr) DNSMsgTransport {
+				return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+					assert.Equal(t, ".", queryMsg.Question[0].Name)
+					assert.Equal(t, dns.TypeNS, queryMsg.Question[0].Qtype)
+					assert.False(t, queryMsg.RecursionDesired)
+					assert.NotNil(t, queryMsg.IsEdns0())
+					return tc.respond(addr, queryMsg)
+				}}
+			}
+
+			priming := rp.Prime(context.Background())
+			require.Len(t, priming.Attempts, tc.wantAttempts)
+			assert.Equal(t, netip.MustParseAddr("198.41.0.4"), priming.Attempts[0].Server)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, priming.Err, tc.wantErr)
+				assert.NotEmpty(t, priming.Failure)
+				assert.Nil(t, priming.Hints)
+				return
+			}
+			require.NoError(t, priming.Err)
+			assert.Empty(t, priming.Failure)
+			require.NotNil(t, priming.Response)
+			assert.Equal(t, RootHints{{
+				Name: "a.root-servers.net.",
+				Addrs: []netip.Addr{
+					netip.MustParseAddr("198.41.0.4"),
+					netip.MustParseAddr("2001:503:ba3e::2:30"),
+				},
+			}}, priming.Hints)
+		})
+	}
+}
+
+func TestRootPrimerNoHints(t *testing.T) {
+	rp := NewRootPrimer(&net.Dialer{})
+	rp.Hints = nil
+	priming := rp.Prime(context.Background())
+	require.ErrorIs(t, priming.Err, ErrInvalidRootHints)
+	assert.Empty(t, priming.Attempts)
+}
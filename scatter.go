@@ -0,0 +1,264 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ScatterExchanger sends the same DNS over UDP query to many endpoints
+// concurrently using a small pool of unconnected sockets, which is the
+// core of open resolver scans and resolver surveys.
+//
+// Construct using [NewScatterExchanger].
+type ScatterExchanger struct {
+	// ListenConfig is the [NetListenConfig] to use to create sockets.
+	//
+	// Set by [NewScatterExchanger] to the user-provided value.
+	ListenConfig NetListenConfig
+
+	// Sockets is the maximum number of sockets per address family.
+	//
+	// Set by [NewScatterExchanger] to 8.
+	Sockets int
+
+	// Timeout is the overall timeout of a scatter exchange.
+	//
+	// Set by [NewScatterExchanger] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// BufferPool is the OPTIONAL [*BufferPool] from which we obtain the
+	// buffers used to serialize queries and receive responses. Sharing a
+	// pool across scatter exchanges reduces the GC pressure of large scans.
+	// When nil, we allocate new buffers for each socket.
+	BufferPool *BufferPool
+}
+
+// ScatterResult is the result of querying an endpoint using [*ScatterExchanger].
+type ScatterResult struct {
+	// Endpoint is the endpoint we queried.
+	Endpoint netip.AddrPort
+
+	// Response is the response or nil.
+	Response *dnscodec.Response
+
+	// Err is the error or nil.
+	Err error
+
+	// Failure is the result of applying [ClassifyError] to Err.
+	Failure string
+
+	// Sent is when we sent the query or the zero value.
+	Sent time.Time
+
+	// Elapsed is the time elapsed since Sent.
+	Elapsed time.Duration
+}
+
+// NewScatterExchanger creates a new [*ScatterExchanger].
+func NewScatterExchanger(lc NetListenConfig) *ScatterExchanger {
+	return &ScatterExchanger{
+		ListenConfig: lc,
+		Sockets:      8,
+		Timeout:      DefaultResolverTimeout,
+	}
+}
+
+// ScatterExchange sends the query to each endpoint and returns the results
+// in the same order of the endpoints.
+//
+// We spread the endpoints over the sockets and match responses to queries
+// using the source address, the query ID, and the question. We stop when
+// all the endpoints answered or when the Timeout expires.
+func (se *ScatterExchanger) ScatterExchange(
+	ctx context.Context, query *dnscodec.Query, endpoints []netip.AddrPort) []*ScatterResult {
+	ctx, cancel := context.WithTimeout(ctx, se.Timeout)
+	defer cancel()
+
+	// 1. group the results by address family
+	results := make([]*ScatterResult, 0, len(endpoints))
+	families := make(map[string][]*ScatterResult)
+	for _, epnt := range endpoints {
+		result := &ScatterResult{Endpoint: epnt}
+		results = append(results, result)
+		network := "udp6"
+		if epnt.Addr().Unmap().Is4() {
+			network = "udp4"
+		}
+		families[network] = append(families[network], result)
+	}
+
+	// 2. spread each family over the sockets and run concurrently
+	wg := &sync.WaitGroup{}
+	for network, group := range families {
+		count := min(max(se.Sockets, 1), len(group))
+		shards := make([][]*ScatterResult, count)
+		for idx, result := range group {
+			shards[idx%count] = append(shards[idx%count], result)
+		}
+		for _, shard := range shards {
+			wg.Go(func() {
+				se.scatter(ctx, network, query, shard)
+			})
+		}
+	}
+	wg.Wait()
+
+	// 3. classify the errors
+	for _, result := range results {
+		result.Failure = ClassifyError(result.Err)
+	}
+	return results
+}
+
+// scatterPending is a query waiting for its response.
+type scatterPending struct {
+	// queryMsg is the query we sent.
+	queryMsg *dns.Msg
+
+	// result is the result to fill.
+	result *ScatterResult
+}
+
+// scatter queries the given endpoints using a single socket.
+func (se *ScatterExchanger) scatter(
+	ctx context.Context, network string, query *dnscodec.Query, results []*ScatterResult) {
+	// 1. create the socket and make sure the context interrupts I/O
+	pconn, err := se.ListenConfig.ListenPacket(ctx, network, ":0")
+	if err != nil {
+		for _, result := range results {
+			result.Err = err
+		}
+		return
+	}
+	defer pconn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = pconn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = pconn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// 2. receive the responses in the background
+	var (
+		mu        sync.Mutex
+		pending   = make(map[netip.AddrPort][]*scatterPending)
+		remaining = len(results)
+		readErr   error
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readErr = se.recv(pconn, &mu, pending, &remaining)
+	}()
+
+	// 3. send the queries
+	maxSize, recvSize := dnsOverUDPSizes(0, 0)
+	buff := se.BufferPool.Get(recvSize)
+	defer se.BufferPool.Put(buff)
+	for _, result := range results {
+		queryMsg, rawQuery, err := dnsOverUDPPackQuery(query, maxSize, false, *buff)
+		if err == nil {
+			key := scatterKey(result.Endpoint)
+			mu.Lock()
+			pending[key] = append(pending[key], &scatterPending{queryMsg: queryMsg, result: result})
+			result.Sent = time.Now()
+			mu.Unlock()
+			_, err = pconn.WriteTo(rawQuery, net.UDPAddrFromAddrPort(result.Endpoint))
+		}
+		if err != nil {
+			mu.Lock()
+			scatterRemove(pending, result)
+			result.Err = err
+			remaining--
+			mu.Unlock()
+		}
+	}
+
+	// 4. unblock the receiver if all the sends failed
+	mu.Lock()
+	if remaining <= 0 {
+		_ = pconn.SetDeadline(time.Now())
+	}
+	mu.Unlock()
+	<-done
+
+	// 5. fail the queries that did not receive a response
+	if ctx.Err() != nil {
+		readErr = ctx.Err()
+	}
+	for _, entries := range pending {
+		for _, entry := range entries {
+			entry.result.Err = readErr
+			entry.result.Elapsed = time.Since(entry.result.Sent)
+		}
+	}
+}
+
+// recv receives responses until all the queries are answered or reading fails.
+func (se *ScatterExchanger) recv(pconn net.PacketConn,
+	mu *sync.Mutex, pending map[netip.AddrPort][]*scatterPending, remaining *int) error {
+	_, recvSize := dnsOverUDPSizes(0, 0)
+	buff := se.BufferPool.Get(recvSize)
+	defer se.BufferPool.Put(buff)
+	for {
+		// 1. read the next datagram and parse it
+		count, addr, err := pconn.ReadFrom(*buff)
+		if err != nil {
+			return err
+		}
+		respMsg := new(dns.Msg)
+		if err := respMsg.Unpack((*buff)[:count]); err != nil {
+			continue
+		}
+
+		// 2. find the matching query, if any
+		mu.Lock()
+		key := scatterKey(dnsOverUDPAddrPort(addr))
+		for idx, entry := range pending[key] {
+			resp, err := dnscodec.ParseResponse(entry.queryMsg, respMsg)
+			if errors.Is(err, dnscodec.ErrInvalidResponse) {
+				continue
+			}
+			entry.result.Response, entry.result.Err = resp, err
+			entry.result.Elapsed = time.Since(entry.result.Sent)
+			pending[key] = append(pending[key][:idx], pending[key][idx+1:]...)
+			if len(pending[key]) <= 0 {
+				delete(pending, key)
+			}
+			*remaining--
+			break
+		}
+		finished := *remaining <= 0
+		mu.Unlock()
+		if finished {
+			return nil
+		}
+	}
+}
+
+// scatterRemove removes the pending query associated with the given result.
+func scatterRemove(pending map[netip.AddrPort][]*scatterPending, result *ScatterResult) {
+	key := scatterKey(result.Endpoint)
+	for idx, entry := range pending[key] {
+		if entry.result == result {
+			pending[key] = append(pending[key][:idx], pending[key][idx+1:]...)
+			break
+		}
+	}
+	if len(pending[key]) <= 0 {
+		delete(pending, key)
+	}
+}
+
+// scatterKey normalizes an endpoint to match the source of the responses.
+func scatterKey(epnt netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(epnt.Addr().Unmap().WithZone(""), epnt.Port())
+}
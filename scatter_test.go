@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScatterExchanger(t *testing.T) {
+	se := NewScatterExchanger(&net.ListenConfig{})
+	assert.Equal(t, 8, se.Sockets)
+	assert.Equal(t, DefaultResolverTimeout, se.Timeout)
+}
+
+func TestScatterExchange(t *testing.T) {
+	// create two answering servers and a silent endpoint
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server1 := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	server2 := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { silent.Close() })
+
+	endpoints := []netip.AddrPort{
+		netip.MustParseAddrPort(server1.Address()),
+		netip.MustParseAddrPort(silent.LocalAddr().String()),
+		netip.MustParseAddrPort(server2.Address()),
+		netip.MustParseAddrPort(server1.Address()),
+	}
+
+	se := NewScatterExchanger(&net.ListenConfig{})
+	se.Sockets = 2
+	se.Timeout = 250 * time.Millisecond
+	results := se.ScatterExchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA), endpoints)
+	require.Len(t, results, 4)
+
+	for idx, result := range results {
+		assert.Equal(t, endpoints[idx], result.Endpoint)
+		assert.False(t, result.Sent.IsZero())
+		assert.Positive(t, result.Elapsed)
+		if idx == 1 {
+			require.Error(t, result.Err)
+			assert.Equal(t, FailureGenericTimeout, result.Failure)
+			assert.Nil(t, result.Response)
+			continue
+		}
+		require.NoError(t, result.Err)
+		assert.Empty(t, result.Failure)
+		addrs, err := result.Response.RecordsA()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	}
+}
+
+func TestScatterExchangeBufferPool(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	endpoints := []netip.AddrPort{netip.MustParseAddrPort(server.Address())}
+
+	se := NewScatterExchanger(&net.ListenConfig{})
+	se.Sockets = 1
+	se.BufferPool = NewBufferPool()
+	for range 2 {
+		results := se.ScatterExchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA), endpoints)
+		require.Len(t, results, 1)
+		require.NoError(t, results[0].Err)
+		addrs, err := results[0].Response.RecordsA()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	}
+}
+
+func TestScatterExchangeRcodeError(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+	endpoints := []netip.AddrPort{netip.MustParseAddrPort(server.Address())}
+
+	se := NewScatterExchanger(&net.ListenConfig{})
+	results := se.ScatterExchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA), endpoints)
+	require.Len(t, results, 1)
+	require.ErrorIs(t, results[0].Err, dnscodec.ErrNoName)
+	assert.Equal(t, FailureDNSNXDOMAIN, results[0].Failure)
+}
+
+func TestScatterExchangeFailure(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// lc is the listen config to use.
+		lc NetListenConfig
+
+		// query is the query to send.
+		query *dnscodec.Query
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	expectedErr := errors.New("mocked error")
+
+	tests := []testCase{
+		{
+			name: "listen failure",
+			lc: listenConfigFunc(func(ctx context.Context, network, address string) (net.PacketConn, error) {
+				return nil, expectedErr
+			}),
+			query:   dnscodec.NewQuery("example.com", dns.TypeA),
+			wantErr: expectedErr,
+		},
+
+		{
+			name:  "query serialization failure",
+			lc:    &net.ListenConfig{},
+			query: dnscodec.NewQuery("invalid\x00name", dns.TypeA),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := []netip.AddrPort{
+				netip.MustParseAddrPort("127.0.0.1:53"),
+				netip.MustParseAddrPort("[::1]:53"),
+			}
+			se := NewScatterExchanger(tc.lc)
+			results := se.ScatterExchange(context.Background(), tc.query, endpoints)
+			require.Len(t, results, 2)
+			for _, result := range results {
+				require.Error(t, result.Err)
+				if tc.wantErr != nil {
+					require.ErrorIs(t, result.Err, tc.wantErr)
+				}
+				assert.NotEmpty(t, result.Failure)
+				assert.True(t, result.Sent.IsZero())
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"time"
+)
+
+// Sink receives the records produced by measurements.
+type Sink interface {
+	WriteRecord(record *CampaignRecord) error
+}
+
+// Scheduler periodically runs a [*Campaign] and writes the records into a [Sink].
+//
+// Construct using [NewScheduler].
+type Scheduler struct {
+	// Campaign is the [*Campaign] to run.
+	//
+	// Set by [NewScheduler] to the user-provided value.
+	Campaign *Campaign
+
+	// Sink is the [Sink] receiving the records.
+	//
+	// Set by [NewScheduler] to the user-provided value.
+	Sink Sink
+
+	// Interval is the delay between the end of a round and the start of the next one.
+	//
+	// Set by [NewScheduler] to the user-provided value.
+	Interval time.Duration
+
+	// Jitter OPTIONALLY adds a random delay in [0, Jitter) to each interval,
+	// to avoid synchronizing with periodic events on the network.
+	Jitter time.Duration
+
+	// MaxRounds OPTIONALLY limits the number of rounds. When zero, we
+	// keep running until the context is done.
+	MaxRounds int
+
+	// Clock is the [Clock] to use to wait between rounds.
+	//
+	// Set by [NewScheduler] to [RealClock].
+	Clock Clock
+
+	// Rand is the [Rand] to use to compute the Jitter.
+	//
+	// Set by [NewScheduler] to [GlobalRand].
+	Rand Rand
+}
+
+// NewScheduler creates a new [*Scheduler].
+func NewScheduler(campaign *Campaign, sink Sink, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		Campaign: campaign,
+		Sink:     sink,
+		Interval: interval,
+		Clock:    RealClock{},
+		Rand:     GlobalRand{},
+	}
+}
+
+// Run runs the first round immediately and then runs a new round after each
+// interval, until the context is done or MaxRounds rounds have completed.
+//
+// We stop and return the error when the [Sink] fails. Otherwise, we return
+// nil after MaxRounds rounds and the context error when the context is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for round := 0; s.MaxRounds <= 0 || round < s.MaxRounds; round++ {
+		// 1. wait for the next round to begin
+		if round > 0 {
+			timer := s.Clock.NewTimer(s.delay())
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		// 2. run the round and write the records
+		if err := s.runRound(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delay returns the delay before the next round.
+func (s *Scheduler) delay() time.Duration {
+	delay := s.Interval
+	if s.Jitter > 0 {
+		delay += time.Duration(randNew(s.Rand).Int64N(int64(s.Jitter)))
+	}
+	return delay
+}
+
+// runRound runs a single round.
+func (s *Scheduler) runRound(ctx context.Context) error {
+	// 1. make sure we can interrupt the campaign if the sink fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 2. write records until the sink fails, then drain the channel
+	var err error
+	for record := range s.Campaign.Run(ctx) {
+		if err != nil {
+			continue
+		}
+		if err = s.Sink.WriteRecord(record); err != nil {
+			cancel()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sinkFunc allows to mock [Sink].
+type sinkFunc func(record *CampaignRecord) error
+
+func (fx sinkFunc) WriteRecord(record *CampaignRecord) error {
+	return fx(record)
+}
+
+// newSchedulerCampaign creates a [*Campaign] whose lookups fail with NXDOMAIN.
+func newSchedulerCampaign() *Campaign {
+	return NewCampaign([]string{"example.com", "example.org"}, CampaignResolver{
+		Name: "stub",
+		Transport: transportStub{
+			exchange: func(context.Context, *dnscodec.Query) (*dnscodec.Response, error) {
+				return nil, dnscodec.ErrNoName
+			},
+		},
+	})
+}
+
+func TestSchedulerMaxRounds(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []*CampaignRecord
+	)
+	sched := NewScheduler(newSchedulerCampaign(), sinkFunc(func(record *CampaignRecord) error {
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+		return nil
+	}), time.Millisecond)
+	sched.Jitter = time.Millisecond
+	sched.MaxRounds = 3
+
+	require.NoError(t, sched.Run(context.Background()))
+	require.Len(t, records, 3*4)
+	for _, record := range records {
+		assert.Equal(t, FailureDNSNXDOMAIN, record.Failure)
+	}
+}
+
+func TestSchedulerSinkFailure(t *testing.T) {
+	expectedErr := errors.New("sink failed")
+	var count int
+	sched := NewScheduler(newSchedulerCampaign(), sinkFunc(func(*CampaignRecord) error {
+		count++
+		return expectedErr
+	}), time.Millisecond)
+
+	require.ErrorIs(t, sched.Run(context.Background()), expectedErr)
+	require.Equal(t, 1, count)
+}
+
+func TestSchedulerContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var count int
+	sched := NewScheduler(newSchedulerCampaign(), sinkFunc(func(*CampaignRecord) error {
+		count++
+		cancel()
+		return nil
+	}), time.Hour)
+
+	require.ErrorIs(t, sched.Run(ctx), context.Canceled)
+	require.GreaterOrEqual(t, count, 1)
+}
+
+func TestSchedulerSimulatedClock(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records int
+	)
+	clock := NewSimulatedClock(time.Now())
+	sched := NewScheduler(newSchedulerCampaign(), sinkFunc(func(*CampaignRecord) error {
+		mu.Lock()
+		records++
+		mu.Unlock()
+		return nil
+	}), time.Hour)
+	sched.Clock = clock
+	sched.MaxRounds = 2
+
+	done := make(chan error, 1)
+	go func() { done <- sched.Run(context.Background()) }()
+
+	// wait for the scheduler to block on the timer after the first round
+	for clock.PendingTimers() <= 0 {
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	require.Equal(t, 4, records)
+	mu.Unlock()
+
+	// the second round runs only after the interval elapses
+	clock.Advance(time.Hour)
+	require.NoError(t, <-done)
+	require.Equal(t, 8, records)
+}
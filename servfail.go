@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// SERVFAIL diagnosis outcomes produced by [*ServfailDiagnoser].
+const (
+	// ServfailNone indicates that the resolver did not return SERVFAIL.
+	ServfailNone = "none"
+
+	// ServfailDNSSEC indicates that DNSSEC validation failed.
+	ServfailDNSSEC = "dnssec_failure"
+
+	// ServfailPolicyBlock indicates that the resolver refuses to resolve
+	// a domain that the authoritative servers resolve.
+	ServfailPolicyBlock = "policy_block"
+
+	// ServfailUpstreamUnreachable indicates that the resolver could not
+	// reach the authoritative servers.
+	ServfailUpstreamUnreachable = "upstream_unreachable"
+
+	// ServfailUnknown indicates that the evidence is not sufficient.
+	ServfailUnknown = "unknown"
+)
+
+// ServfailDiagnoser investigates why a resolver returns SERVFAIL.
+//
+// Upon SERVFAIL, we retry with the CD flag set to disable DNSSEC validation,
+// check the extended DNS errors (RFC 8914), and query the authoritative
+// servers directly, to distinguish between DNSSEC failures, unreachable
+// authoritative servers, and policy blocks.
+//
+// Construct using [NewServfailDiagnoser].
+type ServfailDiagnoser struct {
+	// Transport is the [DNSMsgTransport] to use to query the resolver.
+	//
+	// Set by [NewServfailDiagnoser] to the user-provided value.
+	Transport DNSMsgTransport
+
+	// NewAuthoritativeTransport creates the [DNSMsgTransport] to use
+	// to query the authoritative server with the given address.
+	//
+	// Set by [NewServfailDiagnoser] to a function creating a
+	// [*DNSOverUDPTransport] for port 53 using the given dialer.
+	NewAuthoritativeTransport func(addr netip.Addr) DNSMsgTransport
+
+	// Timeout is the timeout of each exchange.
+	//
+	// Set by [NewServfailDiagnoser] to [DefaultResolverTimeout].
+	Timeout time.Duration
+
+	// Rand is the [Rand] to use for the query IDs.
+	//
+	// Set by [NewServfailDiagnoser] to [GlobalRand].
+	Rand Rand
+}
+
+// ServfailDiagnosis is the diagnosis produced by [*ServfailDiagnoser].
+type ServfailDiagnosis struct {
+	// Outcome is the diagnosis outcome (e.g., [ServfailDNSSEC]).
+	Outcome string
+
+	// Rcode is the response code of the original query.
+	Rcode int
+
+	// Err is the error of the original query or nil.
+	Err error
+
+	// ExtendedErrors contains the extended DNS errors of the original query.
+	ExtendedErrors []*dns.EDNS0_EDE
+
+	// CheckingDisabledRcode is the response code when retrying with the CD
+	// flag set or -1 if the retry failed or we did not retry.
+	CheckingDisabledRcode int
+
+	// AuthoritativeServer is the address of the authoritative server that
+	// answered or the zero value.
+	AuthoritativeServer netip.Addr
+
+	// AuthoritativeRcode is the response code of the authoritative server
+	// or -1 if we could not query any authoritative server.
+	AuthoritativeRcode int
+
+	// AuthoritativeErr is the error querying the authoritative servers or nil.
+	AuthoritativeErr error
+}
+
+// NewServfailDiagnoser creates a new [*ServfailDiagnoser].
+func NewServfailDiagnoser(txp DNSMsgTransport, dialer NetDialer) *ServfailDiagnoser {
+	return &ServfailDiagnoser{
+		Transport: txp,
+		NewAuthoritativeTransport: func(addr netip.Addr) DNSMsgTransport {
+			return NewDNSOverUDPTransport(dialer, netip.AddrPortFrom(addr, 53))
+		},
+		Timeout: DefaultResolverTimeout,
+		Rand:    GlobalRand{},
+	}
+}
+
+// Diagnose queries the resolver and, upon SERVFAIL, diagnoses its cause.
+func (sd *ServfailDiagnoser) Diagnose(ctx context.Context, domain string, qtype uint16) *ServfailDiagnosis {
+	diagnosis := &ServfailDiagnosis{
+		Outcome:               ServfailNone,
+		CheckingDisabledRcode: -1,
+		AuthoritativeRcode:    -1,
+	}
+	domain = dns.Fqdn(domain)
+
+	// 1. send the original query and stop unless we see SERVFAIL
+	respMsg, err := sd.exchange(ctx, sd.Transport, sd.newQuery(domain, qtype, true, false))
+	if err != nil {
+		diagnosis.Outcome = ServfailUnknown
+		diagnosis.Err = err
+		return diagnosis
+	}
+	diagnosis.Rcode = respMsg.Rcode
+	if respMsg.Rcode != dns.RcodeServerFailure {
+		return diagnosis
+	}
+
+	// 2. collect the extended DNS errors
+	if opt := respMsg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if ede, ok := option.(*dns.EDNS0_EDE); ok {
+				diagnosis.ExtendedErrors = append(diagnosis.ExtendedErrors, ede)
+			}
+		}
+	}
+
+	// 3. retry with DNSSEC validation disabled
+	if respMsg, err := sd.exchange(ctx, sd.Transport, sd.newQuery(domain, qtype, true, true)); err == nil {
+		diagnosis.CheckingDisabledRcode = respMsg.Rcode
+	}
+
+	// 4. query the authoritative servers directly
+	sd.queryAuthoritative(ctx, diagnosis, domain, qtype)
+
+	diagnosis.Outcome = diagnosis.outcome()
+	return diagnosis
+}
+
+// outcome computes the outcome, preferring the explicit extended DNS errors.
+func (d *ServfailDiagnosis) outcome() string {
+	for _, ede := range d.ExtendedErrors {
+		switch ede.InfoCode {
+		case dns.ExtendedErrorCodeBlocked, dns.ExtendedErrorCodeCensored,
+			dns.ExtendedErrorCodeFiltered, dns.ExtendedErrorCodeProhibited:
+			return ServfailPolicyBlock
+
+		case dns.ExtendedErrorCodeUnsupportedDNSKEYAlgorithm, dns.ExtendedErrorCodeUnsupportedDSDigestType,
+			dns.ExtendedErrorCodeDNSSECIndeterminate, dns.ExtendedErrorCodeDNSBogus,
+			dns.ExtendedErrorCodeSignatureExpired, dns.ExtendedErrorCodeSignatureNotYetValid,
+			dns.ExtendedErrorCodeDNSKEYMissing, dns.ExtendedErrorCodeRRSIGsMissing,
+			dns.ExtendedErrorCodeNoZoneKeyBitSet, dns.ExtendedErrorCodeNSECMissing:
+			return ServfailDNSSEC
+
+		case dns.ExtendedErrorCodeNoReachableAuthority, dns.ExtendedErrorCodeNetworkError:
+			return ServfailUpstreamUnreachable
+		}
+	}
+	switch {
+	case d.CheckingDisabledRcode >= 0 && d.CheckingDisabledRcode != dns.RcodeServerFailure:
+		return ServfailDNSSEC
+	case d.AuthoritativeErr != nil:
+		return ServfailUpstreamUnreachable
+	case d.AuthoritativeRcode >= 0 && d.AuthoritativeRcode != dns.RcodeServerFailure:
+		return ServfailPolicyBlock
+	default:
+		return ServfailUnknown
+	}
+}
+
+// queryAuthoritative finds the authoritative servers for the domain and
+// queries them directly until one of them answers.
+func (sd *ServfailDiagnoser) queryAuthoritative(
+	ctx context.Context, diagnosis *ServfailDiagnosis, domain string, qtype uint16) {
+	// 1. find the closest enclosing zone with NS records
+	addrs, err := sd.lookupAuthoritative(ctx, domain)
+	if err != nil {
+		diagnosis.AuthoritativeErr = err
+		return
+	}
+
+	// 2. query the authoritative servers in order
+	for _, addr := range addrs {
+		txp := sd.NewAuthoritativeTransport(addr)
+		respMsg, err := sd.exchange(ctx, txp, sd.newQuery(domain, qtype, false, false))
+		if err != nil {
+			diagnosis.AuthoritativeErr = err
+			continue
+		}
+		diagnosis.AuthoritativeServer = addr
+		diagnosis.AuthoritativeRcode = respMsg.Rcode
+		diagnosis.AuthoritativeErr = nil
+		return
+	}
+}
+
+// lookupAuthoritative returns the addresses of the authoritative servers
+// of the closest zone enclosing the domain.
+//
+// We disable DNSSEC validation, since it may be the cause of SERVFAIL.
+func (sd *ServfailDiagnoser) lookupAuthoritative(ctx context.Context, domain string) ([]netip.Addr, error) {
+	// 1. walk up the name until we find NS records
+	var names []string
+	for offset, end := 0, false; !end && len(names) <= 0; offset, end = dns.NextLabel(domain, offset) {
+		respMsg, err := sd.exchange(ctx, sd.Transport, sd.newQuery(domain[offset:], dns.TypeNS, true, true))
+		if err != nil {
+			return nil, err
+		}
+		for _, rr := range respMsg.Answer {
+			if ns, ok := rr.(*dns.NS); ok {
+				names = append(names, ns.Ns)
+			}
+		}
+	}
+	if len(names) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+
+	// 2. resolve the addresses of the servers
+	var addrs []netip.Addr
+	for _, name := range names {
+		respMsg, err := sd.exchange(ctx, sd.Transport, sd.newQuery(name, dns.TypeA, true, true))
+		if err != nil {
+			continue
+		}
+		for _, rr := range respMsg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				if addr, ok := netip.AddrFromSlice(a.A); ok {
+					addrs = append(addrs, addr.Unmap())
+				}
+			}
+		}
+	}
+	if len(addrs) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return addrs, nil
+}
+
+// newQuery creates a query message with the given flags.
+func (sd *ServfailDiagnoser) newQuery(domain string, qtype uint16, rd, cd bool) *dns.Msg {
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion(dns.Fqdn(domain), qtype)
+	queryMsg.Id = randID(sd.Rand)
+	queryMsg.RecursionDesired = rd
+	queryMsg.CheckingDisabled = cd
+	queryMsg.SetEdns0(dnscodec.QueryMaxResponseSizeUDP, true)
+	return queryMsg
+}
+
+// exchange performs an exchange using the given transport and the configured timeout.
+func (sd *ServfailDiagnoser) exchange(ctx context.Context, txp DNSMsgTransport, queryMsg *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, sd.Timeout)
+	defer cancel()
+	return txp.ExchangeMsg(ctx, queryMsg)
+}
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// servfailResolverConfig configures the resolver created by newServfailResolver.
+type servfailResolverConfig struct {
+	// cdFixes causes the resolver to answer when the CD flag is set.
+	cdFixes bool
+
+	// ede is the OPTIONAL extended DNS error to include in SERVFAIL responses.
+	ede uint16
+
+	// servfail causes the resolver to answer SERVFAIL for www.example.com.
+	servfail bool
+}
+
+// newServfailResolver returns a [DNSMsgTransport] emulating a resolver where
+// example.com is served by ns.example.com, which has address 10.0.0.1.
+func newServfailResolver(config *servfailResolverConfig) DNSMsgTransport {
+	return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		respMsg := new(dns.Msg)
+		respMsg.SetReply(queryMsg)
+		q0 := queryMsg.Question[0]
+		switch {
+		case q0.Name == "example.com." && q0.Qtype == dns.TypeNS:
+			respMsg.Answer = append(respMsg.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: q0.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 60},
+				Ns:  "ns.example.com.",
+			})
+		case q0.Name == "ns.example.com." && q0.Qtype == dns.TypeA:
+			respMsg.Answer = append(respMsg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q0.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(10, 0, 0, 1),
+			})
+		case q0.Name == "www.example.com." && q0.Qtype == dns.TypeA:
+			if config.servfail && !(config.cdFixes && queryMsg.CheckingDisabled) {
+				respMsg.Rcode = dns.RcodeServerFailure
+				if config.ede != 0 {
+					opt := respMsg.SetEdns0(1232, false).IsEdns0()
+					opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: config.ede})
+				}
+			}
+		}
+		return respMsg, nil
+	}}
+}
+
+func TestServfailDiagnoser(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// resolver configures the resolver.
+		resolver *servfailResolverConfig
+
+		// authoritativeErr is the error returned by the authoritative server or nil.
+		authoritativeErr error
+
+		// wantOutcome is the expected outcome.
+		wantOutcome string
+
+		// wantAuthoritative indicates whether we expect the authoritative server to answer.
+		wantAuthoritative bool
+	}
+
+	tests := []testCase{
+		{
+			name:        "no SERVFAIL",
+			resolver:    &servfailResolverConfig{},
+			wantOutcome: ServfailNone,
+		},
+
+		{
+			name:              "extended DNS error indicating censorship",
+			resolver:          &servfailResolverConfig{servfail: true, ede: dns.ExtendedErrorCodeCensored},
+			wantOutcome:       ServfailPolicyBlock,
+			wantAuthoritative: true,
+		},
+
+		{
+			name:              "extended DNS error indicating bogus DNSSEC",
+			resolver:          &servfailResolverConfig{servfail: true, ede: dns.ExtendedErrorCodeDNSBogus},
+			wantOutcome:       ServfailDNSSEC,
+			wantAuthoritative: true,
+		},
+
+		{
+			name:             "extended DNS error indicating no reachable authority",
+			resolver:         &servfailResolverConfig{servfail: true, ede: dns.ExtendedErrorCodeNoReachableAuthority},
+			authoritativeErr: errors.New("timeout"),
+			wantOutcome:      ServfailUpstreamUnreachable,
+		},
+
+		{
+			name:              "checking disabled fixes SERVFAIL",
+			resolver:          &servfailResolverConfig{servfail: true, cdFixes: true},
+			wantOutcome:       ServfailDNSSEC,
+			wantAuthoritative: true,
+		},
+
+		{
+			name:              "authoritative server answers",
+			resolver:          &servfailResolverConfig{servfail: true},
+			wantOutcome:       ServfailPolicyBlock,
+			wantAuthoritative: true,
+		},
+
+		{
+			name:             "authoritative server unreachable",
+			resolver:         &servfailResolverConfig{servfail: true},
+			authoritativeErr: errors.New("timeout"),
+			wantOutcome:      ServfailUpstreamUnreachable,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sd := NewServfailDiagnoser(newServfailResolver(tc.resolver), &net.Dialer{})
+			var queried []netip.Addr
+			sd.NewAuthoritativeTransport = func(addr netip.Addr) DNSMsgTransport {
+				queried = append(queried, addr)
+				return msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+					if tc.authoritativeErr != nil {
+						return nil, tc.authoritativeErr
+					}
+					assert.False(t, queryMsg.RecursionDesired)
+					respMsg := new(dns.Msg)
+					respMsg.SetReply(queryMsg)
+					respMsg.Authoritative = true
+					return respMsg, nil
+				}}
+			}
+
+			diagnosis := sd.Diagnose(context.Background(), "www.example.com", dns.TypeA)
+			require.NoError(t, diagnosis.Err)
+			assert.Equal(t, tc.wantOutcome, diagnosis.Outcome)
+			if tc.wantOutcome == ServfailNone {
+				assert.Equal(t, dns.RcodeSuccess, diagnosis.Rcode)
+				assert.Empty(t, queried)
+				return
+			}
+			assert.Equal(t, dns.RcodeServerFailure, diagnosis.Rcode)
+			assert.Equal(t, tc.resolver.ede != 0, len(diagnosis.ExtendedErrors) > 0)
+			assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.1")}, queried)
+			if !tc.wantAuthoritative {
+				assert.ErrorIs(t, diagnosis.AuthoritativeErr, tc.authoritativeErr)
+				assert.Equal(t, -1, diagnosis.AuthoritativeRcode)
+				return
+			}
+			require.NoError(t, diagnosis.AuthoritativeErr)
+			assert.Equal(t, netip.MustParseAddr("10.0.0.1"), diagnosis.AuthoritativeServer)
+			assert.Equal(t, dns.RcodeSuccess, diagnosis.AuthoritativeRcode)
+		})
+	}
+}
+
+func TestServfailDiagnoserResolverFailure(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	sd := NewServfailDiagnoser(msgTransportStub{exchangeMsg: func(context.Context, *dns.Msg) (*dns.Msg, error) {
+		return nil, expectedErr
+	}}, &net.Dialer{})
+	diagnosis := sd.Diagnose(context.Background(), "www.example.com", dns.TypeA)
+	require.ErrorIs(t, diagnosis.Err, expectedErr)
+	assert.Equal(t, ServfailUnknown, diagnosis.Outcome)
+}
+
+func TestServfailDiagnoserNoNameServers(t *testing.T) {
+	sd := NewServfailDiagnoser(msgTransportStub{exchangeMsg: func(ctx context.Context, queryMsg *dns.Msg) (*dns.Msg, error) {
+		respMsg := new(dns.Msg)
+		respMsg.SetRcode(queryMsg, dns.RcodeServerFailure)
+		return respMsg, nil
+	}}, &net.Dialer{})
+	diagnosis := sd.Diagnose(context.Background(), "www.example.com", dns.TypeA)
+	require.NoError(t, diagnosis.Err)
+	assert.Equal(t, dns.RcodeServerFailure, diagnosis.CheckingDisabledRcode)
+	assert.Error(t, diagnosis.AuthoritativeErr)
+	assert.Equal(t, ServfailUpstreamUnreachable, diagnosis.Outcome)
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"slices"
+)
+
+// ErrSPKIPinMismatch indicates that no certificate matches the configured SPKI pins.
+var ErrSPKIPinMismatch = errors.New("no certificate matches the SPKI pins")
+
+// SPKIPin returns the SPKI pin of the given certificate, which is the base64
+// encoding of the SHA-256 hash of its SubjectPublicKeyInfo (RFC 7469), the
+// format several public resolvers use to publish their pins.
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// NewSPKIPinnedTLSConfig returns a clone of config that requires the server
+// to present a certificate matching one of the given SPKI pins, which one can
+// use with any encrypted transport accepting a [*tls.Config] (e.g., the TLSConfig
+// field of [*EscalatingTransport] and [*EndpointProber]).
+//
+// When verifyPKI is true, we pin in addition to PKI verification and accept any
+// certificate in the verified chains (RFC 7858). Otherwise, we pin instead of PKI
+// verification and, since there is no verified chain, only accept the leaf, whose
+// key the server proved to own during the handshake.
+//
+// We call the VerifyConnection function of config, if any, after checking the pins.
+func NewSPKIPinnedTLSConfig(config *tls.Config, pins []string, verifyPKI bool) *tls.Config {
+	config = config.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.InsecureSkipVerify = !verifyPKI
+	pins = slices.Clone(pins)
+	verifyConnection := config.VerifyConnection
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if !spkiPinsMatch(state, pins, verifyPKI) {
+			return ErrSPKIPinMismatch
+		}
+		if verifyConnection != nil {
+			return verifyConnection(state)
+		}
+		return nil
+	}
+	return config
+}
+
+// spkiPinsMatch returns whether any acceptable certificate matches the pins.
+func spkiPinsMatch(state tls.ConnectionState, pins []string, verifyPKI bool) bool {
+	var candidates []*x509.Certificate
+	switch {
+	case verifyPKI:
+		for _, chain := range state.VerifiedChains {
+			candidates = append(candidates, chain...)
+		}
+	case len(state.PeerCertificates) > 0:
+		candidates = state.PeerCertificates[:1]
+	}
+	for _, cert := range candidates {
+		if slices.Contains(pins, SPKIPin(cert)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSPKIPin(t *testing.T) {
+	cert := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("spki")}
+	digest := sha256.Sum256([]byte("spki"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), SPKIPin(cert))
+}
+
+func TestNewSPKIPinnedTLSConfig(t *testing.T) {
+	address, pool := newTLSServer(t, "dns.example.com")
+	_, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+
+	// obtain the server certificate to compute the pin
+	conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: pool, ServerName: "dns.example.com"})
+	require.NoError(t, err)
+	pin := SPKIPin(conn.ConnectionState().PeerCertificates[0])
+	conn.Close()
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the TLS config to pin.
+		config *tls.Config
+
+		// pins contains the SPKI pins.
+		pins []string
+
+		// verifyPKI indicates whether to also use PKI verification.
+		verifyPKI bool
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	otherPin := SPKIPin(&x509.Certificate{RawSubjectPublicKeyInfo: []byte("other")})
+	expectedErr := errors.New("mocked error")
+	tests := []testCase{
+		{
+			name:      "pin in addition to PKI",
+			config:    &tls.Config{RootCAs: pool},
+			pins:      []string{otherPin, pin},
+			verifyPKI: true,
+		},
+
+		{
+			name:      "pin instead of PKI",
+			config:    nil, // the certificate is not in the system pool
+			pins:      []string{pin},
+			verifyPKI: false,
+		},
+
+		{
+			name:      "pin mismatch with PKI",
+			config:    &tls.Config{RootCAs: pool},
+			pins:      []string{otherPin},
+			verifyPKI: true,
+			wantErr:   ErrSPKIPinMismatch,
+		},
+
+		{
+			name:      "pin mismatch without PKI",
+			config:    nil,
+			pins:      []string{otherPin},
+			verifyPKI: false,
+			wantErr:   ErrSPKIPinMismatch,
+		},
+
+		{
+			name: "chained VerifyConnection failure",
+			config: &tls.Config{VerifyConnection: func(tls.ConnectionState) error {
+				return expectedErr
+			}},
+			pins:      []string{pin},
+			verifyPKI: false,
+			wantErr:   expectedErr,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewSPKIPinnedTLSConfig(tc.config, tc.pins, tc.verifyPKI)
+			if tc.config != nil {
+				assert.False(t, tc.config.InsecureSkipVerify, "should not modify the original config")
+			}
+
+			resolver := &netstub.FuncResolver{
+				LookupHostFunc: func(context.Context, string) ([]string, error) {
+					return []string{"127.0.0.1"}, nil
+				},
+			}
+			dialer := NewDialer(&net.Dialer{}, resolver)
+			conn, err := dialer.DialTLSContext(
+				context.Background(), "tcp", net.JoinHostPort("dns.example.com", port), config)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, conn)
+				return
+			}
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"cmp"
+	"context"
+	"net"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// LookupSRV is like [*net.Resolver.LookupSRV]: we query for _service._proto.name,
+// or directly for name when service and proto are empty, and return the owner
+// name of the records along with the records sorted by priority and randomized
+// by weight within each priority (RFC 2782) using the Rand.
+//
+// Because of the underscores, this method requires transports implementing
+// [DNSMsgTransport], such as [*DNSOverUDPTransport].
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	// 1. perform the lookup
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+	records, err := resolverLookupServiceRecords[*dns.SRV](ctx, r, target, dns.TypeSRV)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 2. convert and sort the records
+	srvs := make([]*net.SRV, 0, len(records))
+	for _, record := range records {
+		srvs = append(srvs, &net.SRV{
+			Target:   record.Target,
+			Port:     record.Port,
+			Priority: record.Priority,
+			Weight:   record.Weight,
+		})
+	}
+	srvSort(r.Rand, srvs)
+	return records[0].Hdr.Name, srvs, nil
+}
+
+// srvSort sorts the records by priority and shuffles each priority by weight.
+func srvSort(r Rand, srvs []*net.SRV) {
+	slices.SortStableFunc(srvs, func(a, b *net.SRV) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	for start := 0; start < len(srvs); {
+		end := start + 1
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+		srvShuffleByWeight(r, srvs[start:end])
+		start = end
+	}
+}
+
+// srvShuffleByWeight implements the RFC 2782 weighted selection: we repeatedly
+// select a record with probability proportional to its weight, hence the
+// records with zero weight come last unless all the weights are zero.
+func srvShuffleByWeight(r Rand, srvs []*net.SRV) {
+	var sum int
+	for _, srv := range srvs {
+		sum += int(srv.Weight)
+	}
+	rnd := randNew(r)
+	for sum > 0 && len(srvs) > 1 {
+		var partial int
+		value := rnd.IntN(sum)
+		for idx := range srvs {
+			partial += int(srvs[idx].Weight)
+			if partial > value {
+				srvs[0], srvs[idx] = srvs[idx], srvs[0]
+				break
+			}
+		}
+		sum -= int(srvs[0].Weight)
+		srvs = srvs[1:]
+	}
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverLookupSRV(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// service is the service to query.
+		service string
+
+		// proto is the protocol to query.
+		proto string
+
+		// domain is the domain to query.
+		domain string
+
+		// wantCNAME is the expected owner name.
+		wantCNAME string
+
+		// wantTargets contains the expected targets.
+		wantTargets []string
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	reso := newRecordsResolver(
+		"_xmpp-server._tcp.example.com. 300 IN SRV 20 0 5269 c.example.com.",
+		"_xmpp-server._tcp.example.com. 300 IN SRV 10 0 5269 a.example.com.",
+		"_sip._udp.example.com. 300 IN SRV 10 0 5060 sip.example.com.",
+	)
+
+	tests := []testCase{
+		{
+			name:        "service and proto",
+			service:     "xmpp-server",
+			proto:       "tcp",
+			domain:      "example.com",
+			wantCNAME:   "_xmpp-server._tcp.example.com.",
+			wantTargets: []string{"a.example.com.", "c.example.com."},
+		},
+
+		{
+			name:        "name only",
+			domain:      "_sip._udp.example.com",
+			wantCNAME:   "_sip._udp.example.com.",
+			wantTargets: []string{"sip.example.com."},
+		},
+
+		{
+			name:    "no records",
+			service: "imap",
+			proto:   "tcp",
+			domain:  "example.com",
+			wantErr: dnscodec.ErrNoData,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cname, srvs, err := reso.LookupSRV(context.Background(), tc.service, tc.proto, tc.domain)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				var dnsErr *net.DNSError
+				require.ErrorAs(t, err, &dnsErr)
+				assert.Empty(t, cname)
+				assert.Nil(t, srvs)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCNAME, cname)
+			var targets []string
+			for _, srv := range srvs {
+				targets = append(targets, srv.Target)
+			}
+			assert.Equal(t, tc.wantTargets, targets)
+		})
+	}
+}
+
+func TestSRVSort(t *testing.T) {
+	t.Run("sorts by priority and puts zero weights last", func(t *testing.T) {
+		for seed := range uint64(32) {
+			srvs := []*net.SRV{
+				{Target: "d.", Priority: 20, Weight: 5},
+				{Target: "b.", Priority: 10, Weight: 0},
+				{Target: "a.", Priority: 10, Weight: 10},
+				{Target: "c.", Priority: 10, Weight: 0},
+			}
+			srvSort(NewSeededRand(seed), srvs)
+			assert.Equal(t, "a.", srvs[0].Target)
+			assert.ElementsMatch(t, []string{"b.", "c."}, []string{srvs[1].Target, srvs[2].Target})
+			assert.Equal(t, "d.", srvs[3].Target)
+		}
+	})
+
+	t.Run("selects proportionally to the weight", func(t *testing.T) {
+		const trials = 1000
+		var heavy int
+		r := NewSeededRand(7)
+		for range trials {
+			srvs := []*net.SRV{
+				{Target: "light.", Priority: 10, Weight: 1},
+				{Target: "heavy.", Priority: 10, Weight: 3},
+			}
+			srvSort(r, srvs)
+			if srvs[0].Target == "heavy." {
+				heavy++
+			}
+		}
+		assert.InDelta(t, 0.75, float64(heavy)/trials, 0.05)
+	})
+
+	t.Run("is reproducible with the same seed", func(t *testing.T) {
+		sorted := func() []string {
+			srvs := []*net.SRV{
+				{Target: "a.", Priority: 10, Weight: 1},
+				{Target: "b.", Priority: 10, Weight: 1},
+				{Target: "c.", Priority: 10, Weight: 1},
+			}
+			srvSort(NewSeededRand(7), srvs)
+			var targets []string
+			for _, srv := range srvs {
+				targets = append(targets, srv.Target)
+			}
+			return targets
+		}
+		assert.Equal(t, sorted(), sorted())
+	})
+}
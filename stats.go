@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// LatencyStats contains summary statistics for a set of latency samples.
+//
+// Construct using [NewLatencyStats].
+type LatencyStats struct {
+	// Count is the number of samples.
+	Count int
+
+	// Min is the minimum latency.
+	Min time.Duration
+
+	// Median is the median latency.
+	Median time.Duration
+
+	// P95 is the 95th percentile latency.
+	P95 time.Duration
+
+	// P99 is the 99th percentile latency.
+	P99 time.Duration
+
+	// Max is the maximum latency.
+	Max time.Duration
+
+	// Mean is the mean latency.
+	Mean time.Duration
+
+	// Stddev is the population standard deviation of the latency.
+	Stddev time.Duration
+}
+
+// NewLatencyStats computes the [LatencyStats] of the given samples.
+//
+// We compute percentiles using the nearest-rank method. All the fields
+// except Count are zero when there are no samples.
+func NewLatencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) <= 0 {
+		return LatencyStats{}
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	var sum float64
+	for _, sample := range sorted {
+		sum += float64(sample)
+	}
+	mean := sum / float64(len(sorted))
+	var variance float64
+	for _, sample := range sorted {
+		variance += (float64(sample) - mean) * (float64(sample) - mean)
+	}
+	variance /= float64(len(sorted))
+
+	return LatencyStats{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Median: latencyPercentile(sorted, 50),
+		P95:    latencyPercentile(sorted, 95),
+		P99:    latencyPercentile(sorted, 99),
+		Max:    sorted[len(sorted)-1],
+		Mean:   time.Duration(mean),
+		Stddev: time.Duration(math.Sqrt(variance)),
+	}
+}
+
+// latencyPercentile returns the given percentile of the sorted samples
+// using the nearest-rank method.
+func latencyPercentile(sorted []time.Duration, percentile float64) time.Duration {
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
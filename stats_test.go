@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// samples contains the samples.
+		samples []time.Duration
+
+		// want is the expected result.
+		want LatencyStats
+	}
+
+	hundred := make([]time.Duration, 0, 100)
+	for idx := 100; idx >= 1; idx-- {
+		hundred = append(hundred, time.Duration(idx)*time.Millisecond)
+	}
+
+	tests := []testCase{
+		{
+			name:    "no samples",
+			samples: nil,
+			want:    LatencyStats{},
+		},
+
+		{
+			name:    "single sample",
+			samples: []time.Duration{time.Second},
+			want: LatencyStats{
+				Count:  1,
+				Min:    time.Second,
+				Median: time.Second,
+				P95:    time.Second,
+				P99:    time.Second,
+				Max:    time.Second,
+				Mean:   time.Second,
+				Stddev: 0,
+			},
+		},
+
+		{
+			name:    "two samples",
+			samples: []time.Duration{3 * time.Second, time.Second},
+			want: LatencyStats{
+				Count:  2,
+				Min:    time.Second,
+				Median: time.Second,
+				P95:    3 * time.Second,
+				P99:    3 * time.Second,
+				Max:    3 * time.Second,
+				Mean:   2 * time.Second,
+				Stddev: time.Second,
+			},
+		},
+
+		{
+			name:    "hundred samples",
+			samples: hundred,
+			want: LatencyStats{
+				Count:  100,
+				Min:    time.Millisecond,
+				Median: 50 * time.Millisecond,
+				P95:    95 * time.Millisecond,
+				P99:    99 * time.Millisecond,
+				Max:    100 * time.Millisecond,
+				Mean:   50500 * time.Microsecond,
+				Stddev: 28866070, // sqrt((100^2-1)/12) milliseconds
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, NewLatencyStats(tc.samples))
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// StdlibNetDialer is a [NetDialer] using the standard library that allows
+// to configure socket options that cannot be set through [NetDialer].
+//
+// Because both [*Dialer] and [*DNSOverUDPTransport] depend on [NetDialer],
+// you can use this type to select the egress path of both on multi-homed hosts.
+//
+// Use the Dialer template to configure options already supported by the
+// standard library, such as TCP keep-alive using KeepAliveConfig.
+//
+// Construct using [NewStdlibNetDialer].
+type StdlibNetDialer struct {
+	// Dialer is the [*net.Dialer] used as a template for each dial.
+	//
+	// Set by [NewStdlibNetDialer] to the user-provided value.
+	Dialer *net.Dialer
+
+	// LocalAddr is the OPTIONAL local IP address to bind to before dialing.
+	//
+	// When unset, the kernel chooses the local address.
+	LocalAddr netip.Addr
+
+	// LocalPortMin is the OPTIONAL minimum local port to bind to.
+	//
+	// When both LocalPortMin and LocalPortMax are zero, which is the
+	// default, the kernel chooses a random ephemeral port for each dial.
+	//
+	// When LocalPortMax is less than or equal to LocalPortMin, we
+	// always bind to LocalPortMin. Note that this prevents dialing
+	// concurrently using the same protocol and local address.
+	LocalPortMin uint16
+
+	// LocalPortMax is the OPTIONAL maximum local port to bind to.
+	//
+	// When greater than LocalPortMin, we bind to a random port in the
+	// closed interval between LocalPortMin and LocalPortMax.
+	LocalPortMax uint16
+
+	// Interface is the OPTIONAL name of the network interface to bind
+	// to before dialing. This is only supported on Linux.
+	Interface string
+
+	// MultipathTCP OPTIONALLY enables Multipath TCP for TCP connections.
+	//
+	// When the kernel does not support MPTCP, we fall back to TCP.
+	MultipathTCP bool
+
+	// TCPFastOpen OPTIONALLY enables TCP Fast Open for TCP connections.
+	//
+	// This is only supported on Linux, where it uses TCP_FASTOPEN_CONNECT.
+	TCPFastOpen bool
+
+	// Rand is the [Rand] to use to choose the local port.
+	//
+	// Set by [NewStdlibNetDialer] to [GlobalRand].
+	Rand Rand
+}
+
+// NewStdlibNetDialer creates a new [*StdlibNetDialer] instance.
+func NewStdlibNetDialer(dialer *net.Dialer) *StdlibNetDialer {
+	return &StdlibNetDialer{Dialer: dialer, Rand: GlobalRand{}}
+}
+
+// Ensure that [*StdlibNetDialer] implements [NetDialer].
+var _ NetDialer = &StdlibNetDialer{}
+
+// DialContext implements [NetDialer].
+func (d *StdlibNetDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	// 1. clone the template so we can safely mutate it
+	child := *d.Dialer
+
+	// 2. possibly bind to the configured local address and port
+	if d.LocalAddr.IsValid() || d.LocalPortMin > 0 || d.LocalPortMax > 0 {
+		laddr, err := stdlibNetDialerLocalAddr(network, netip.AddrPortFrom(d.LocalAddr, d.localPort()))
+		if err != nil {
+			return nil, err
+		}
+		child.LocalAddr = laddr
+	}
+
+	// 3. possibly configure MPTCP
+	if d.MultipathTCP {
+		child.SetMultipathTCP(true)
+	}
+
+	// 4. possibly set socket options using the control function
+	var controls []stdlibNetDialerControlFunc
+	if d.Interface != "" {
+		controls = append(controls, stdlibNetDialerBindToDevice(d.Interface))
+	}
+	if d.TCPFastOpen && stdlibNetDialerIsTCP(network) {
+		controls = append(controls, stdlibNetDialerTCPFastOpen)
+	}
+	stdlibNetDialerChainControl(&child, controls...)
+
+	// 5. defer to the standard library
+	return child.DialContext(ctx, network, address)
+}
+
+// localPort returns the local port to bind to.
+func (d *StdlibNetDialer) localPort() uint16 {
+	if d.LocalPortMax <= d.LocalPortMin {
+		return d.LocalPortMin
+	}
+	return d.LocalPortMin + uint16(randNew(d.Rand).IntN(int(d.LocalPortMax-d.LocalPortMin)+1))
+}
+
+// stdlibNetDialerIsTCP returns whether the network is a TCP network.
+func stdlibNetDialerIsTCP(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return true
+	default:
+		return false
+	}
+}
+
+// stdlibNetDialerLocalAddr returns the [net.Addr] to bind to for the given network.
+func stdlibNetDialerLocalAddr(network string, epnt netip.AddrPort) (net.Addr, error) {
+	switch {
+	case stdlibNetDialerIsTCP(network):
+		return net.TCPAddrFromAddrPort(epnt), nil
+	case network == "udp" || network == "udp4" || network == "udp6":
+		return net.UDPAddrFromAddrPort(epnt), nil
+	default:
+		return nil, fmt.Errorf("cannot bind local address for network: %s", network)
+	}
+}
+
+// stdlibNetDialerControlFunc is the type of [*net.Dialer] Control func.
+type stdlibNetDialerControlFunc = func(network, address string, conn syscall.RawConn) error
+
+// stdlibNetDialerChainControl runs the given controls after any control already
+// configured in the dialer template, which we do not want to override.
+func stdlibNetDialerChainControl(dialer *net.Dialer, controls ...stdlibNetDialerControlFunc) {
+	if len(controls) <= 0 {
+		return
+	}
+	prevContext, prev := dialer.ControlContext, dialer.Control
+	dialer.Control = nil
+	dialer.ControlContext = func(ctx context.Context, network, address string, conn syscall.RawConn) error {
+		switch {
+		case prevContext != nil:
+			if err := prevContext(ctx, network, address, conn); err != nil {
+				return err
+			}
+		case prev != nil:
+			if err := prev(network, address, conn); err != nil {
+				return err
+			}
+		}
+		for _, control := range controls {
+			if err := control(network, address, conn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
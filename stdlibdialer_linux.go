@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package minest
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// stdlibNetDialerBindToDevice returns a control function binding the socket to a device.
+func stdlibNetDialerBindToDevice(iface string) stdlibNetDialerControlFunc {
+	return func(network, address string, conn syscall.RawConn) error {
+		var serr error
+		err := conn.Control(func(fd uintptr) {
+			serr = unix.BindToDevice(int(fd), iface)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}
+}
+
+// stdlibNetDialerTCPFastOpen is a control function enabling TCP_FASTOPEN_CONNECT.
+func stdlibNetDialerTCPFastOpen(network, address string, conn syscall.RawConn) error {
+	var serr error
+	err := conn.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
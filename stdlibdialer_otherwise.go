@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package minest
+
+import (
+	"errors"
+	"syscall"
+)
+
+// stdlibNetDialerBindToDevice returns a control function that always fails
+// because binding to a device is only supported on Linux.
+func stdlibNetDialerBindToDevice(iface string) stdlibNetDialerControlFunc {
+	return func(network, address string, conn syscall.RawConn) error {
+		return errors.ErrUnsupported
+	}
+}
+
+// stdlibNetDialerTCPFastOpen is a control function that always fails
+// because TCP Fast Open is only supported on Linux.
+func stdlibNetDialerTCPFastOpen(network, address string, conn syscall.RawConn) error {
+	return errors.ErrUnsupported
+}
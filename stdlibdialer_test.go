@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/bassosimone/dnstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdlibNetDialerLocalAddr(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// network is the network to use.
+		network string
+
+		// listen returns the address to dial.
+		listen func(t *testing.T) string
+	}
+
+	tests := []testCase{
+		{
+			name:    "tcp",
+			network: "tcp",
+			listen: func(t *testing.T) string {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+				t.Cleanup(func() { listener.Close() })
+				return listener.Addr().String()
+			},
+		},
+
+		{
+			name:    "udp",
+			network: "udp",
+			listen: func(t *testing.T) string {
+				pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				require.NoError(t, err)
+				t.Cleanup(func() { pconn.Close() })
+				return pconn.LocalAddr().String()
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := NewStdlibNetDialer(&net.Dialer{})
+			dialer.LocalAddr = netip.MustParseAddr("127.0.0.1")
+			conn, err := dialer.DialContext(context.Background(), tc.network, tc.listen(t))
+			require.NoError(t, err)
+			defer conn.Close()
+			laddr, err := netip.ParseAddrPort(conn.LocalAddr().String())
+			require.NoError(t, err)
+			assert.Equal(t, dialer.LocalAddr, laddr.Addr())
+		})
+	}
+}
+
+func TestStdlibNetDialerLocalAddrUnsupportedNetwork(t *testing.T) {
+	dialer := NewStdlibNetDialer(&net.Dialer{})
+	dialer.LocalAddr = netip.MustParseAddr("127.0.0.1")
+	_, err := dialer.DialContext(context.Background(), "unix", "/nonexistent")
+	require.Error(t, err)
+}
+
+func TestStdlibNetDialerWithDNSOverUDPTransport(t *testing.T) {
+	config := dnstest.NewHandlerConfig()
+	config.AddNetipAddr("example.com", netip.MustParseAddr("93.184.216.34"))
+	server := newUDPServer(t, "127.0.0.1:0", dnstest.NewHandler(config))
+
+	dialer := NewStdlibNetDialer(&net.Dialer{})
+	dialer.LocalAddr = netip.MustParseAddr("127.0.0.1")
+	txp := NewDNSOverUDPTransport(dialer, netip.MustParseAddrPort(server.Address()))
+	addrs, err := NewResolver(txp).LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+}
+
+func TestStdlibNetDialerInterface(t *testing.T) {
+	dialer := NewStdlibNetDialer(&net.Dialer{})
+	dialer.Interface = "lo"
+	conn, err := dialer.DialContext(context.Background(), "udp", "127.0.0.1:53")
+	if runtime.GOOS != "linux" {
+		require.ErrorIs(t, err, errors.ErrUnsupported)
+		return
+	}
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("not enough privileges to bind to a device")
+	}
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestStdlibNetDialerPreservesTemplateControl(t *testing.T) {
+	expectedErr := errors.New("control failed")
+	dialer := NewStdlibNetDialer(&net.Dialer{
+		Control: func(string, string, syscall.RawConn) error {
+			return expectedErr
+		},
+	})
+	dialer.Interface = "lo"
+	_, err := dialer.DialContext(context.Background(), "udp", "127.0.0.1:53")
+	require.ErrorIs(t, err, expectedErr)
+	assert.NotNil(t, dialer.Dialer.Control)
+	assert.Nil(t, dialer.Dialer.ControlContext)
+}
+
+func TestStdlibNetDialerTCPOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// configure configures the dialer.
+		configure func(*StdlibNetDialer)
+	}
+
+	tests := []testCase{
+		{
+			name: "MPTCP",
+			configure: func(d *StdlibNetDialer) {
+				d.MultipathTCP = true
+			},
+		},
+
+		{
+			name: "TCP Fast Open",
+			configure: func(d *StdlibNetDialer) {
+				d.TCPFastOpen = true
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := NewStdlibNetDialer(&net.Dialer{})
+			tc.configure(dialer)
+			conn, err := dialer.DialContext(context.Background(), "tcp", listener.Addr().String())
+			if runtime.GOOS != "linux" && dialer.TCPFastOpen {
+				require.ErrorIs(t, err, errors.ErrUnsupported)
+				return
+			}
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
+
+func TestStdlibNetDialerTCPFastOpenIgnoredForUDP(t *testing.T) {
+	dialer := NewStdlibNetDialer(&net.Dialer{})
+	dialer.TCPFastOpen = true
+	conn, err := dialer.DialContext(context.Background(), "udp", "127.0.0.1:53")
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestStdlibNetDialerLocalPort(t *testing.T) {
+	// Obtain a port that is most likely free by binding and closing a socket.
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	freePort := netip.MustParseAddrPort(pconn.LocalAddr().String()).Port()
+	pconn.Close()
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// min is the minimum local port.
+		min uint16
+
+		// max is the maximum local port.
+		max uint16
+	}
+
+	tests := []testCase{
+		{
+			name: "fixed port",
+			min:  freePort,
+			max:  0,
+		},
+
+		{
+			name: "port range",
+			min:  freePort,
+			max:  freePort + 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := NewStdlibNetDialer(&net.Dialer{})
+			dialer.LocalPortMin = tc.min
+			dialer.LocalPortMax = tc.max
+			conn, err := dialer.DialContext(context.Background(), "udp", "127.0.0.1:53")
+			require.NoError(t, err)
+			defer conn.Close()
+			laddr := netip.MustParseAddrPort(conn.LocalAddr().String())
+			assert.GreaterOrEqual(t, laddr.Port(), tc.min)
+			assert.LessOrEqual(t, laddr.Port(), max(tc.min, tc.max))
+		})
+	}
+}
+
+func TestStdlibNetDialerLocalPortRange(t *testing.T) {
+	dialer := NewStdlibNetDialer(&net.Dialer{})
+	dialer.LocalPortMin = 40000
+	dialer.LocalPortMax = 40003
+	seen := map[uint16]bool{}
+	for range 256 {
+		port := dialer.localPort()
+		require.GreaterOrEqual(t, port, dialer.LocalPortMin)
+		require.LessOrEqual(t, port, dialer.LocalPortMax)
+		seen[port] = true
+	}
+	require.Len(t, seen, 4)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"github.com/miekg/dns"
+)
+
+// SVCBRecord contains the fields of an SVCB or HTTPS record (RFC 9460)
+// that matter for measuring, e.g., the availability of ECH.
+//
+// Construct using [NewSVCBRecord].
+type SVCBRecord struct {
+	// Priority is the record priority, where zero means AliasMode.
+	Priority uint16
+
+	// Target is the canonical target name, where "." means the owner name.
+	Target string
+
+	// ALPN contains the alpn SvcParam values.
+	ALPN []string
+
+	// NoDefaultALPN is true when the record has the no-default-alpn SvcParam.
+	NoDefaultALPN bool
+
+	// Port is the port SvcParam value or zero when missing.
+	Port uint16
+
+	// IPv4Hint contains the ipv4hint SvcParam addresses.
+	IPv4Hint []netip.Addr
+
+	// IPv6Hint contains the ipv6hint SvcParam addresses.
+	IPv6Hint []netip.Addr
+
+	// ECH is the ech SvcParam value (i.e., the ECHConfigList) or nil.
+	ECH []byte
+}
+
+// NewSVCBRecord creates a new [*SVCBRecord] from an SVCB record. For
+// an HTTPS record, pass the embedded SVCB field.
+func NewSVCBRecord(rr *dns.SVCB) *SVCBRecord {
+	record := &SVCBRecord{Priority: rr.Priority, Target: dns.CanonicalName(rr.Target)}
+	for _, kv := range rr.Value {
+		switch kv := kv.(type) {
+		case *dns.SVCBAlpn:
+			record.ALPN = kv.Alpn
+		case *dns.SVCBNoDefaultAlpn:
+			record.NoDefaultALPN = true
+		case *dns.SVCBPort:
+			record.Port = kv.Port
+		case *dns.SVCBIPv4Hint:
+			record.IPv4Hint = svcbHintAddrs(kv.Hint)
+		case *dns.SVCBIPv6Hint:
+			record.IPv6Hint = svcbHintAddrs(kv.Hint)
+		case *dns.SVCBECHConfig:
+			record.ECH = kv.ECH
+		}
+	}
+	return record
+}
+
+// svcbHintAddrs converts the hint addresses to [netip.Addr].
+func svcbHintAddrs(hints []net.IP) []netip.Addr {
+	addrs := make([]netip.Addr, 0, len(hints))
+	for _, hint := range hints {
+		if addr, ok := netip.AddrFromSlice(hint); ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs
+}
+
+// LookupSVCB resolves a name to its SVCB records (RFC 9460).
+//
+// SVCB names typically contain underscores (e.g., _dns.resolver.arpa), hence
+// this method requires transports implementing [DNSMsgTransport] for them.
+func (r *Resolver) LookupSVCB(ctx context.Context, name string) ([]*dns.SVCB, error) {
+	return resolverLookupServiceRecords[*dns.SVCB](ctx, r, name, dns.TypeSVCB)
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSVCBRecord(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// record is the SVCB or HTTPS record.
+		record string
+
+		// want is the expected result.
+		want *SVCBRecord
+	}
+
+	tests := []testCase{
+		{
+			name:   "AliasMode",
+			record: "example.com. 300 IN HTTPS 0 svc.EXAMPLE.net.",
+			want:   &SVCBRecord{Priority: 0, Target: "svc.example.net."},
+		},
+
+		{
+			name: "ServiceMode with all the SvcParams",
+			record: "example.com. 300 IN HTTPS 1 . alpn=h3,h2 no-default-alpn port=8443 " +
+				"ipv4hint=192.0.2.1,192.0.2.2 ech=AEP+DQA/ ipv6hint=2001:db8::1",
+			want: &SVCBRecord{
+				Priority:      1,
+				Target:        ".",
+				ALPN:          []string{"h3", "h2"},
+				NoDefaultALPN: true,
+				Port:          8443,
+				IPv4Hint:      []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")},
+				IPv6Hint:      []netip.Addr{netip.MustParseAddr("2001:db8::1")},
+				ECH:           []byte{0x00, 0x43, 0xfe, 0x0d, 0x00, 0x3f},
+			},
+		},
+
+		{
+			name:   "SVCB record",
+			record: "_dns.resolver.arpa. 300 IN SVCB 1 dns.example.net. alpn=dot port=853",
+			want:   &SVCBRecord{Priority: 1, Target: "dns.example.net.", ALPN: []string{"dot"}, Port: 853},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var svcb *dns.SVCB
+			switch rr := runtimex.PanicOnError1(dns.NewRR(tc.record)).(type) {
+			case *dns.HTTPS:
+				svcb = &rr.SVCB
+			case *dns.SVCB:
+				svcb = rr
+			}
+			require.NotNil(t, svcb)
+			assert.Equal(t, tc.want, NewSVCBRecord(svcb))
+		})
+	}
+}
+
+func TestResolverLookupSVCB(t *testing.T) {
+	reso := newRecordsResolver(
+		"_dns.resolver.arpa. 300 IN SVCB 1 dns.example.net. alpn=dot port=853",
+		"_dns.resolver.arpa. 300 IN SVCB 2 dns.example.net. alpn=h2 dohpath=/dns-query{?dns}",
+	)
+	records, err := reso.LookupSVCB(context.Background(), "_dns.resolver.arpa")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, []string{"dot"}, NewSVCBRecord(records[0]).ALPN)
+	assert.Equal(t, uint16(2), records[1].Priority)
+
+	records, err = reso.LookupSVCB(context.Background(), "_dns.example.com")
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	assert.Nil(t, records)
+}
+
+func TestResolverLookupHTTPSWithPortPrefix(t *testing.T) {
+	reso := newRecordsResolver("_8443._https.example.com. 300 IN HTTPS 1 . alpn=h2")
+	records, err := reso.LookupHTTPS(context.Background(), "_8443._https.example.com")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, []string{"h2"}, NewSVCBRecord(&records[0].SVCB).ALPN)
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// ErrSystemConfigUnsupported indicates that we do not know how to read
+// the DNS configuration of the operating system on this platform.
+var ErrSystemConfigUnsupported = errors.New("reading the system DNS configuration is not supported")
+
+// DefaultResolvConfPath is the default path of the resolv.conf file.
+const DefaultResolvConfPath = "/etc/resolv.conf"
+
+// SystemDNSConfig is the DNS configuration of the operating system.
+type SystemDNSConfig struct {
+	// Nameservers contains the configured nameservers in order of preference.
+	Nameservers []netip.AddrPort
+
+	// Search contains the domain search list.
+	Search []string
+
+	// Ndots is the number of dots a name must contain for being
+	// tried as an absolute name before using the search list.
+	Ndots int
+}
+
+// NewResolver creates a new [*Resolver] querying the Nameservers in order
+// using DNS over UDP and the given [NetDialer], which allows measuring what
+// the operating system would do. We do not apply Search and Ndots, hence
+// the caller should qualify the names according to them.
+func (c *SystemDNSConfig) NewResolver(dialer NetDialer) *Resolver {
+	transports := make([]DNSTransport, 0, len(c.Nameservers))
+	for _, endpoint := range c.Nameservers {
+		transports = append(transports, NewDNSOverUDPTransport(dialer, endpoint))
+	}
+	return NewResolver(transports...)
+}
+
+// SystemConfig reads the DNS configuration of the operating system.
+type SystemConfig interface {
+	// ReadSystemDNSConfig returns the current configuration.
+	ReadSystemDNSConfig() (*SystemDNSConfig, error)
+}
+
+// DefaultSystemConfig returns the [SystemConfig] for the current platform,
+// which is a [*ResolvConfSystemConfig] on Unix and [WindowsSystemConfig] on
+// Windows. On other platforms, the returned [SystemConfig] fails with
+// [ErrSystemConfigUnsupported].
+func DefaultSystemConfig() SystemConfig {
+	return newDefaultSystemConfig()
+}
+
+// ResolvConfSystemConfig is a [SystemConfig] parsing a resolv.conf file.
+//
+// Construct using [NewResolvConfSystemConfig].
+type ResolvConfSystemConfig struct {
+	// Path is the path of the resolv.conf file.
+	//
+	// Set by [NewResolvConfSystemConfig] to [DefaultResolvConfPath].
+	Path string
+}
+
+// NewResolvConfSystemConfig creates a new [*ResolvConfSystemConfig].
+func NewResolvConfSystemConfig() *ResolvConfSystemConfig {
+	return &ResolvConfSystemConfig{Path: DefaultResolvConfPath}
+}
+
+// Ensure that [*ResolvConfSystemConfig] implements [SystemConfig].
+var _ SystemConfig = &ResolvConfSystemConfig{}
+
+// ReadSystemDNSConfig implements [SystemConfig].
+//
+// Like the standard library, we ignore the nameservers that are not IP addresses.
+func (sc *ResolvConfSystemConfig) ReadSystemDNSConfig() (*SystemDNSConfig, error) {
+	// 1. parse the file
+	clientConfig, err := dns.ClientConfigFromFile(sc.Path)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(clientConfig.Port, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. convert the nameservers to endpoints
+	config := &SystemDNSConfig{Search: clientConfig.Search, Ndots: clientConfig.Ndots}
+	for _, server := range clientConfig.Servers {
+		addr, err := netip.ParseAddr(server)
+		if err != nil {
+			continue
+		}
+		config.Nameservers = append(config.Nameservers, netip.AddrPortFrom(addr, uint16(port)))
+	}
+	return config, nil
+}
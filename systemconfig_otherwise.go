@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !unix && !windows
+
+package minest
+
+// newDefaultSystemConfig returns a [SystemConfig] failing with [ErrSystemConfigUnsupported]
+// because we do not know how to read the DNS configuration on this platform.
+func newDefaultSystemConfig() SystemConfig {
+	return unsupportedSystemConfig{}
+}
+
+// unsupportedSystemConfig is the [SystemConfig] used on unsupported platforms.
+type unsupportedSystemConfig struct{}
+
+// ReadSystemDNSConfig implements [SystemConfig].
+func (unsupportedSystemConfig) ReadSystemDNSConfig() (*SystemDNSConfig, error) {
+	return nil, ErrSystemConfigUnsupported
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResolvConfSystemConfig(t *testing.T) {
+	sc := NewResolvConfSystemConfig()
+	assert.Equal(t, DefaultResolvConfPath, sc.Path)
+	assert.NotNil(t, DefaultSystemConfig())
+}
+
+func TestResolvConfSystemConfig(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// content is the resolv.conf content.
+		content string
+
+		// want is the expected configuration.
+		want *SystemDNSConfig
+	}
+
+	tests := []testCase{
+		{
+			name: "typical file",
+			content: "# comment\n" +
+				"nameserver 192.0.2.53\n" +
+				"nameserver 2001:db8::53\n" +
+				"nameserver dns.example.com\n" +
+				"search example.com example.net\n" +
+				"options ndots:2 timeout:1\n",
+			want: &SystemDNSConfig{
+				Nameservers: []netip.AddrPort{
+					netip.MustParseAddrPort("192.0.2.53:53"),
+					netip.MustParseAddrPort("[2001:db8::53]:53"),
+				},
+				Search: []string{"example.com", "example.net"},
+				Ndots:  2,
+			},
+		},
+
+		{
+			name:    "empty file",
+			content: "",
+			want:    &SystemDNSConfig{Search: []string{}, Ndots: 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := NewResolvConfSystemConfig()
+			sc.Path = filepath.Join(t.TempDir(), "resolv.conf")
+			require.NoError(t, os.WriteFile(sc.Path, []byte(tc.content), 0600))
+
+			config, err := sc.ReadSystemDNSConfig()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, config)
+		})
+	}
+}
+
+func TestResolvConfSystemConfigMissingFile(t *testing.T) {
+	sc := NewResolvConfSystemConfig()
+	sc.Path = filepath.Join(t.TempDir(), "nonexistent")
+	config, err := sc.ReadSystemDNSConfig()
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.Nil(t, config)
+}
+
+func TestSystemDNSConfigNewResolver(t *testing.T) {
+	config := &SystemDNSConfig{
+		Nameservers: []netip.AddrPort{
+			netip.MustParseAddrPort("192.0.2.53:53"),
+			netip.MustParseAddrPort("[2001:db8::53]:53"),
+		},
+	}
+	reso := config.NewResolver(&net.Dialer{})
+	require.Len(t, reso.Transports, 2)
+	for idx, txp := range reso.Transports {
+		udp, ok := txp.(*DNSOverUDPTransport)
+		require.True(t, ok)
+		assert.Equal(t, config.Nameservers[idx], udp.Endpoint)
+	}
+}
@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build unix
+
+package minest
+
+// newDefaultSystemConfig returns a [*ResolvConfSystemConfig] using [DefaultResolvConfPath].
+func newDefaultSystemConfig() SystemConfig {
+	return NewResolvConfSystemConfig()
+}
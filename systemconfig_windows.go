@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build windows
+
+package minest
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// newDefaultSystemConfig returns a [WindowsSystemConfig].
+func newDefaultSystemConfig() SystemConfig {
+	return WindowsSystemConfig{}
+}
+
+// WindowsSystemConfig is a [SystemConfig] obtaining the nameservers and the
+// per-adapter DNS suffixes using GetAdaptersAddresses and the global search
+// list from the registry, which is what the Windows stub resolver uses.
+type WindowsSystemConfig struct{}
+
+// Ensure that [WindowsSystemConfig] implements [SystemConfig].
+var _ SystemConfig = WindowsSystemConfig{}
+
+// ReadSystemDNSConfig implements [SystemConfig].
+func (WindowsSystemConfig) ReadSystemDNSConfig() (*SystemDNSConfig, error) {
+	// 1. obtain the adapters
+	adapters, err := windowsAdapterAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. start from the global search list, if any
+	config := &SystemDNSConfig{Search: windowsSearchList(), Ndots: 1}
+
+	// 3. collect the nameservers and suffixes of the adapters that are up
+	for _, aa := range adapters {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for server := aa.FirstDnsServerAddress; server != nil; server = server.Next {
+			addr, ok := windowsSockaddrAddr(server.Address)
+			if !ok || windowsIsDeprecatedSiteLocal(addr) {
+				continue
+			}
+			endpoint := netip.AddrPortFrom(addr, 53)
+			if !slices.Contains(config.Nameservers, endpoint) {
+				config.Nameservers = append(config.Nameservers, endpoint)
+			}
+		}
+		if suffix := windows.UTF16PtrToString(aa.DnsSuffix); suffix != "" && !slices.Contains(config.Search, suffix) {
+			config.Search = append(config.Search, suffix)
+		}
+	}
+	return config, nil
+}
+
+// windowsAdapterAddresses returns the network adapters using GetAdaptersAddresses.
+func windowsAdapterAddresses() ([]*windows.IpAdapterAddresses, error) {
+	// 1. call the API growing the buffer until it is large enough
+	size := uint32(15000) // recommended initial size
+	var buff []byte
+	for {
+		buff = make([]byte, size)
+		err := windows.GetAdaptersAddresses(syscall.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_PREFIX, 0,
+			(*windows.IpAdapterAddresses)(unsafe.Pointer(&buff[0])), &size)
+		if err == nil {
+			if size == 0 {
+				return nil, nil
+			}
+			break
+		}
+		if !errors.Is(err, windows.ERROR_BUFFER_OVERFLOW) || size <= uint32(len(buff)) {
+			return nil, os.NewSyscallError("getadaptersaddresses", err)
+		}
+	}
+
+	// 2. walk the linked list
+	var adapters []*windows.IpAdapterAddresses
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buff[0])); aa != nil; aa = aa.Next {
+		adapters = append(adapters, aa)
+	}
+	return adapters, nil
+}
+
+// windowsSockaddrAddr returns the IP address of the given socket address.
+func windowsSockaddrAddr(sa windows.SocketAddress) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(sa.IP())
+	return addr.Unmap(), ok
+}
+
+// windowsIsDeprecatedSiteLocal returns whether the address is one of the
+// deprecated fec0:0:0:ffff::{1,2,3} addresses that Windows configures by
+// default when there is no IPv6 DNS server, which the standard library skips.
+func windowsIsDeprecatedSiteLocal(addr netip.Addr) bool {
+	if !addr.Is6() {
+		return false
+	}
+	raw := addr.As16()
+	prefix := [14]byte{0xfe, 0xc0, 0, 0, 0, 0, 0xff, 0xff}
+	return [14]byte(raw[:14]) == prefix && raw[14] == 0 && raw[15] >= 1 && raw[15] <= 3
+}
+
+// windowsSearchList returns the global search list from the registry, if any.
+func windowsSearchList() []string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+	value, _, err := key.GetStringValue("SearchList")
+	if err != nil {
+		return nil
+	}
+	var search []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			search = append(search, entry)
+		}
+	}
+	return search
+}
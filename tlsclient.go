@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// TLSConn is a TLS client connection created by a [TLSClientFactory].
+type TLSConn interface {
+	net.Conn
+	HandshakeContext(ctx context.Context) error
+	ConnectionState() tls.ConnectionState
+}
+
+// Ensure that [*tls.Conn] implements [TLSConn].
+var _ TLSConn = &tls.Conn{}
+
+// TLSClientFactory creates [TLSConn] client connections.
+//
+// This interface allows replacing the TLS stack of the standard library, whose
+// ClientHello is easy to fingerprint and block, for example with uTLS to mimic
+// the ClientHello of mainstream browsers. Because uTLS uses its own connection
+// state type, such an implementation needs to wrap the uTLS connection and
+// convert its state to a [tls.ConnectionState].
+type TLSClientFactory interface {
+	NewTLSClient(conn net.Conn, config *tls.Config) TLSConn
+}
+
+// StdlibTLSClientFactory is a [TLSClientFactory] using the standard library.
+type StdlibTLSClientFactory struct{}
+
+// Ensure that [StdlibTLSClientFactory] implements [TLSClientFactory].
+var _ TLSClientFactory = StdlibTLSClientFactory{}
+
+// NewTLSClient implements [TLSClientFactory].
+func (StdlibTLSClientFactory) NewTLSClient(conn net.Conn, config *tls.Config) TLSConn {
+	return tls.Client(conn, config)
+}
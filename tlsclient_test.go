@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// tlsClientFactoryFunc allows to mock [TLSClientFactory].
+type tlsClientFactoryFunc func(conn net.Conn, config *tls.Config) TLSConn
+
+func (fx tlsClientFactoryFunc) NewTLSClient(conn net.Conn, config *tls.Config) TLSConn {
+	return fx(conn, config)
+}
+
+// failingTLSConn is a [TLSConn] whose handshake fails.
+type failingTLSConn struct {
+	net.Conn
+	err error
+}
+
+func (c *failingTLSConn) HandshakeContext(ctx context.Context) error {
+	return c.err
+}
+
+func (c *failingTLSConn) ConnectionState() tls.ConnectionState {
+	return tls.ConnectionState{}
+}
+
+func TestStdlibTLSClientFactory(t *testing.T) {
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	tconn := StdlibTLSClientFactory{}.NewTLSClient(conn, &tls.Config{ServerName: "dns.example.com"})
+	require.IsType(t, &tls.Conn{}, tconn)
+}
+
+func TestDialerDialTLSContextUsesTLSClientFactory(t *testing.T) {
+	address, pool := newTLSServer(t, "dns.example.com")
+	_, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+
+	resolver := &netstub.FuncResolver{
+		LookupHostFunc: func(context.Context, string) ([]string, error) {
+			return []string{"127.0.0.1"}, nil
+		},
+	}
+	dialer := NewDialer(&net.Dialer{}, resolver)
+	require.Equal(t, StdlibTLSClientFactory{}, dialer.TLSClientFactory)
+	var configs []*tls.Config
+	dialer.TLSClientFactory = tlsClientFactoryFunc(func(conn net.Conn, config *tls.Config) TLSConn {
+		configs = append(configs, config)
+		return tls.Client(conn, config)
+	})
+
+	conn, err := dialer.DialTLSContext(
+		context.Background(), "tcp", net.JoinHostPort("dns.example.com", port), &tls.Config{RootCAs: pool})
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Len(t, configs, 1)
+	require.Equal(t, "dns.example.com", configs[0].ServerName)
+	require.True(t, conn.ConnectionState().HandshakeComplete)
+}
+
+func TestDNSStreamDialExchangeMsgUsesTLSClientFactory(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	dialer := &netstub.FuncDialer{
+		DialContextFunc: func(context.Context, string, string) (net.Conn, error) {
+			conn, _ := net.Pipe()
+			return conn, nil
+		},
+	}
+	factory := tlsClientFactoryFunc(func(conn net.Conn, config *tls.Config) TLSConn {
+		return &failingTLSConn{Conn: conn, err: expectedErr}
+	})
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	endpoint := netip.MustParseAddrPort("127.0.0.1:853")
+
+	respMsg, err := dnsStreamDialExchangeMsg(
+		context.Background(), dialer, endpoint, factory, &tls.Config{}, queryMsg, nil)
+	require.ErrorIs(t, err, expectedErr)
+	require.Nil(t, respMsg)
+}
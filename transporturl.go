@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+)
+
+// ErrUnsupportedTransportURL indicates that [NewDNSTransportFromURL] cannot
+// build a [DNSTransport] for the given URL.
+var ErrUnsupportedTransportURL = errors.New("unsupported transport URL")
+
+// NewDNSTransportFromURL creates a [DNSTransport] from a URL, which allows
+// reading lists of resolvers from configuration files.
+//
+// We support the following schemes, where ADDRESS must be an IP address:
+//
+//   - "udp://ADDRESS[:PORT]" for DNS over UDP, where PORT defaults to 53, for
+//     which we return a [*DNSOverUDPTransport];
+//
+//   - "tcp://ADDRESS[:PORT]" for DNS over TCP, where PORT defaults to 53;
+//
+//   - "tls://ADDRESS[:PORT][?sni=NAME]" for DNS over TLS, where PORT defaults
+//     to 853 and NAME is the server name to use for the handshake and for
+//     verifying the certificate, which otherwise must be valid for ADDRESS.
+//
+// The returned transports use the given [NetDialer] and the DNS over TCP and DNS
+// over TLS transports dial a new connection for each exchange. The "https" and
+// "quic" schemes fail with [ErrUnsupportedTransportURL], since the corresponding
+// transports live in separate modules. Link-local IPv6 addresses may include
+// a percent-encoded zone (e.g., "udp://[fe80::1%25eth0]").
+func NewDNSTransportFromURL(dialer NetDialer, rawURL string) (DNSTransport, error) {
+	// 1. parse the URL and make sure we support it
+	URL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var defaultPort uint64
+	switch URL.Scheme {
+	case "udp", "tcp":
+		defaultPort = 53
+	case "tls":
+		defaultPort = 853
+	default:
+		return nil, fmt.Errorf("%w: scheme %q", ErrUnsupportedTransportURL, URL.Scheme)
+	}
+	query := URL.Query()
+	sni := query.Get("sni")
+	query.Del("sni")
+	if URL.Path != "" || len(query) > 0 || URL.User != nil || (sni != "" && URL.Scheme != "tls") {
+		return nil, fmt.Errorf("%w: unexpected path, query, or user info", ErrUnsupportedTransportURL)
+	}
+
+	// 2. parse the endpoint using the default port if needed
+	addr, err := netip.ParseAddr(URL.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedTransportURL, err)
+	}
+	port := defaultPort
+	if value := URL.Port(); value != "" {
+		port, err = strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnsupportedTransportURL, err)
+		}
+	}
+	endpoint := netip.AddrPortFrom(addr, uint16(port))
+
+	// 3. create the transport
+	switch URL.Scheme {
+	case "tcp":
+		return &dnsStreamDialTransport{dialer: dialer, endpoint: endpoint}, nil
+	case "tls":
+		if sni == "" {
+			sni = addr.WithZone("").String()
+		}
+		return &dnsStreamDialTransport{
+			config:   &tls.Config{ServerName: sni},
+			dialer:   dialer,
+			endpoint: endpoint,
+			factory:  StdlibTLSClientFactory{},
+		}, nil
+	default:
+		return NewDNSOverUDPTransport(dialer, endpoint), nil
+	}
+}
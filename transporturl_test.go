@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDNSTransportFromURL(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// URL is the URL to parse.
+		URL string
+
+		// wantEndpoint is the expected endpoint when successful.
+		wantEndpoint netip.AddrPort
+
+		// wantStream is true when we expect a DNS over TCP or TLS transport.
+		wantStream bool
+
+		// wantSNI is the expected SNI for DNS over TLS or empty.
+		wantSNI string
+
+		// wantErr is the error to match, if not nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:         "IPv4 with port",
+			URL:          "udp://8.8.8.8:5353",
+			wantEndpoint: netip.MustParseAddrPort("8.8.8.8:5353"),
+		},
+
+		{
+			name:         "IPv4 with default port",
+			URL:          "udp://8.8.8.8",
+			wantEndpoint: netip.MustParseAddrPort("8.8.8.8:53"),
+		},
+
+		{
+			name:         "IPv6 with default port",
+			URL:          "udp://[2001:4860:4860::8888]",
+			wantEndpoint: netip.MustParseAddrPort("[2001:4860:4860::8888]:53"),
+		},
+
+		{
+			name:         "IPv6 link-local with zone",
+			URL:          "udp://[fe80::1%25eth0]:53",
+			wantEndpoint: netip.MustParseAddrPort("[fe80::1%eth0]:53"),
+		},
+
+		{
+			name:         "DNS over TCP",
+			URL:          "tcp://8.8.8.8",
+			wantEndpoint: netip.MustParseAddrPort("8.8.8.8:53"),
+			wantStream:   true,
+		},
+
+		{
+			name:         "DNS over TLS with SNI",
+			URL:          "tls://1.1.1.1:853?sni=cloudflare-dns.com",
+			wantEndpoint: netip.MustParseAddrPort("1.1.1.1:853"),
+			wantStream:   true,
+			wantSNI:      "cloudflare-dns.com",
+		},
+
+		{
+			name:         "DNS over TLS with default port and without SNI",
+			URL:          "tls://[2606:4700:4700::1111]",
+			wantEndpoint: netip.MustParseAddrPort("[2606:4700:4700::1111]:853"),
+			wantStream:   true,
+			wantSNI:      "2606:4700:4700::1111",
+		},
+
+		{
+			name:    "SNI with DNS over TCP",
+			URL:     "tcp://8.8.8.8?sni=dns.google",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name:    "unexpected query parameter",
+			URL:     "tls://1.1.1.1?sni=cloudflare-dns.com&foo=bar",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name:    "DNS over HTTPS",
+			URL:     "https://dns.google/dns-query",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name:    "DNS over QUIC",
+			URL:     "quic://dns.adguard.com:853",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name:    "domain name instead of address",
+			URL:     "udp://dns.google:53",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name:    "invalid port",
+			URL:     "udp://8.8.8.8:65536",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name:    "unexpected path",
+			URL:     "udp://8.8.8.8:53/dns-query",
+			wantErr: ErrUnsupportedTransportURL,
+		},
+
+		{
+			name: "invalid URL",
+			URL:  "udp://[::1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := &net.Dialer{}
+			txp, err := NewDNSTransportFromURL(dialer, tc.URL)
+			switch {
+			case tc.wantErr != nil:
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, txp)
+			case !tc.wantEndpoint.IsValid():
+				require.Error(t, err)
+				require.Nil(t, txp)
+			case tc.wantStream:
+				require.NoError(t, err)
+				stream, ok := txp.(*dnsStreamDialTransport)
+				require.True(t, ok)
+				require.Equal(t, tc.wantEndpoint, stream.endpoint)
+				require.Same(t, dialer, stream.dialer)
+				if tc.wantSNI == "" {
+					require.Nil(t, stream.config)
+					return
+				}
+				require.Equal(t, tc.wantSNI, stream.config.ServerName)
+				require.Equal(t, StdlibTLSClientFactory{}, stream.factory)
+			default:
+				require.NoError(t, err)
+				udp, ok := txp.(*DNSOverUDPTransport)
+				require.True(t, ok)
+				require.Equal(t, tc.wantEndpoint, udp.Endpoint)
+				require.Same(t, dialer, udp.Dialer)
+			}
+		})
+	}
+}
+
+func TestNewDNSTransportFromURLTCPExchange(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	startDNSServer(t, &dns.Server{Listener: listener, Handler: dns.HandlerFunc(
+		func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+			respMsg := new(dns.Msg)
+			respMsg.SetReply(queryMsg)
+			respMsg.Answer = append(respMsg.Answer,
+				runtimex.PanicOnError1(dns.NewRR("example.com. 60 IN A 93.184.216.34")))
+			w.WriteMsg(respMsg)
+		})})
+
+	txp, err := NewDNSTransportFromURL(&net.Dialer{}, "tcp://"+listener.Addr().String())
+	require.NoError(t, err)
+	addrs, err := NewResolver(txp).LookupA(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"93.184.216.34"}, addrs)
+}
+
+func TestDNSStreamDialTransportEDNS(t *testing.T) {
+	var opts []*dns.OPT
+	address := newStreamDNSServer(t, func(w dns.ResponseWriter, queryMsg *dns.Msg) {
+		opts = append(opts, queryMsg.IsEdns0())
+		answerWithA(w, queryMsg)
+	})
+	txp := &dnsStreamDialTransport{dialer: &net.Dialer{}, endpoint: netip.MustParseAddrPort(address)}
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+
+	txp.maxSize = 1232
+	_, err := txp.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	txp.disableEDNS = true
+	_, err = txp.Exchange(context.Background(), query)
+	require.NoError(t, err)
+
+	require.Len(t, opts, 2)
+	require.NotNil(t, opts[0])
+	require.Equal(t, uint16(1232), opts[0].UDPSize())
+	require.Nil(t, opts[1])
+}
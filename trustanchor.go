@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidTrustAnchors indicates that the trust anchors do not contain any DS or DNSKEY record.
+var ErrInvalidTrustAnchors = errors.New("invalid trust anchors")
+
+// defaultRootTrustAnchors contains the IANA root zone KSKs (KSK-2017 and KSK-2024).
+const defaultRootTrustAnchors = `
+. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+
+// Trust anchor states (RFC 5011 Section 4).
+const (
+	// TrustAnchorStateAddPending indicates a new key in the hold-down period.
+	TrustAnchorStateAddPending = "add_pending"
+
+	// TrustAnchorStateValid indicates a trusted key.
+	TrustAnchorStateValid = "valid"
+
+	// TrustAnchorStateMissing indicates a trusted key missing from the DNSKEY RRset.
+	TrustAnchorStateMissing = "missing"
+
+	// TrustAnchorStateRevoked indicates a key with the REVOKE bit set.
+	TrustAnchorStateRevoked = "revoked"
+)
+
+// TrustAnchorKey is a key tracked by [*TrustAnchorStore].
+type TrustAnchorKey struct {
+	// DS is the DS record identifying the key.
+	DS *dns.DS
+
+	// DNSKEY is the last observed DNSKEY record or nil.
+	DNSKEY *dns.DNSKEY
+
+	// State is the key state (e.g., [TrustAnchorStateValid]).
+	State string
+
+	// FirstSeen is when we first observed the key or the zero value
+	// for keys loaded from the configuration.
+	FirstSeen time.Time
+
+	// LastSeen is when we last observed the key or the zero value.
+	LastSeen time.Time
+}
+
+// TrustAnchorEvent describes a key state transition.
+type TrustAnchorEvent struct {
+	// KeyTag is the key tag of the key.
+	KeyTag uint16
+
+	// Algorithm is the key algorithm.
+	Algorithm uint8
+
+	// OldState is the previous state or empty for new keys.
+	OldState string
+
+	// NewState is the new state or empty for removed keys.
+	NewState string
+
+	// Time is when the transition occurred.
+	Time time.Time
+}
+
+// TrustAnchorStore contains the trust anchors of a zone and tracks their
+// rollover by observing the zone DNSKEY RRset, following RFC 5011.
+//
+// A [*TrustAnchorStore] is safe for concurrent use.
+//
+// Construct using [NewTrustAnchorStore] or [LoadTrustAnchors].
+type TrustAnchorStore struct {
+	// AddHoldDown is the time for which a new key must be continuously
+	// observed before it becomes valid.
+	//
+	// Set by [NewTrustAnchorStore] and [LoadTrustAnchors] to 30 days.
+	AddHoldDown time.Duration
+
+	// keys contains the tracked keys.
+	keys []*TrustAnchorKey
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+}
+
+// NewTrustAnchorStore creates a new [*TrustAnchorStore] containing the IANA root zone KSKs.
+func NewTrustAnchorStore() *TrustAnchorStore {
+	return runtimex.PanicOnError1(LoadTrustAnchors(strings.NewReader(defaultRootTrustAnchors)))
+}
+
+// LoadTrustAnchors creates a new [*TrustAnchorStore] containing the DS and
+// DNSKEY records in the given reader using the zone file format.
+//
+// We consider all the loaded keys valid.
+func LoadTrustAnchors(r io.Reader) (*TrustAnchorStore, error) {
+	store := &TrustAnchorStore{AddHoldDown: 30 * 24 * time.Hour}
+	zp := dns.NewZoneParser(r, ".", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr := rr.(type) {
+		case *dns.DS:
+			store.keys = append(store.keys, &TrustAnchorKey{DS: rr, State: TrustAnchorStateValid})
+		case *dns.DNSKEY:
+			store.keys = append(store.keys, &TrustAnchorKey{
+				DS:     rr.ToDS(dns.SHA256),
+				DNSKEY: rr,
+				State:  TrustAnchorStateValid,
+			})
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if len(store.keys) <= 0 {
+		return nil, ErrInvalidTrustAnchors
+	}
+	return store, nil
+}
+
+// DS returns the DS records of the trusted keys, which include the valid
+// keys and the missing keys, to be used when validating.
+func (s *TrustAnchorStore) DS() []*dns.DS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*dns.DS
+	for _, key := range s.keys {
+		if key.State == TrustAnchorStateValid || key.State == TrustAnchorStateMissing {
+			out = append(out, key.DS)
+		}
+	}
+	return out
+}
+
+// Keys returns a copy of all the tracked keys.
+func (s *TrustAnchorStore) Keys() []TrustAnchorKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]TrustAnchorKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		out = append(out, *key)
+	}
+	return out
+}
+
+// Observe updates the keys state using the given DNSKEY RRset observed at
+// the given time and returns the state transitions.
+//
+// We only consider keys with the SEP flag set. The caller is responsible for
+// validating the RRset using [*TrustAnchorStore.DS] before observing it, for
+// example using the root zone DNSKEY RRset returned by [*Resolver.ChainFetch].
+func (s *TrustAnchorStore) Observe(rrset []dns.RR, now time.Time) []*TrustAnchorEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 1. update the state of the observed keys
+	var events []*TrustAnchorEvent
+	seen := make(map[*TrustAnchorKey]bool)
+	for _, rr := range rrset {
+		dnskey, ok := rr.(*dns.DNSKEY)
+		if !ok || dnskey.Flags&dns.SEP == 0 {
+			continue
+		}
+
+		// 1.1. revoked keys change their key tag, so we need to clear
+		// the REVOKE bit to find the corresponding key
+		unrevoked := dns.Copy(dnskey).(*dns.DNSKEY)
+		unrevoked.Flags &^= dns.REVOKE
+		key := s.find(unrevoked)
+
+		switch {
+		case dnskey.Flags&dns.REVOKE != 0:
+			if key != nil {
+				events = s.transition(events, key, TrustAnchorStateRevoked, now)
+				key.DNSKEY, key.LastSeen = dnskey, now
+				seen[key] = true
+			}
+
+		case key == nil:
+			key = &TrustAnchorKey{DS: dnskey.ToDS(dns.SHA256), DNSKEY: dnskey, FirstSeen: now, LastSeen: now}
+			s.keys = append(s.keys, key)
+			events = s.transition(events, key, TrustAnchorStateAddPending, now)
+			seen[key] = true
+
+		default:
+			key.DNSKEY, key.LastSeen = dnskey, now
+			if key.FirstSeen.IsZero() {
+				key.FirstSeen = now
+			}
+			switch {
+			case key.State == TrustAnchorStateMissing:
+				events = s.transition(events, key, TrustAnchorStateValid, now)
+			case key.State == TrustAnchorStateAddPending && now.Sub(key.FirstSeen) >= s.AddHoldDown:
+				events = s.transition(events, key, TrustAnchorStateValid, now)
+			}
+			seen[key] = true
+		}
+	}
+
+	// 2. handle the keys that are not in the RRset
+	keys := s.keys[:0]
+	for _, key := range s.keys {
+		switch {
+		case seen[key]:
+		case key.State == TrustAnchorStateAddPending:
+			events = s.transition(events, key, "", now)
+			continue // we must restart the hold-down if the key reappears
+		case key.State == TrustAnchorStateValid:
+			events = s.transition(events, key, TrustAnchorStateMissing, now)
+		}
+		keys = append(keys, key)
+	}
+	s.keys = keys
+	return events
+}
+
+// find returns the key matching the given DNSKEY or nil.
+func (s *TrustAnchorStore) find(dnskey *dns.DNSKEY) *TrustAnchorKey {
+	for _, key := range s.keys {
+		if key.DS.KeyTag != dnskey.KeyTag() || key.DS.Algorithm != dnskey.Algorithm {
+			continue
+		}
+		if ds := dnskey.ToDS(key.DS.DigestType); ds != nil && strings.EqualFold(ds.Digest, key.DS.Digest) {
+			return key
+		}
+	}
+	return nil
+}
+
+// transition changes the key state and appends the corresponding event.
+func (s *TrustAnchorStore) transition(
+	events []*TrustAnchorEvent, key *TrustAnchorKey, state string, now time.Time) []*TrustAnchorEvent {
+	if key.State == state {
+		return events
+	}
+	events = append(events, &TrustAnchorEvent{
+		KeyTag:    key.DS.KeyTag,
+		Algorithm: key.DS.Algorithm,
+		OldState:  key.State,
+		NewState:  state,
+		Time:      now,
+	})
+	key.State = state
+	return events
+}
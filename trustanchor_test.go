@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTrustAnchorKSK generates a new root zone KSK.
+func newTrustAnchorKSK(t *testing.T) *dns.DNSKEY {
+	t.Helper()
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: ".", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 172800},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	_, err := dnskey.Generate(256)
+	require.NoError(t, err)
+	return dnskey
+}
+
+// revokeTrustAnchorKSK returns a copy of the given KSK with the REVOKE bit set.
+func revokeTrustAnchorKSK(dnskey *dns.DNSKEY) *dns.DNSKEY {
+	revoked := dns.Copy(dnskey).(*dns.DNSKEY)
+	revoked.Flags |= dns.REVOKE
+	return revoked
+}
+
+func TestNewTrustAnchorStore(t *testing.T) {
+	store := NewTrustAnchorStore()
+	ds := store.DS()
+	require.Len(t, ds, 2)
+	assert.Equal(t, uint16(20326), ds[0].KeyTag)
+	assert.Equal(t, uint16(38696), ds[1].KeyTag)
+	assert.Equal(t, 30*24*time.Hour, store.AddHoldDown)
+}
+
+func TestLoadTrustAnchors(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// input is the zone file content.
+		input string
+
+		// wantKeys is the expected number of keys.
+		wantKeys int
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	tests := []testCase{
+		{
+			name:     "DS and DNSKEY records",
+			input:    newTrustAnchorKSK(t).String() + "\n. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D\n",
+			wantKeys: 2,
+		},
+
+		{
+			name:    "no anchors",
+			input:   ". 3600 IN NS a.root-servers.net.\n",
+			wantErr: true,
+		},
+
+		{
+			name:    "syntax error",
+			input:   ". IN DS 20326 8\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := LoadTrustAnchors(strings.NewReader(tc.input))
+			if tc.wantErr {
+				require.Error(t, err)
+				assert.Nil(t, store)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, store.DS(), tc.wantKeys)
+			for _, key := range store.Keys() {
+				assert.Equal(t, TrustAnchorStateValid, key.State)
+			}
+		})
+	}
+}
+
+func TestTrustAnchorStoreObserve(t *testing.T) {
+	ksk1, ksk2, ksk3 := newTrustAnchorKSK(t), newTrustAnchorKSK(t), newTrustAnchorKSK(t)
+	store, err := LoadTrustAnchors(strings.NewReader(ksk1.String()))
+	require.NoError(t, err)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// transition is a compact representation of [*TrustAnchorEvent].
+	type transition struct {
+		keyTag   uint16
+		oldState string
+		newState string
+	}
+
+	// observe observes the given keys and returns the transitions.
+	observe := func(now time.Time, keys ...*dns.DNSKEY) []transition {
+		var rrset []dns.RR
+		for _, key := range keys {
+			rrset = append(rrset, key)
+		}
+		var out []transition
+		for _, ev := range store.Observe(rrset, now) {
+			assert.Equal(t, now, ev.Time)
+			assert.Equal(t, dns.ECDSAP256SHA256, ev.Algorithm)
+			out = append(out, transition{ev.KeyTag, ev.OldState, ev.NewState})
+		}
+		return out
+	}
+
+	// 1. observing the trusted key does not change anything
+	assert.Empty(t, observe(t0, ksk1))
+
+	// 2. a new key enters the hold-down period
+	assert.Equal(t, []transition{
+		{ksk2.KeyTag(), "", TrustAnchorStateAddPending},
+	}, observe(t0, ksk1, ksk2))
+	assert.Len(t, store.DS(), 1)
+
+	// 3. the new key becomes valid after the hold-down period
+	assert.Empty(t, observe(t0.Add(29*24*time.Hour), ksk1, ksk2))
+	assert.Equal(t, []transition{
+		{ksk2.KeyTag(), TrustAnchorStateAddPending, TrustAnchorStateValid},
+	}, observe(t0.Add(30*24*time.Hour), ksk1, ksk2))
+	assert.Len(t, store.DS(), 2)
+
+	// 4. a pending key disappearing is removed
+	t1 := t0.Add(31 * 24 * time.Hour)
+	assert.Equal(t, []transition{
+		{ksk3.KeyTag(), "", TrustAnchorStateAddPending},
+	}, observe(t1, ksk1, ksk2, ksk3))
+	assert.Equal(t, []transition{
+		{ksk3.KeyTag(), TrustAnchorStateAddPending, ""},
+	}, observe(t1, ksk1, ksk2))
+	assert.Len(t, store.Keys(), 2)
+
+	// 5. the old key is revoked
+	assert.Equal(t, []transition{
+		{ksk1.KeyTag(), TrustAnchorStateValid, TrustAnchorStateRevoked},
+	}, observe(t1, revokeTrustAnchorKSK(ksk1), ksk2))
+	assert.Equal(t, []*dns.DS{ksk2.ToDS(dns.SHA256)}, store.DS())
+	assert.Empty(t, observe(t1, ksk2))
+
+	// 6. the current key goes missing and then reappears
+	assert.Equal(t, []transition{
+		{ksk2.KeyTag(), TrustAnchorStateValid, TrustAnchorStateMissing},
+	}, observe(t1))
+	assert.Len(t, store.DS(), 1)
+	assert.Equal(t, []transition{
+		{ksk2.KeyTag(), TrustAnchorStateMissing, TrustAnchorStateValid},
+	}, observe(t1, ksk2))
+
+	// 7. keys without the SEP flag and unknown revoked keys are ignored
+	zsk := dns.Copy(ksk3).(*dns.DNSKEY)
+	zsk.Flags = dns.ZONE
+	assert.Empty(t, observe(t1, ksk2, zsk, revokeTrustAnchorKSK(ksk3)))
+	assert.Len(t, store.Keys(), 2)
+}
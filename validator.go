@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ResponseValidator validates a response message for a query message and
+// builds the corresponding [*dnscodec.Response].
+//
+// The default pipeline is [dnscodec.ParseResponse], which ensures that the
+// response ID and question match the query, maps the response code to errors,
+// and filters the answers following the CNAME chain. Implementing this interface
+// allows relaxing or extending these checks (e.g., recording 0x20 case mismatches,
+// which the default pipeline accepts) without forking the transports.
+//
+// Transports that receive datagrams for several queries skip the responses
+// for which the validator fails with [dnscodec.ErrInvalidResponse], since
+// these are most likely responses for other queries.
+type ResponseValidator interface {
+	ValidateResponse(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error)
+}
+
+// ResponseValidatorFunc allows using a function as a [ResponseValidator].
+type ResponseValidatorFunc func(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error)
+
+// Ensure that [ResponseValidatorFunc] implements [ResponseValidator].
+var _ ResponseValidator = ResponseValidatorFunc(nil)
+
+// ValidateResponse implements [ResponseValidator].
+func (fx ResponseValidatorFunc) ValidateResponse(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+	return fx(queryMsg, respMsg)
+}
+
+// validateResponse validates the response using the given OPTIONAL
+// validator, falling back to [dnscodec.ParseResponse] when nil.
+func validateResponse(validator ResponseValidator, queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+	if validator == nil {
+		return dnscodec.ParseResponse(queryMsg, respMsg)
+	}
+	return validator.ValidateResponse(queryMsg, respMsg)
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relaxedIDValidator is a [ResponseValidator] accepting responses with
+// a mismatching ID and recording the mismatching IDs.
+type relaxedIDValidator struct {
+	mismatches []uint16
+}
+
+func (v *relaxedIDValidator) ValidateResponse(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+	if respMsg.Id != queryMsg.Id {
+		v.mismatches = append(v.mismatches, respMsg.Id)
+		respMsg = respMsg.Copy()
+		respMsg.Id = queryMsg.Id
+	}
+	return dnscodec.ParseResponse(queryMsg, respMsg)
+}
+
+func TestResponseValidatorFunc(t *testing.T) {
+	expectedErr := errors.New("mocked error")
+	validator := ResponseValidatorFunc(func(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+		return nil, expectedErr
+	})
+	resp, err := validator.ValidateResponse(new(dns.Msg), new(dns.Msg))
+	require.ErrorIs(t, err, expectedErr)
+	require.Nil(t, resp)
+}
+
+func TestDNSOverStreamTransportValidator(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// validator is the validator to use or nil.
+		validator *relaxedIDValidator
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	tests := []testCase{
+		{
+			name:      "default validation",
+			validator: nil,
+			wantErr:   dnscodec.ErrInvalidResponse,
+		},
+
+		{
+			name:      "relaxed validation",
+			validator: &relaxedIDValidator{},
+			wantErr:   nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stream := newDNSOverStreamServer(t, func(queryMsg *dns.Msg) *dns.Msg {
+				respMsg := dnsOverStreamAnswer(queryMsg)
+				respMsg.Id = queryMsg.Id + 1
+				return respMsg
+			})
+			txp := NewDNSOverStreamTransport(stream)
+			defer txp.Close()
+			if tc.validator != nil {
+				txp.Validator = tc.validator
+			}
+
+			resp, err := txp.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, resp)
+				return
+			}
+			require.NoError(t, err)
+			addrs, err := resp.RecordsA()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"93.184.216.34"}, addrs)
+			assert.Len(t, tc.validator.mismatches, 1)
+		})
+	}
+}
+
+func TestDNSOverUDPTransportValidator(t *testing.T) {
+	var rawResp []byte
+	conn := &netstub.FuncConn{
+		WriteFunc: func(b []byte) (int, error) {
+			rawResp = buildRawResponseFromQuery(t, b)
+			return len(b), nil
+		},
+		ReadFunc: func(b []byte) (int, error) {
+			return copy(b, rawResp), nil
+		},
+	}
+	transport := NewDNSOverUDPTransport(&netstub.FuncDialer{}, netip.MustParseAddrPort("127.0.0.1:53"))
+	expectedErr := errors.New("mocked error")
+	var called bool
+	transport.Validator = ResponseValidatorFunc(func(queryMsg, respMsg *dns.Msg) (*dnscodec.Response, error) {
+		called = true
+		return nil, expectedErr
+	})
+
+	resp, err := transport.ExchangeWithConn(context.Background(), conn, dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, expectedErr)
+	require.Nil(t, resp)
+	require.True(t, called)
+}
@@ -0,0 +1,319 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// Blocking outcomes produced by [DetectBlocking].
+const (
+	// BlockingAccessible indicates that the domain resolves normally.
+	BlockingAccessible = "accessible"
+
+	// BlockingInconclusive indicates that the evidence is not sufficient.
+	BlockingInconclusive = "inconclusive"
+
+	// BlockingDNSBogon indicates that the resolver returned bogon addresses.
+	BlockingDNSBogon = "dns.bogon"
+
+	// BlockingDNSFiltered indicates that the resolver declared filtering
+	// the domain using an extended DNS error (RFC 8914).
+	BlockingDNSFiltered = "dns.filtered"
+
+	// BlockingDNSInconsistent indicates that the answers differ from the
+	// control, which may also be caused by CDNs.
+	BlockingDNSInconsistent = "dns.inconsistent"
+
+	// BlockingDNSInjection indicates that we received distinct responses
+	// for the same query, which is typical of on-path injection.
+	BlockingDNSInjection = "dns.injection"
+
+	// BlockingDNSNXDOMAIN indicates NXDOMAIN while the control resolves the domain.
+	BlockingDNSNXDOMAIN = "dns.nxdomain"
+
+	// BlockingDNSTimeout indicates a timeout while the control resolves the domain.
+	BlockingDNSTimeout = "dns.timeout"
+
+	// BlockingDNSUDP indicates that DNS over UDP times out while the
+	// resolver is reachable using other protocols.
+	BlockingDNSUDP = "dns.udp_blocking"
+
+	// BlockingDoT indicates that DNS over TLS connections are reset
+	// while the resolver is reachable using other protocols.
+	BlockingDoT = "dot.blocking"
+)
+
+// BlockingEvidence contains the evidence used by [DetectBlocking].
+//
+// All the fields are OPTIONAL. The more evidence, the more accurate the verdict.
+type BlockingEvidence struct {
+	// Measurement is the measurement using the resolver under test. Using
+	// [*DNSOverUDPUnconnectedTransport] also collects injected datagrams.
+	Measurement *DNSMeasurement
+
+	// Control is the measurement of the same query using a resolver
+	// we assume is not subject to blocking.
+	Control *DNSMeasurement
+
+	// Endpoint is the report comparing protocols for the resolver under test.
+	Endpoint *EndpointReport
+}
+
+// BlockingFinding is a piece of evidence supporting an outcome.
+type BlockingFinding struct {
+	// Outcome is the supported outcome (e.g., [BlockingDNSBogon]).
+	Outcome string
+
+	// Confidence is the confidence in the outcome between 0 and 1.
+	Confidence float64
+
+	// Reason describes the finding.
+	Reason string
+}
+
+// BlockingVerdict is the verdict produced by [DetectBlocking].
+type BlockingVerdict struct {
+	// Outcome is the outcome of the finding with the highest confidence
+	// or [BlockingInconclusive] when there are no findings.
+	Outcome string
+
+	// Confidence is the confidence of the outcome between 0 and 1.
+	Confidence float64
+
+	// Findings contains all the findings sorted by descending confidence.
+	Findings []*BlockingFinding
+}
+
+// DetectBlocking combines the given evidence into a [*BlockingVerdict].
+func DetectBlocking(evidence *BlockingEvidence) *BlockingVerdict {
+	// 1. collect the findings from each piece of evidence
+	var findings []*BlockingFinding
+	if evidence.Measurement != nil {
+		findings = append(findings, blockingMeasurementFindings(evidence.Measurement, evidence.Control)...)
+	}
+	if evidence.Endpoint != nil {
+		findings = append(findings, blockingEndpointFindings(evidence.Endpoint)...)
+	}
+
+	// 2. select the finding with the highest confidence
+	slices.SortStableFunc(findings, func(a, b *BlockingFinding) int {
+		return cmp.Compare(b.Confidence, a.Confidence)
+	})
+	verdict := &BlockingVerdict{Outcome: BlockingInconclusive, Findings: findings}
+	if len(findings) > 0 {
+		verdict.Outcome = findings[0].Outcome
+		verdict.Confidence = findings[0].Confidence
+	}
+	return verdict
+}
+
+// blockingBogons contains the prefixes that should not appear in public answers.
+var blockingBogons = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// blockingIsBogon returns whether the given address is a bogon.
+func blockingIsBogon(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range blockingBogons {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockingUnpack unpacks the raw response of the given measurement or returns nil.
+//
+// We use the raw response because Response is nil for RCODE errors.
+func blockingUnpack(m *DNSMeasurement) *dns.Msg {
+	if m == nil || m.RawResponse == nil {
+		return nil
+	}
+	respMsg := new(dns.Msg)
+	if respMsg.Unpack(m.RawResponse) != nil {
+		return nil
+	}
+	return respMsg
+}
+
+// blockingAddrs returns the A and AAAA addresses in the given response.
+func blockingAddrs(respMsg *dns.Msg) []netip.Addr {
+	var addrs []netip.Addr
+	for _, rr := range respMsg.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			if addr, ok := netip.AddrFromSlice(rr.A); ok {
+				addrs = append(addrs, addr.Unmap())
+			}
+		case *dns.AAAA:
+			if addr, ok := netip.AddrFromSlice(rr.AAAA); ok {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// blockingMeasurementFindings returns the findings for the given measurement
+// and the OPTIONAL control measurement.
+func blockingMeasurementFindings(m, control *DNSMeasurement) []*BlockingFinding {
+	var findings []*BlockingFinding
+	respMsg, controlMsg := blockingUnpack(m), blockingUnpack(control)
+	controlOK := controlMsg != nil && controlMsg.Rcode == dns.RcodeSuccess && len(blockingAddrs(controlMsg)) > 0
+
+	// 1. distinct responses for the same query indicate injection
+	var distinct [][]byte
+	for _, datagram := range m.Datagrams {
+		if !slices.ContainsFunc(distinct, func(raw []byte) bool { return bytes.Equal(raw, datagram.RawResponse) }) {
+			distinct = append(distinct, datagram.RawResponse)
+		}
+		if datagram.UnexpectedSource {
+			findings = append(findings, &BlockingFinding{
+				Outcome:    BlockingDNSInjection,
+				Confidence: 0.9,
+				Reason:     fmt.Sprintf("received response from unexpected source %s", datagram.Source),
+			})
+		}
+	}
+	if len(distinct) >= 2 {
+		findings = append(findings, &BlockingFinding{
+			Outcome:    BlockingDNSInjection,
+			Confidence: 0.9,
+			Reason:     fmt.Sprintf("received %d distinct responses", len(distinct)),
+		})
+	}
+
+	// 2. handle the case where we did not receive any response
+	if respMsg == nil {
+		if m.Failure == FailureGenericTimeout && controlOK {
+			findings = append(findings, &BlockingFinding{
+				Outcome:    BlockingDNSTimeout,
+				Confidence: 0.5,
+				Reason:     "timeout while the control resolves the domain",
+			})
+		}
+		return findings
+	}
+
+	// 3. resolvers may explicitly declare filtering using EDE
+	if opt := respMsg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			ede, ok := option.(*dns.EDNS0_EDE)
+			if !ok {
+				continue
+			}
+			switch ede.InfoCode {
+			case dns.ExtendedErrorCodeBlocked, dns.ExtendedErrorCodeCensored,
+				dns.ExtendedErrorCodeFiltered, dns.ExtendedErrorCodeProhibited:
+				findings = append(findings, &BlockingFinding{
+					Outcome:    BlockingDNSFiltered,
+					Confidence: 0.95,
+					Reason:     fmt.Sprintf("extended DNS error: %s", dns.ExtendedErrorCodeToString[ede.InfoCode]),
+				})
+			}
+		}
+	}
+
+	// 4. compare NXDOMAIN with the control
+	if respMsg.Rcode == dns.RcodeNameError && controlOK {
+		findings = append(findings, &BlockingFinding{
+			Outcome:    BlockingDNSNXDOMAIN,
+			Confidence: 0.8,
+			Reason:     "NXDOMAIN while the control resolves the domain",
+		})
+	}
+
+	// 5. check for bogons and compare the answers with the control
+	addrs := blockingAddrs(respMsg)
+	for _, addr := range addrs {
+		if blockingIsBogon(addr) {
+			findings = append(findings, &BlockingFinding{
+				Outcome:    BlockingDNSBogon,
+				Confidence: 0.8,
+				Reason:     fmt.Sprintf("answer contains bogon %s", addr),
+			})
+		}
+	}
+	if len(findings) > 0 || respMsg.Rcode != dns.RcodeSuccess || len(addrs) <= 0 {
+		return findings
+	}
+	if !controlOK {
+		findings = append(findings, &BlockingFinding{
+			Outcome:    BlockingAccessible,
+			Confidence: 0.6,
+			Reason:     "resolved the domain without a control to compare with",
+		})
+		return findings
+	}
+	controlAddrs := blockingAddrs(controlMsg)
+	for _, addr := range addrs {
+		if slices.Contains(controlAddrs, addr) {
+			findings = append(findings, &BlockingFinding{
+				Outcome:    BlockingAccessible,
+				Confidence: 0.9,
+				Reason:     "answers overlap with the control",
+			})
+			return findings
+		}
+	}
+	findings = append(findings, &BlockingFinding{
+		Outcome:    BlockingDNSInconsistent,
+		Confidence: 0.3,
+		Reason:     "answers do not overlap with the control",
+	})
+	return findings
+}
+
+// blockingEndpointFindings returns the findings for the given endpoint report.
+func blockingEndpointFindings(report *EndpointReport) []*BlockingFinding {
+	var findings []*BlockingFinding
+	results := make(map[string]*EndpointProtocolResult)
+	for _, result := range report.Results {
+		results[result.Protocol] = result
+	}
+	reachableExcept := func(protocol string) bool {
+		for _, result := range report.Results {
+			if result.Protocol != protocol && result.Reachable {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 1. UDP timeouts while other protocols work
+	if udp := results["udp"]; udp != nil && udp.Failure == FailureGenericTimeout && reachableExcept("udp") {
+		findings = append(findings, &BlockingFinding{
+			Outcome:    BlockingDNSUDP,
+			Confidence: 0.7,
+			Reason:     "DNS over UDP times out while other protocols work",
+		})
+	}
+
+	// 2. DoT resets while other protocols work
+	if dot := results["dot"]; dot != nil && dot.Failure == FailureConnectionReset && reachableExcept("dot") {
+		findings = append(findings, &BlockingFinding{
+			Outcome:    BlockingDoT,
+			Confidence: 0.8,
+			Reason:     "DNS over TLS connections are reset while other protocols work",
+		})
+	}
+	return findings
+}
@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package minest
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlockingMeasurement creates a [*DNSMeasurement] whose raw response has
+// the given rcode, the given A answers, and the OPTIONAL EDE info code.
+func newBlockingMeasurement(t *testing.T, rcode int, ede uint16, addrs ...string) *DNSMeasurement {
+	t.Helper()
+	queryMsg := new(dns.Msg)
+	queryMsg.SetQuestion("example.com.", dns.TypeA)
+	respMsg := new(dns.Msg)
+	respMsg.SetRcode(queryMsg, rcode)
+	for _, addr := range addrs {
+		respMsg.Answer = append(respMsg.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP(addr),
+		})
+	}
+	if ede != 0 {
+		opt := respMsg.SetEdns0(1232, false).IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: ede})
+	}
+	rawResp, err := respMsg.Pack()
+	require.NoError(t, err)
+	return &DNSMeasurement{RawResponse: rawResp}
+}
+
+func TestDetectBlocking(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// evidence returns the evidence to use.
+		evidence func(t *testing.T) *BlockingEvidence
+
+		// wantOutcome is the expected outcome.
+		wantOutcome string
+
+		// wantConfidence is the expected confidence.
+		wantConfidence float64
+	}
+
+	tests := []testCase{
+		{
+			name: "no evidence",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{}
+			},
+			wantOutcome:    BlockingInconclusive,
+			wantConfidence: 0,
+		},
+
+		{
+			name: "accessible without control",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+				}
+			},
+			wantOutcome:    BlockingAccessible,
+			wantConfidence: 0.6,
+		},
+
+		{
+			name: "accessible consistent with control",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+					Control:     newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34", "93.184.216.35"),
+				}
+			},
+			wantOutcome:    BlockingAccessible,
+			wantConfidence: 0.9,
+		},
+
+		{
+			name: "inconsistent with control",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeSuccess, 0, "1.1.1.1"),
+					Control:     newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+				}
+			},
+			wantOutcome:    BlockingDNSInconsistent,
+			wantConfidence: 0.3,
+		},
+
+		{
+			name: "bogon answer",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeSuccess, 0, "10.10.34.35"),
+				}
+			},
+			wantOutcome:    BlockingDNSBogon,
+			wantConfidence: 0.8,
+		},
+
+		{
+			name: "NXDOMAIN with control",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeNameError, 0),
+					Control:     newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+				}
+			},
+			wantOutcome:    BlockingDNSNXDOMAIN,
+			wantConfidence: 0.8,
+		},
+
+		{
+			name: "NXDOMAIN without control",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeNameError, 0),
+				}
+			},
+			wantOutcome:    BlockingInconclusive,
+			wantConfidence: 0,
+		},
+
+		{
+			name: "extended DNS error",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeNameError, dns.ExtendedErrorCodeCensored),
+					Control:     newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+				}
+			},
+			wantOutcome:    BlockingDNSFiltered,
+			wantConfidence: 0.95,
+		},
+
+		{
+			name: "injected duplicates",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				m := newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34")
+				injected := newBlockingMeasurement(t, dns.RcodeSuccess, 0, "1.2.3.4")
+				m.Datagrams = []*DNSOverUDPDatagram{
+					{RawResponse: injected.RawResponse},
+					{RawResponse: m.RawResponse},
+				}
+				return &BlockingEvidence{Measurement: m}
+			},
+			wantOutcome:    BlockingDNSInjection,
+			wantConfidence: 0.9,
+		},
+
+		{
+			name: "identical duplicates",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				m := newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34")
+				m.Datagrams = []*DNSOverUDPDatagram{
+					{RawResponse: m.RawResponse},
+					{RawResponse: m.RawResponse},
+				}
+				return &BlockingEvidence{Measurement: m}
+			},
+			wantOutcome:    BlockingAccessible,
+			wantConfidence: 0.6,
+		},
+
+		{
+			name: "unexpected source",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				m := newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34")
+				m.Datagrams = []*DNSOverUDPDatagram{{
+					Source:           netip.MustParseAddrPort("8.8.4.4:53"),
+					RawResponse:      m.RawResponse,
+					UnexpectedSource: true,
+				}}
+				return &BlockingEvidence{Measurement: m}
+			},
+			wantOutcome:    BlockingDNSInjection,
+			wantConfidence: 0.9,
+		},
+
+		{
+			name: "timeout with control",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: &DNSMeasurement{Failure: FailureGenericTimeout},
+					Control:     newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+				}
+			},
+			wantOutcome:    BlockingDNSTimeout,
+			wantConfidence: 0.5,
+		},
+
+		{
+			name: "timeouts only on UDP",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: &DNSMeasurement{Failure: FailureGenericTimeout},
+					Endpoint: &EndpointReport{Results: []*EndpointProtocolResult{
+						{Protocol: "udp", Failure: FailureGenericTimeout},
+						{Protocol: "tcp", Reachable: true},
+					}},
+				}
+			},
+			wantOutcome:    BlockingDNSUDP,
+			wantConfidence: 0.7,
+		},
+
+		{
+			name: "timeouts on all protocols",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Endpoint: &EndpointReport{Results: []*EndpointProtocolResult{
+						{Protocol: "udp", Failure: FailureGenericTimeout},
+						{Protocol: "tcp", Failure: FailureGenericTimeout},
+					}},
+				}
+			},
+			wantOutcome:    BlockingInconclusive,
+			wantConfidence: 0,
+		},
+
+		{
+			name: "resets on DoT",
+			evidence: func(t *testing.T) *BlockingEvidence {
+				return &BlockingEvidence{
+					Measurement: newBlockingMeasurement(t, dns.RcodeSuccess, 0, "93.184.216.34"),
+					Endpoint: &EndpointReport{Results: []*EndpointProtocolResult{
+						{Protocol: "udp", Reachable: true},
+						{Protocol: "dot", Failure: FailureConnectionReset},
+					}},
+				}
+			},
+			wantOutcome:    BlockingDoT,
+			wantConfidence: 0.8,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			verdict := DetectBlocking(tc.evidence(t))
+			assert.Equal(t, tc.wantOutcome, verdict.Outcome)
+			assert.Equal(t, tc.wantConfidence, verdict.Confidence)
+			for idx := 1; idx < len(verdict.Findings); idx++ {
+				assert.GreaterOrEqual(t, verdict.Findings[idx-1].Confidence, verdict.Findings[idx].Confidence)
+			}
+		})
+	}
+}